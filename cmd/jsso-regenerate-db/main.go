@@ -47,7 +47,7 @@ func main() {
 	conn.Close(ctx)
 
 	if dbConfig.RunMigrations {
-		db, err := store.Connect(ctx, dbConfig.DatabaseURL)
+		db, err := store.Connect(ctx, dbConfig)
 		if err != nil {
 			zap.L().Fatal("problem connecting to database", zap.String("database_url", dbConfig.DatabaseURL), zap.Error(err))
 		}
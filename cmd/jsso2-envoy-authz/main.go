@@ -18,6 +18,9 @@ func main() {
 	authzCfg := &envoyauthz.Config{}
 	server.AddFlagGroup("Authorization Server", authzCfg)
 	server.Setup()
+	if err := authzCfg.Validate(); err != nil {
+		zap.L().Fatal("invalid configuration", zap.Error(err))
+	}
 
 	unaryInterceptors, streamInterceptors := opc.GRPCInterceptors()
 	opts := []grpc.DialOption{
@@ -26,7 +29,7 @@ func main() {
 	}
 
 	startupCtx, c := context.WithTimeout(context.Background(), 15*time.Second)
-	cli, err := client.Dial(startupCtx, authzCfg.Address, &client.Credentials{}, opts...)
+	cli, err := client.Dial(startupCtx, authzCfg.Address, authzCfg.Credentials(), opts...)
 	if err != nil {
 		c()
 		zap.L().Fatal("problem dialing jsso server", zap.Error(err))
@@ -36,7 +39,13 @@ func main() {
 	svc := &envoyauthz.Service{
 		SessionClient:  cli.SessionClient,
 		UsernameHeader: authzCfg.AddPlaintextUsernameHeader,
+		Policy:         authzCfg.Policy(),
+		Breaker:        authzCfg.Breaker(),
+		Cache:          authzCfg.Cache(),
 	}
+	bgCtx, stopBackground := context.WithCancel(context.Background())
+	server.AddDrainHandler(stopBackground)
+	go svc.Cache.Watch(bgCtx, zap.L().Named("cache"), cli.EventsClient)
 	server.AddService(func(s *grpc.Server) {
 		envoy_auth.RegisterAuthorizationServer(s, svc)
 	})
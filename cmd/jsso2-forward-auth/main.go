@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/jrockway/jsso2/pkg/client"
+	"github.com/jrockway/jsso2/pkg/forwardauth"
+	opc "github.com/jrockway/opinionated-server/client"
+	"github.com/jrockway/opinionated-server/server"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+)
+
+func main() {
+	server.AppName = "jsso2-forward-auth"
+	authCfg := &forwardauth.Config{}
+	server.AddFlagGroup("Forward Auth Server", authCfg)
+	server.Setup()
+
+	unaryInterceptors, streamInterceptors := opc.GRPCInterceptors()
+	opts := []grpc.DialOption{
+		grpc.WithChainUnaryInterceptor(unaryInterceptors...),
+		grpc.WithChainStreamInterceptor(streamInterceptors...),
+	}
+
+	startupCtx, c := context.WithTimeout(context.Background(), 15*time.Second)
+	cli, err := client.Dial(startupCtx, authCfg.Address, &client.Credentials{}, opts...)
+	if err != nil {
+		c()
+		zap.L().Fatal("problem dialing jsso server", zap.Error(err))
+	}
+	c()
+
+	h, err := authCfg.Handler(forwardauth.Client(cli.SessionClient))
+	if err != nil {
+		zap.L().Fatal("problem configuring forward-auth handler", zap.Error(err))
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/", h)
+	server.SetHTTPHandler(mux)
+	server.ListenAndServe()
+}
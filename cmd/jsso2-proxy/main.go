@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/jrockway/jsso2/pkg/authproxy"
+	"github.com/jrockway/jsso2/pkg/client"
+	opc "github.com/jrockway/opinionated-server/client"
+	"github.com/jrockway/opinionated-server/server"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+)
+
+func main() {
+	server.AppName = "jsso2-proxy"
+	proxyCfg := &authproxy.Config{}
+	server.AddFlagGroup("Proxy", proxyCfg)
+	server.Setup()
+
+	unaryInterceptors, streamInterceptors := opc.GRPCInterceptors()
+	opts := []grpc.DialOption{
+		grpc.WithChainUnaryInterceptor(unaryInterceptors...),
+		grpc.WithChainStreamInterceptor(streamInterceptors...),
+	}
+
+	startupCtx, c := context.WithTimeout(context.Background(), 15*time.Second)
+	cli, err := client.Dial(startupCtx, proxyCfg.Address, &client.Credentials{}, opts...)
+	if err != nil {
+		c()
+		zap.L().Fatal("problem dialing jsso server", zap.Error(err))
+	}
+	c()
+
+	proxy, err := proxyCfg.Proxy(cli.SessionClient)
+	if err != nil {
+		zap.L().Fatal("problem configuring proxy", zap.Error(err))
+	}
+	server.SetHTTPHandler(proxy)
+	server.ListenAndServe()
+}
@@ -3,18 +3,26 @@ package main
 import (
 	"context"
 	"net/http"
+	"os"
 
 	"github.com/fullstorydev/grpcui/standalone"
+	"github.com/jrockway/jsso2/pkg/audit"
 	"github.com/jrockway/jsso2/pkg/internalauth"
 	"github.com/jrockway/jsso2/pkg/jsso/cmd"
 	"github.com/jrockway/jsso2/pkg/jssopb"
 	"github.com/jrockway/jsso2/pkg/store"
+	"github.com/jrockway/jsso2/pkg/webhooks"
 	"github.com/jrockway/opinionated-server/server"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
 )
 
 func main() {
+	// "jsso2 migrate" manages the database schema instead of running the server.
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrate(os.Args[2:], os.Stdout, os.Stderr))
+	}
+
 	server.AppName = "jsso2"
 
 	appConfig := &cmd.Config{}
@@ -23,18 +31,54 @@ func main() {
 	server.AddFlagGroup("database", dbConfig)
 	authConfig := &internalauth.Config{}
 	server.AddFlagGroup("authorization", authConfig)
+	reaperConfig := &store.ReaperConfig{}
+	server.AddFlagGroup("session reaper", reaperConfig)
+	checkpointConfig := &audit.CheckpointConfig{}
+	server.AddFlagGroup("audit log checkpoints", checkpointConfig)
+	webhookConfig := &webhooks.Config{}
+	server.AddFlagGroup("webhooks", webhookConfig)
 
 	server.Setup()
 	l := zap.L().Named("startup")
 
-	db, err := cmd.ConnectDB(l, dbConfig)
-	if err != nil {
-		zap.L().Fatal("problem connecting to database", zap.Error(err))
+	bgCtx, stopBackground := context.WithCancel(context.Background())
+	server.AddDrainHandler(stopBackground)
+	var s store.Store
+	switch {
+	case dbConfig.InMemory:
+		l.Warn("using an in-memory store; all data will be lost when the server exits")
+		m := store.NewMemory()
+		m.Retry = dbConfig.RetryConfig
+		s = m
+	case store.IsSQLiteURL(dbConfig.DatabaseURL):
+		db, err := cmd.ConnectSQLite(l, dbConfig)
+		if err != nil {
+			zap.L().Fatal("problem opening database", zap.Error(err))
+		}
+		go db.RunReaper(bgCtx, zap.L().Named("reaper"), reaperConfig)
+		s = db
+	default:
+		db, err := cmd.ConnectDB(l, dbConfig)
+		if err != nil {
+			zap.L().Fatal("problem connecting to database", zap.Error(err))
+		}
+		go db.RunReaper(bgCtx, zap.L().Named("reaper"), reaperConfig)
+		go db.MonitorReplica(bgCtx, zap.L().Named("replica"), dbConfig)
+		go db.ListenForAuditEvents(bgCtx, zap.L().Named("audit_listener"))
+		if dbConfig.SessionCacheSize > 0 {
+			db.EnableSessionCache(dbConfig.SessionCacheSize, dbConfig.SessionCacheTTL)
+			go db.ListenForSessionChanges(bgCtx, zap.L().Named("session_cache"))
+		}
+		s = db
 	}
-	app, err := cmd.Setup(appConfig, authConfig, db)
+	app, err := cmd.Setup(appConfig, authConfig, s)
 	if err != nil {
 		zap.L().Fatal("problem initializing app", zap.Error(err))
 	}
+	app.EventsService.Done = bgCtx.Done()
+	go audit.RunCheckpointer(bgCtx, zap.L().Named("audit_checkpoint"), s, app.AuditSigner, checkpointConfig)
+	go webhooks.Run(bgCtx, zap.L().Named("webhooks"), s, webhookConfig)
+
 	server.AddUnaryInterceptor(app.Permissions.UnaryServerInterceptor())
 	server.AddStreamInterceptor(app.Permissions.StreamServerInterceptor())
 	server.SetHTTPHandler(app.PublicMux)
@@ -43,6 +87,9 @@ func main() {
 		jssopb.RegisterUserService(s, jssopb.NewUserService(app.UserService))
 		jssopb.RegisterLoginService(s, jssopb.NewLoginService(app.LoginService))
 		jssopb.RegisterSessionService(s, jssopb.NewSessionService(app.SessionService))
+		jssopb.RegisterAuditService(s, jssopb.NewAuditService(app.AuditService))
+		jssopb.RegisterEventsService(s, jssopb.NewEventsService(app.EventsService))
+		jssopb.RegisterWebhooksService(s, jssopb.NewWebhooksService(app.WebhooksService))
 	})
 
 	server.SetStartupCallback(func(info server.Info) {
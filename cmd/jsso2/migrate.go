@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/jrockway/jsso2/pkg/store"
+)
+
+const migrateUsage = `[OPTIONS] COMMAND
+
+Commands:
+  status              Show which migrations have been applied.
+  up                  Apply all pending migrations.
+  down-to VERSION     Revert migrations until the schema is at VERSION (0 is an empty database).`
+
+// runMigrate implements "jsso2 migrate ...", returning the process exit code.
+func runMigrate(args []string, stdout, stderr io.Writer) int {
+	dbConfig := &store.Config{}
+	parser := flags.NewParser(nil, flags.HelpFlag|flags.PassDoubleDash)
+	parser.Name = "jsso2 migrate"
+	parser.Usage = migrateUsage
+	if _, err := parser.AddGroup("database", "", dbConfig); err != nil {
+		panic(err)
+	}
+	rest, err := parser.ParseArgs(args)
+	if err != nil {
+		if ferr, ok := err.(*flags.Error); ok && ferr.Type == flags.ErrHelp {
+			fmt.Fprintln(stderr, ferr.Message)
+			return 2
+		}
+		fmt.Fprintf(stderr, "flag parsing: %v\n", err)
+		return 3
+	}
+	if len(rest) == 0 {
+		parser.WriteHelp(stderr)
+		return 2
+	}
+
+	ctx, c := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer c()
+	var db migrator
+	if store.IsSQLiteURL(dbConfig.DatabaseURL) {
+		s, err := store.ConnectSQLite(ctx, dbConfig)
+		if err != nil {
+			fmt.Fprintf(stderr, "open database: %v\n", err)
+			return 1
+		}
+		defer s.Close()
+		db = s
+	} else {
+		c, err := store.Connect(ctx, dbConfig)
+		if err != nil {
+			fmt.Fprintf(stderr, "connect to database: %v\n", err)
+			return 1
+		}
+		db = c
+	}
+
+	if err := migrate(ctx, db, rest, stdout); err != nil {
+		fmt.Fprintf(stderr, "%v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// migrator is implemented by the stores that have a schema to migrate.
+type migrator interface {
+	MigrationStatus(ctx context.Context) (*store.MigrationStatus, error)
+	MigrateDB(ctx context.Context) error
+	MigrateTo(ctx context.Context, version int32) error
+}
+
+func migrate(ctx context.Context, db migrator, args []string, stdout io.Writer) error {
+	switch cmd := args[0]; cmd {
+	case "status":
+		if len(args) != 1 {
+			return errors.New("usage: status")
+		}
+		status, err := db.MigrationStatus(ctx)
+		if err != nil {
+			return err
+		}
+		for _, m := range status.Migrations {
+			applied := "pending"
+			if m.Applied {
+				applied = "applied"
+			}
+			fmt.Fprintf(stdout, "%3d %-8s %s\n", m.Version, applied, m.Name)
+		}
+		fmt.Fprintf(stdout, "current version: %d\nrequired version: %d\n", status.Current, status.Required)
+		return nil
+	case "up":
+		if len(args) != 1 {
+			return errors.New("usage: up")
+		}
+		if err := db.MigrateDB(ctx); err != nil {
+			return err
+		}
+		fmt.Fprintln(stdout, "database is up to date")
+		return nil
+	case "down-to":
+		if len(args) != 2 {
+			return errors.New("usage: down-to VERSION")
+		}
+		v, err := strconv.ParseInt(args[1], 10, 32)
+		if err != nil || v < 0 {
+			return fmt.Errorf("invalid version %q", args[1])
+		}
+		status, err := db.MigrationStatus(ctx)
+		if err != nil {
+			return err
+		}
+		if int32(v) > status.Current {
+			return fmt.Errorf("database is at version %d; down-to %d would migrate up (use \"up\" instead)", status.Current, v)
+		}
+		if err := db.MigrateTo(ctx, int32(v)); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "database is at version %d\n", v)
+		return nil
+	default:
+		return fmt.Errorf("unknown command %q", cmd)
+	}
+}
@@ -0,0 +1,8 @@
+-- Indexes that let the session reaper find garbage without scanning the entire session table.
+create index idx_session_expires_at on session (expires_at);
+create index idx_credential_created_by_session on credential (created_by_session_id);
+
+---- create above / drop below ----
+
+drop index idx_credential_created_by_session;
+drop index idx_session_expires_at;
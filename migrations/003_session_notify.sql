@@ -0,0 +1,32 @@
+-- Notify listeners whenever a session or user changes, so that in-memory session caches on every
+-- replica can drop their copy.  Payloads are "s:<hex session id>" or "u:<user id>".
+create function notify_session_changed() returns trigger as $$
+begin
+    if tg_op = 'DELETE' then
+        perform pg_notify('jsso2_session_changed', 's:' || encode(old.id, 'hex'));
+        return old;
+    end if;
+    perform pg_notify('jsso2_session_changed', 's:' || encode(new.id, 'hex'));
+    return new;
+end;
+$$ language plpgsql;
+
+create trigger trigger_session_changed after insert or update or delete on session
+    for each row execute function notify_session_changed();
+
+create function notify_user_changed() returns trigger as $$
+begin
+    perform pg_notify('jsso2_session_changed', 'u:' || new.id::text);
+    return new;
+end;
+$$ language plpgsql;
+
+create trigger trigger_user_changed after update on "user"
+    for each row execute function notify_user_changed();
+
+---- create above / drop below ----
+
+drop trigger trigger_user_changed on "user";
+drop function notify_user_changed;
+drop trigger trigger_session_changed on session;
+drop function notify_session_changed;
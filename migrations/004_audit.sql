@@ -0,0 +1,38 @@
+-- The audit log.  Users are recorded by ID and by their username at the time of the event, and
+-- neither is a foreign key, since root and anonymous don't exist in the "user" table.  An ID of 0
+-- and an empty username mean that there was no such user.  There is no foreign key to the session
+-- table either, because the reaper eventually deletes sessions.
+create table audit_event (
+    id bigserial primary key not null,
+    created_at timestamp (3) with time zone not null,
+    action text not null check (action != ''),
+    actor_user_id bigint not null,
+    actor_username citext not null,
+    actor_session_id bytea null,
+    target_user_id bigint not null,
+    target_username citext not null,
+    ip_address text not null,
+    user_agent text not null,
+    result text not null check (result in ('success', 'failure')),
+    error text not null,
+    details jsonb not null check (jsonb_typeof(details) = 'object')
+);
+create index idx_audit_event_created_at on audit_event (created_at);
+create index idx_audit_event_actor on audit_event (actor_user_id, id);
+create index idx_audit_event_target on audit_event (target_user_id, id);
+
+-- The audit log is append-only.
+create function prevent_audit_event_change() returns trigger as $$
+begin
+    raise exception 'audit_event is append-only';
+end;
+$$ language plpgsql;
+
+create trigger trigger_audit_event_append_only before update or delete on audit_event
+    for each row execute function prevent_audit_event_change();
+
+---- create above / drop below ----
+
+drop trigger trigger_audit_event_append_only on audit_event;
+drop function prevent_audit_event_change;
+drop table audit_event;
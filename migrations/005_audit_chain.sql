@@ -0,0 +1,36 @@
+-- Chain audit events together by hash, and add signed checkpoints of the chain; see
+-- types.AuditEvent and types.AuditCheckpoint.  Existing events are left without hashes, since the
+-- hashes are computed in Go.  A null prev_hash on an event with a hash marks the start of the chain.
+alter table audit_event add column prev_hash bytea null;
+alter table audit_event add column hash bytea null;
+
+create table audit_checkpoint (
+    id bigserial primary key not null,
+    created_at timestamp (3) with time zone not null,
+    audit_event_id bigint not null,
+    hash bytea not null,
+    signature bytea not null
+);
+
+create or replace function prevent_audit_event_change() returns trigger as $$
+begin
+    raise exception '% is append-only', tg_table_name;
+end;
+$$ language plpgsql;
+
+create trigger trigger_audit_checkpoint_append_only before update or delete on audit_checkpoint
+    for each row execute function prevent_audit_event_change();
+
+---- create above / drop below ----
+
+drop trigger trigger_audit_checkpoint_append_only on audit_checkpoint;
+
+create or replace function prevent_audit_event_change() returns trigger as $$
+begin
+    raise exception 'audit_event is append-only';
+end;
+$$ language plpgsql;
+
+drop table audit_checkpoint;
+alter table audit_event drop column hash;
+alter table audit_event drop column prev_hash;
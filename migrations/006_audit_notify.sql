@@ -0,0 +1,16 @@
+-- Notify listeners whenever an audit event is added, so that event watchers on every replica can
+-- read it.  The payload is the event's ID.
+create function notify_audit_event_added() returns trigger as $$
+begin
+    perform pg_notify('jsso2_audit_event_added', new.id::text);
+    return new;
+end;
+$$ language plpgsql;
+
+create trigger trigger_audit_event_added after insert on audit_event
+    for each row execute function notify_audit_event_added();
+
+---- create above / drop below ----
+
+drop trigger trigger_audit_event_added on audit_event;
+drop function notify_audit_event_added;
@@ -0,0 +1,38 @@
+-- Outbound webhooks; see pkg/webhooks.  Deliveries form a durable queue: the dispatcher follows the
+-- audit log from webhook_cursor and enqueues a pending delivery for each matching webhook, and the
+-- sender retries pending deliveries until they succeed or run out of attempts.
+create table webhook (
+    id bigserial primary key not null,
+    created_at timestamp (3) with time zone not null,
+    url text not null check (url != ''),
+    description text not null,
+    event_types jsonb not null check (jsonb_typeof(event_types) = 'array'),
+    secret bytea not null check (length(secret) >= 32)
+);
+
+create table webhook_delivery (
+    id bigserial primary key not null,
+    webhook_id bigint not null references webhook (id) on delete cascade,
+    audit_event_id bigint not null,
+    event_type text not null,
+    state text not null check (state in ('pending', 'succeeded', 'dead')),
+    created_at timestamp (3) with time zone not null,
+    attempts integer not null default 0,
+    next_attempt_at timestamp (3) with time zone not null,
+    last_attempt_at timestamp (3) with time zone null,
+    last_error text not null default ''
+);
+create index webhook_delivery_due on webhook_delivery (next_attempt_at) where state = 'pending';
+create index webhook_delivery_webhook on webhook_delivery (webhook_id, id);
+
+-- The ID of the last audit event that the dispatcher has considered.  There is at most one row.
+create table webhook_cursor (
+    id boolean primary key not null default true check (id),
+    audit_event_id bigint not null
+);
+
+---- create above / drop below ----
+
+drop table webhook_cursor;
+drop table webhook_delivery;
+drop table webhook;
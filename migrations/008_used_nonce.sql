@@ -0,0 +1,12 @@
+-- Nonces of set-cookie tokens that have been redeemed; see store.RedeemNonce.  A token can only be
+-- used while it's younger than sessions.SetCookieTokenLifetime, so each row is only needed until
+-- expires_at, after which it's deleted by the reaper.
+create table used_nonce (
+    nonce bytea primary key not null check (length(nonce) >= 16),
+    expires_at timestamp (3) with time zone not null
+);
+create index used_nonce_expires_at on used_nonce (expires_at);
+
+---- create above / drop below ----
+
+drop table used_nonce;
@@ -0,0 +1,17 @@
+// Package migrations contains the SQL migrations that set up the jsso2 database schema.
+package migrations
+
+import "embed"
+
+// FS holds the migrations, named like 001_initial.sql, in the format that tern expects.
+//
+//go:embed *.sql
+var FS embed.FS
+
+// SQLiteFS holds the equivalent migrations for SQLite, in the sqlite directory.  They use the same
+// format as the Postgres migrations, but there are no equivalents of 003_session_notify.sql and
+// 006_audit_notify.sql because SQLite has no LISTEN/NOTIFY, so later SQLite migrations are numbered
+// lower than their Postgres counterparts.
+//
+//go:embed sqlite/*.sql
+var SQLiteFS embed.FS
@@ -0,0 +1,43 @@
+-- The SQLite equivalent of ../001_initial.sql.  Timestamps are stored as milliseconds since the
+-- Unix epoch, JSON as text, and usernames are compared case-insensitively with the NOCASE
+-- collation (which, unlike citext, only folds ASCII letters).
+create table "user" (
+    id integer primary key autoincrement not null,
+    username text not null collate nocase
+);
+create unique index idx_unique_user_username on "user" (username);
+
+create table session (
+    id blob primary key not null check (length(id) = 64),
+    user_id integer not null,
+    metadata text not null check (json_valid(metadata) and metadata != 'null'),
+    taints text not null check (json_valid(taints) and taints != 'null'),
+    created_at integer not null,
+    expires_at integer not null,
+    constraint fk_user foreign key (user_id) references "user" (id)
+);
+create index idx_session_user on session (user_id);
+
+create table credential (
+    id integer primary key autoincrement not null,
+    aaguid blob null,
+    credential_id blob not null check (length(credential_id) >= 16),
+    public_key blob not null,
+    user_id integer not null,
+    name text not null,
+    created_at integer not null,
+    deleted_at integer null,
+    created_by_session_id blob not null,
+    sign_count integer not null,
+    constraint fk_user foreign key (user_id) references "user" (id),
+    constraint fk_session foreign key (created_by_session_id) references session (id)
+);
+create unique index idx_unique_active_credential on credential (credential_id, user_id, deleted_at);
+create index idx_credential_user on credential (user_id);
+create index idx_credential_user_active on credential (user_id) where deleted_at is null;
+
+---- create above / drop below ----
+
+drop table credential;
+drop table session;
+drop table "user";
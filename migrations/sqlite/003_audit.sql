@@ -0,0 +1,36 @@
+-- The SQLite equivalent of ../004_audit.sql.
+create table audit_event (
+    id integer primary key autoincrement not null,
+    created_at integer not null,
+    action text not null check (action != ''),
+    actor_user_id integer not null,
+    actor_username text not null collate nocase,
+    actor_session_id blob null,
+    target_user_id integer not null,
+    target_username text not null collate nocase,
+    ip_address text not null,
+    user_agent text not null,
+    result text not null check (result in ('success', 'failure')),
+    error text not null,
+    details text not null check (json_valid(details) and json_type(details) = 'object')
+);
+create index idx_audit_event_created_at on audit_event (created_at);
+create index idx_audit_event_actor on audit_event (actor_user_id, id);
+create index idx_audit_event_target on audit_event (target_user_id, id);
+
+-- The audit log is append-only.
+create trigger trigger_audit_event_no_update before update on audit_event
+begin
+    select raise(abort, 'audit_event is append-only');
+end;
+
+create trigger trigger_audit_event_no_delete before delete on audit_event
+begin
+    select raise(abort, 'audit_event is append-only');
+end;
+
+---- create above / drop below ----
+
+drop trigger trigger_audit_event_no_delete;
+drop trigger trigger_audit_event_no_update;
+drop table audit_event;
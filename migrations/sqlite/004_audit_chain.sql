@@ -0,0 +1,29 @@
+-- The SQLite equivalent of ../005_audit_chain.sql.
+alter table audit_event add column prev_hash blob null;
+alter table audit_event add column hash blob null;
+
+create table audit_checkpoint (
+    id integer primary key autoincrement not null,
+    created_at integer not null,
+    audit_event_id integer not null,
+    hash blob not null,
+    signature blob not null
+);
+
+create trigger trigger_audit_checkpoint_no_update before update on audit_checkpoint
+begin
+    select raise(abort, 'audit_checkpoint is append-only');
+end;
+
+create trigger trigger_audit_checkpoint_no_delete before delete on audit_checkpoint
+begin
+    select raise(abort, 'audit_checkpoint is append-only');
+end;
+
+---- create above / drop below ----
+
+drop trigger trigger_audit_checkpoint_no_delete;
+drop trigger trigger_audit_checkpoint_no_update;
+drop table audit_checkpoint;
+alter table audit_event drop column hash;
+alter table audit_event drop column prev_hash;
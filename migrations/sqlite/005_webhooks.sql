@@ -0,0 +1,35 @@
+-- The SQLite equivalent of ../007_webhooks.sql.
+create table webhook (
+    id integer primary key autoincrement not null,
+    created_at integer not null,
+    url text not null check (url != ''),
+    description text not null,
+    event_types text not null check (json_type(event_types) = 'array'),
+    secret blob not null check (length(secret) >= 32)
+);
+
+create table webhook_delivery (
+    id integer primary key autoincrement not null,
+    webhook_id integer not null references webhook (id) on delete cascade,
+    audit_event_id integer not null,
+    event_type text not null,
+    state text not null check (state in ('pending', 'succeeded', 'dead')),
+    created_at integer not null,
+    attempts integer not null default 0,
+    next_attempt_at integer not null,
+    last_attempt_at integer null,
+    last_error text not null default ''
+);
+create index webhook_delivery_due on webhook_delivery (next_attempt_at) where state = 'pending';
+create index webhook_delivery_webhook on webhook_delivery (webhook_id, id);
+
+create table webhook_cursor (
+    id boolean primary key not null default true check (id),
+    audit_event_id integer not null
+);
+
+---- create above / drop below ----
+
+drop table webhook_cursor;
+drop table webhook_delivery;
+drop table webhook;
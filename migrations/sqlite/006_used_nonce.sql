@@ -0,0 +1,10 @@
+-- The SQLite equivalent of ../008_used_nonce.sql.
+create table used_nonce (
+    nonce blob primary key not null check (length(nonce) >= 16),
+    expires_at integer not null
+);
+create index used_nonce_expires_at on used_nonce (expires_at);
+
+---- create above / drop below ----
+
+drop table used_nonce;
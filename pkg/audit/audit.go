@@ -0,0 +1,104 @@
+// Package audit builds the events that are recorded in the audit log.
+package audit
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/jrockway/jsso2/pkg/sessions"
+	"github.com/jrockway/jsso2/pkg/types"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Actions that are recorded in the audit log.
+const (
+	ActionUserEdit               = "user.edit"
+	ActionGenerateEnrollmentLink = "user.generate_enrollment_link"
+	ActionEnroll                 = "enrollment.finish"
+	ActionLogin                  = "login.finish"
+	ActionLoginNewIP             = "login.new_ip"
+	ActionSignCountDecreased     = "credential.sign_count_decreased"
+	ActionLogout                 = "session.logout"
+	ActionRevokeSession          = "session.revoke"
+)
+
+// EventType returns the type of event that an audit event represents, or TYPE_UNKNOWN if it isn't
+// one that's sent to event watchers.
+func EventType(e *types.AuditEvent) types.Event_Type {
+	success := e.GetResult() == types.AuditEvent_SUCCESS
+	switch e.GetAction() {
+	case ActionLogin:
+		if success {
+			return types.Event_LOGIN
+		}
+		return types.Event_LOGIN_FAILED
+	case ActionLoginNewIP:
+		return types.Event_LOGIN_FROM_NEW_IP
+	case ActionLogout:
+		return types.Event_LOGOUT
+	case ActionRevokeSession:
+		return types.Event_SESSION_REVOKED
+	case ActionEnroll:
+		if success {
+			return types.Event_CREDENTIAL_ADDED
+		}
+	case ActionUserEdit:
+		if success {
+			return types.Event_USER_CHANGED
+		}
+	}
+	return types.Event_TYPE_UNKNOWN
+}
+
+// New returns a successful event for an action performed on target by the session in ctx, on behalf
+// of the client that sent the incoming gRPC request.
+func New(ctx context.Context, action string, target *types.User) *types.AuditEvent {
+	session, _ := sessions.FromContext(ctx)
+	e := newEvent(action, session, target)
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		// Like session metadata, this assumes that Envoy sets x-forwarded-for.
+		if ip := md.Get("x-forwarded-for"); len(ip) == 1 {
+			e.IpAddress = ip[0]
+		}
+		if ua := md.Get("user-agent"); len(ua) == 1 {
+			e.UserAgent = ua[0]
+		}
+	}
+	return e
+}
+
+// FromRequest is like New, but for actions performed with the provided session during an HTTP
+// request.
+func FromRequest(req *http.Request, session *types.Session, action string, target *types.User) *types.AuditEvent {
+	e := newEvent(action, session, target)
+	e.IpAddress = req.Header.Get("x-forwarded-for")
+	e.UserAgent = req.Header.Get("user-agent")
+	return e
+}
+
+func newEvent(action string, session *types.Session, target *types.User) *types.AuditEvent {
+	e := &types.AuditEvent{
+		CreatedAt: timestamppb.Now(),
+		Action:    action,
+		Result:    types.AuditEvent_SUCCESS,
+	}
+	if u := session.GetUser(); u != nil {
+		e.Actor = &types.User{Id: u.GetId(), Username: u.GetUsername()}
+	}
+	// Root and anonymous sessions all have the same all-zeroes ID, which doesn't identify anything.
+	if id := session.GetId(); !sessions.IsZero(id) {
+		e.ActorSessionId = id
+	}
+	if target != nil {
+		e.Target = &types.User{Id: target.GetId(), Username: target.GetUsername()}
+	}
+	return e
+}
+
+// Fail marks the event as a failed attempt at the action, because of err.
+func Fail(e *types.AuditEvent, err error) *types.AuditEvent {
+	e.Result = types.AuditEvent_FAILURE
+	e.Error = err.Error()
+	return e
+}
@@ -0,0 +1,87 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jrockway/jsso2/pkg/sessions"
+	"github.com/jrockway/jsso2/pkg/types"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/testing/protocmp"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestNew(t *testing.T) {
+	id := make([]byte, 64)
+	id[0] = 1
+	user := &types.User{Id: 42, Username: "test"}
+	session := &types.Session{Id: id, User: user, Taints: []string{sessions.TaintStartLogin}}
+	target := &types.User{Id: 43, Username: "target", CreatedAt: timestamppb.Now()}
+
+	ctx := sessions.NewContext(context.Background(), session)
+	ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("x-forwarded-for", "192.0.2.1", "user-agent", "test/1.0"))
+	req := httptest.NewRequest("GET", "/logout", nil)
+	req.Header.Set("x-forwarded-for", "192.0.2.1")
+	req.Header.Set("user-agent", "test/1.0")
+
+	want := &types.AuditEvent{
+		Action:         ActionLogin,
+		Actor:          &types.User{Id: 42, Username: "test"},
+		ActorSessionId: id,
+		Target:         &types.User{Id: 43, Username: "target"},
+		IpAddress:      "192.0.2.1",
+		UserAgent:      "test/1.0",
+		Result:         types.AuditEvent_SUCCESS,
+	}
+	for name, got := range map[string]*types.AuditEvent{
+		"grpc": New(ctx, ActionLogin, target),
+		"http": FromRequest(req, session, ActionLogin, target),
+	} {
+		if got.GetCreatedAt() == nil {
+			t.Errorf("%s: created_at not set", name)
+		}
+		got.CreatedAt = nil
+		if diff := cmp.Diff(got, want, protocmp.Transform()); diff != "" {
+			t.Errorf("%s: event (-got +want):\n%s", name, diff)
+		}
+	}
+
+	got := Fail(New(sessions.NewContext(context.Background(), sessions.Root()), ActionUserEdit, nil), errors.New("oops"))
+	got.CreatedAt = nil
+	want = &types.AuditEvent{
+		Action: ActionUserEdit,
+		Actor:  &types.User{Id: sessions.RootUser, Username: sessions.RootUsername},
+		Result: types.AuditEvent_FAILURE,
+		Error:  "oops",
+	}
+	if diff := cmp.Diff(got, want, protocmp.Transform()); diff != "" {
+		t.Errorf("failed root event (-got +want):\n%s", diff)
+	}
+}
+
+func TestEventType(t *testing.T) {
+	testData := []struct {
+		action string
+		result types.AuditEvent_Result
+		want   types.Event_Type
+	}{
+		{ActionLogin, types.AuditEvent_SUCCESS, types.Event_LOGIN},
+		{ActionLogin, types.AuditEvent_FAILURE, types.Event_LOGIN_FAILED},
+		{ActionLoginNewIP, types.AuditEvent_SUCCESS, types.Event_LOGIN_FROM_NEW_IP},
+		{ActionLogout, types.AuditEvent_SUCCESS, types.Event_LOGOUT},
+		{ActionRevokeSession, types.AuditEvent_SUCCESS, types.Event_SESSION_REVOKED},
+		{ActionEnroll, types.AuditEvent_SUCCESS, types.Event_CREDENTIAL_ADDED},
+		{ActionEnroll, types.AuditEvent_FAILURE, types.Event_TYPE_UNKNOWN},
+		{ActionUserEdit, types.AuditEvent_SUCCESS, types.Event_USER_CHANGED},
+		{ActionGenerateEnrollmentLink, types.AuditEvent_SUCCESS, types.Event_TYPE_UNKNOWN},
+	}
+	for _, test := range testData {
+		e := &types.AuditEvent{Action: test.action, Result: test.result}
+		if got, want := EventType(e), test.want; got != want {
+			t.Errorf("%s (%v):\n  got: %v\n want: %v", test.action, test.result, got, want)
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jrockway/jsso2/pkg/store"
+	"github.com/jrockway/jsso2/pkg/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+var (
+	checkpointRuns = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "jsso2_audit_checkpoint_runs",
+		Help: "Number of times the audit log checkpointer ran, by outcome.",
+	}, []string{"status"})
+	checkpointLastSuccess = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "jsso2_audit_checkpoint_last_success_timestamp_seconds",
+		Help: "Unix time at which the audit log checkpointer last finished successfully.",
+	})
+)
+
+// verifyBatchSize is the number of events that Verify reads in each transaction.
+const verifyBatchSize = 1000
+
+// CheckpointConfig configures the background signing of audit log checkpoints.
+type CheckpointConfig struct {
+	Interval time.Duration `long:"audit_checkpoint_interval" env:"AUDIT_CHECKPOINT_INTERVAL" default:"1h" description:"How often to sign a checkpoint of the audit log.  0 disables checkpoints."`
+}
+
+// Signer signs and verifies audit log checkpoints.
+type Signer struct {
+	key []byte
+}
+
+// NewSigner returns a Signer that uses the provided key, which must be at least 32 bytes.
+func NewSigner(key []byte) (*Signer, error) {
+	if len(key) < 32 {
+		return nil, fmt.Errorf("checkpoint key must be at least 32 bytes; got %d", len(key))
+	}
+	return &Signer{key: key}, nil
+}
+
+// DeriveCheckpointKey derives a checkpoint signing key from the token key, for installations that
+// don't configure a dedicated one.
+func DeriveCheckpointKey(tokenKey []byte) []byte {
+	mac := hmac.New(sha256.New, tokenKey)
+	mac.Write([]byte("jsso2 audit checkpoint"))
+	return mac.Sum(nil)
+}
+
+func (s *Signer) sign(c *types.AuditCheckpoint) []byte {
+	mac := hmac.New(sha256.New, s.key)
+	var buf [16]byte
+	binary.BigEndian.PutUint64(buf[0:8], uint64(c.GetCreatedAt().AsTime().UnixNano()/int64(time.Millisecond)))
+	binary.BigEndian.PutUint64(buf[8:16], uint64(c.GetAuditEventId()))
+	mac.Write(buf[:])
+	mac.Write(c.GetHash())
+	return mac.Sum(nil)
+}
+
+// Sign fills in the checkpoint's signature.
+func (s *Signer) Sign(c *types.AuditCheckpoint) {
+	c.Signature = s.sign(c)
+}
+
+// Verify returns true if the checkpoint was signed with this Signer's key.
+func (s *Signer) Verify(c *types.AuditCheckpoint) bool {
+	return hmac.Equal(s.sign(c), c.GetSignature())
+}
+
+// Checkpoint signs the hash of the newest event in the audit log, unless it has already been
+// signed.  It returns the new checkpoint, or nil if there was nothing to do.
+func Checkpoint(ctx context.Context, l *zap.Logger, db store.Store, s *Signer) (*types.AuditCheckpoint, error) {
+	var result *types.AuditCheckpoint
+	if err := db.DoTx(ctx, l, false, func(tx store.Tx) error {
+		result = nil
+		events, err := tx.QueryAuditEvents(ctx, &store.AuditFilter{Limit: 1})
+		if err != nil {
+			return fmt.Errorf("read newest event: %w", err)
+		}
+		if len(events) == 0 || len(events[0].GetHash()) == 0 {
+			return nil
+		}
+		newest := events[0]
+		cs, err := tx.GetAuditCheckpoints(ctx)
+		if err != nil {
+			return fmt.Errorf("read checkpoints: %w", err)
+		}
+		if n := len(cs); n > 0 && cs[n-1].GetAuditEventId() >= newest.GetId() {
+			return nil
+		}
+		c := &types.AuditCheckpoint{
+			// Truncated so that the database doesn't round it to a value that isn't signed.
+			CreatedAt:    timestamppb.New(time.Now().Truncate(time.Millisecond)),
+			AuditEventId: newest.GetId(),
+			Hash:         newest.GetHash(),
+		}
+		s.Sign(c)
+		if err := tx.AddAuditCheckpoint(ctx, c); err != nil {
+			return fmt.Errorf("add checkpoint: %w", err)
+		}
+		result = c
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("checkpoint audit log: %w", err)
+	}
+	return result, nil
+}
+
+// RunCheckpointer runs Checkpoint every cfg.Interval until the context is cancelled.
+func RunCheckpointer(ctx context.Context, l *zap.Logger, db store.Store, s *Signer, cfg *CheckpointConfig) {
+	if cfg.Interval <= 0 {
+		l.Info("audit log checkpoints disabled")
+		return
+	}
+	t := time.NewTicker(cfg.Interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		c, err := Checkpoint(ctx, l, db, s)
+		switch {
+		case errors.Is(err, context.Canceled):
+			return
+		case err != nil:
+			checkpointRuns.WithLabelValues("error").Inc()
+			l.Warn("problem checkpointing audit log", zap.Error(err))
+		default:
+			checkpointRuns.WithLabelValues("ok").Inc()
+			checkpointLastSuccess.SetToCurrentTime()
+			if c != nil {
+				l.Debug("checkpointed audit log", zap.Int64("audit_event_id", c.GetAuditEventId()))
+			}
+		}
+	}
+}
+
+// Report is the result of verifying the audit log.
+type Report struct {
+	// Events is the number of events that were checked.
+	Events int64
+	// Unchained is the number of events written before hash chaining was introduced, which
+	// can't be verified.
+	Unchained int64
+	// Checkpoints is the number of checkpoints that were checked.
+	Checkpoints int64
+	// AfterLastCheckpoint is the number of chained events newer than the last checkpoint.
+	// Deleting these events from the end of the log can't be detected.
+	AfterLastCheckpoint int64
+	// Problems describes every inconsistency found.  The log is intact if it's empty.
+	Problems []string
+}
+
+func (r *Report) problemf(format string, args ...interface{}) {
+	r.Problems = append(r.Problems, fmt.Sprintf(format, args...))
+}
+
+// Verify walks the entire audit log, checking that every event's hash matches its contents and
+// the previous event, and that every checkpoint is correctly signed and refers to an event with the
+// checkpointed hash.
+func Verify(ctx context.Context, l *zap.Logger, db store.Store, s *Signer) (*Report, error) {
+	r := new(Report)
+	var cs []*types.AuditCheckpoint
+	if err := db.DoTx(ctx, l, true, func(tx store.Tx) (err error) {
+		cs, err = tx.GetAuditCheckpoints(ctx)
+		return
+	}); err != nil {
+		return nil, fmt.Errorf("read checkpoints: %w", err)
+	}
+	checkpoints := make(map[int64][]*types.AuditCheckpoint)
+	var lastCheckpoint int64
+	for _, c := range cs {
+		r.Checkpoints++
+		if !s.Verify(c) {
+			r.problemf("checkpoint %d has an invalid signature", c.GetId())
+			continue
+		}
+		checkpoints[c.GetAuditEventId()] = append(checkpoints[c.GetAuditEventId()], c)
+		if id := c.GetAuditEventId(); id > lastCheckpoint {
+			lastCheckpoint = id
+		}
+	}
+
+	var prev []byte
+	var afterID int64
+	for {
+		var events []*types.AuditEvent
+		if err := db.DoTx(ctx, l, true, func(tx store.Tx) (err error) {
+			events, err = tx.QueryAuditEvents(ctx, &store.AuditFilter{AfterID: afterID, OldestFirst: true, Limit: verifyBatchSize})
+			return
+		}); err != nil {
+			return r, fmt.Errorf("read events after %d: %w", afterID, err)
+		}
+		for _, e := range events {
+			r.Events++
+			afterID = e.GetId()
+			if len(e.GetHash()) == 0 {
+				if prev != nil {
+					r.problemf("event %d is missing its hash", e.GetId())
+				} else {
+					r.Unchained++
+				}
+				continue
+			}
+			if !bytes.Equal(e.GetPrevHash(), prev) {
+				r.problemf("event %d does not follow the previous event; events may have been deleted", e.GetId())
+			}
+			if want := store.AuditEventHash(e.GetPrevHash(), e); !bytes.Equal(e.GetHash(), want) {
+				r.problemf("event %d does not match its hash; it may have been modified", e.GetId())
+			}
+			prev = e.GetHash()
+			if e.GetId() > lastCheckpoint {
+				r.AfterLastCheckpoint++
+			}
+			for _, c := range checkpoints[e.GetId()] {
+				if !bytes.Equal(c.GetHash(), e.GetHash()) {
+					r.problemf("checkpoint %d does not match event %d", c.GetId(), e.GetId())
+				}
+			}
+			delete(checkpoints, e.GetId())
+		}
+		if len(events) < verifyBatchSize {
+			break
+		}
+	}
+	var missing []*types.AuditCheckpoint
+	for _, cs := range checkpoints {
+		missing = append(missing, cs...)
+	}
+	sort.Slice(missing, func(i, j int) bool { return missing[i].GetId() < missing[j].GetId() })
+	for _, c := range missing {
+		r.problemf("checkpoint %d refers to missing event %d", c.GetId(), c.GetAuditEventId())
+	}
+	return r, nil
+}
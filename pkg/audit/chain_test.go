@@ -0,0 +1,188 @@
+package audit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jrockway/jsso2/pkg/store"
+	"github.com/jrockway/jsso2/pkg/types"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// tamperedStore is a store whose audit events are edited by tamper as they're read.
+type tamperedStore struct {
+	store.Store
+	tamper func([]*types.AuditEvent) []*types.AuditEvent
+}
+
+type tamperedTx struct {
+	store.Tx
+	tamper func([]*types.AuditEvent) []*types.AuditEvent
+}
+
+func (s *tamperedStore) DoTx(ctx context.Context, l *zap.Logger, readOnly bool, f func(tx store.Tx) error) error {
+	return s.Store.DoTx(ctx, l, readOnly, func(tx store.Tx) error {
+		return f(&tamperedTx{Tx: tx, tamper: s.tamper})
+	})
+}
+
+func (tx *tamperedTx) QueryAuditEvents(ctx context.Context, f *store.AuditFilter) ([]*types.AuditEvent, error) {
+	events, err := tx.Tx.QueryAuditEvents(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	return tx.tamper(events), nil
+}
+
+func TestSigner(t *testing.T) {
+	if _, err := NewSigner([]byte("short")); err == nil {
+		t.Error("new signer with short key: expected error")
+	}
+	s, err := NewSigner(DeriveCheckpointKey([]byte("XXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXX")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewSigner([]byte("YYYYYYYYYYYYYYYYYYYYYYYYYYYYYYYY"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &types.AuditCheckpoint{CreatedAt: timestamppb.Now(), AuditEventId: 1, Hash: []byte("hash")}
+	s.Sign(c)
+	if !s.Verify(c) {
+		t.Error("signed checkpoint does not verify")
+	}
+	if other.Verify(c) {
+		t.Error("checkpoint verifies with the wrong key")
+	}
+	c.AuditEventId = 2
+	if s.Verify(c) {
+		t.Error("modified checkpoint verifies")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	ctx, c := context.WithTimeout(context.Background(), 10*time.Second)
+	defer c()
+	l := zaptest.NewLogger(t)
+	s, err := NewSigner([]byte("XXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXX"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := store.NewMemory()
+	add := func(t *testing.T, action string) {
+		t.Helper()
+		if err := db.DoTx(ctx, l, false, func(tx store.Tx) error {
+			return tx.AddAuditEvent(ctx, newEvent(action, nil, &types.User{Id: 1, Username: "test"}))
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkpoint := func(t *testing.T) *types.AuditCheckpoint {
+		t.Helper()
+		c, err := Checkpoint(ctx, l, db, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	if c := checkpoint(t); c != nil {
+		t.Errorf("checkpoint of empty log: expected nil, got %v", c)
+	}
+	for i := 0; i < 3; i++ {
+		add(t, ActionUserEdit)
+	}
+	if c := checkpoint(t); c.GetAuditEventId() != 3 {
+		t.Errorf("checkpoint: expected event 3, got %v", c)
+	}
+	if c := checkpoint(t); c != nil {
+		t.Errorf("checkpoint of unchanged log: expected nil, got %v", c)
+	}
+	add(t, ActionLogout)
+
+	testData := []struct {
+		name   string
+		tamper func([]*types.AuditEvent) []*types.AuditEvent
+		want   *Report
+	}{
+		{
+			name:   "intact",
+			tamper: func(es []*types.AuditEvent) []*types.AuditEvent { return es },
+			want:   &Report{Events: 4, Checkpoints: 1, AfterLastCheckpoint: 1},
+		},
+		{
+			name: "modified",
+			tamper: func(es []*types.AuditEvent) []*types.AuditEvent {
+				es[1].Action = ActionLogin
+				return es
+			},
+			want: &Report{Events: 4, Checkpoints: 1, AfterLastCheckpoint: 1, Problems: []string{
+				"event 2 does not match its hash; it may have been modified",
+			}},
+		},
+		{
+			name: "deleted",
+			tamper: func(es []*types.AuditEvent) []*types.AuditEvent {
+				return append(es[:1], es[2:]...)
+			},
+			want: &Report{Events: 3, Checkpoints: 1, AfterLastCheckpoint: 1, Problems: []string{
+				"event 3 does not follow the previous event; events may have been deleted",
+			}},
+		},
+		{
+			name: "checkpointed event deleted",
+			tamper: func(es []*types.AuditEvent) []*types.AuditEvent {
+				return es[:2]
+			},
+			want: &Report{Events: 2, Checkpoints: 1, Problems: []string{
+				"checkpoint 1 refers to missing event 3",
+			}},
+		},
+		{
+			name: "rehashed",
+			tamper: func(es []*types.AuditEvent) []*types.AuditEvent {
+				// Rewriting the chain after an event is modified is detected by the checkpoint.
+				var prev []byte
+				for _, e := range es {
+					if e.GetId() == 2 {
+						e.Action = ActionLogin
+					}
+					e.PrevHash = prev
+					e.Hash = store.AuditEventHash(prev, e)
+					prev = e.Hash
+				}
+				return es
+			},
+			want: &Report{Events: 4, Checkpoints: 1, AfterLastCheckpoint: 1, Problems: []string{
+				"checkpoint 1 does not match event 3",
+			}},
+		},
+	}
+	for _, test := range testData {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := Verify(ctx, l, &tamperedStore{Store: db, tamper: test.tamper}, s)
+			if err != nil {
+				t.Fatalf("verify: %v", err)
+			}
+			if diff := cmp.Diff(got, test.want); diff != "" {
+				t.Errorf("report (-got +want):\n%s", diff)
+			}
+		})
+	}
+
+	other, err := NewSigner([]byte("YYYYYYYYYYYYYYYYYYYYYYYYYYYYYYYY"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Verify(ctx, l, db, other)
+	if err != nil {
+		t.Fatalf("verify with the wrong key: %v", err)
+	}
+	if want := []string{"checkpoint 1 has an invalid signature"}; !cmp.Equal(got.Problems, want) {
+		t.Errorf("verify with the wrong key: problems:\n  got: %v\n want: %v", got.Problems, want)
+	}
+}
@@ -0,0 +1,198 @@
+// Package authproxy is a reverse proxy that asks jsso2 to authorize each request before passing it
+// to an upstream application.  It does the job of Envoy and the envoyauthz adapter for small
+// deployments that don't want to run Envoy.
+package authproxy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"github.com/jrockway/jsso2/pkg/forwardauth"
+	"github.com/jrockway/jsso2/pkg/jssopb"
+	"go.uber.org/zap"
+)
+
+// assertionHeader is session.AssertionHeader; it's always removed from incoming requests, so that
+// only an assertion issued by jsso2 reaches the upstream.
+const assertionHeader = "X-Jsso2-Assertion"
+
+// AnyHost is the host of the upstream that serves requests for hosts without an upstream of their
+// own.
+const AnyHost = "*"
+
+type Config struct {
+	Address                    string        `long:"jsso_server_address" env:"JSSO_SERVER_ADDRESS" description:"The URL of JSSO's gRPC server."`
+	Upstreams                  string        `long:"upstreams" env:"UPSTREAMS" description:"Where to send authorized requests, as comma-separated host=url pairs, like 'grafana.example.com=http://grafana:3000'.  A host of * matches any host."`
+	AddPlaintextUsernameHeader string        `long:"plaintext_username_header" env:"PLAINTEXT_USERNAME_HEADER" description:"If set, send the authenticated user's username upstream in a header with this name."`
+	Timeout                    time.Duration `long:"check_timeout" env:"CHECK_TIMEOUT" default:"5s" description:"How long to wait for JSSO to authorize a request."`
+	TrustedProxies             string        `long:"trusted_proxies" env:"TRUSTED_PROXIES" description:"Comma-separated IP addresses or CIDR blocks of load balancers in front of the proxy, whose X-Forwarded-Proto header is believed.  Without this, the scheme of a request is http unless the proxy itself serves it over TLS."`
+}
+
+// ParseUpstreams parses a list of comma-separated host=url pairs.
+func ParseUpstreams(s string) (map[string]*url.URL, error) {
+	result := make(map[string]*url.URL)
+	for i, part := range strings.Split(strings.TrimSpace(s), ",") {
+		part = strings.TrimSpace(part)
+		eq := strings.IndexByte(part, '=')
+		if eq < 1 {
+			return nil, fmt.Errorf("upstream %d: expected host=url", i)
+		}
+		host := strings.ToLower(part[:eq])
+		if _, ok := result[host]; ok {
+			return nil, fmt.Errorf("upstream %d: duplicate host %q", i, host)
+		}
+		u, err := url.Parse(part[eq+1:])
+		if err != nil {
+			return nil, fmt.Errorf("upstream %d (%q): parse url: %w", i, host, err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+			return nil, fmt.Errorf("upstream %d (%q): url %q must be an absolute http or https url", i, host, u.String())
+		}
+		result[host] = u
+	}
+	return result, nil
+}
+
+// Proxy returns the proxy described by the config.
+func (c *Config) Proxy(client jssopb.SessionClient) (*Proxy, error) {
+	upstreams, err := ParseUpstreams(c.Upstreams)
+	if err != nil {
+		return nil, fmt.Errorf("parse upstreams: %w", err)
+	}
+	p := &Proxy{
+		SessionClient:  client,
+		Upstreams:      make(map[string]http.Handler),
+		UsernameHeader: c.AddPlaintextUsernameHeader,
+		Timeout:        c.Timeout,
+	}
+	if c.TrustedProxies != "" {
+		p.TrustedProxies, err = forwardauth.ParseTrustedProxies(c.TrustedProxies)
+		if err != nil {
+			return nil, fmt.Errorf("parse trusted proxies: %w", err)
+		}
+	}
+	for host, u := range upstreams {
+		p.Upstreams[host] = httputil.NewSingleHostReverseProxy(u)
+	}
+	return p, nil
+}
+
+// Proxy is an http.Handler that authorizes requests with jsso2, and sends those that are allowed to
+// the upstream for their host.
+//
+// Allowed requests are changed the same way that envoyauthz has Envoy change them: the Cookie and
+// Authorization headers are replaced with the ones that jsso2 returns, which removes the jsso2
+// session cookie and credentials, and any identity assertion is added.  Denied requests are
+// answered with the redirect or error that jsso2 returns.
+type Proxy struct {
+	SessionClient  jssopb.SessionClient
+	Upstreams      map[string]http.Handler // By lowercase host without a port, or AnyHost.
+	UsernameHeader string                  // If set, send the username upstream in this header.
+	Timeout        time.Duration           // If non-zero, how long to wait for AuthorizeHTTP.
+	TrustedProxies []*net.IPNet            // Peers whose X-Forwarded-Proto is believed; nobody if empty.
+}
+
+// upstream returns the upstream for the request's host.
+func (p *Proxy) upstream(req *http.Request) (http.Handler, bool) {
+	host := req.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if u, ok := p.Upstreams[strings.ToLower(host)]; ok {
+		return u, true
+	}
+	u, ok := p.Upstreams[AnyHost]
+	return u, ok
+}
+
+// RequestURL returns the URL that the client requested.  The path and query are exactly what the
+// client sent.  The scheme comes from the X-Forwarded-Proto header if trustForwardedProto is true,
+// and from whether or not the request arrived over TLS otherwise.
+func RequestURL(req *http.Request, trustForwardedProto bool) *url.URL {
+	u := &url.URL{
+		Scheme:     "http",
+		Host:       req.Host,
+		Path:       req.URL.Path,
+		RawPath:    req.URL.RawPath,
+		RawQuery:   req.URL.RawQuery,
+		ForceQuery: req.URL.ForceQuery,
+	}
+	if req.TLS != nil {
+		u.Scheme = "https"
+	}
+	if proto := req.Header.Get("X-Forwarded-Proto"); trustForwardedProto && (proto == "http" || proto == "https") {
+		u.Scheme = proto
+	}
+	return u
+}
+
+// authorizeRequest builds the AuthorizeHTTPRequest for a request.  Clients can set
+// X-Forwarded-Proto to anything, so it's only used if the request came from a trusted proxy.
+func (p *Proxy) authorizeRequest(req *http.Request) *jssopb.AuthorizeHTTPRequest {
+	ip := req.RemoteAddr
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+	u := RequestURL(req, forwardauth.FromTrustedProxy(req, p.TrustedProxies))
+	return forwardauth.NewAuthorizeHTTPRequest(req, req.Method, u, ip)
+}
+
+// applyAllow changes the headers of an allowed request as the Allow decision says.
+func (p *Proxy) applyAllow(h http.Header, allow *jssopb.Allow) {
+	h.Del("Cookie")
+	h.Del("Authorization")
+	h.Del(assertionHeader)
+	for k, v := range forwardauth.JoinHeaders(allow.GetAddHeaders()) {
+		h.Set(k, v)
+	}
+	if p.UsernameHeader != "" {
+		h.Set(p.UsernameHeader, allow.GetUsername())
+	}
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	l := ctxzap.Extract(ctx)
+
+	upstream, ok := p.upstream(req)
+	if !ok {
+		http.Error(w, fmt.Sprintf("No upstream for host %q.", req.Host), http.StatusNotFound)
+		return
+	}
+	// Nothing from the client may pass for the username header, even if the request is denied
+	// and never reaches the upstream.
+	if p.UsernameHeader != "" {
+		req.Header.Del(p.UsernameHeader)
+	}
+
+	authCtx := ctx
+	if p.Timeout > 0 {
+		var cancel context.CancelFunc
+		authCtx, cancel = context.WithTimeout(ctx, p.Timeout)
+		defer cancel()
+	}
+	reply, err := p.SessionClient.AuthorizeHTTP(authCtx, p.authorizeRequest(req))
+	if err != nil {
+		l.Warn("authorization check failed", zap.Error(err))
+		forwardauth.WriteAuthorizeError(w, err)
+		return
+	}
+
+	switch decision := reply.GetDecision().(type) {
+	case *jssopb.AuthorizeHTTPReply_Allow:
+		p.applyAllow(req.Header, decision.Allow)
+		upstream.ServeHTTP(w, req)
+	case *jssopb.AuthorizeHTTPReply_Deny:
+		forwardauth.WriteDeny(w, decision.Deny, http.StatusTemporaryRedirect)
+	default:
+		l.Error("authorization check returned no decision", zap.Any("reply", reply))
+		http.Error(w, "Authorization check returned no decision.", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,333 @@
+package authproxy
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jrockway/jsso2/pkg/jssopb"
+	"github.com/jrockway/jsso2/pkg/types"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeSessionClient records the request it's called with and returns reply and err.
+type fakeSessionClient struct {
+	jssopb.SessionClient
+	req   *jssopb.AuthorizeHTTPRequest
+	reply *jssopb.AuthorizeHTTPReply
+	err   error
+}
+
+func (c *fakeSessionClient) AuthorizeHTTP(ctx context.Context, req *jssopb.AuthorizeHTTPRequest, opts ...grpc.CallOption) (*jssopb.AuthorizeHTTPReply, error) {
+	c.req = req
+	return c.reply, c.err
+}
+
+// upstream records the last request it received.
+type upstream struct {
+	name string
+	req  *http.Request
+}
+
+func (u *upstream) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	u.req = req
+	w.Write([]byte(u.name))
+}
+
+func TestParseUpstreams(t *testing.T) {
+	got, err := ParseUpstreams("App.example.com=http://app:8080, *=https://default.internal/prefix")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	gotStrings := map[string]string{}
+	for k, v := range got {
+		gotStrings[k] = v.String()
+	}
+	want := map[string]string{
+		"app.example.com": "http://app:8080",
+		"*":               "https://default.internal/prefix",
+	}
+	if diff := cmp.Diff(gotStrings, want); diff != "" {
+		t.Errorf("upstreams (-got +want):\n%s", diff)
+	}
+
+	for _, bad := range []string{
+		"",
+		"app.example.com",
+		"=http://app",
+		"app.example.com=app:8080",
+		"app.example.com=/foo",
+		"a=http://a,A=http://b",
+	} {
+		if _, err := ParseUpstreams(bad); err == nil {
+			t.Errorf("parse %q: expected error", bad)
+		}
+	}
+}
+
+func TestProxy(t *testing.T) {
+	allow := &jssopb.AuthorizeHTTPReply{
+		Decision: &jssopb.AuthorizeHTTPReply_Allow{
+			Allow: &jssopb.Allow{
+				Username: "alice",
+				AddHeaders: []*types.Header{
+					{Key: "cookie", Value: "other=1"},
+					{Key: "cookie", Value: "another=2"},
+					{Key: "x-jsso2-assertion", Value: "signed"},
+				},
+			},
+		},
+	}
+	testData := []struct {
+		name         string
+		host         string
+		reply        *jssopb.AuthorizeHTTPReply
+		err          error
+		wantCode     int
+		wantUpstream string
+		wantHeaders  http.Header // Headers sent upstream, or in the response if there's no upstream.
+		wantBody     string
+	}{
+		{
+			name:         "allow",
+			host:         "app.example.com:443",
+			reply:        allow,
+			wantCode:     http.StatusOK,
+			wantUpstream: "app",
+			wantHeaders: http.Header{
+				"Accept":            {"text/html"},
+				"Cookie":            {"other=1; another=2"},
+				"X-Jsso2-Assertion": {"signed"},
+				"X-Username":        {"alice"},
+			},
+		},
+		{
+			name:         "any host",
+			host:         "other.example.com",
+			reply:        allow,
+			wantCode:     http.StatusOK,
+			wantUpstream: "default",
+		},
+		{
+			name: "redirect",
+			host: "app.example.com",
+			reply: &jssopb.AuthorizeHTTPReply{
+				Decision: &jssopb.AuthorizeHTTPReply_Deny{
+					Deny: &jssopb.Deny{
+						Destination: &jssopb.Deny_Redirect_{
+							Redirect: &jssopb.Deny_Redirect{RedirectUrl: "https://sso.example.com/login"},
+						},
+					},
+				},
+			},
+			wantCode: http.StatusTemporaryRedirect,
+			wantHeaders: http.Header{
+				"Location": {"https://sso.example.com/login"},
+			},
+		},
+		{
+			name: "api client",
+			host: "app.example.com",
+			reply: &jssopb.AuthorizeHTTPReply{
+				Decision: &jssopb.AuthorizeHTTPReply_Deny{
+					Deny: &jssopb.Deny{
+						Destination: &jssopb.Deny_Response_{
+							Response: &jssopb.Deny_Response{
+								ContentType: "application/json",
+								Body:        `{"error":"login required"}`,
+								StatusCode:  401,
+							},
+						},
+					},
+				},
+			},
+			wantCode: http.StatusUnauthorized,
+			wantHeaders: http.Header{
+				"Content-Type": {"application/json"},
+			},
+			wantBody: `{"error":"login required"}`,
+		},
+		{
+			name:     "jsso2 down",
+			host:     "app.example.com",
+			err:      status.Error(codes.Unavailable, "down"),
+			wantCode: http.StatusServiceUnavailable,
+		},
+	}
+	for _, test := range testData {
+		t.Run(test.name, func(t *testing.T) {
+			client := &fakeSessionClient{reply: test.reply, err: test.err}
+			app, def := &upstream{name: "app"}, &upstream{name: "default"}
+			p := &Proxy{
+				SessionClient:  client,
+				Upstreams:      map[string]http.Handler{"app.example.com": app, AnyHost: def},
+				UsernameHeader: "x-username",
+			}
+			req := httptest.NewRequest("GET", "/foo%2Fbar?q=1", nil)
+			req.Host = test.host
+			req.Header.Set("Accept", "text/html")
+			req.Header.Set("Cookie", "jsso-session-id=secret; other=1")
+			req.Header.Set("Authorization", "SessionID secret")
+			req.Header.Set("X-Jsso2-Assertion", "forged")
+			req.Header.Set("X-Username", "root")
+			rec := httptest.NewRecorder()
+			p.ServeHTTP(rec, req)
+
+			if got, want := rec.Code, test.wantCode; got != want {
+				t.Errorf("status:\n  got: %v\n want: %v", got, want)
+			}
+			if got, want := client.req.GetRequestUri(), "http://"+test.host+"/foo%2Fbar?q=1"; got != want {
+				t.Errorf("request uri:\n  got: %v\n want: %v", got, want)
+			}
+			if got, want := client.req.GetCookies(), []string{"jsso-session-id=secret", "other=1"}; !cmp.Equal(got, want) {
+				t.Errorf("cookies:\n  got: %v\n want: %v", got, want)
+			}
+			var gotUpstream string
+			for _, u := range []*upstream{app, def} {
+				if u.req != nil {
+					gotUpstream = u.name
+				}
+			}
+			if got, want := gotUpstream, test.wantUpstream; got != want {
+				t.Fatalf("upstream:\n  got: %v\n want: %v", got, want)
+			}
+			if test.wantUpstream != "" {
+				if test.wantHeaders != nil {
+					if diff := cmp.Diff(upstreamHeaders(app, def), test.wantHeaders); diff != "" {
+						t.Errorf("upstream headers (-got +want):\n%s", diff)
+					}
+				}
+				return
+			}
+			for k, want := range test.wantHeaders {
+				if got := rec.Header()[k]; !cmp.Equal(got, want) {
+					t.Errorf("header %s:\n  got: %v\n want: %v", k, got, want)
+				}
+			}
+			if test.wantBody != "" {
+				if got, want := rec.Body.String(), test.wantBody; got != want {
+					t.Errorf("body:\n  got: %v\n want: %v", got, want)
+				}
+			}
+		})
+	}
+}
+
+// upstreamHeaders returns the headers of the request that reached an upstream.
+func upstreamHeaders(us ...*upstream) http.Header {
+	for _, u := range us {
+		if u.req != nil {
+			return u.req.Header
+		}
+	}
+	return nil
+}
+
+func TestForwardedProto(t *testing.T) {
+	_, proxies, err := net.ParseCIDR("192.0.2.0/24") // httptest's default RemoteAddr is 192.0.2.1.
+	if err != nil {
+		t.Fatal(err)
+	}
+	testData := []struct {
+		name    string
+		trusted []*net.IPNet
+		tls     bool
+		proto   string
+		want    string
+	}{
+		{name: "plaintext", want: "http://app.example.com/"},
+		{name: "tls", tls: true, want: "https://app.example.com/"},
+		{name: "untrusted peer", proto: "https", want: "http://app.example.com/"},
+		{name: "untrusted peer over tls", tls: true, proto: "http", want: "https://app.example.com/"},
+		{name: "trusted peer", trusted: []*net.IPNet{proxies}, proto: "https", want: "https://app.example.com/"},
+		{name: "trusted peer without header", trusted: []*net.IPNet{proxies}, want: "http://app.example.com/"},
+		{name: "trusted peer with junk", trusted: []*net.IPNet{proxies}, proto: "javascript", want: "http://app.example.com/"},
+	}
+	for _, test := range testData {
+		t.Run(test.name, func(t *testing.T) {
+			client := &fakeSessionClient{reply: &jssopb.AuthorizeHTTPReply{}}
+			p := &Proxy{
+				SessionClient:  client,
+				Upstreams:      map[string]http.Handler{AnyHost: &upstream{}},
+				TrustedProxies: test.trusted,
+			}
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Host = "app.example.com"
+			if test.tls {
+				req.TLS = &tls.ConnectionState{}
+			}
+			if test.proto != "" {
+				req.Header.Set("X-Forwarded-Proto", test.proto)
+			}
+			p.ServeHTTP(httptest.NewRecorder(), req)
+			if got, want := client.req.GetRequestUri(), test.want; got != want {
+				t.Errorf("request uri:\n  got: %v\n want: %v", got, want)
+			}
+		})
+	}
+}
+
+func TestNoUpstream(t *testing.T) {
+	client := &fakeSessionClient{}
+	p := &Proxy{
+		SessionClient: client,
+		Upstreams:     map[string]http.Handler{"app.example.com": &upstream{}},
+	}
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Host = "other.example.com"
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, req)
+	if got, want := rec.Code, http.StatusNotFound; got != want {
+		t.Errorf("status:\n  got: %v\n want: %v", got, want)
+	}
+	if client.req != nil {
+		t.Error("unexpected authorization check for a host with no upstream")
+	}
+}
+
+func TestConfigProxy(t *testing.T) {
+	var gotURI, gotCookie string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		gotURI, gotCookie = req.RequestURI, req.Header.Get("Cookie")
+	}))
+	defer backend.Close()
+
+	cfg := &Config{Upstreams: "app.example.com=" + backend.URL}
+	client := &fakeSessionClient{
+		reply: &jssopb.AuthorizeHTTPReply{
+			Decision: &jssopb.AuthorizeHTTPReply_Allow{
+				Allow: &jssopb.Allow{Username: "alice"},
+			},
+		},
+	}
+	p, err := cfg.Proxy(client)
+	if err != nil {
+		t.Fatalf("configure proxy: %v", err)
+	}
+	if len(p.TrustedProxies) != 0 {
+		t.Errorf("trusted proxies: got %v, want none", p.TrustedProxies)
+	}
+	badCfg := &Config{Upstreams: cfg.Upstreams, TrustedProxies: "not an address"}
+	if _, err := badCfg.Proxy(client); err == nil {
+		t.Error("configure proxy with invalid trusted proxies: expected error")
+	}
+	req := httptest.NewRequest("GET", "http://app.example.com/a%2Fb?q=1", nil)
+	req.Header.Set("Cookie", "jsso-session-id=secret")
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, req)
+	if got, want := rec.Code, http.StatusOK; got != want {
+		t.Fatalf("status:\n  got: %v\n want: %v", got, want)
+	}
+	if got, want := gotURI, "/a%2Fb?q=1"; got != want {
+		t.Errorf("upstream request uri:\n  got: %v\n want: %v", got, want)
+	}
+	if gotCookie != "" {
+		t.Errorf("upstream received cookies %q; want none", gotCookie)
+	}
+}
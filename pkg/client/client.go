@@ -10,9 +10,12 @@ import (
 
 // Set is a set of connected JSSO clients.
 type Set struct {
-	cc            *grpc.ClientConn
-	UserClient    jssopb.UserClient
-	SessionClient jssopb.SessionClient
+	cc             *grpc.ClientConn
+	UserClient     jssopb.UserClient
+	SessionClient  jssopb.SessionClient
+	AuditClient    jssopb.AuditClient
+	EventsClient   jssopb.EventsClient
+	WebhooksClient jssopb.WebhooksClient
 }
 
 // Credentials authenticates requests to the JSSO server.
@@ -44,9 +47,12 @@ func (c *Credentials) RequireTransportSecurity() bool {
 // FromCC returns a clientset based on an existing client connection.
 func FromCC(cc *grpc.ClientConn) *Set {
 	return &Set{
-		cc:            cc,
-		UserClient:    jssopb.NewUserClient(cc),
-		SessionClient: jssopb.NewSessionClient(cc),
+		cc:             cc,
+		UserClient:     jssopb.NewUserClient(cc),
+		SessionClient:  jssopb.NewSessionClient(cc),
+		AuditClient:    jssopb.NewAuditClient(cc),
+		EventsClient:   jssopb.NewEventsClient(cc),
+		WebhooksClient: jssopb.NewWebhooksClient(cc),
 	}
 }
 
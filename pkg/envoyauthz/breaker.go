@@ -0,0 +1,79 @@
+package envoyauthz
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrBreakerOpen is returned by Breaker.Allow while the session service is considered down.
+var ErrBreakerOpen = errors.New("circuit breaker open: session service is unavailable")
+
+// Breaker is a circuit breaker for calls to the session service.  After Threshold consecutive
+// failures, it fails calls immediately for Cooldown, so that an outage doesn't make every request
+// wait for its full timeout and retries.  After the cooldown, one call is let through to probe the
+// service; if it succeeds, the breaker closes, and if it fails, the cooldown starts again.
+//
+// A nil Breaker allows every call.
+type Breaker struct {
+	Threshold int
+	Cooldown  time.Duration
+
+	now       func() time.Time // For tests.
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+func (b *Breaker) time() time.Time {
+	if b.now != nil {
+		return b.now()
+	}
+	return time.Now()
+}
+
+// Allow returns ErrBreakerOpen if a call to the session service should not be attempted.  Callers
+// that get a nil error must report the result of the call to Record.
+func (b *Breaker) Allow() error {
+	if b == nil || b.Threshold < 1 {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < b.Threshold {
+		return nil
+	}
+	if b.probing || b.time().Before(b.openUntil) {
+		return ErrBreakerOpen
+	}
+	b.probing = true
+	return nil
+}
+
+// Record records the result of a call to the session service.
+func (b *Breaker) Record(err error) {
+	if b == nil || b.Threshold < 1 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+	switch status.Code(err) {
+	case codes.OK:
+		b.failures = 0
+	case codes.Canceled:
+		// The client gave up; that says nothing about the session service.
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Unknown, codes.Internal, codes.ResourceExhausted:
+		b.failures++
+		if b.failures >= b.Threshold {
+			b.openUntil = b.time().Add(b.Cooldown)
+		}
+	default:
+		// Any other error came from a session service that's up and answering.
+		b.failures = 0
+	}
+}
@@ -0,0 +1,61 @@
+package envoyauthz
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestBreaker(t *testing.T) {
+	now := time.Unix(0, 0)
+	b := &Breaker{
+		Threshold: 2,
+		Cooldown:  time.Second,
+		now:       func() time.Time { return now },
+	}
+	down := status.Error(codes.Unavailable, "down")
+	call := func(t *testing.T, result error) {
+		t.Helper()
+		if err := b.Allow(); err != nil {
+			t.Fatalf("allow: %v", err)
+		}
+		b.Record(result)
+	}
+	check := func(t *testing.T, want error) {
+		t.Helper()
+		if got := b.Allow(); !errors.Is(got, want) {
+			t.Fatalf("allow:\n  got: %v\n want: %v", got, want)
+		}
+	}
+
+	call(t, down)
+	call(t, status.Error(codes.PermissionDenied, "up, but says no"))
+	call(t, down)
+	call(t, down)
+	check(t, ErrBreakerOpen)
+
+	now = now.Add(time.Second)
+	check(t, nil) // The probe.
+	check(t, ErrBreakerOpen)
+	b.Record(down)
+	check(t, ErrBreakerOpen)
+
+	now = now.Add(time.Second)
+	check(t, nil)
+	b.Record(nil)
+	call(t, down)
+	check(t, nil)
+
+	var disabled *Breaker
+	check = func(t *testing.T, want error) {
+		t.Helper()
+		if got := disabled.Allow(); got != want {
+			t.Fatalf("allow nil breaker:\n  got: %v\n want: %v", got, want)
+		}
+	}
+	disabled.Record(down)
+	check(t, nil)
+}
@@ -0,0 +1,251 @@
+package envoyauthz
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/jrockway/jsso2/pkg/jssopb"
+	"github.com/jrockway/jsso2/pkg/types"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// cacheKey identifies the credentials and site of a request.  It's a hash, so that the cache
+// doesn't hold onto anyone's session.
+type cacheKey [sha256.Size]byte
+
+// cacheEntry is a cached Allow decision.
+type cacheEntry struct {
+	reply      *jssopb.AuthorizeHTTPReply
+	username   string
+	expires    time.Time // Until when the decision is served without asking the session service.
+	staleUntil time.Time // Until when the decision is served when the session service is unreachable.
+}
+
+// Cache caches Allow decisions, so that repeated requests with the same credentials don't each
+// need a round-trip to the session service, and so that recently-allowed users can keep working
+// through short outages.  Entries are keyed on the request's host and its entire Cookie and
+// Authorization headers, because the decision includes the cookies and authorization headers to
+// pass upstream; the path and method are not part of the key, so the cache assumes that the access
+// policy doesn't depend on them.
+//
+// The decision includes any identity assertion as it was originally issued, so TTL plus StaleTTL
+// should be well under the maximum age that upstream services accept for assertions.
+//
+// Denials are never cached.  Watch removes the entries of users that log out or are changed.
+type Cache struct {
+	TTL        time.Duration // How long a decision is fresh.
+	StaleTTL   time.Duration // How long after that a decision is used if the session service is down.
+	MaxEntries int           // If non-zero, the maximum number of decisions to keep.
+
+	now     func() time.Time // For tests.
+	mu      sync.Mutex
+	entries map[cacheKey]*cacheEntry
+}
+
+func (c *Cache) time() time.Time {
+	if c.now != nil {
+		return c.now()
+	}
+	return time.Now()
+}
+
+// key returns the cache key for a request.
+func (c *Cache) key(host string, authorization, cookies []string) cacheKey {
+	if c == nil {
+		return cacheKey{}
+	}
+	h := sha256.New()
+	// Every field is length-prefixed, so that no two different requests hash the same input.
+	write := func(s string) {
+		fmt.Fprintf(h, "%d:%s", len(s), s)
+	}
+	write(host)
+	fmt.Fprintf(h, "%d", len(authorization))
+	for _, a := range authorization {
+		write(a)
+	}
+	fmt.Fprintf(h, "%d", len(cookies))
+	for _, c := range cookies {
+		write(c)
+	}
+	var k cacheKey
+	copy(k[:], h.Sum(nil))
+	return k
+}
+
+// Get returns the cached decision for key.  If stale is true, decisions that are past their TTL but
+// within their StaleTTL are returned.
+func (c *Cache) Get(key cacheKey, stale bool) (*jssopb.AuthorizeHTTPReply, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	now := c.time()
+	if now.Before(e.expires) || (stale && now.Before(e.staleUntil)) {
+		return e.reply, true
+	}
+	if !now.Before(e.staleUntil) {
+		delete(c.entries, key)
+	}
+	return nil, false
+}
+
+// Put caches reply under key, if it's an Allow decision.
+func (c *Cache) Put(key cacheKey, reply *jssopb.AuthorizeHTTPReply) {
+	if c == nil || c.TTL <= 0 || reply.GetAllow() == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.time()
+	if c.entries == nil {
+		c.entries = make(map[cacheKey]*cacheEntry)
+	}
+	if _, ok := c.entries[key]; !ok && c.MaxEntries > 0 && len(c.entries) >= c.MaxEntries {
+		c.evictLocked(now)
+	}
+	c.entries[key] = &cacheEntry{
+		reply:      reply,
+		username:   reply.GetAllow().GetUsername(),
+		expires:    now.Add(c.TTL),
+		staleUntil: now.Add(c.TTL + c.StaleTTL),
+	}
+}
+
+// evictLocked makes room for a new entry, by removing every entry that can no longer be served,
+// or if there are none, an arbitrary entry.
+func (c *Cache) evictLocked(now time.Time) {
+	for k, e := range c.entries {
+		if !now.Before(e.staleUntil) {
+			delete(c.entries, k)
+		}
+	}
+	if len(c.entries) < c.MaxEntries {
+		return
+	}
+	for k := range c.entries {
+		delete(c.entries, k)
+		break
+	}
+}
+
+// Invalidate removes every decision that allowed the named user.
+func (c *Cache) Invalidate(username string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, e := range c.entries {
+		if e.username == username {
+			delete(c.entries, k)
+		}
+	}
+}
+
+// Clear removes every decision.
+func (c *Cache) Clear() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = nil
+}
+
+// HandleEvent invalidates the decisions that an event could make wrong.
+func (c *Cache) HandleEvent(e *types.Event) {
+	switch e.GetType() {
+	case types.Event_LOGOUT, types.Event_SESSION_REVOKED:
+		for _, u := range []*types.User{e.GetAuditEvent().GetActor(), e.GetAuditEvent().GetTarget()} {
+			if name := u.GetUsername(); name != "" {
+				c.Invalidate(name)
+			}
+		}
+	case types.Event_USER_CHANGED:
+		// The event only records the user's new username, so entries under an old one can't be
+		// found.  Edits are rare enough that starting over is fine.
+		c.Clear()
+	}
+}
+
+// watchRetryInterval is how long Watch waits before reconnecting to the event stream.
+const watchRetryInterval = time.Second
+
+// Watch invalidates cached decisions as revocation events arrive from the session service, until
+// the context is done.  If the stream breaks, it reconnects and resumes after the last event it
+// saw.
+func (c *Cache) Watch(ctx context.Context, l *zap.Logger, client jssopb.EventsClient) {
+	if c == nil {
+		return
+	}
+	req := &jssopb.WatchEventsRequest{
+		Types: []types.Event_Type{types.Event_LOGOUT, types.Event_SESSION_REVOKED, types.Event_USER_CHANGED},
+	}
+	for {
+		err := c.watchOnce(ctx, client, req)
+		if ctx.Err() != nil {
+			return
+		}
+		switch statusCode(err) {
+		case codes.PermissionDenied, codes.Unauthenticated:
+			// Retrying won't help, but the credentials might be fixed on the server side.
+			l.Error("not allowed to watch revocation events; check --jsso_session_token", zap.Error(err))
+		default:
+			l.Warn("revocation event stream broke; reconnecting", zap.Error(err), zap.String("cursor", req.GetCursor()))
+		}
+		if req.GetCursor() == "" {
+			// Events that happened before the first one we saw can't be replayed.
+			c.Clear()
+		}
+		t := time.NewTimer(watchRetryInterval)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// statusCode is status.Code, but it also finds statuses that have been wrapped.
+func statusCode(err error) codes.Code {
+	var s interface{ GRPCStatus() *status.Status }
+	if errors.As(err, &s) {
+		return s.GRPCStatus().Code()
+	}
+	return status.Code(err)
+}
+
+// watchOnce handles events from one stream, updating the request's cursor as it goes.
+func (c *Cache) watchOnce(ctx context.Context, client jssopb.EventsClient, req *jssopb.WatchEventsRequest) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := client.Watch(ctx, req)
+	if err != nil {
+		return fmt.Errorf("start watch: %w", err)
+	}
+	for {
+		reply, err := stream.Recv()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return errors.New("stream ended")
+			}
+			return fmt.Errorf("receive event: %w", err)
+		}
+		c.HandleEvent(reply.GetEvent())
+		req.Cursor = reply.GetEvent().GetCursor()
+	}
+}
@@ -0,0 +1,261 @@
+package envoyauthz
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/jrockway/jsso2/pkg/client"
+	"github.com/jrockway/jsso2/pkg/jssopb"
+	"github.com/jrockway/jsso2/pkg/jtesting"
+	"github.com/jrockway/jsso2/pkg/testserver"
+	"github.com/jrockway/jsso2/pkg/types"
+	"go.uber.org/zap/zaptest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+func allowUser(username string) *jssopb.AuthorizeHTTPReply {
+	return &jssopb.AuthorizeHTTPReply{
+		Decision: &jssopb.AuthorizeHTTPReply_Allow{
+			Allow: &jssopb.Allow{Username: username},
+		},
+	}
+}
+
+func TestCache(t *testing.T) {
+	now := time.Unix(0, 0)
+	c := &Cache{
+		TTL:        time.Second,
+		StaleTTL:   time.Minute,
+		MaxEntries: 2,
+		now:        func() time.Time { return now },
+	}
+	alice := c.key("app.example.com", nil, []string{"jsso-session-id=alice"})
+	bob := c.key("app.example.com", []string{"SessionID bob"}, nil)
+	if other := c.key("other.example.com", nil, []string{"jsso-session-id=alice"}); other == alice {
+		t.Error("keys for different hosts are equal")
+	}
+	if split := c.key("app.example.com", []string{"SessionID", " bob"}, nil); split == bob {
+		t.Error("keys for different headers are equal")
+	}
+
+	c.Put(alice, &jssopb.AuthorizeHTTPReply{Decision: &jssopb.AuthorizeHTTPReply_Deny{Deny: &jssopb.Deny{}}})
+	if _, ok := c.Get(alice, true); ok {
+		t.Error("denial was cached")
+	}
+	c.Put(alice, allowUser("alice"))
+	c.Put(bob, allowUser("bob"))
+	if got, ok := c.Get(alice, false); !ok || got.GetAllow().GetUsername() != "alice" {
+		t.Errorf("get alice: got %v, %v", got, ok)
+	}
+
+	now = now.Add(2 * time.Second)
+	if _, ok := c.Get(alice, false); ok {
+		t.Error("expired decision was fresh")
+	}
+	if _, ok := c.Get(alice, true); !ok {
+		t.Error("expired decision was not available as a stale decision")
+	}
+
+	c.Invalidate("alice")
+	if _, ok := c.Get(alice, true); ok {
+		t.Error("invalidated decision was available")
+	}
+	if _, ok := c.Get(bob, true); !ok {
+		t.Error("decision for another user was invalidated")
+	}
+
+	now = now.Add(time.Hour)
+	carol := c.key("app.example.com", nil, []string{"jsso-session-id=carol"})
+	dave := c.key("app.example.com", nil, []string{"jsso-session-id=dave"})
+	eve := c.key("app.example.com", nil, []string{"jsso-session-id=eve"})
+	c.Put(carol, allowUser("carol"))
+	c.Put(dave, allowUser("dave"))
+	c.Put(eve, allowUser("eve"))
+	var n int
+	for _, k := range []cacheKey{bob, carol, dave, eve} {
+		if _, ok := c.Get(k, false); ok {
+			n++
+		}
+	}
+	if got, want := n, 2; got != want {
+		t.Errorf("entries after eviction:\n  got: %v\n want: %v", got, want)
+	}
+	if _, ok := c.Get(eve, false); !ok {
+		t.Error("newest entry was evicted")
+	}
+
+	c.HandleEvent(&types.Event{
+		Type:       types.Event_LOGOUT,
+		AuditEvent: &types.AuditEvent{Actor: &types.User{Username: "eve"}, Target: &types.User{Username: "eve"}},
+	})
+	if _, ok := c.Get(eve, false); ok {
+		t.Error("logged out user's entry is still cached")
+	}
+	c.Put(eve, allowUser("eve"))
+	c.HandleEvent(&types.Event{
+		Type:       types.Event_USER_CHANGED,
+		AuditEvent: &types.AuditEvent{Target: &types.User{Username: "someone-else"}},
+	})
+	if _, ok := c.Get(eve, false); ok {
+		t.Error("entries survived a user change")
+	}
+
+	var disabled *Cache
+	disabled.Put(disabled.key("app.example.com", nil, nil), allowUser("alice"))
+	if _, ok := disabled.Get(disabled.key("app.example.com", nil, nil), true); ok {
+		t.Error("nil cache returned a decision")
+	}
+}
+
+// fakeEventsClient serves each element of streams in turn to calls to Watch, recording the
+// requests.
+type fakeEventsClient struct {
+	streams [][]*types.Event
+	reqs    []*jssopb.WatchEventsRequest
+	done    chan struct{}
+}
+
+func (c *fakeEventsClient) Watch(ctx context.Context, req *jssopb.WatchEventsRequest, opts ...grpc.CallOption) (jssopb.Events_WatchClient, error) {
+	c.reqs = append(c.reqs, &jssopb.WatchEventsRequest{Types: req.GetTypes(), Cursor: req.GetCursor()})
+	if len(c.streams) == 0 {
+		close(c.done)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	s := &fakeWatchClient{events: c.streams[0]}
+	c.streams = c.streams[1:]
+	return s, nil
+}
+
+type fakeWatchClient struct {
+	grpc.ClientStream
+	events []*types.Event
+}
+
+func (s *fakeWatchClient) Recv() (*jssopb.WatchEventsReply, error) {
+	if len(s.events) == 0 {
+		return nil, io.EOF
+	}
+	e := s.events[0]
+	s.events = s.events[1:]
+	return &jssopb.WatchEventsReply{Event: e}, nil
+}
+
+func TestWatch(t *testing.T) {
+	c := &Cache{TTL: time.Hour}
+	alice := c.key("app.example.com", nil, []string{"jsso-session-id=alice"})
+	bob := c.key("app.example.com", nil, []string{"jsso-session-id=bob"})
+	c.Put(alice, allowUser("alice"))
+	c.Put(bob, allowUser("bob"))
+
+	client := &fakeEventsClient{
+		streams: [][]*types.Event{
+			{
+				{
+					Type:       types.Event_LOGOUT,
+					Cursor:     "42",
+					AuditEvent: &types.AuditEvent{Actor: &types.User{Username: "alice"}},
+				},
+			},
+		},
+		done: make(chan struct{}),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	finished := make(chan struct{})
+	go func() {
+		c.Watch(ctx, zaptest.NewLogger(t), client)
+		close(finished)
+	}()
+	select {
+	case <-client.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for reconnect")
+	}
+	cancel()
+	<-finished
+
+	if _, ok := c.Get(alice, false); ok {
+		t.Error("alice's entry is still cached after she logged out")
+	}
+	if _, ok := c.Get(bob, false); !ok {
+		t.Error("bob's entry was removed")
+	}
+	if got, want := len(client.reqs), 2; got != want {
+		t.Fatalf("watch calls:\n  got: %v\n want: %v", got, want)
+	}
+	if got, want := client.reqs[1].GetCursor(), "42"; got != want {
+		t.Errorf("cursor after reconnect:\n  got: %v\n want: %v", got, want)
+	}
+}
+
+// credentialedEventsClient makes every call with the provided credentials, like the sidecar's
+// connection does.
+type credentialedEventsClient struct {
+	jssopb.EventsClient
+	creds *client.Credentials
+}
+
+func (c *credentialedEventsClient) Watch(ctx context.Context, req *jssopb.WatchEventsRequest, opts ...grpc.CallOption) (jssopb.Events_WatchClient, error) {
+	return c.EventsClient.Watch(ctx, req, append(opts, grpc.PerRPCCredentials(c.creds))...)
+}
+
+func TestWatchPermissions(t *testing.T) {
+	s := testserver.New()
+	s.InMemory = true
+	r := &jtesting.R{Logger: true}
+	s.ToR(r)
+	jtesting.Run(t, "watch", *r, func(t *testing.T, e *jtesting.E) {
+		set := client.FromCC(e.ClientConn)
+
+		anonymous := &credentialedEventsClient{EventsClient: set.EventsClient, creds: (&Config{}).Credentials()}
+		ctx, cancel := context.WithTimeout(e.Context, 5*time.Second)
+		defer cancel()
+		c := &Cache{TTL: time.Hour}
+		err := c.watchOnce(ctx, anonymous, &jssopb.WatchEventsRequest{})
+		if got, want := statusCode(err), codes.PermissionDenied; got != want {
+			t.Errorf("watch without credentials:\n  got: %v (%v)\n want: %v", got, err, want)
+		}
+		if err := (&Config{CacheTTL: time.Second}).Validate(); err == nil {
+			t.Error("expected a cache without credentials to be rejected")
+		}
+
+		cfg := &Config{CacheTTL: time.Hour, RootPassword: "root"}
+		if err := cfg.Validate(); err != nil {
+			t.Fatalf("validate: %v", err)
+		}
+		root := &credentialedEventsClient{EventsClient: set.EventsClient, creds: cfg.Credentials()}
+		c = cfg.Cache()
+		alice := c.key("app.example.com", nil, []string{"jsso-session-id=alice"})
+		finished := make(chan struct{})
+		go func() {
+			c.Watch(ctx, zaptest.NewLogger(t), root)
+			close(finished)
+		}()
+		defer func() {
+			cancel()
+			<-finished
+		}()
+
+		// The watch starts from whatever is newest when it connects, so keep changing users
+		// until one of the changes is seen.
+		for i := 0; ; i++ {
+			c.Put(alice, allowUser("alice"))
+			if _, err := set.UserClient.Edit(ctx, &jssopb.EditUserRequest{
+				User: &types.User{Username: fmt.Sprintf("user%d", i)},
+			}, grpc.PerRPCCredentials(cfg.Credentials())); err != nil {
+				t.Fatalf("add user: %v", err)
+			}
+			time.Sleep(10 * time.Millisecond)
+			if _, ok := c.Get(alice, false); !ok {
+				break
+			}
+			if ctx.Err() != nil {
+				t.Fatal("timeout waiting for a user change to clear the cache")
+			}
+		}
+	})
+}
@@ -2,39 +2,281 @@ package envoyauthz
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
 	"net/textproto"
 	"net/url"
+	"sort"
 	"strings"
 	"time"
 
 	envoy_config_core_v3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
 	envoy_auth "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
 	envoy_type_v3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"github.com/jrockway/jsso2/pkg/client"
+	"github.com/jrockway/jsso2/pkg/forwardauth"
 	"github.com/jrockway/jsso2/pkg/jssopb"
 	"github.com/jrockway/jsso2/pkg/sessions"
+	"github.com/jrockway/jsso2/pkg/types"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
 	protostatus "google.golang.org/genproto/googleapis/rpc/status"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
 	"google.golang.org/protobuf/types/known/wrapperspb"
 )
 
-const (
-	maxRetries      = 3
-	backoffInterval = 10 * time.Millisecond
+var (
+	checks = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "jsso2_envoyauthz_checks",
+		Help: "Number of authorization checks, by decision and reason.  Allowed requests are fresh, cached, stale, or fail_open; denials are no_credentials, invalid_credentials, policy, unknown, or bad_request; errors are a gRPC code or invalid_route_settings.",
+	}, []string{"decision", "reason"})
+	checkSeconds = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "jsso2_envoyauthz_check_seconds",
+		Help:    "Time taken to answer authorization checks, by decision.",
+		Buckets: prometheus.ExponentialBuckets(0.0005, 2, 14),
+	}, []string{"decision"})
+	authorizeSeconds = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "jsso2_envoyauthz_authorize_seconds",
+		Help:    "Time taken by each call to AuthorizeHTTP, by gRPC code.",
+		Buckets: prometheus.ExponentialBuckets(0.0005, 2, 14),
+	}, []string{"code"})
+	authorizeRetries = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "jsso2_envoyauthz_authorize_retries",
+		Help: "Number of calls to AuthorizeHTTP that retried a failed call.",
+	})
+	breakerRejections = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "jsso2_envoyauthz_breaker_rejections",
+		Help: "Number of calls to AuthorizeHTTP that weren't made because the circuit breaker was open.",
+	})
 )
 
+// denyReason returns the reason label for a denial.
+func denyReason(d *jssopb.Deny) string {
+	switch c := d.GetCategory(); c {
+	case jssopb.Deny_NO_CREDENTIALS, jssopb.Deny_INVALID_CREDENTIALS, jssopb.Deny_POLICY:
+		return strings.ToLower(c.String())
+	}
+	return "unknown"
+}
+
+// assertionHeader is session.AssertionHeader; it's removed from every request that the session
+// service didn't issue an assertion for, so that a replayed assertion can't pass for a real one.
+const assertionHeader = "x-jsso2-assertion"
+
+// MetadataNamespace is the key under which Check reports who made a request, in the dynamic
+// metadata of the ext_authz filter.  Access logs can then record the user without the upstream
+// seeing any identity headers:
+//
+//	%DYNAMIC_METADATA(envoy.filters.http.ext_authz:jsso2:username)%
+//
+// Allowed requests have username, user_id, groups, and session_handle; denied requests have
+// deny_reason; requests that failed open have fail_open.  The session handle identifies a session
+// in logs, but can't be used as a credential.
+const MetadataNamespace = "jsso2"
+
+// dynamicMetadata wraps fields in the jsso2 namespace.
+func dynamicMetadata(fields map[string]*structpb.Value) *structpb.Struct {
+	return &structpb.Struct{
+		Fields: map[string]*structpb.Value{
+			MetadataNamespace: structpb.NewStructValue(&structpb.Struct{Fields: fields}),
+		},
+	}
+}
+
+// allowMetadata returns the dynamic metadata for an allowed request.
+func allowMetadata(a *jssopb.Allow) *structpb.Struct {
+	var groups []*structpb.Value
+	for _, g := range a.GetGroups() {
+		groups = append(groups, structpb.NewStringValue(g))
+	}
+	return dynamicMetadata(map[string]*structpb.Value{
+		"username":       structpb.NewStringValue(a.GetUsername()),
+		"user_id":        structpb.NewNumberValue(float64(a.GetUserId())),
+		"groups":         structpb.NewListValue(&structpb.ListValue{Values: groups}),
+		"session_handle": structpb.NewStringValue(a.GetSessionHandle()),
+	})
+}
+
 type Config struct {
-	Address                    string `long:"jsso_server_address" env:"JSSO_SERVER_ADDRESS" description:"The URL of JSSO's gRPC server."`
-	AddPlaintextUsernameHeader string `long:"plaintext_username_header" env:"PLAINTEXT_USERNAME_HEADER" description:"If set, send the authenticated user's username in a header with this name."`
+	Address                    string        `long:"jsso_server_address" env:"JSSO_SERVER_ADDRESS" description:"The URL of JSSO's gRPC server."`
+	AddPlaintextUsernameHeader string        `long:"plaintext_username_header" env:"PLAINTEXT_USERNAME_HEADER" description:"If set, send the authenticated user's username in a header with this name."`
+	MaxAttempts                int           `long:"max_attempts" env:"MAX_ATTEMPTS" default:"3" description:"The number of times to try an authorization check before giving up; routes can override this with the jsso2_max_attempts context extension."`
+	RetryBackoff               time.Duration `long:"retry_backoff" env:"RETRY_BACKOFF" default:"10ms" description:"How long to wait between attempts; routes can override this with the jsso2_retry_backoff context extension."`
+	Timeout                    time.Duration `long:"check_timeout" env:"CHECK_TIMEOUT" default:"0" description:"If non-zero, the deadline for all attempts together; routes can override this with the jsso2_timeout context extension.  Envoy's own ext_authz timeout always applies."`
+	BreakerThreshold           int           `long:"breaker_threshold" env:"BREAKER_THRESHOLD" default:"5" description:"After this many consecutive failures to reach JSSO, fail checks immediately for --breaker_cooldown; 0 disables the circuit breaker."`
+	BreakerCooldown            time.Duration `long:"breaker_cooldown" env:"BREAKER_COOLDOWN" default:"5s" description:"How long to fail checks immediately once the circuit breaker opens, before trying JSSO again."`
+	CacheTTL                   time.Duration `long:"cache_ttl" env:"CACHE_TTL" default:"0" description:"How long to reuse a decision to allow a request for other requests with the same credentials and host; 0 disables caching."`
+	CacheStaleTTL              time.Duration `long:"cache_stale_ttl" env:"CACHE_STALE_TTL" default:"0" description:"How long past --cache_ttl to keep reusing a decision while JSSO is unreachable."`
+	CacheMaxEntries            int           `long:"cache_max_entries" env:"CACHE_MAX_ENTRIES" default:"10000" description:"The maximum number of decisions to cache; 0 means unlimited."`
+	SessionToken               string        `long:"jsso_session_token" env:"JSSO_SESSION_TOKEN" description:"A session ID to authenticate to JSSO with.  With --cache_ttl, this or --jsso_root_password is required, because watching for revoked sessions needs a session that may watch events."`
+	RootPassword               string        `long:"jsso_root_password" env:"JSSO_ROOT_PASSWORD" description:"JSSO's root password, to authenticate with instead of --jsso_session_token."`
+}
+
+// Credentials returns the credentials to authenticate to JSSO with.
+func (c *Config) Credentials() *client.Credentials {
+	return &client.Credentials{
+		Token: c.SessionToken,
+		Root:  c.RootPassword,
+	}
+}
+
+// Validate checks that the config is usable.
+func (c *Config) Validate() error {
+	if c.CacheTTL > 0 && c.SessionToken == "" && c.RootPassword == "" {
+		return errors.New("--cache_ttl requires --jsso_session_token or --jsso_root_password, so that revoked sessions can be removed from the cache")
+	}
+	return nil
+}
+
+// Policy returns the default policy described by the config.
+func (c *Config) Policy() *Policy {
+	return &Policy{
+		MaxAttempts:  c.MaxAttempts,
+		RetryBackoff: c.RetryBackoff,
+		Timeout:      c.Timeout,
+	}
+}
+
+// Cache returns the decision cache described by the config, or nil if caching is disabled.
+func (c *Config) Cache() *Cache {
+	if c.CacheTTL <= 0 {
+		return nil
+	}
+	return &Cache{
+		TTL:        c.CacheTTL,
+		StaleTTL:   c.CacheStaleTTL,
+		MaxEntries: c.CacheMaxEntries,
+	}
+}
+
+// Breaker returns the circuit breaker described by the config.
+func (c *Config) Breaker() *Breaker {
+	return &Breaker{
+		Threshold: c.BreakerThreshold,
+		Cooldown:  c.BreakerCooldown,
+	}
 }
 
 type Service struct {
 	UsernameHeader string
 	SessionClient  jssopb.SessionClient
+	Policy         *Policy  // The policy for routes that don't override it; DefaultPolicy if nil.
+	Breaker        *Breaker // If set, stop calling SessionClient while it's failing.
+	Cache          *Cache   // If set, cache Allow decisions.
+}
+
+// RequestURL reconstructs the URL of the request that Envoy is asking about.  Envoy's path is the
+// request target exactly as the client sent it, including the query string and any
+// percent-encoding, so it's split apart here rather than being treated as a path; the result's
+// String() is the URL the client asked for.  The host always comes from the Host header, even if
+// the path looks like it contains one.
+func RequestURL(httpReq *envoy_auth.AttributeContext_HttpRequest) (*url.URL, error) {
+	u := &url.URL{
+		Scheme: httpReq.GetHeaders()["x-forwarded-proto"],
+		Host:   httpReq.GetHost(),
+	}
+	if u.Scheme == "" {
+		u.Scheme = httpReq.GetScheme()
+	}
+	if u.Scheme == "" {
+		u.Scheme = "http"
+	}
+	target := httpReq.GetPath()
+	if strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://") {
+		// Absolute-form, as sent to forward proxies.  Only the path and query are used.
+		abs, err := url.Parse(target)
+		if err != nil {
+			return nil, fmt.Errorf("parse absolute request target: %w", err)
+		}
+		target = abs.EscapedPath()
+		if abs.RawQuery != "" || abs.ForceQuery {
+			target += "?" + abs.RawQuery
+		}
+	}
+	if i := strings.IndexByte(target, '#'); i >= 0 {
+		u.Fragment = target[i+1:]
+		target = target[:i]
+	}
+	if i := strings.IndexByte(target, '?'); i >= 0 {
+		u.RawQuery = target[i+1:]
+		u.ForceQuery = u.RawQuery == ""
+		target = target[:i]
+	} else if q := httpReq.GetQuery(); q != "" {
+		u.RawQuery = q
+	}
+	if u.Fragment == "" {
+		u.Fragment = httpReq.GetFragment()
+	}
+	if !strings.HasPrefix(target, "/") {
+		return nil, fmt.Errorf("request path %q does not start with /", target)
+	}
+	path, err := url.PathUnescape(target)
+	if err != nil {
+		return nil, fmt.Errorf("unescape request path: %w", err)
+	}
+	u.Path = path
+	// Keeping the raw path preserves escapes that are significant, like %2F, and those that
+	// aren't, so that the URL is byte-for-byte what the client requested.
+	u.RawPath = target
+	return u, nil
 }
 
+// outcome describes the result of a check, for metrics and tracing.
+type outcome struct {
+	decision string // "allow", "deny", or "error".
+	reason   string // Why; see the help for the checks metric.
+}
+
+// Check implements envoy_auth.AuthorizationServer.
 func (s *Service) Check(ctx context.Context, req *envoy_auth.CheckRequest) (*envoy_auth.CheckResponse, error) {
+	start := time.Now()
+	span, ctx := startSpan(ctx, req.GetAttributes().GetRequest().GetHttp().GetHeaders())
+	defer span.Finish()
+	o := &outcome{decision: "error", reason: "unknown"}
+	reply, err := s.check(ctx, req, o)
+	checks.WithLabelValues(o.decision, o.reason).Inc()
+	checkSeconds.WithLabelValues(o.decision).Observe(time.Since(start).Seconds())
+	span.SetTag("decision", o.decision)
+	span.SetTag("reason", o.reason)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogKV("error", err.Error())
+	}
+	return reply, err
+}
+
+// startSpan starts the span for a check.  Its parent is the span of the HTTP request being
+// checked, if Envoy included one in its headers, so that the check and the AuthorizeHTTP call it
+// makes show up in the request's trace.  The span of the ext_authz call itself, if any, is
+// referenced but not the parent.
+func startSpan(ctx context.Context, headers map[string]string) (opentracing.Span, context.Context) {
+	tracer := opentracing.GlobalTracer()
+	h := http.Header{}
+	for k, v := range headers {
+		h.Set(k, v)
+	}
+	var opts []opentracing.StartSpanOption
+	grpcParent := opentracing.SpanFromContext(ctx)
+	if sc, err := tracer.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(h)); err == nil {
+		opts = append(opts, opentracing.ChildOf(sc))
+		if grpcParent != nil {
+			opts = append(opts, opentracing.FollowsFrom(grpcParent.Context()))
+		}
+	} else if grpcParent != nil {
+		opts = append(opts, opentracing.ChildOf(grpcParent.Context()))
+	}
+	span := tracer.StartSpan("envoyauthz.check", opts...)
+	return span, opentracing.ContextWithSpan(ctx, span)
+}
+
+func (s *Service) check(ctx context.Context, req *envoy_auth.CheckRequest, o *outcome) (*envoy_auth.CheckResponse, error) {
 	reply := &envoy_auth.CheckResponse{
 		Status: &protostatus.Status{
 			Code: int32(codes.Unavailable),
@@ -70,12 +312,25 @@ func (s *Service) Check(ctx context.Context, req *envoy_auth.CheckRequest) (*env
 	for _, c := range sessions.Cookies(headers["cookie"]) {
 		requestCookies = append(requestCookies, c.String())
 	}
+	var otherHeaders []*types.Header
+	for k, v := range headers {
+		switch k {
+		case "authorization", "cookie":
+			continue
+		}
+		otherHeaders = append(otherHeaders, &types.Header{Key: k, Value: v})
+	}
+	sort.Slice(otherHeaders, func(i, j int) bool { return otherHeaders[i].GetKey() < otherHeaders[j].GetKey() })
 
 	requestID := headers["x-request-id"]
-	requestURL := &url.URL{
-		Scheme: headers["x-forwarded-proto"],
-		Host:   httpReq.GetHost(),
-		Path:   httpReq.GetPath(),
+	requestURL, err := RequestURL(httpReq)
+	if err != nil {
+		deny := reply.GetDeniedResponse()
+		deny.Status.Code = envoy_type_v3.StatusCode_BadRequest
+		deny.Body = fmt.Sprintf("Invalid request: %v", err)
+		reply.Status.Code = int32(codes.InvalidArgument)
+		o.decision, o.reason = "deny", "bad_request"
+		return reply, nil
 	}
 
 	authorizeReq := &jssopb.AuthorizeHTTPRequest{
@@ -85,185 +340,259 @@ func (s *Service) Check(ctx context.Context, req *envoy_auth.CheckRequest) (*env
 		AuthorizationHeaders: authorizationHeaders,
 		Cookies:              requestCookies,
 		IpAddress:            attrs.GetSource().GetAddress().GetSocketAddress().GetAddress(),
+		Headers:              otherHeaders,
 	}
-	var errs []string
-	for i := 0; i < maxRetries; i++ {
-		auth, err := s.SessionClient.AuthorizeHTTP(ctx, authorizeReq)
-		if err != nil {
-			errs = append(errs, fmt.Sprintf("[call remote AuthorizeHTTP: %v]", err))
-			t := time.NewTimer(backoffInterval)
-			select {
-			case <-t.C:
-				continue
-			case <-ctx.Done():
-				t.Stop()
-				var code = codes.Unknown
-				switch ctx.Err() {
-				case context.DeadlineExceeded:
-					code = codes.DeadlineExceeded
-				case context.Canceled:
-					code = codes.Canceled
-				}
-				return reply, status.Error(code, fmt.Sprintf("after %d tries: %v", i+1, errs))
-			}
+	policy := DefaultPolicy
+	if s.Policy != nil {
+		policy = *s.Policy
+	}
+	policy, err = policy.WithExtensions(attrs.GetContextExtensions())
+	if err != nil {
+		reply.GetDeniedResponse().Body = fmt.Sprintf("Invalid authorization settings for this route: %v", err)
+		o.reason = "invalid_route_settings"
+		return reply, status.Error(codes.Internal, fmt.Sprintf("parse route settings: %v", err))
+	}
+	cacheKey := s.Cache.key(requestURL.Host, authorizationHeaders, requestCookies)
+	source := "cached"
+	auth, ok := s.Cache.Get(cacheKey, false)
+	if !ok {
+		source = "fresh"
+		auth, err = s.authorize(ctx, policy, authorizeReq)
+		if err == nil {
+			s.Cache.Put(cacheKey, auth)
+		} else if stale, ok := s.Cache.Get(cacheKey, true); ok {
+			ctxzap.Extract(ctx).Warn("authorization check failed; using a stale decision", zap.String("url", requestURL.String()), zap.Error(err))
+			auth, err, source = stale, nil, "stale"
 		}
-		switch decision := auth.Decision.(type) {
-		case *jssopb.AuthorizeHTTPReply_Allow:
-			allowRes := auth.GetAllow()
-			allow := &envoy_auth.OkHttpResponse{}
-			reply.Status = &protostatus.Status{
-				Code: int32(codes.OK),
-			}
-			reply.HttpResponse = &envoy_auth.CheckResponse_OkResponse{
-				OkResponse: allow,
-			}
-			headers := map[string][]string{}
-			for _, h := range allowRes.GetAddHeaders() {
-				k := textproto.CanonicalMIMEHeaderKey(h.GetKey())
-				headers[k] = append(headers[k], h.GetValue())
-			}
-			if _, ok := headers["Cookie"]; !ok {
-				allow.HeadersToRemove = append(allow.HeadersToRemove, "cookie")
-			}
-			if _, ok := headers["Authorization"]; !ok {
-				allow.HeadersToRemove = append(allow.HeadersToRemove, "authorization")
+	}
+	if err != nil {
+		if policy.FailOpen {
+			ctxzap.Extract(ctx).Warn("authorization check failed; allowing request on a fail-open route", zap.String("url", requestURL.String()), zap.Error(err))
+			o.decision, o.reason = "allow", "fail_open"
+			return s.failOpen(), nil
+		}
+		o.reason = status.Code(err).String()
+		return &envoy_auth.CheckResponse{
+			Status: &protostatus.Status{
+				Code:    int32(status.Code(err)),
+				Message: status.Convert(err).Message(),
+			},
+			HttpResponse: &envoy_auth.CheckResponse_DeniedResponse{
+				DeniedResponse: &envoy_auth.DeniedHttpResponse{
+					Status: &envoy_type_v3.HttpStatus{
+						Code: envoy_type_v3.StatusCode_ServiceUnavailable,
+					},
+					Body: status.Convert(err).Message(),
+					Headers: []*envoy_config_core_v3.HeaderValueOption{
+						{
+							Header: &envoy_config_core_v3.HeaderValue{
+								Key:   "content-type",
+								Value: "text-plain",
+							},
+						},
+					},
+				},
+			},
+		}, err
+	}
+	switch decision := auth.Decision.(type) {
+	case *jssopb.AuthorizeHTTPReply_Allow:
+		o.decision, o.reason = "allow", source
+		allowRes := auth.GetAllow()
+		allow := &envoy_auth.OkHttpResponse{}
+		reply.Status = &protostatus.Status{
+			Code: int32(codes.OK),
+		}
+		reply.HttpResponse = &envoy_auth.CheckResponse_OkResponse{
+			OkResponse: allow,
+		}
+		reply.DynamicMetadata = allowMetadata(allowRes)
+		headers := forwardauth.JoinHeaders(allowRes.GetAddHeaders())
+		if _, ok := headers["Cookie"]; !ok {
+			allow.HeadersToRemove = append(allow.HeadersToRemove, "cookie")
+		}
+		if _, ok := headers["Authorization"]; !ok {
+			allow.HeadersToRemove = append(allow.HeadersToRemove, "authorization")
+		}
+		if _, ok := headers[textproto.CanonicalMIMEHeaderKey(assertionHeader)]; !ok {
+			allow.HeadersToRemove = append(allow.HeadersToRemove, assertionHeader)
+		}
+		// Only this service gets to say that a request failed open.
+		allow.HeadersToRemove = append(allow.HeadersToRemove, FailOpenHeader)
+		for k, v := range headers {
+			// Envoy can't add multiple copies of a header; see forwardauth.JoinHeaders.
+			allow.Headers = append(allow.Headers, &envoy_config_core_v3.HeaderValueOption{
+				Append: &wrapperspb.BoolValue{
+					Value: false,
+				},
+				Header: &envoy_config_core_v3.HeaderValue{
+					Key:   k,
+					Value: v,
+				},
+			})
+		}
+		if h := s.UsernameHeader; h != "" {
+			allow.Headers = append(allow.Headers, &envoy_config_core_v3.HeaderValueOption{
+				Append: &wrapperspb.BoolValue{
+					Value: false,
+				},
+				Header: &envoy_config_core_v3.HeaderValue{
+					Key:   h,
+					Value: allowRes.GetUsername(),
+				},
+			})
+		}
+	case *jssopb.AuthorizeHTTPReply_Deny:
+		o.decision, o.reason = "deny", denyReason(decision.Deny)
+		deny := &envoy_auth.DeniedHttpResponse{}
+		reply.Status = &protostatus.Status{
+			Code: int32(codes.PermissionDenied),
+		}
+		reply.HttpResponse = &envoy_auth.CheckResponse_DeniedResponse{
+			DeniedResponse: deny,
+		}
+		reply.DynamicMetadata = dynamicMetadata(map[string]*structpb.Value{
+			"deny_reason": structpb.NewStringValue(o.reason),
+		})
+		switch decision.Deny.GetDestination().(type) {
+		case *jssopb.Deny_Redirect_:
+			denyRed := decision.Deny.GetRedirect()
+			deny.Status = &envoy_type_v3.HttpStatus{
+				Code: envoy_type_v3.StatusCode_TemporaryRedirect,
 			}
-			for k, v := range headers {
-				// This needs some tweaking.  Envoy is happy to proxy multiple
-				// copies of a header, but it doesn't have a way to let us add
-				// multiple copies of a header.  We can only append with a , or set
-				// a single header.
-				//
-				// RFC2616 Section 4.2 says: Multiple message-header fields with the
-				// same field-name MAY be present in a message if and only if the
-				// entire field-value for that header field is defined as a
-				// comma-separated list [i.e., #(values)]. It MUST be possible to
-				// combine the multiple header fields into one "field-name:
-				// field-value" pair, without changing the semantics of the message,
-				// by appending each subsequent field-value to the first, each
-				// separated by a comma.
-				//
-				// But I haven't found anything that does that except Envoy when
-				// generating a CheckRequest.  Go's http server, for example, treats:
-				//
-				//   Authorization: foo,bar
-				//
-				// very differently from:
-				//
-				//   Authorization: foo
-				//   Authorization: bar
-				//
-				// I suppose this is unlikely to matter in any case that we care
-				// about.  Nobody is really sending multiple Authorization headers,
-				// and if one of them is for us, we consume that and only set a
-				// single Authorization header on the upstream request, so that case
-				// works OK.  Cookies we handle specially, because whoever invented
-				// Cookies did not care for RFC2616.  RFC7230 at least mentions that
-				// (and revises the above text about separators to make it somewhat
-				// clear you can't do it in general.)
-				joined := strings.Join(v, ",")
-				if k == "Cookie" {
-					// RFC 6265 4.2.1: ...the user agent will send a Cookie
-					// header that conforms to the following grammar:
-					// cookie-header = "Cookie:" OWS cookie-string OWS
-					// cookie-string = cookie-pair *( ";" SP cookie-pair )
-					joined = strings.Join(v, "; ")
-				}
-				allow.Headers = append(allow.Headers, &envoy_config_core_v3.HeaderValueOption{
+			deny.Body = fmt.Sprintf("Not authorized.  Redirecting you to %q", denyRed.GetRedirectUrl())
+			deny.Headers = []*envoy_config_core_v3.HeaderValueOption{
+				{
+					Header: &envoy_config_core_v3.HeaderValue{
+						Key:   "content-type",
+						Value: "text/plain",
+					},
 					Append: &wrapperspb.BoolValue{
 						Value: false,
 					},
+				},
+				{
 					Header: &envoy_config_core_v3.HeaderValue{
-						Key:   k,
-						Value: joined,
+						Key:   "location",
+						Value: denyRed.GetRedirectUrl(),
 					},
-				})
-			}
-			if h := s.UsernameHeader; h != "" {
-				allow.Headers = append(allow.Headers, &envoy_config_core_v3.HeaderValueOption{
 					Append: &wrapperspb.BoolValue{
 						Value: false,
 					},
-					Header: &envoy_config_core_v3.HeaderValue{
-						Key:   h,
-						Value: allowRes.GetUsername(),
-					},
-				})
+				},
 			}
-		case *jssopb.AuthorizeHTTPReply_Deny:
-			deny := &envoy_auth.DeniedHttpResponse{}
-			reply.Status = &protostatus.Status{
-				Code: int32(codes.PermissionDenied),
+		case *jssopb.Deny_Response_:
+			denyRes := decision.Deny.GetResponse()
+			deny.Status = &envoy_type_v3.HttpStatus{
+				Code: envoy_type_v3.StatusCode_Forbidden,
 			}
-			reply.HttpResponse = &envoy_auth.CheckResponse_DeniedResponse{
-				DeniedResponse: deny,
+			if code := denyRes.GetStatusCode(); code != 0 {
+				deny.Status.Code = envoy_type_v3.StatusCode(code)
 			}
-			switch decision.Deny.GetDestination().(type) {
-			case *jssopb.Deny_Redirect_:
-				denyRed := decision.Deny.GetRedirect()
-				deny.Status = &envoy_type_v3.HttpStatus{
-					Code: envoy_type_v3.StatusCode_TemporaryRedirect,
-				}
-				deny.Body = fmt.Sprintf("Not authorized.  Redirecting you to %q", denyRed.GetRedirectUrl())
-				deny.Headers = []*envoy_config_core_v3.HeaderValueOption{
-					{
-						Header: &envoy_config_core_v3.HeaderValue{
-							Key:   "content-type",
-							Value: "text/plain",
-						},
-						Append: &wrapperspb.BoolValue{
-							Value: false,
-						},
-					},
-					{
-						Header: &envoy_config_core_v3.HeaderValue{
-							Key:   "location",
-							Value: denyRed.GetRedirectUrl(),
-						},
-						Append: &wrapperspb.BoolValue{
-							Value: false,
-						},
+			deny.Body = denyRes.GetBody()
+			deny.Headers = []*envoy_config_core_v3.HeaderValueOption{
+				{
+					Header: &envoy_config_core_v3.HeaderValue{
+						Key:   "content-type",
+						Value: denyRes.GetContentType(),
 					},
-				}
-			case *jssopb.Deny_Response_:
-				denyRes := decision.Deny.GetResponse()
-				deny.Status = &envoy_type_v3.HttpStatus{
-					Code: envoy_type_v3.StatusCode_Forbidden,
-				}
-				deny.Body = denyRes.GetBody()
-				deny.Headers = []*envoy_config_core_v3.HeaderValueOption{
-					{
-						Header: &envoy_config_core_v3.HeaderValue{
-							Key:   "content-type",
-							Value: denyRes.GetContentType(),
-						},
-						Append: &wrapperspb.BoolValue{
-							Value: false,
-						},
+					Append: &wrapperspb.BoolValue{
+						Value: false,
 					},
+				},
+			}
+		}
+		for _, h := range decision.Deny.GetAddHeaders() {
+			deny.Headers = append(deny.Headers, &envoy_config_core_v3.HeaderValueOption{
+				Header: &envoy_config_core_v3.HeaderValue{
+					Key:   h.GetKey(),
+					Value: h.GetValue(),
+				},
+				Append: &wrapperspb.BoolValue{
+					Value: true,
+				},
+			})
+		}
+	}
+	return reply, nil
+}
+
+// authorize calls AuthorizeHTTP according to the provided policy, returning a gRPC status error if
+// no attempt succeeds.
+func (s *Service) authorize(ctx context.Context, policy Policy, req *jssopb.AuthorizeHTTPRequest) (*jssopb.AuthorizeHTTPReply, error) {
+	if policy.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, policy.Timeout)
+		defer cancel()
+	}
+	var errs []string
+	for i := 0; i < policy.MaxAttempts; i++ {
+		if i > 0 {
+			t := time.NewTimer(policy.RetryBackoff)
+			select {
+			case <-t.C:
+			case <-ctx.Done():
+				t.Stop()
+				var code = codes.Unknown
+				switch ctx.Err() {
+				case context.DeadlineExceeded:
+					code = codes.DeadlineExceeded
+				case context.Canceled:
+					code = codes.Canceled
 				}
+				return nil, status.Error(code, fmt.Sprintf("authorization check failed after %d tries: %v", i, errs))
 			}
 		}
-		return reply, nil
+		if err := s.Breaker.Allow(); err != nil {
+			breakerRejections.Inc()
+			errs = append(errs, fmt.Sprintf("[%v]", err))
+			break
+		}
+		if i > 0 {
+			authorizeRetries.Inc()
+		}
+		start := time.Now()
+		auth, err := s.SessionClient.AuthorizeHTTP(ctx, req)
+		authorizeSeconds.WithLabelValues(status.Code(err).String()).Observe(time.Since(start).Seconds())
+		s.Breaker.Record(err)
+		if err == nil {
+			return auth, nil
+		}
+		errs = append(errs, fmt.Sprintf("[call remote AuthorizeHTTP: %v]", err))
 	}
+	return nil, status.Error(codes.Unavailable, fmt.Sprintf("authorization check failed after %d tries: %v", len(errs), errs))
+}
 
-	msg := fmt.Sprintf("authorization check failed after %d tries: %v", maxRetries, errs)
+// failOpen returns a response that lets a request through without authenticating it.  Credentials
+// and identity headers are removed, so that upstream applications can't mistake the request for an
+// authenticated one.
+func (s *Service) failOpen() *envoy_auth.CheckResponse {
+	remove := []string{"authorization", "cookie", assertionHeader}
+	if h := s.UsernameHeader; h != "" {
+		remove = append(remove, h)
+	}
 	return &envoy_auth.CheckResponse{
-		HttpResponse: &envoy_auth.CheckResponse_DeniedResponse{
-			DeniedResponse: &envoy_auth.DeniedHttpResponse{
-				Status: &envoy_type_v3.HttpStatus{
-					Code: envoy_type_v3.StatusCode_ServiceUnavailable,
-				},
-				Body: msg,
+		Status: &protostatus.Status{
+			Code: int32(codes.OK),
+		},
+		HttpResponse: &envoy_auth.CheckResponse_OkResponse{
+			OkResponse: &envoy_auth.OkHttpResponse{
 				Headers: []*envoy_config_core_v3.HeaderValueOption{
 					{
+						Append: &wrapperspb.BoolValue{
+							Value: false,
+						},
 						Header: &envoy_config_core_v3.HeaderValue{
-							Key:   "content-type",
-							Value: "text-plain",
+							Key:   FailOpenHeader,
+							Value: "true",
 						},
 					},
 				},
+				HeadersToRemove: remove,
 			},
 		},
-	}, status.Error(codes.Unavailable, msg)
+		DynamicMetadata: dynamicMetadata(map[string]*structpb.Value{
+			"fail_open": structpb.NewBoolValue(true),
+		}),
+	}
 }
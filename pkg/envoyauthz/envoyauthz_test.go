@@ -0,0 +1,742 @@
+package envoyauthz
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	envoy_auth "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	envoy_type_v3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"github.com/google/go-cmp/cmp"
+	"github.com/jrockway/jsso2/pkg/jssopb"
+	"github.com/jrockway/jsso2/pkg/redirecttokens"
+	"github.com/jrockway/jsso2/pkg/types"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/testing/protocmp"
+)
+
+// fakeSessionClient records the request it's called with and returns err, reply, or if both are
+// nil, denies the request with a redirect.
+type fakeSessionClient struct {
+	req   *jssopb.AuthorizeHTTPRequest
+	reply *jssopb.AuthorizeHTTPReply
+	err   error
+	calls int
+	span  opentracing.Span // The span in the context of the last call.
+}
+
+func (c *fakeSessionClient) AuthorizeHTTP(ctx context.Context, req *jssopb.AuthorizeHTTPRequest, opts ...grpc.CallOption) (*jssopb.AuthorizeHTTPReply, error) {
+	c.req = req
+	c.calls++
+	c.span = opentracing.SpanFromContext(ctx)
+	if c.err != nil {
+		return nil, c.err
+	}
+	if c.reply != nil {
+		return c.reply, nil
+	}
+	return &jssopb.AuthorizeHTTPReply{
+		Decision: &jssopb.AuthorizeHTTPReply_Deny{
+			Deny: &jssopb.Deny{
+				Destination: &jssopb.Deny_Redirect_{
+					Redirect: &jssopb.Deny_Redirect{
+						RedirectUrl: "https://sso.example.com/login?redirect=" + url.QueryEscape(req.GetRequestUri()),
+					},
+				},
+			},
+		},
+	}, nil
+}
+
+func TestRequestURL(t *testing.T) {
+	testData := []struct {
+		name      string
+		path      string
+		query     string
+		fragment  string
+		want      string
+		wantPath  string
+		wantQuery url.Values
+	}{
+		{
+			name:     "plain",
+			path:     "/foo/bar",
+			want:     "https://app.example.com/foo/bar",
+			wantPath: "/foo/bar",
+		},
+		{
+			name:      "query",
+			path:      "/search?q=foo&page=2",
+			want:      "https://app.example.com/search?q=foo&page=2",
+			wantPath:  "/search",
+			wantQuery: url.Values{"q": {"foo"}, "page": {"2"}},
+		},
+		{
+			name:      "escaped query",
+			path:      "/d/abc?from=now-1h&var-host=a%2Cb&q=a+b%26c%3Dd",
+			want:      "https://app.example.com/d/abc?from=now-1h&var-host=a%2Cb&q=a+b%26c%3Dd",
+			wantPath:  "/d/abc",
+			wantQuery: url.Values{"from": {"now-1h"}, "var-host": {"a,b"}, "q": {"a b&c=d"}},
+		},
+		{
+			name:     "escaped slash",
+			path:     "/repos/a%2Fb/files",
+			want:     "https://app.example.com/repos/a%2Fb/files",
+			wantPath: "/repos/a/b/files",
+		},
+		{
+			name:      "escaped spaces and unicode",
+			path:      "/hello%20world/%E2%9C%93?x=%E2%9C%93",
+			want:      "https://app.example.com/hello%20world/%E2%9C%93?x=%E2%9C%93",
+			wantPath:  "/hello world/✓",
+			wantQuery: url.Values{"x": {"✓"}},
+		},
+		{
+			name:     "raw unicode",
+			path:     "/über",
+			want:     "https://app.example.com/%C3%BCber",
+			wantPath: "/über",
+		},
+		{
+			name:     "path params",
+			path:     "/a;b=c/d",
+			want:     "https://app.example.com/a;b=c/d",
+			wantPath: "/a;b=c/d",
+		},
+		{
+			name:     "empty query",
+			path:     "/foo?",
+			want:     "https://app.example.com/foo?",
+			wantPath: "/foo",
+		},
+		{
+			name:     "fragment",
+			path:     "/foo?a=b#section-2",
+			want:     "https://app.example.com/foo?a=b#section-2",
+			wantPath: "/foo",
+			wantQuery: url.Values{
+				"a": {"b"},
+			},
+		},
+		{
+			name:      "separate query and fragment",
+			path:      "/foo",
+			query:     "a=b",
+			fragment:  "top",
+			want:      "https://app.example.com/foo?a=b#top",
+			wantPath:  "/foo",
+			wantQuery: url.Values{"a": {"b"}},
+		},
+		{
+			name:     "path that looks like a host",
+			path:     "//evil.example.com/x",
+			want:     "https://app.example.com//evil.example.com/x",
+			wantPath: "//evil.example.com/x",
+		},
+		{
+			name:      "absolute form",
+			path:      "http://evil.example.com/x%2Fy?q=1",
+			want:      "https://app.example.com/x%2Fy?q=1",
+			wantPath:  "/x/y",
+			wantQuery: url.Values{"q": {"1"}},
+		},
+	}
+
+	redirects := new(redirecttokens.Config)
+	if err := redirects.SetKey([]byte("XXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXX")); err != nil {
+		t.Fatal(err)
+	}
+	session := &types.Session{Id: []byte("login session")}
+
+	for _, test := range testData {
+		t.Run(test.name, func(t *testing.T) {
+			client := &fakeSessionClient{}
+			s := &Service{SessionClient: client}
+			reply, err := s.Check(context.Background(), &envoy_auth.CheckRequest{
+				Attributes: &envoy_auth.AttributeContext{
+					Request: &envoy_auth.AttributeContext_Request{
+						Http: &envoy_auth.AttributeContext_HttpRequest{
+							Method:   "GET",
+							Host:     "app.example.com",
+							Path:     test.path,
+							Query:    test.query,
+							Fragment: test.fragment,
+							Headers:  map[string]string{"x-forwarded-proto": "https"},
+						},
+					},
+				},
+			})
+			if err != nil {
+				t.Fatalf("check: %v", err)
+			}
+			if got, want := reply.GetDeniedResponse().GetStatus().GetCode(), envoy_type_v3.StatusCode_TemporaryRedirect; got != want {
+				t.Errorf("status:\n  got: %v\n want: %v", got, want)
+			}
+			uri := client.req.GetRequestUri()
+			if got, want := uri, test.want; got != want {
+				t.Errorf("request uri:\n  got: %v\n want: %v", got, want)
+			}
+
+			// This is what the session service's policy sees.
+			u, err := url.Parse(uri)
+			if err != nil {
+				t.Fatalf("parse request uri: %v", err)
+			}
+			if got, want := u.Host, "app.example.com"; got != want {
+				t.Errorf("host:\n  got: %v\n want: %v", got, want)
+			}
+			if got, want := u.Path, test.wantPath; got != want {
+				t.Errorf("path:\n  got: %v\n want: %v", got, want)
+			}
+			if got, want := u.Query().Encode(), test.wantQuery.Encode(); got != want {
+				t.Errorf("query:\n  got: %v\n want: %v", got, want)
+			}
+			if got, want := u.String(), uri; got != want {
+				t.Errorf("reparsed uri:\n  got: %v\n want: %v", got, want)
+			}
+
+			// And this is where the user ends up after logging in.
+			token, err := redirects.New(u.String(), "GET", []byte("browser nonce"))
+			if err != nil {
+				t.Fatalf("new redirect token: %v", err)
+			}
+			if token, err = redirects.Bind(token, session, nil, []byte("browser nonce")); err != nil {
+				t.Fatalf("bind redirect token: %v", err)
+			}
+			redirect, err := redirects.Verify(token, session, nil)
+			if err != nil {
+				t.Fatalf("verify redirect token: %v", err)
+			}
+			if got, want := redirect.GetUri(), test.want; got != want {
+				t.Errorf("redirect uri:\n  got: %v\n want: %v", got, want)
+			}
+		})
+	}
+}
+
+func TestRequestURLErrors(t *testing.T) {
+	for _, path := range []string{"*", "foo", "/bad%zzescape"} {
+		client := &fakeSessionClient{}
+		s := &Service{SessionClient: client}
+		reply, err := s.Check(context.Background(), &envoy_auth.CheckRequest{
+			Attributes: &envoy_auth.AttributeContext{
+				Request: &envoy_auth.AttributeContext_Request{
+					Http: &envoy_auth.AttributeContext_HttpRequest{
+						Method: "GET",
+						Host:   "app.example.com",
+						Path:   path,
+					},
+				},
+			},
+		})
+		if err != nil {
+			t.Errorf("path %q: check: %v", path, err)
+			continue
+		}
+		if got, want := reply.GetDeniedResponse().GetStatus().GetCode(), envoy_type_v3.StatusCode_BadRequest; got != want {
+			t.Errorf("path %q: status:\n  got: %v\n want: %v", path, got, want)
+		}
+		if client.req != nil {
+			t.Errorf("path %q: unexpectedly asked the session service about the request", path)
+		}
+	}
+}
+
+func TestDenyResponse(t *testing.T) {
+	client := &fakeSessionClient{
+		reply: &jssopb.AuthorizeHTTPReply{
+			Decision: &jssopb.AuthorizeHTTPReply_Deny{
+				Deny: &jssopb.Deny{
+					Destination: &jssopb.Deny_Response_{
+						Response: &jssopb.Deny_Response{
+							ContentType: "application/json",
+							Body:        `{"error":"login required"}`,
+							StatusCode:  401,
+						},
+					},
+					AddHeaders: []*types.Header{
+						{Key: "set-cookie", Value: "jsso-session-id-browser-nonce=nonce"},
+					},
+				},
+			},
+		},
+	}
+	s := &Service{SessionClient: client}
+	reply, err := s.Check(context.Background(), &envoy_auth.CheckRequest{
+		Attributes: &envoy_auth.AttributeContext{
+			Request: &envoy_auth.AttributeContext_Request{
+				Http: &envoy_auth.AttributeContext_HttpRequest{
+					Method: "GET",
+					Host:   "app.example.com",
+					Path:   "/api/things",
+					Headers: map[string]string{
+						"accept":        "application/json",
+						"authorization": "Bearer foo",
+						"cookie":        "foo=bar",
+						"user-agent":    "test",
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("check: %v", err)
+	}
+
+	wantHeaders := []*types.Header{
+		{Key: "accept", Value: "application/json"},
+		{Key: "user-agent", Value: "test"},
+	}
+	if diff := cmp.Diff(client.req.GetHeaders(), wantHeaders, protocmp.Transform()); diff != "" {
+		t.Errorf("headers sent to the session service (-got +want):\n%s", diff)
+	}
+
+	deny := reply.GetDeniedResponse()
+	if got, want := deny.GetStatus().GetCode(), envoy_type_v3.StatusCode_Unauthorized; got != want {
+		t.Errorf("status:\n  got: %v\n want: %v", got, want)
+	}
+	if got, want := deny.GetBody(), `{"error":"login required"}`; got != want {
+		t.Errorf("body:\n  got: %v\n want: %v", got, want)
+	}
+	if got, want := deny.GetHeaders()[0].GetHeader().GetValue(), "application/json"; got != want {
+		t.Errorf("content-type:\n  got: %v\n want: %v", got, want)
+	}
+	if got, want := deny.GetHeaders()[len(deny.GetHeaders())-1].GetHeader().GetValue(), "jsso-session-id-browser-nonce=nonce"; got != want {
+		t.Errorf("set-cookie:\n  got: %v\n want: %v", got, want)
+	}
+}
+
+func TestAssertionHeader(t *testing.T) {
+	testData := []struct {
+		name       string
+		addHeaders []*types.Header
+		wantRemove []string
+		wantSet    string
+	}{
+		{
+			name:       "no assertion issued",
+			wantRemove: []string{"cookie", "authorization", assertionHeader, FailOpenHeader},
+		},
+		{
+			name:       "assertion issued",
+			addHeaders: []*types.Header{{Key: assertionHeader, Value: "signed"}},
+			wantRemove: []string{"cookie", "authorization", FailOpenHeader},
+			wantSet:    "signed",
+		},
+	}
+	for _, test := range testData {
+		t.Run(test.name, func(t *testing.T) {
+			client := &fakeSessionClient{
+				reply: &jssopb.AuthorizeHTTPReply{
+					Decision: &jssopb.AuthorizeHTTPReply_Allow{
+						Allow: &jssopb.Allow{Username: "alice", AddHeaders: test.addHeaders},
+					},
+				},
+			}
+			s := &Service{SessionClient: client}
+			reply, err := s.Check(context.Background(), &envoy_auth.CheckRequest{
+				Attributes: &envoy_auth.AttributeContext{
+					Request: &envoy_auth.AttributeContext_Request{
+						Http: &envoy_auth.AttributeContext_HttpRequest{
+							Method: "GET",
+							Host:   "app.example.com",
+							Path:   "/",
+							Headers: map[string]string{
+								"cookie":        "jsso-session-id=foo",
+								assertionHeader: "forged",
+							},
+						},
+					},
+				},
+			})
+			if err != nil {
+				t.Fatalf("check: %v", err)
+			}
+			ok := reply.GetOkResponse()
+			if diff := cmp.Diff(ok.GetHeadersToRemove(), test.wantRemove); diff != "" {
+				t.Errorf("removed headers (-got +want):\n%s", diff)
+			}
+			var gotSet string
+			for _, h := range ok.GetHeaders() {
+				if strings.EqualFold(h.GetHeader().GetKey(), assertionHeader) {
+					gotSet = h.GetHeader().GetValue()
+				}
+			}
+			if got, want := gotSet, test.wantSet; got != want {
+				t.Errorf("assertion header sent upstream:\n  got: %v\n want: %v", got, want)
+			}
+		})
+	}
+}
+
+func TestDynamicMetadata(t *testing.T) {
+	testData := []struct {
+		name  string
+		reply *jssopb.AuthorizeHTTPReply
+		err   error
+		ext   map[string]string
+		want  map[string]interface{}
+	}{
+		{
+			name: "allow",
+			reply: &jssopb.AuthorizeHTTPReply{
+				Decision: &jssopb.AuthorizeHTTPReply_Allow{
+					Allow: &jssopb.Allow{
+						Username:      "alice",
+						UserId:        42,
+						Groups:        []string{"admins", "users"},
+						SessionHandle: "0123456789abcdef",
+						BearerToken:   "secret",
+					},
+				},
+			},
+			want: map[string]interface{}{
+				"username":       "alice",
+				"user_id":        float64(42),
+				"groups":         []interface{}{"admins", "users"},
+				"session_handle": "0123456789abcdef",
+			},
+		},
+		{
+			name: "deny",
+			reply: &jssopb.AuthorizeHTTPReply{
+				Decision: &jssopb.AuthorizeHTTPReply_Deny{
+					Deny: &jssopb.Deny{
+						Reason:   "session expired",
+						Category: jssopb.Deny_INVALID_CREDENTIALS,
+					},
+				},
+			},
+			want: map[string]interface{}{
+				"deny_reason": "invalid_credentials",
+			},
+		},
+		{
+			name: "fail open",
+			err:  status.Error(codes.Unavailable, "jsso2 is down"),
+			ext:  map[string]string{MaxAttemptsKey: "1", FailureModeKey: "open"},
+			want: map[string]interface{}{
+				"fail_open": true,
+			},
+		},
+	}
+	for _, test := range testData {
+		t.Run(test.name, func(t *testing.T) {
+			client := &fakeSessionClient{reply: test.reply, err: test.err}
+			s := &Service{SessionClient: client}
+			reply, err := s.Check(context.Background(), &envoy_auth.CheckRequest{
+				Attributes: &envoy_auth.AttributeContext{
+					Request: &envoy_auth.AttributeContext_Request{
+						Http: &envoy_auth.AttributeContext_HttpRequest{
+							Method: "GET",
+							Host:   "app.example.com",
+							Path:   "/",
+						},
+					},
+					ContextExtensions: test.ext,
+				},
+			})
+			if err != nil {
+				t.Fatalf("check: %v", err)
+			}
+			md := reply.GetDynamicMetadata().AsMap()
+			if diff := cmp.Diff(md, map[string]interface{}{MetadataNamespace: test.want}); diff != "" {
+				t.Errorf("dynamic metadata (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestFailureModes(t *testing.T) {
+	testData := []struct {
+		name       string
+		ext        map[string]string
+		wantCalls  int
+		wantStatus envoy_type_v3.StatusCode
+		wantErr    bool
+	}{
+		{
+			name:       "default",
+			wantCalls:  3,
+			wantStatus: envoy_type_v3.StatusCode_ServiceUnavailable,
+			wantErr:    true,
+		},
+		{
+			name:       "one attempt",
+			ext:        map[string]string{MaxAttemptsKey: "1"},
+			wantCalls:  1,
+			wantStatus: envoy_type_v3.StatusCode_ServiceUnavailable,
+			wantErr:    true,
+		},
+		{
+			name:       "timeout",
+			ext:        map[string]string{MaxAttemptsKey: "100", RetryBackoffKey: "1s", TimeoutKey: "10ms"},
+			wantCalls:  1,
+			wantStatus: envoy_type_v3.StatusCode_ServiceUnavailable,
+			wantErr:    true,
+		},
+		{
+			name:      "fail open",
+			ext:       map[string]string{FailureModeKey: "open", RetryBackoffKey: "0s"},
+			wantCalls: 3,
+		},
+		{
+			name:       "invalid settings",
+			ext:        map[string]string{FailureModeKey: "sideways"},
+			wantStatus: envoy_type_v3.StatusCode_InternalServerError,
+			wantErr:    true,
+		},
+	}
+	for _, test := range testData {
+		t.Run(test.name, func(t *testing.T) {
+			client := &fakeSessionClient{err: status.Error(codes.Unavailable, "jsso2 is down")}
+			s := &Service{SessionClient: client, UsernameHeader: "x-username"}
+			reply, err := s.Check(context.Background(), &envoy_auth.CheckRequest{
+				Attributes: &envoy_auth.AttributeContext{
+					Request: &envoy_auth.AttributeContext_Request{
+						Http: &envoy_auth.AttributeContext_HttpRequest{
+							Method: "GET",
+							Host:   "status.example.com",
+							Path:   "/",
+							Headers: map[string]string{
+								"cookie":     "jsso-session-id=foo",
+								"x-username": "root",
+							},
+						},
+					},
+					ContextExtensions: test.ext,
+				},
+			})
+			if got, want := err != nil, test.wantErr; got != want {
+				t.Errorf("error: got %v, want error: %v", err, want)
+			}
+			if got, want := client.calls, test.wantCalls; got != want {
+				t.Errorf("calls:\n  got: %v\n want: %v", got, want)
+			}
+			if test.wantStatus != 0 {
+				if got, want := reply.GetDeniedResponse().GetStatus().GetCode(), test.wantStatus; got != want {
+					t.Errorf("status:\n  got: %v\n want: %v", got, want)
+				}
+				return
+			}
+			ok := reply.GetOkResponse()
+			if ok == nil {
+				t.Fatalf("expected request to be allowed; got %v", reply)
+			}
+			if got, want := ok.GetHeaders()[0].GetHeader().GetKey(), FailOpenHeader; got != want {
+				t.Errorf("added header:\n  got: %v\n want: %v", got, want)
+			}
+			want := []string{"authorization", "cookie", assertionHeader, "x-username"}
+			if diff := cmp.Diff(ok.GetHeadersToRemove(), want); diff != "" {
+				t.Errorf("removed headers (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestBreakerFailsFast(t *testing.T) {
+	client := &fakeSessionClient{err: status.Error(codes.Unavailable, "jsso2 is down")}
+	s := &Service{
+		SessionClient: client,
+		Policy:        &Policy{MaxAttempts: 3},
+		Breaker:       &Breaker{Threshold: 2, Cooldown: time.Hour},
+	}
+	req := &envoy_auth.CheckRequest{
+		Attributes: &envoy_auth.AttributeContext{
+			Request: &envoy_auth.AttributeContext_Request{
+				Http: &envoy_auth.AttributeContext_HttpRequest{
+					Method: "GET",
+					Host:   "app.example.com",
+					Path:   "/",
+				},
+			},
+		},
+	}
+	if _, err := s.Check(context.Background(), req); err == nil {
+		t.Fatal("expected error")
+	}
+	if got, want := client.calls, 2; got != want {
+		t.Errorf("calls after first check:\n  got: %v\n want: %v", got, want)
+	}
+	if _, err := s.Check(context.Background(), req); err == nil {
+		t.Fatal("expected error")
+	}
+	if got, want := client.calls, 2; got != want {
+		t.Errorf("calls after second check:\n  got: %v\n want: %v", got, want)
+	}
+}
+
+func TestCachedDecisions(t *testing.T) {
+	now := time.Unix(0, 0)
+	client := &fakeSessionClient{reply: allowUser("alice")}
+	s := &Service{
+		SessionClient: client,
+		Policy:        &Policy{MaxAttempts: 1},
+		Cache: &Cache{
+			TTL:      time.Second,
+			StaleTTL: time.Minute,
+			now:      func() time.Time { return now },
+		},
+	}
+	check := func(t *testing.T, cookie string) (*envoy_auth.CheckResponse, error) {
+		t.Helper()
+		return s.Check(context.Background(), &envoy_auth.CheckRequest{
+			Attributes: &envoy_auth.AttributeContext{
+				Request: &envoy_auth.AttributeContext_Request{
+					Http: &envoy_auth.AttributeContext_HttpRequest{
+						Method:  "GET",
+						Host:    "app.example.com",
+						Path:    "/",
+						Headers: map[string]string{"cookie": cookie},
+					},
+				},
+			},
+		})
+	}
+	allowed := func(t *testing.T, reply *envoy_auth.CheckResponse, err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("check: %v", err)
+		}
+		if reply.GetOkResponse() == nil {
+			t.Fatalf("expected request to be allowed; got %v", reply)
+		}
+	}
+
+	reply, err := check(t, "jsso-session-id=alice")
+	allowed(t, reply, err)
+	reply, err = check(t, "jsso-session-id=alice")
+	allowed(t, reply, err)
+	if got, want := client.calls, 1; got != want {
+		t.Errorf("calls after a cached check:\n  got: %v\n want: %v", got, want)
+	}
+
+	// Once the decision expires, it's only used if the session service is down.
+	now = now.Add(2 * time.Second)
+	client.err = status.Error(codes.Unavailable, "jsso2 is down")
+	reply, err = check(t, "jsso-session-id=alice")
+	allowed(t, reply, err)
+	if got, want := client.calls, 2; got != want {
+		t.Errorf("calls after an expired check:\n  got: %v\n want: %v", got, want)
+	}
+	if _, err := check(t, "jsso-session-id=bob"); err == nil {
+		t.Error("uncached check while the session service is down: expected error")
+	}
+
+	now = now.Add(time.Hour)
+	if _, err := check(t, "jsso-session-id=alice"); err == nil {
+		t.Error("check after the stale decision expired: expected error")
+	}
+}
+
+func TestTracing(t *testing.T) {
+	tracer := mocktracer.New()
+	opentracing.SetGlobalTracer(tracer)
+	defer opentracing.SetGlobalTracer(opentracing.NoopTracer{})
+
+	// The span of the HTTP request that Envoy is checking.
+	requestSpan := tracer.StartSpan("ingress")
+	h := http.Header{}
+	if err := tracer.Inject(requestSpan.Context(), opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(h)); err != nil {
+		t.Fatalf("inject: %v", err)
+	}
+	headers := map[string]string{}
+	for k := range h {
+		headers[strings.ToLower(k)] = h.Get(k)
+	}
+	// The span of Envoy's call to Check.
+	grpcSpan := tracer.StartSpan("ext_authz")
+	ctx := opentracing.ContextWithSpan(context.Background(), grpcSpan)
+
+	client := &fakeSessionClient{}
+	s := &Service{SessionClient: client}
+	if _, err := s.Check(ctx, &envoy_auth.CheckRequest{
+		Attributes: &envoy_auth.AttributeContext{
+			Request: &envoy_auth.AttributeContext_Request{
+				Http: &envoy_auth.AttributeContext_HttpRequest{
+					Method:  "GET",
+					Host:    "app.example.com",
+					Path:    "/",
+					Headers: headers,
+				},
+			},
+		},
+	}); err != nil {
+		t.Fatalf("check: %v", err)
+	}
+
+	spans := tracer.FinishedSpans()
+	if got, want := len(spans), 1; got != want {
+		t.Fatalf("finished spans:\n  got: %v\n want: %v", got, want)
+	}
+	check := spans[0]
+	if got, want := check.ParentID, requestSpan.Context().(mocktracer.MockSpanContext).SpanID; got != want {
+		t.Errorf("parent of check span:\n  got: %v\n want: %v", got, want)
+	}
+	if got, want := check.Tag("decision"), "deny"; got != want {
+		t.Errorf("decision tag:\n  got: %v\n want: %v", got, want)
+	}
+	if client.span == nil {
+		t.Fatal("AuthorizeHTTP was called without a span")
+	}
+	if got, want := client.span.Context().(mocktracer.MockSpanContext).SpanID, check.SpanContext.SpanID; got != want {
+		t.Errorf("span passed to AuthorizeHTTP:\n  got: %v\n want: %v", got, want)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	count := func(decision, reason string) float64 {
+		return testutil.ToFloat64(checks.WithLabelValues(decision, reason))
+	}
+	policyDenials := count("deny", "policy")
+	unavailable := count("error", "Unavailable")
+	retries := testutil.ToFloat64(authorizeRetries)
+
+	client := &fakeSessionClient{
+		reply: &jssopb.AuthorizeHTTPReply{
+			Decision: &jssopb.AuthorizeHTTPReply_Deny{
+				Deny: &jssopb.Deny{
+					Category:    jssopb.Deny_POLICY,
+					Destination: &jssopb.Deny_Redirect_{Redirect: &jssopb.Deny_Redirect{}},
+				},
+			},
+		},
+	}
+	s := &Service{SessionClient: client, Policy: &Policy{MaxAttempts: 2}}
+	req := &envoy_auth.CheckRequest{
+		Attributes: &envoy_auth.AttributeContext{
+			Request: &envoy_auth.AttributeContext_Request{
+				Http: &envoy_auth.AttributeContext_HttpRequest{
+					Method: "GET",
+					Host:   "app.example.com",
+					Path:   "/",
+				},
+			},
+		},
+	}
+	if _, err := s.Check(context.Background(), req); err != nil {
+		t.Fatalf("check: %v", err)
+	}
+	client.err = status.Error(codes.Unavailable, "jsso2 is down")
+	if _, err := s.Check(context.Background(), req); err == nil {
+		t.Fatal("check while jsso2 is down: expected error")
+	}
+
+	if got, want := count("deny", "policy")-policyDenials, 1.0; got != want {
+		t.Errorf("policy denials:\n  got: %v\n want: %v", got, want)
+	}
+	if got, want := count("error", "Unavailable")-unavailable, 1.0; got != want {
+		t.Errorf("unavailable errors:\n  got: %v\n want: %v", got, want)
+	}
+	if got, want := testutil.ToFloat64(authorizeRetries)-retries, 1.0; got != want {
+		t.Errorf("retries:\n  got: %v\n want: %v", got, want)
+	}
+}
@@ -0,0 +1,94 @@
+package envoyauthz
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Keys of the context extensions that routes can set to override the default Policy.  In Envoy's
+// route configuration, they go in typed_per_filter_config:
+//
+//	envoy.filters.http.ext_authz:
+//	  "@type": type.googleapis.com/envoy.extensions.filters.http.ext_authz.v3.ExtAuthzPerRoute
+//	  check_settings:
+//	    context_extensions:
+//	      jsso2_failure_mode: open
+//	      jsso2_timeout: 50ms
+const (
+	MaxAttemptsKey  = "jsso2_max_attempts"  // An integer; how many times to call AuthorizeHTTP.
+	RetryBackoffKey = "jsso2_retry_backoff" // A duration; how long to wait between attempts.
+	TimeoutKey      = "jsso2_timeout"       // A duration; the deadline for all attempts together.
+	FailureModeKey  = "jsso2_failure_mode"  // "open" or "closed"; what to do if no attempt succeeds.
+)
+
+// FailOpenHeader is added to requests that were allowed because the authorization check could not
+// be completed on a route that fails open.  Such requests are not authenticated; the header lets
+// upstream applications and logs tell them apart from requests that were.
+const FailOpenHeader = "x-jsso2-fail-open"
+
+// Policy controls how hard Check tries to reach the session service, and what it does if it can't.
+type Policy struct {
+	MaxAttempts  int           // The number of times to call AuthorizeHTTP; at least 1.
+	RetryBackoff time.Duration // How long to wait between attempts.
+	Timeout      time.Duration // If non-zero, the deadline for all attempts, including backoff.
+	// If true, let requests through unauthenticated when the session service can't be reached.
+	// This is only appropriate for low-risk routes, like read-only status pages.
+	FailOpen bool
+}
+
+// DefaultPolicy is used when a Service has no Policy of its own.
+var DefaultPolicy = Policy{
+	MaxAttempts:  3,
+	RetryBackoff: 10 * time.Millisecond,
+}
+
+// WithExtensions returns a copy of the policy with any settings in the provided context extensions
+// applied.
+func (p Policy) WithExtensions(ext map[string]string) (Policy, error) {
+	if v, ok := ext[MaxAttemptsKey]; ok {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return p, fmt.Errorf("parse %s: %w", MaxAttemptsKey, err)
+		}
+		if n < 1 {
+			return p, fmt.Errorf("%s must be at least 1; got %d", MaxAttemptsKey, n)
+		}
+		p.MaxAttempts = n
+	}
+	if v, ok := ext[RetryBackoffKey]; ok {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return p, fmt.Errorf("parse %s: %w", RetryBackoffKey, err)
+		}
+		if d < 0 {
+			return p, fmt.Errorf("%s must not be negative; got %v", RetryBackoffKey, d)
+		}
+		p.RetryBackoff = d
+	}
+	if v, ok := ext[TimeoutKey]; ok {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return p, fmt.Errorf("parse %s: %w", TimeoutKey, err)
+		}
+		if d < 0 {
+			return p, fmt.Errorf("%s must not be negative; got %v", TimeoutKey, d)
+		}
+		p.Timeout = d
+	}
+	if v, ok := ext[FailureModeKey]; ok {
+		switch v {
+		case "open":
+			p.FailOpen = true
+		case "closed":
+			p.FailOpen = false
+		default:
+			return p, fmt.Errorf("%s must be open or closed; got %q", FailureModeKey, v)
+		}
+	}
+	if p.MaxAttempts < 1 {
+		return p, errors.New("max attempts must be at least 1")
+	}
+	return p, nil
+}
@@ -0,0 +1,89 @@
+package envoyauthz
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWithExtensions(t *testing.T) {
+	testData := []struct {
+		name    string
+		ext     map[string]string
+		want    Policy
+		wantErr bool
+	}{
+		{
+			name: "no extensions",
+			want: DefaultPolicy,
+		},
+		{
+			name: "unrelated extensions",
+			ext:  map[string]string{"foo": "bar"},
+			want: DefaultPolicy,
+		},
+		{
+			name: "everything",
+			ext: map[string]string{
+				MaxAttemptsKey:  "1",
+				RetryBackoffKey: "1ms",
+				TimeoutKey:      "50ms",
+				FailureModeKey:  "open",
+			},
+			want: Policy{
+				MaxAttempts:  1,
+				RetryBackoff: time.Millisecond,
+				Timeout:      50 * time.Millisecond,
+				FailOpen:     true,
+			},
+		},
+		{
+			name: "fail closed",
+			ext:  map[string]string{FailureModeKey: "closed"},
+			want: DefaultPolicy,
+		},
+		{
+			name:    "zero attempts",
+			ext:     map[string]string{MaxAttemptsKey: "0"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid attempts",
+			ext:     map[string]string{MaxAttemptsKey: "lots"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid backoff",
+			ext:     map[string]string{RetryBackoffKey: "10"},
+			wantErr: true,
+		},
+		{
+			name:    "negative timeout",
+			ext:     map[string]string{TimeoutKey: "-1s"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid failure mode",
+			ext:     map[string]string{FailureModeKey: "yes"},
+			wantErr: true,
+		},
+	}
+	for _, test := range testData {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := DefaultPolicy.WithExtensions(test.ext)
+			if test.wantErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(got, test.want); diff != "" {
+				t.Errorf("policy (-got +want):\n%s", diff)
+			}
+		})
+	}
+}
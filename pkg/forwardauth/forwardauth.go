@@ -0,0 +1,420 @@
+// Package forwardauth answers the authorization subrequests of reverse proxies that aren't Envoy:
+// nginx's auth_request module and Traefik's ForwardAuth middleware.  The proxy sends the handler
+// a copy of the request's headers, with the original URL in X-Original-URL, X-Original-URI, or
+// X-Forwarded-Proto/Host/Uri; a 2xx reply lets the request through, and anything else is sent to
+// the client.
+//
+// nginx only accepts 2xx, 401, and 403 from an auth_request subrequest, so requests that look like
+// they came from nginx (they have X-Original-URL or X-Original-URI) are redirected to the login
+// page with a 401 and a Location header, which nginx can turn into a real redirect.  Requests that
+// shouldn't be redirected (XHRs, fetches, and non-GET requests) are denied with a 401 that has no
+// Location header, so the redirect must only happen when there's somewhere to go; nginx replaces
+// the body of those 401s with its own error page.  Denials also set a cookie that ties the login
+// to the browser, which nginx only passes on if told to:
+//
+//	location / {
+//	    auth_request /forward-auth;
+//	    auth_request_set $jsso2_login $upstream_http_location;
+//	    auth_request_set $jsso2_cookie $upstream_http_set_cookie;
+//	    auth_request_set $jsso2_username $upstream_http_x_jsso2_username;
+//	    auth_request_set $jsso2_assertion $upstream_http_x_jsso2_assertion;
+//	    proxy_set_header X-JSSO2-Username $jsso2_username;
+//	    proxy_set_header X-JSSO2-Assertion $jsso2_assertion;
+//	    error_page 401 = @login;
+//	    ...
+//	}
+//	location = /forward-auth {
+//	    internal;
+//	    proxy_pass http://jsso2/forward-auth;
+//	    proxy_pass_request_body off;
+//	    proxy_set_header Content-Length "";
+//	    proxy_set_header X-Original-URI $request_uri;
+//	    proxy_set_header X-Original-Method $request_method;
+//	    proxy_set_header X-Forwarded-Proto $scheme;
+//	    proxy_set_header X-Forwarded-Host $host;
+//	    proxy_set_header X-Real-IP $remote_addr;
+//	}
+//	location @login {
+//	    add_header Set-Cookie $jsso2_cookie always;
+//	    if ($jsso2_login = "") {
+//	        return 401;
+//	    }
+//	    return 302 $jsso2_login;
+//	}
+//
+// Traefik passes any other reply through to the client, so everyone else gets an ordinary 302.
+// Traefik copies identity headers to the upstream request if they're listed in the middleware's
+// authResponseHeaders.
+//
+// The forwarded headers choose the URL that jsso2 authorizes, mints redirect tokens for, and signs
+// identity assertions for, so the handler only answers requests that come directly from one of
+// its TrustedProxies; the proxies must overwrite those headers on every subrequest.
+//
+// Unlike the Envoy adapter, neither proxy can remove headers from the upstream request, so the
+// jsso2 session cookie reaches upstream applications unless the proxy is configured to strip it.
+package forwardauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"github.com/jrockway/jsso2/pkg/jssopb"
+	"github.com/jrockway/jsso2/pkg/sessions"
+	"github.com/jrockway/jsso2/pkg/types"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Headers added to allowed requests' replies, for the proxy to copy to the upstream request.
+const (
+	UsernameHeader = "X-JSSO2-Username"
+	UserIDHeader   = "X-JSSO2-User-Id"
+)
+
+type Config struct {
+	Address        string `long:"jsso_server_address" env:"JSSO_SERVER_ADDRESS" description:"The URL of JSSO's gRPC server."`
+	TrustedProxies string `long:"trusted_proxies" env:"TRUSTED_PROXIES" description:"Comma-separated IP addresses or CIDR blocks of the ingress proxies that send forward-auth requests.  Requests from anywhere else are rejected, because their forwarded headers can't be trusted."`
+}
+
+// Handler returns the handler described by the config.
+func (c *Config) Handler(a Authorizer) (*Handler, error) {
+	proxies, err := ParseTrustedProxies(c.TrustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("parse trusted proxies: %w", err)
+	}
+	return &Handler{Authorizer: a, TrustedProxies: proxies}, nil
+}
+
+// ParseTrustedProxies parses a list of comma-separated IP addresses and CIDR blocks.
+func ParseTrustedProxies(s string) ([]*net.IPNet, error) {
+	var result []*net.IPNet
+	for i, part := range strings.Split(strings.TrimSpace(s), ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			return nil, fmt.Errorf("proxy %d: empty address", i)
+		}
+		if !strings.Contains(part, "/") {
+			ip := net.ParseIP(part)
+			if ip == nil {
+				return nil, fmt.Errorf("proxy %d: invalid ip address %q", i, part)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			result = append(result, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(part)
+		if err != nil {
+			return nil, fmt.Errorf("proxy %d: %w", i, err)
+		}
+		result = append(result, n)
+	}
+	return result, nil
+}
+
+// Authorizer decides whether a request may proceed.  session.Service is an Authorizer.
+type Authorizer interface {
+	AuthorizeHTTP(ctx context.Context, req *jssopb.AuthorizeHTTPRequest) (*jssopb.AuthorizeHTTPReply, error)
+}
+
+type clientAuthorizer struct {
+	c jssopb.SessionClient
+}
+
+func (a *clientAuthorizer) AuthorizeHTTP(ctx context.Context, req *jssopb.AuthorizeHTTPRequest) (*jssopb.AuthorizeHTTPReply, error) {
+	return a.c.AuthorizeHTTP(ctx, req)
+}
+
+// Client returns an Authorizer that asks a remote jsso2 server.
+func Client(c jssopb.SessionClient) Authorizer {
+	return &clientAuthorizer{c: c}
+}
+
+type inProcessAuthorizer struct {
+	a Authorizer
+}
+
+func (a *inProcessAuthorizer) AuthorizeHTTP(ctx context.Context, req *jssopb.AuthorizeHTTPRequest) (*jssopb.AuthorizeHTTPReply, error) {
+	return a.a.AuthorizeHTTP(sessions.NewContext(ctx, sessions.Anonymous()), req)
+}
+
+// InProcess returns an Authorizer that calls a session service running in the same process.  The
+// call is made as an anonymous proxy, as a gRPC call without credentials would be.
+func InProcess(a Authorizer) Authorizer {
+	return &inProcessAuthorizer{a: a}
+}
+
+// Handler is an http.Handler that answers forward-auth subrequests.
+type Handler struct {
+	Authorizer     Authorizer
+	TrustedProxies []*net.IPNet // The peers allowed to send requests; nobody if empty.
+}
+
+// trusted returns true if the request came directly from a trusted proxy.
+func (h *Handler) trusted(req *http.Request) bool {
+	return FromTrustedProxy(req, h.TrustedProxies)
+}
+
+// FromTrustedProxy returns true if the request's peer address is in one of the provided networks.
+func FromTrustedProxy(req *http.Request, proxies []*net.IPNet) bool {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, n := range proxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// RequestURL returns the URL of the request that the proxy is asking about.
+func RequestURL(req *http.Request) (*url.URL, error) {
+	if raw := req.Header.Get("X-Original-URL"); raw != "" {
+		u, err := url.ParseRequestURI(raw)
+		if err != nil {
+			return nil, fmt.Errorf("parse X-Original-URL: %w", err)
+		}
+		if !u.IsAbs() || u.Host == "" {
+			return nil, fmt.Errorf("X-Original-URL %q is not an absolute URL", raw)
+		}
+		return u, nil
+	}
+	target := req.Header.Get("X-Forwarded-Uri")
+	if target == "" {
+		target = req.Header.Get("X-Original-URI")
+	}
+	if target == "" {
+		return nil, errors.New("no X-Original-URL, X-Original-URI, or X-Forwarded-Uri header")
+	}
+	if !strings.HasPrefix(target, "/") {
+		return nil, fmt.Errorf("request path %q does not start with /", target)
+	}
+	u, err := url.ParseRequestURI(target)
+	if err != nil {
+		return nil, fmt.Errorf("parse request path: %w", err)
+	}
+	u.Scheme = req.Header.Get("X-Forwarded-Proto")
+	if u.Scheme == "" {
+		u.Scheme = "http"
+	}
+	u.Host = req.Header.Get("X-Forwarded-Host")
+	if u.Host == "" {
+		u.Host = req.Host
+	}
+	return u, nil
+}
+
+// requestMethod returns the method of the request that the proxy is asking about.
+func requestMethod(req *http.Request) string {
+	for _, h := range []string{"X-Forwarded-Method", "X-Original-Method"} {
+		if m := req.Header.Get(h); m != "" {
+			return m
+		}
+	}
+	return req.Method
+}
+
+// clientIP returns the address of the client that made the original request.
+func clientIP(req *http.Request) string {
+	if ip := req.Header.Get("X-Real-IP"); ip != "" {
+		return ip
+	}
+	if xff := req.Header.Get("X-Forwarded-For"); xff != "" {
+		return strings.TrimSpace(strings.Split(xff, ",")[0])
+	}
+	if host, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		return host
+	}
+	return req.RemoteAddr
+}
+
+// fromNginx returns true if the request looks like an nginx auth_request subrequest.
+func fromNginx(req *http.Request) bool {
+	return req.Header.Get("X-Original-URL") != "" || req.Header.Get("X-Original-URI") != ""
+}
+
+// NewAuthorizeHTTPRequest builds an AuthorizeHTTPRequest for req, which asks about a request for u
+// with the provided method, from the client at ip.  Every adapter that sees an http.Request uses
+// this, so that jsso2 sees the same request no matter which proxy is in front of it.
+func NewAuthorizeHTTPRequest(req *http.Request, method string, u *url.URL, ip string) *jssopb.AuthorizeHTTPRequest {
+	var requestCookies []string
+	for _, c := range req.Cookies() {
+		requestCookies = append(requestCookies, c.String())
+	}
+	var otherHeaders []*types.Header
+	for k, v := range req.Header {
+		switch k {
+		case "Authorization", "Cookie":
+			continue
+		}
+		otherHeaders = append(otherHeaders, &types.Header{Key: strings.ToLower(k), Value: strings.Join(v, ",")})
+	}
+	sort.Slice(otherHeaders, func(i, j int) bool { return otherHeaders[i].GetKey() < otherHeaders[j].GetKey() })
+	return &jssopb.AuthorizeHTTPRequest{
+		RequestMethod:        method,
+		RequestUri:           u.String(),
+		RequestId:            req.Header.Get("X-Request-Id"),
+		AuthorizationHeaders: req.Header.Values("Authorization"),
+		Cookies:              requestCookies,
+		IpAddress:            ip,
+		Headers:              otherHeaders,
+	}
+}
+
+// authorizeRequest builds the AuthorizeHTTPRequest for a forward-auth subrequest.
+func authorizeRequest(req *http.Request) (*jssopb.AuthorizeHTTPRequest, error) {
+	u, err := RequestURL(req)
+	if err != nil {
+		return nil, err
+	}
+	return NewAuthorizeHTTPRequest(req, requestMethod(req), u, clientIP(req)), nil
+}
+
+// JoinHeaders combines the headers that an Allow decision adds to the upstream request into one
+// value per header, keyed by canonical header name.
+//
+// Envoy is happy to proxy multiple copies of a header, but it doesn't have a way to let us add
+// multiple copies of a header.  We can only append with a , or set a single header.
+//
+// RFC2616 Section 4.2 says: Multiple message-header fields with the same field-name MAY be present
+// in a message if and only if the entire field-value for that header field is defined as a
+// comma-separated list [i.e., #(values)]. It MUST be possible to combine the multiple header fields
+// into one "field-name: field-value" pair, without changing the semantics of the message, by
+// appending each subsequent field-value to the first, each separated by a comma.
+//
+// But I haven't found anything that does that except Envoy when generating a CheckRequest.  Go's
+// http server, for example, treats:
+//
+//	Authorization: foo,bar
+//
+// very differently from:
+//
+//	Authorization: foo
+//	Authorization: bar
+//
+// I suppose this is unlikely to matter in any case that we care about.  Nobody is really sending
+// multiple Authorization headers, and if one of them is for us, we consume that and only set a
+// single Authorization header on the upstream request, so that case works OK.  Cookies we handle
+// specially, because whoever invented Cookies did not care for RFC2616.  RFC7230 at least mentions
+// that (and revises the above text about separators to make it somewhat clear you can't do it in
+// general.)
+//
+// Every adapter joins headers this way, even ones that could send multiple copies, so that
+// upstreams see the same request from any proxy.
+func JoinHeaders(add []*types.Header) map[string]string {
+	headers := map[string][]string{}
+	for _, h := range add {
+		k := textproto.CanonicalMIMEHeaderKey(h.GetKey())
+		headers[k] = append(headers[k], h.GetValue())
+	}
+	result := make(map[string]string, len(headers))
+	for k, v := range headers {
+		joined := strings.Join(v, ",")
+		if k == "Cookie" {
+			// RFC 6265 4.2.1: ...the user agent will send a Cookie
+			// header that conforms to the following grammar:
+			// cookie-header = "Cookie:" OWS cookie-string OWS
+			// cookie-string = cookie-pair *( ";" SP cookie-pair )
+			joined = strings.Join(v, "; ")
+		}
+		result[k] = joined
+	}
+	return result
+}
+
+// WriteAuthorizeError answers a request whose authorization check failed with err.
+func WriteAuthorizeError(w http.ResponseWriter, err error) {
+	code := http.StatusServiceUnavailable
+	if status.Code(err) == codes.InvalidArgument {
+		code = http.StatusBadRequest
+	}
+	http.Error(w, "Authorization check failed.", code)
+}
+
+// WriteDeny answers a denied request with the redirect or response that the Deny decision contains,
+// along with the headers that it adds.  Redirects are sent with redirectCode, which is a 3xx code
+// unless the proxy needs something else.
+func WriteDeny(w http.ResponseWriter, deny *jssopb.Deny, redirectCode int) {
+	for _, h := range deny.GetAddHeaders() {
+		w.Header().Add(h.GetKey(), h.GetValue())
+	}
+	switch dest := deny.GetDestination().(type) {
+	case *jssopb.Deny_Redirect_:
+		w.Header().Set("Location", dest.Redirect.GetRedirectUrl())
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(redirectCode)
+		fmt.Fprintf(w, "Not authorized.  Redirecting you to %q", dest.Redirect.GetRedirectUrl())
+	case *jssopb.Deny_Response_:
+		code := int(dest.Response.GetStatusCode())
+		if code == 0 {
+			code = http.StatusForbidden
+		}
+		w.Header().Set("Content-Type", dest.Response.GetContentType())
+		w.WriteHeader(code)
+		w.Write([]byte(dest.Response.GetBody()))
+	default:
+		http.Error(w, "Not authorized.", http.StatusForbidden)
+	}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	l := ctxzap.Extract(ctx)
+
+	if !h.trusted(req) {
+		l.Warn("forward-auth request from untrusted peer", zap.String("peer", req.RemoteAddr))
+		http.Error(w, "Forward-auth requests are only accepted from trusted proxies.", http.StatusForbidden)
+		return
+	}
+	authReq, err := authorizeRequest(req)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+	reply, err := h.Authorizer.AuthorizeHTTP(ctx, authReq)
+	if err != nil {
+		l.Warn("authorization check failed", zap.Error(err))
+		WriteAuthorizeError(w, err)
+		return
+	}
+
+	switch decision := reply.GetDecision().(type) {
+	case *jssopb.AuthorizeHTTPReply_Allow:
+		allow := decision.Allow
+		for k, v := range JoinHeaders(allow.GetAddHeaders()) {
+			w.Header().Set(k, v)
+		}
+		w.Header().Set(UsernameHeader, allow.GetUsername())
+		w.Header().Set(UserIDHeader, strconv.FormatInt(allow.GetUserId(), 10))
+		w.WriteHeader(http.StatusOK)
+	case *jssopb.AuthorizeHTTPReply_Deny:
+		// Denials that aren't redirects never have a Location header, even for nginx; see the
+		// package doc.
+		code := http.StatusFound
+		if fromNginx(req) {
+			code = http.StatusUnauthorized
+		}
+		WriteDeny(w, decision.Deny, code)
+	default:
+		l.Error("authorization check returned no decision", zap.Any("reply", reply))
+		http.Error(w, "Authorization check returned no decision.", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,388 @@
+package forwardauth
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jrockway/jsso2/pkg/jssopb"
+	"github.com/jrockway/jsso2/pkg/sessions"
+	"github.com/jrockway/jsso2/pkg/types"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/testing/protocmp"
+)
+
+// fakeAuthorizer records the request it's called with and returns reply and err.
+type fakeAuthorizer struct {
+	req     *jssopb.AuthorizeHTTPRequest
+	session *types.Session // The session in the context of the last call.
+	reply   *jssopb.AuthorizeHTTPReply
+	err     error
+}
+
+func (a *fakeAuthorizer) AuthorizeHTTP(ctx context.Context, req *jssopb.AuthorizeHTTPRequest) (*jssopb.AuthorizeHTTPReply, error) {
+	a.req = req
+	a.session, _ = sessions.FromContext(ctx)
+	return a.reply, a.err
+}
+
+func mustParseTrustedProxies(t *testing.T, s string) []*net.IPNet {
+	t.Helper()
+	proxies, err := ParseTrustedProxies(s)
+	if err != nil {
+		t.Fatalf("parse trusted proxies: %v", err)
+	}
+	return proxies
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	proxies := mustParseTrustedProxies(t, "10.0.0.1, 192.168.0.0/16,::1")
+	h := &Handler{TrustedProxies: proxies}
+	for addr, want := range map[string]bool{
+		"10.0.0.1:80":     true,
+		"10.0.0.2:80":     false,
+		"192.168.3.4:80":  true,
+		"[::1]:80":        true,
+		"[::2]:80":        false,
+		"203.0.113.1:443": false,
+		"garbage":         false,
+	} {
+		req := httptest.NewRequest("GET", "/forward-auth", nil)
+		req.RemoteAddr = addr
+		if got := h.trusted(req); got != want {
+			t.Errorf("trusted(%s):\n  got: %v\n want: %v", addr, got, want)
+		}
+	}
+	for _, bad := range []string{"", "10.0.0.1,", "example.com", "10.0.0.0/33"} {
+		if _, err := ParseTrustedProxies(bad); err == nil {
+			t.Errorf("parse %q: expected error", bad)
+		}
+	}
+}
+
+func TestUntrustedPeer(t *testing.T) {
+	a := &fakeAuthorizer{
+		reply: &jssopb.AuthorizeHTTPReply{
+			Decision: &jssopb.AuthorizeHTTPReply_Allow{
+				Allow: &jssopb.Allow{Username: "alice"},
+			},
+		},
+	}
+	h := &Handler{Authorizer: a, TrustedProxies: mustParseTrustedProxies(t, "10.0.0.1")}
+	req := httptest.NewRequest("GET", "/forward-auth", nil)
+	req.RemoteAddr = "203.0.113.1:1234"
+	req.Header.Set("X-Original-URL", "https://victim.example.com/")
+	req.Header.Set("X-Forwarded-Host", "victim.example.com")
+	req.Header.Set("X-Forwarded-Proto", "https")
+	req.Header.Set("X-Forwarded-Uri", "/")
+	req.Header.Set("Cookie", "jsso-session-id=stolen")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if got, want := rec.Code, http.StatusForbidden; got != want {
+		t.Errorf("status:\n  got: %v\n want: %v", got, want)
+	}
+	if a.req != nil {
+		t.Errorf("request from an untrusted peer was authorized: %v", a.req)
+	}
+	if got := rec.Header().Get(UsernameHeader); got != "" {
+		t.Errorf("identity header sent to an untrusted peer: %v", got)
+	}
+}
+
+func TestRequestURL(t *testing.T) {
+	testData := []struct {
+		name    string
+		host    string
+		headers map[string]string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "ingress-nginx",
+			headers: map[string]string{
+				"X-Original-URL": "https://app.example.com/a%2Fb?q=1",
+			},
+			want: "https://app.example.com/a%2Fb?q=1",
+		},
+		{
+			name: "nginx",
+			host: "jsso2",
+			headers: map[string]string{
+				"X-Original-URI":    "/foo/bar%20baz?q=a+b",
+				"X-Forwarded-Proto": "https",
+				"X-Forwarded-Host":  "app.example.com",
+			},
+			want: "https://app.example.com/foo/bar%20baz?q=a+b",
+		},
+		{
+			name: "traefik",
+			host: "jsso2",
+			headers: map[string]string{
+				"X-Forwarded-Uri":   "/",
+				"X-Forwarded-Proto": "http",
+				"X-Forwarded-Host":  "app.example.com",
+			},
+			want: "http://app.example.com/",
+		},
+		{
+			name: "no forwarded host",
+			host: "app.example.com",
+			headers: map[string]string{
+				"X-Original-URI": "/foo",
+			},
+			want: "http://app.example.com/foo",
+		},
+		{
+			name:    "no original url",
+			host:    "jsso2",
+			wantErr: true,
+		},
+		{
+			name: "relative original url",
+			headers: map[string]string{
+				"X-Original-URL": "/foo",
+			},
+			wantErr: true,
+		},
+		{
+			name: "relative path",
+			headers: map[string]string{
+				"X-Forwarded-Uri": "foo",
+			},
+			wantErr: true,
+		},
+	}
+	for _, test := range testData {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/forward-auth", nil)
+			req.Host = test.host
+			for k, v := range test.headers {
+				req.Header.Set(k, v)
+			}
+			u, err := RequestURL(req)
+			if got, want := err != nil, test.wantErr; got != want {
+				t.Fatalf("error: got %v, want error: %v", err, want)
+			}
+			if err != nil {
+				return
+			}
+			if got, want := u.String(), test.want; got != want {
+				t.Errorf("url:\n  got: %v\n want: %v", got, want)
+			}
+		})
+	}
+}
+
+func TestAuthorizeRequest(t *testing.T) {
+	a := &fakeAuthorizer{err: status.Error(codes.Unavailable, "down")}
+	h := &Handler{Authorizer: a, TrustedProxies: mustParseTrustedProxies(t, "10.0.0.0/24")}
+	req := httptest.NewRequest("GET", "/forward-auth", nil)
+	req.RemoteAddr = "10.0.0.2:1234"
+	req.Header.Set("X-Forwarded-Method", "POST")
+	req.Header.Set("X-Forwarded-Proto", "https")
+	req.Header.Set("X-Forwarded-Host", "app.example.com")
+	req.Header.Set("X-Forwarded-Uri", "/api/things")
+	req.Header.Set("X-Forwarded-For", "10.0.0.1, 10.0.0.2")
+	req.Header.Set("X-Request-Id", "1234")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Add("Authorization", "Bearer foo")
+	req.Header.Add("Authorization", "SessionID bar")
+	req.Header.Set("Cookie", "jsso-session-id=baz; other=1")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	want := &jssopb.AuthorizeHTTPRequest{
+		RequestMethod:        "POST",
+		RequestUri:           "https://app.example.com/api/things",
+		RequestId:            "1234",
+		AuthorizationHeaders: []string{"Bearer foo", "SessionID bar"},
+		Cookies:              []string{"jsso-session-id=baz", "other=1"},
+		IpAddress:            "10.0.0.1",
+		Headers: []*types.Header{
+			{Key: "accept", Value: "application/json"},
+			{Key: "x-forwarded-for", Value: "10.0.0.1, 10.0.0.2"},
+			{Key: "x-forwarded-host", Value: "app.example.com"},
+			{Key: "x-forwarded-method", Value: "POST"},
+			{Key: "x-forwarded-proto", Value: "https"},
+			{Key: "x-forwarded-uri", Value: "/api/things"},
+			{Key: "x-request-id", Value: "1234"},
+		},
+	}
+	if diff := cmp.Diff(a.req, want, protocmp.Transform()); diff != "" {
+		t.Errorf("request (-got +want):\n%s", diff)
+	}
+	if got, want := rec.Code, http.StatusServiceUnavailable; got != want {
+		t.Errorf("status:\n  got: %v\n want: %v", got, want)
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	redirect := &jssopb.AuthorizeHTTPReply{
+		Decision: &jssopb.AuthorizeHTTPReply_Deny{
+			Deny: &jssopb.Deny{
+				Destination: &jssopb.Deny_Redirect_{
+					Redirect: &jssopb.Deny_Redirect{RedirectUrl: "https://sso.example.com/login"},
+				},
+				AddHeaders: []*types.Header{
+					{Key: "set-cookie", Value: "jsso-session-id-browser-nonce=nonce"},
+				},
+			},
+		},
+	}
+	jsonDenial := &jssopb.AuthorizeHTTPReply{
+		Decision: &jssopb.AuthorizeHTTPReply_Deny{
+			Deny: &jssopb.Deny{
+				Destination: &jssopb.Deny_Response_{
+					Response: &jssopb.Deny_Response{
+						ContentType: "application/json",
+						Body:        `{"error":"login required"}`,
+						StatusCode:  401,
+					},
+				},
+			},
+		},
+	}
+	testData := []struct {
+		name        string
+		headers     map[string]string
+		reply       *jssopb.AuthorizeHTTPReply
+		err         error
+		wantCode    int
+		wantHeaders map[string]string
+		wantBody    string
+	}{
+		{
+			name: "allow",
+			reply: &jssopb.AuthorizeHTTPReply{
+				Decision: &jssopb.AuthorizeHTTPReply_Allow{
+					Allow: &jssopb.Allow{
+						Username: "alice",
+						UserId:   42,
+						AddHeaders: []*types.Header{
+							{Key: "x-jsso2-assertion", Value: "token"},
+						},
+					},
+				},
+			},
+			wantCode: http.StatusOK,
+			wantHeaders: map[string]string{
+				"X-Jsso2-Username":  "alice",
+				"X-Jsso2-User-Id":   "42",
+				"X-Jsso2-Assertion": "token",
+			},
+		},
+		{
+			name:     "redirect for traefik",
+			headers:  map[string]string{"X-Forwarded-Uri": "/"},
+			reply:    redirect,
+			wantCode: http.StatusFound,
+			wantHeaders: map[string]string{
+				"Location":   "https://sso.example.com/login",
+				"Set-Cookie": "jsso-session-id-browser-nonce=nonce",
+			},
+		},
+		{
+			name:     "redirect for nginx",
+			headers:  map[string]string{"X-Original-URI": "/"},
+			reply:    redirect,
+			wantCode: http.StatusUnauthorized,
+			wantHeaders: map[string]string{
+				"Location":   "https://sso.example.com/login",
+				"Set-Cookie": "jsso-session-id-browser-nonce=nonce",
+			},
+		},
+		{
+			name:     "api client",
+			reply:    jsonDenial,
+			wantCode: http.StatusUnauthorized,
+			wantHeaders: map[string]string{
+				"Content-Type": "application/json",
+			},
+			wantBody: `{"error":"login required"}`,
+		},
+		{
+			// nginx must not turn this into a redirect, so there's no Location header.
+			name:     "api client behind nginx",
+			headers:  map[string]string{"X-Original-URI": "/api/things", "X-Forwarded-Uri": ""},
+			reply:    jsonDenial,
+			wantCode: http.StatusUnauthorized,
+			wantHeaders: map[string]string{
+				"Content-Type": "application/json",
+				"Location":     "",
+			},
+			wantBody: `{"error":"login required"}`,
+		},
+		{
+			name:     "bad request",
+			headers:  map[string]string{"X-Forwarded-Uri": "", "X-Original-URI": ""},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "invalid argument",
+			err:      status.Error(codes.InvalidArgument, "bad url"),
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "no decision",
+			reply:    &jssopb.AuthorizeHTTPReply{},
+			wantCode: http.StatusInternalServerError,
+		},
+	}
+	for _, test := range testData {
+		t.Run(test.name, func(t *testing.T) {
+			a := &fakeAuthorizer{reply: test.reply, err: test.err}
+			// httptest requests come from 192.0.2.1.
+			h := &Handler{Authorizer: InProcess(a), TrustedProxies: mustParseTrustedProxies(t, "192.0.2.1")}
+			req := httptest.NewRequest("GET", "/forward-auth", nil)
+			req.Header.Set("X-Forwarded-Host", "app.example.com")
+			req.Header.Set("X-Forwarded-Uri", "/")
+			for k, v := range test.headers {
+				if v == "" {
+					req.Header.Del(k)
+					continue
+				}
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if got, want := rec.Code, test.wantCode; got != want {
+				t.Errorf("status:\n  got: %v\n want: %v", got, want)
+			}
+			for k, want := range test.wantHeaders {
+				if got := rec.Header().Get(k); got != want {
+					t.Errorf("header %s:\n  got: %v\n want: %v", k, got, want)
+				}
+			}
+			if test.wantBody != "" {
+				if got, want := rec.Body.String(), test.wantBody; got != want {
+					t.Errorf("body:\n  got: %v\n want: %v", got, want)
+				}
+			}
+			if a.req != nil && !sessions.HasTaint(a.session, sessions.TaintAnonymous) {
+				t.Errorf("in-process call was not made as an anonymous session: %v", a.session)
+			}
+		})
+	}
+}
+
+func TestJoinHeaders(t *testing.T) {
+	got := JoinHeaders([]*types.Header{
+		{Key: "cookie", Value: "a=1"},
+		{Key: "Cookie", Value: "b=2"},
+		{Key: "x-jsso2-assertion", Value: "token"},
+		{Key: "accept", Value: "text/html"},
+		{Key: "accept", Value: "application/json"},
+	})
+	want := map[string]string{
+		"Cookie":            "a=1; b=2",
+		"X-Jsso2-Assertion": "token",
+		"Accept":            "text/html,application/json",
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("headers (-got +want):\n%s", diff)
+	}
+}
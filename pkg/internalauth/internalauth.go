@@ -9,6 +9,7 @@ import (
 	"sort"
 	"time"
 
+	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
 	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
 	"github.com/jrockway/jsso2/pkg/sessions"
 	"github.com/jrockway/jsso2/pkg/store"
@@ -36,12 +37,12 @@ type Permissions struct {
 	// If set, a password that can be provided to bypass all access controls.
 	RootPassword string
 	RPCConfig    map[string]*RPCConfig
-	Store        *store.Connection
+	Store        store.Store
 	Cookies      *sessions.CookieConfig
 }
 
 // NewFromConfig builds a Permissions object from configuration.
-func NewFromConfig(c *Config, s *store.Connection) *Permissions {
+func NewFromConfig(c *Config, s store.Store) *Permissions {
 	return &Permissions{
 		Store:        s,
 		RootPassword: c.RootPassword,
@@ -153,7 +154,9 @@ func (p *Permissions) StreamServerInterceptor() grpc.StreamServerInterceptor {
 			l.Debug("user not authorized to perform RPC", zap.Error(err))
 			return err
 		}
-		return handler(srv, ss)
+		wrapped := grpc_middleware.WrapServerStream(ss)
+		wrapped.WrappedContext = ctx
+		return handler(srv, wrapped)
 	}
 }
 
@@ -234,7 +237,10 @@ func (p *Permissions) LoginSessionPrototype(ctx context.Context, target *types.U
 	}, nil
 }
 
-func (p *Permissions) AllowRedirect(destination string) error {
+// AllowRedirect decides whether a user that just logged in with the provided session may be
+// redirected to the destination of a redirect token.  The token includes the method and host of
+// the request that originally required the login.
+func (p *Permissions) AllowRedirect(ctx context.Context, session *types.Session, redirect *types.RedirectToken) error {
 	return nil
 }
 
@@ -264,6 +270,21 @@ func (p *Permissions) AllowAuthorizeHTTP(ctx context.Context, proxyUser *types.U
 	return nil
 }
 
+func (p *Permissions) AllowQueryAudit(ctx context.Context, actor *types.Session) error {
+	return nil
+}
+
+func (p *Permissions) AllowWatchEvents(ctx context.Context, actor *types.Session) error {
+	return nil
+}
+
+// AllowManageWebhooks decides whether actor may add, list, and delete webhooks, and read their
+// deliveries.  Webhook URLs are chosen by the caller and fetched by the server, so this should be
+// limited to administrators, especially if webhooks are allowed to reach private addresses.
+func (p *Permissions) AllowManageWebhooks(ctx context.Context, actor *types.Session) error {
+	return nil
+}
+
 func (p *Permissions) AllowWebVisit(ctx context.Context, session *types.Session, requestURL *url.URL) error {
 	if ts := session.GetTaints(); len(ts) > 0 {
 		return fmt.Errorf("session is tainted: %v", ts)
@@ -60,7 +60,7 @@ func TestAuthorizeRPC(t *testing.T) {
 }
 
 func TestInterceptor(t *testing.T) {
-	p := NewFromConfig(&Config{RootPassword: "foo"}, nil)
+	p := NewFromConfig(&Config{RootPassword: "foo"}, store.NewMemory())
 	p.RPCConfig = map[string]*RPCConfig{}
 
 	h := health.NewServer()
@@ -0,0 +1,101 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	auditlog "github.com/jrockway/jsso2/pkg/audit"
+	"github.com/jrockway/jsso2/pkg/internalauth"
+	"github.com/jrockway/jsso2/pkg/jssopb"
+	"github.com/jrockway/jsso2/pkg/sessions"
+	"github.com/jrockway/jsso2/pkg/store"
+	"github.com/jrockway/jsso2/pkg/types"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultQueryLimit = 100
+	maxQueryLimit     = 1000
+)
+
+type Service struct {
+	DB          store.Store
+	Permissions *internalauth.Permissions
+	Signer      *auditlog.Signer
+}
+
+// Query implements jssopb.AuditService.
+func (s *Service) Query(ctx context.Context, req *jssopb.QueryAuditRequest) (*jssopb.QueryAuditReply, error) {
+	reply := new(jssopb.QueryAuditReply)
+	if err := s.Permissions.AllowQueryAudit(ctx, sessions.MustFromContext(ctx)); err != nil {
+		return reply, fmt.Errorf("check permissions: %w", err)
+	}
+
+	limit := int(req.GetLimit())
+	if limit < 0 || limit > maxQueryLimit {
+		return reply, status.Error(codes.InvalidArgument, fmt.Sprintf("limit must be between 0 and %d", maxQueryLimit))
+	} else if limit == 0 {
+		limit = defaultQueryLimit
+	}
+	if _, ok := types.AuditEvent_Result_name[int32(req.GetResult())]; !ok {
+		return reply, status.Error(codes.InvalidArgument, fmt.Sprintf("unknown result %v", req.GetResult()))
+	}
+	filter := &store.AuditFilter{
+		Action: req.GetAction(),
+		Actor:  req.GetActor(),
+		Target: req.GetTarget(),
+		Result: req.GetResult(),
+		// Ask for one extra event, to see if there's another page.
+		Limit: limit + 1,
+	}
+	if t := req.GetSince(); t != nil {
+		filter.Since = t.AsTime()
+	}
+	if t := req.GetUntil(); t != nil {
+		filter.Until = t.AsTime()
+	}
+	if token := req.GetPageToken(); token != "" {
+		id, err := strconv.ParseInt(token, 10, 64)
+		if err != nil || id < 1 {
+			return reply, status.Error(codes.InvalidArgument, fmt.Sprintf("invalid page token %q", token))
+		}
+		filter.BeforeID = id
+	}
+
+	if err := s.DB.DoTx(ctx, ctxzap.Extract(ctx), true, func(tx store.Tx) error {
+		events, err := tx.QueryAuditEvents(ctx, filter)
+		if err != nil {
+			return fmt.Errorf("query audit events: %w", err)
+		}
+		reply.Events = events
+		return nil
+	}); err != nil {
+		return reply, store.AsGRPCError(fmt.Errorf("query audit log: %w", err))
+	}
+	if len(reply.Events) > limit {
+		reply.Events = reply.Events[:limit]
+		reply.NextPageToken = strconv.FormatInt(reply.Events[limit-1].GetId(), 10)
+	}
+	return reply, nil
+}
+
+// Verify implements jssopb.AuditService.
+func (s *Service) Verify(ctx context.Context, req *jssopb.VerifyAuditRequest) (*jssopb.VerifyAuditReply, error) {
+	reply := new(jssopb.VerifyAuditReply)
+	if err := s.Permissions.AllowQueryAudit(ctx, sessions.MustFromContext(ctx)); err != nil {
+		return reply, fmt.Errorf("check permissions: %w", err)
+	}
+	report, err := auditlog.Verify(ctx, ctxzap.Extract(ctx), s.DB, s.Signer)
+	if err != nil {
+		return reply, store.AsGRPCError(fmt.Errorf("verify audit log: %w", err))
+	}
+	reply.EventsChecked = report.Events
+	reply.UnchainedEvents = report.Unchained
+	reply.CheckpointsChecked = report.Checkpoints
+	reply.EventsAfterLastCheckpoint = report.AfterLastCheckpoint
+	reply.Problems = report.Problems
+	return reply, nil
+}
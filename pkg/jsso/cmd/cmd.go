@@ -2,15 +2,21 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
 
+	auditlog "github.com/jrockway/jsso2/pkg/audit"
+	"github.com/jrockway/jsso2/pkg/forwardauth"
 	"github.com/jrockway/jsso2/pkg/internalauth"
+	"github.com/jrockway/jsso2/pkg/jsso/audit"
 	"github.com/jrockway/jsso2/pkg/jsso/enrollment"
+	"github.com/jrockway/jsso2/pkg/jsso/events"
 	"github.com/jrockway/jsso2/pkg/jsso/login"
 	"github.com/jrockway/jsso2/pkg/jsso/session"
 	"github.com/jrockway/jsso2/pkg/jsso/user"
+	"github.com/jrockway/jsso2/pkg/jsso/webhooks"
 	"github.com/jrockway/jsso2/pkg/logout"
 	"github.com/jrockway/jsso2/pkg/redirecttokens"
 	"github.com/jrockway/jsso2/pkg/sessions"
@@ -24,26 +30,38 @@ import (
 type Config struct {
 	BaseURL      string `long:"base_url" description:"Where the app's public resources are available; used for generating links and cookies." env:"BASE_URL" default:"http://localhost:4000"`
 	TokenKey     string `long:"token_key" description:"32 bytes that are used to encrypt and sign set-cookie and redirect tokens." env:"TOKEN_KEY"`
+	TokenKeyring string `long:"token_keyring" description:"A keyring of id:base64-key pairs, separated by commas, used instead of --token_key.  The first key signs new tokens; the rest only verify old ones.  Manage with 'jssoctl keyring'." env:"TOKEN_KEYRING"`
 	CookieDomain string `long:"cookie_domain" description:"Domain to set cookies for" env:"COOKIE_DOMAIN"`
+
+	AssertionKeyring string `long:"assertion_keyring" description:"A keyring of id:base64-seed pairs, in the same format as --token_keyring, used to sign identity assertions for upstream services with Ed25519.  The public keys are served at /.well-known/jwks.json.  If unset, no assertions are issued." env:"ASSERTION_KEYRING"`
+
+	AuditCheckpointKey string `long:"audit_checkpoint_key" description:"At least 32 bytes that are used to sign audit log checkpoints.  If unset, a key is derived from the token key." env:"AUDIT_CHECKPOINT_KEY"`
+
+	ForwardAuthTrustedProxies string `long:"forward_auth_trusted_proxies" description:"If set, serve forward-auth requests from nginx or Traefik at /forward-auth, accepting them only from these comma-separated IP addresses or CIDR blocks.  List only the ingress proxies; the forwarded headers of a request choose the URL that is authorized, so they must not come from clients." env:"FORWARD_AUTH_TRUSTED_PROXIES"`
 }
 
 type App struct {
-	DB             *store.Connection
+	DB             store.Store
 	Linker         *web.Linker
 	Cookies        *sessions.CookieConfig
 	Redirects      *redirecttokens.Config
 	WebauthnConfig *webauthn.Config
 	Permissions    *internalauth.Permissions
+	AuditSigner    *auditlog.Signer
+	Assertions     *tokens.Keyring
 
 	UserService       *user.Service
 	EnrollmentService *enrollment.Service
 	LoginService      *login.Service
 	SessionService    *session.Service
+	AuditService      *audit.Service
+	EventsService     *events.Service
+	WebhooksService   *webhooks.Service
 
 	PublicMux *http.ServeMux
 }
 
-func Setup(appConfig *Config, authConfig *internalauth.Config, db *store.Connection) (*App, error) {
+func Setup(appConfig *Config, authConfig *internalauth.Config, db store.Store) (*App, error) {
 	app := &App{DB: db}
 	linker, err := web.NewLinker(appConfig.BaseURL)
 	if err != nil {
@@ -52,8 +70,44 @@ func Setup(appConfig *Config, authConfig *internalauth.Config, db *store.Connect
 	app.Linker = linker
 
 	tokenBase := &tokens.GeneratorConfig{}
-	if err := tokenBase.SetKey([]byte(appConfig.TokenKey)); err != nil {
-		return nil, fmt.Errorf("set token encryption key: %w", err)
+	checkpointKey := []byte(appConfig.AuditCheckpointKey)
+	switch {
+	case appConfig.TokenKey != "" && appConfig.TokenKeyring != "":
+		return nil, errors.New("only one of --token_key and --token_keyring may be set")
+	case appConfig.TokenKeyring != "":
+		keys, err := tokens.ParseKeyring(appConfig.TokenKeyring)
+		if err != nil {
+			return nil, fmt.Errorf("parse token keyring: %w", err)
+		}
+		tokenBase.Keyring = keys
+		// Deriving the checkpoint key from a key that will be rotated away would make old
+		// checkpoints unverifiable.
+		if len(checkpointKey) == 0 {
+			return nil, errors.New("--audit_checkpoint_key is required when --token_keyring is set")
+		}
+	default:
+		if err := tokenBase.SetKey([]byte(appConfig.TokenKey)); err != nil {
+			return nil, fmt.Errorf("set token encryption key: %w", err)
+		}
+		if len(checkpointKey) == 0 {
+			checkpointKey = auditlog.DeriveCheckpointKey([]byte(appConfig.TokenKey))
+		}
+	}
+	signer, err := auditlog.NewSigner(checkpointKey)
+	if err != nil {
+		return nil, fmt.Errorf("set audit checkpoint key: %w", err)
+	}
+	app.AuditSigner = signer
+
+	if appConfig.AssertionKeyring != "" {
+		if appConfig.AssertionKeyring == appConfig.TokenKeyring {
+			return nil, errors.New("--assertion_keyring must not be the same as --token_keyring")
+		}
+		keys, err := tokens.ParseKeyring(appConfig.AssertionKeyring)
+		if err != nil {
+			return nil, fmt.Errorf("parse assertion keyring: %w", err)
+		}
+		app.Assertions = keys
 	}
 
 	cookieDomain := linker.Domain()
@@ -66,6 +120,7 @@ func Setup(appConfig *Config, authConfig *internalauth.Config, db *store.Connect
 		Name:            "jsso-session-id",
 		Domain:          cookieDomain,
 		Linker:          linker,
+		Nonces:          &store.NonceStore{DB: db},
 	}
 	app.Cookies = cookieConfig
 
@@ -109,6 +164,20 @@ func Setup(appConfig *Config, authConfig *internalauth.Config, db *store.Connect
 		Cookies:     cookieConfig,
 		Linker:      linker,
 		Redirects:   redirectConfig,
+		Assertions:  app.Assertions,
+	}
+	app.AuditService = &audit.Service{
+		DB:          db,
+		Permissions: app.Permissions,
+		Signer:      signer,
+	}
+	app.EventsService = &events.Service{
+		DB:          db,
+		Permissions: app.Permissions,
+	}
+	app.WebhooksService = &webhooks.Service{
+		DB:          db,
+		Permissions: app.Permissions,
 	}
 
 	logoutHandler := &logout.Handler{
@@ -119,6 +188,17 @@ func Setup(appConfig *Config, authConfig *internalauth.Config, db *store.Connect
 	app.PublicMux = new(http.ServeMux)
 	app.PublicMux.HandleFunc("/set-cookie", cookieConfig.HandleSetCookie)
 	app.PublicMux.Handle("/logout", logoutHandler)
+	app.PublicMux.Handle("/.well-known/jwks.json", tokens.JWKSHandler(app.Assertions))
+	if appConfig.ForwardAuthTrustedProxies != "" {
+		proxies, err := forwardauth.ParseTrustedProxies(appConfig.ForwardAuthTrustedProxies)
+		if err != nil {
+			return nil, fmt.Errorf("parse --forward_auth_trusted_proxies: %w", err)
+		}
+		app.PublicMux.Handle("/forward-auth", &forwardauth.Handler{
+			Authorizer:     forwardauth.InProcess(app.SessionService),
+			TrustedProxies: proxies,
+		})
+	}
 
 	return app, nil
 }
@@ -126,15 +206,51 @@ func Setup(appConfig *Config, authConfig *internalauth.Config, db *store.Connect
 func ConnectDB(l *zap.Logger, dbConfig *store.Config) (*store.Connection, error) {
 	startupCtx, c := context.WithTimeout(context.Background(), time.Minute)
 	defer c()
-	db, err := store.Connect(startupCtx, dbConfig.DatabaseURL)
+	db, err := store.Connect(startupCtx, dbConfig)
 	if err != nil {
 		return nil, fmt.Errorf("connect database at %q: %w", dbConfig.DatabaseURL, err)
 	}
-	if dbConfig.RunMigrations {
+	if err := prepareSchema(startupCtx, l, db, dbConfig.RunMigrations); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// ConnectSQLite is like ConnectDB, but for a SQLite database.
+func ConnectSQLite(l *zap.Logger, dbConfig *store.Config) (*store.SQLite, error) {
+	startupCtx, c := context.WithTimeout(context.Background(), time.Minute)
+	defer c()
+	db, err := store.ConnectSQLite(startupCtx, dbConfig)
+	if err != nil {
+		return nil, fmt.Errorf("open database at %q: %w", dbConfig.DatabaseURL, err)
+	}
+	if err := prepareSchema(startupCtx, l, db, dbConfig.RunMigrations); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+type schema interface {
+	MigrateDB(ctx context.Context) error
+	CheckSchema(ctx context.Context) (*store.MigrationStatus, error)
+}
+
+// prepareSchema migrates the database if requested, and checks that the schema is usable.
+func prepareSchema(ctx context.Context, l *zap.Logger, db schema, migrate bool) error {
+	if migrate {
 		l.Info("running database migrations")
-		if err := db.MigrateDB(startupCtx); err != nil {
-			l.Warn("failed to run database migrations; continuing anyway", zap.Error(err))
+		if err := db.MigrateDB(ctx); err != nil {
+			return fmt.Errorf("migrate database: %w", err)
 		}
 	}
-	return db, nil
+	status, err := db.CheckSchema(ctx)
+	if err != nil {
+		return fmt.Errorf("check database schema: %w", err)
+	}
+	if status.Current > status.Required {
+		l.Warn("database schema is newer than this binary expects; an upgrade may be in progress", zap.Int32("current_version", status.Current), zap.Int32("required_version", status.Required))
+	}
+	return nil
 }
@@ -3,10 +3,11 @@ package enrollment
 import (
 	"context"
 	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
-	"github.com/jmoiron/sqlx"
+	"github.com/jrockway/jsso2/pkg/audit"
 	"github.com/jrockway/jsso2/pkg/internalauth"
 	"github.com/jrockway/jsso2/pkg/jssopb"
 	"github.com/jrockway/jsso2/pkg/sessions"
@@ -19,7 +20,7 @@ import (
 )
 
 type Service struct {
-	DB          *store.Connection
+	DB          store.Store
 	Permissions *internalauth.Permissions
 	Linker      *web.Linker
 	Webauthn    *webauthn.Config
@@ -36,8 +37,8 @@ func (s *Service) Start(ctx context.Context, req *jssopb.StartEnrollmentRequest)
 
 	l := ctxzap.Extract(ctx)
 	var creds []*types.Credential
-	if err := s.DB.DoTx(ctx, l, true, func(tx *sqlx.Tx) error {
-		c, err := store.GetUserCredentials(ctx, tx, user)
+	if err := s.DB.DoTx(ctx, l, true, func(tx store.Tx) error {
+		c, err := tx.GetUserCredentials(ctx, user)
 		if err != nil {
 			return fmt.Errorf("get credentials for user %s: %w", user.GetUsername(), err)
 		}
@@ -71,17 +72,25 @@ func (s *Service) Finish(ctx context.Context, req *jssopb.FinishEnrollmentReques
 	credential.CreatedAt = timestamppb.Now()
 	credential.CreatedBySessionId = session.GetId()
 	l := ctxzap.Extract(ctx)
-	if err := s.DB.DoTx(ctx, l, false, func(tx *sqlx.Tx) error {
-		if err := store.AddCredential(ctx, tx, credential); err != nil {
+	if err := s.DB.DoTx(ctx, l, false, func(tx store.Tx) error {
+		if err := tx.AddCredential(ctx, credential); err != nil {
 			return fmt.Errorf("add credential: %w", err)
 		}
-		s, err := store.LookupSession(ctx, tx, session.GetId())
+		e := audit.New(ctx, audit.ActionEnroll, session.GetUser())
+		e.Details = map[string]string{
+			"credential_id": strconv.FormatInt(credential.GetId(), 10),
+			"name":          credential.GetName(),
+		}
+		if err := tx.AddAuditEvent(ctx, e); err != nil {
+			return fmt.Errorf("add audit event: %w", err)
+		}
+		s, err := tx.LookupSession(ctx, session.GetId())
 		if err != nil {
 			return fmt.Errorf("lookup session: %w", err)
 		}
 		if sessions.HasTaint(s, sessions.TaintEnrollment) {
 			s.ExpiresAt = timestamppb.Now()
-			if err := store.UpdateSession(ctx, tx, s); err != nil {
+			if err := tx.UpdateSession(ctx, s); err != nil {
 				return fmt.Errorf("expire session: %w", err)
 			}
 		}
@@ -13,10 +13,22 @@ import (
 )
 
 func TestEnrollmentHappyPath(t *testing.T) {
+	for _, inMemory := range []bool{false, true} {
+		name := "enrollment_happy_path"
+		if inMemory {
+			name += "_in_memory"
+		}
+		testEnrollmentHappyPath(t, name, inMemory)
+	}
+}
+
+func testEnrollmentHappyPath(t *testing.T, name string, inMemory bool) {
+	t.Helper()
 	s := testserver.New()
+	s.InMemory = inMemory
 	r := &jtesting.R{Logger: true, Database: true}
 	s.ToR(r)
-	jtesting.Run(t, "enrollment_happy_path", *r, func(t *testing.T, e *jtesting.E) {
+	jtesting.Run(t, name, *r, func(t *testing.T, e *jtesting.E) {
 		ctx := metadata.AppendToOutgoingContext(e.Context, "authorization", "root root")
 		userClient := jssopb.NewUserClient(e.ClientConn)
 		enrollmentClient := jssopb.NewEnrollmentClient(e.ClientConn)
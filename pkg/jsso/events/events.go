@@ -0,0 +1,124 @@
+package events
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"github.com/jrockway/jsso2/pkg/audit"
+	"github.com/jrockway/jsso2/pkg/internalauth"
+	"github.com/jrockway/jsso2/pkg/jssopb"
+	"github.com/jrockway/jsso2/pkg/sessions"
+	"github.com/jrockway/jsso2/pkg/store"
+	"github.com/jrockway/jsso2/pkg/types"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// watchBatchSize is the number of audit events read in each transaction.
+	watchBatchSize = 100
+	// watchPollInterval bounds how long a missed notification can delay an event.
+	watchPollInterval = 10 * time.Second
+)
+
+type Service struct {
+	DB          store.Store
+	Permissions *internalauth.Permissions
+
+	// If set, open watches end when this channel is closed, so that the server can drain.
+	Done <-chan struct{}
+}
+
+// Watch implements jssopb.EventsService.
+func (s *Service) Watch(req *jssopb.WatchEventsRequest, stream jssopb.Events_WatchServer) error {
+	ctx := stream.Context()
+	l := ctxzap.Extract(ctx)
+	if err := s.Permissions.AllowWatchEvents(ctx, sessions.MustFromContext(ctx)); err != nil {
+		return fmt.Errorf("check permissions: %w", err)
+	}
+
+	want := make(map[types.Event_Type]bool)
+	for _, t := range req.GetTypes() {
+		if _, ok := types.Event_Type_name[int32(t)]; !ok || t == types.Event_TYPE_UNKNOWN {
+			return status.Error(codes.InvalidArgument, fmt.Sprintf("unknown event type %v", t))
+		}
+		want[t] = true
+	}
+
+	// Subscribe before reading anything, so that events added in between aren't missed.
+	notify := s.DB.SubscribeAuditEvents(ctx)
+	// Notifications can arrive before the read replica has the event, so read from the primary.
+	dbCtx := store.WithPrimary(ctx)
+
+	var cursor int64
+	if c := req.GetCursor(); c != "" {
+		var err error
+		cursor, err = strconv.ParseInt(c, 10, 64)
+		if err != nil || cursor < 0 {
+			return status.Error(codes.InvalidArgument, fmt.Sprintf("invalid cursor %q", c))
+		}
+	} else {
+		if err := s.DB.DoTx(dbCtx, l, true, func(tx store.Tx) error {
+			events, err := tx.QueryAuditEvents(dbCtx, &store.AuditFilter{Limit: 1})
+			if err != nil {
+				return fmt.Errorf("query newest audit event: %w", err)
+			}
+			if len(events) > 0 {
+				cursor = events[0].GetId()
+			}
+			return nil
+		}); err != nil {
+			return store.AsGRPCError(fmt.Errorf("find end of audit log: %w", err))
+		}
+	}
+
+	poll := time.NewTicker(watchPollInterval)
+	defer poll.Stop()
+	for {
+		for {
+			var events []*types.AuditEvent
+			if err := s.DB.DoTx(dbCtx, l, true, func(tx store.Tx) (err error) {
+				events, err = tx.QueryAuditEvents(dbCtx, &store.AuditFilter{
+					Target:      req.GetTarget(),
+					AfterID:     cursor,
+					OldestFirst: true,
+					Limit:       watchBatchSize,
+				})
+				return
+			}); err != nil {
+				return store.AsGRPCError(fmt.Errorf("read audit events after %d: %w", cursor, err))
+			}
+			// Every audit event is chained to the one before it, so they commit in ID
+			// order; an event can't appear behind the cursor after we've read past it.
+			for _, e := range events {
+				cursor = e.GetId()
+				t := audit.EventType(e)
+				if t == types.Event_TYPE_UNKNOWN || (len(want) > 0 && !want[t]) {
+					continue
+				}
+				if err := stream.Send(&jssopb.WatchEventsReply{
+					Event: &types.Event{
+						Type:       t,
+						Cursor:     strconv.FormatInt(cursor, 10),
+						AuditEvent: e,
+					},
+				}); err != nil {
+					return fmt.Errorf("send event: %w", err)
+				}
+			}
+			if len(events) < watchBatchSize {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.Done:
+			return status.Error(codes.Unavailable, "server is shutting down; resume from the last cursor")
+		case <-notify:
+		case <-poll.C:
+		}
+	}
+}
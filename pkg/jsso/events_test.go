@@ -0,0 +1,103 @@
+package jsso
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jrockway/jsso2/pkg/jssopb"
+	"github.com/jrockway/jsso2/pkg/jtesting"
+	"github.com/jrockway/jsso2/pkg/testserver"
+	"github.com/jrockway/jsso2/pkg/types"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestWatchEvents(t *testing.T) {
+	for _, inMemory := range []bool{false, true} {
+		name := "watch_events"
+		if inMemory {
+			name += "_in_memory"
+		}
+		testWatchEvents(t, name, inMemory)
+	}
+}
+
+func testWatchEvents(t *testing.T, name string, inMemory bool) {
+	t.Helper()
+	s := testserver.New()
+	s.InMemory = inMemory
+	r := &jtesting.R{Logger: true, Database: true}
+	s.ToR(r)
+	jtesting.Run(t, name, *r, func(t *testing.T, e *jtesting.E) {
+		ctx := metadata.AppendToOutgoingContext(e.Context, "authorization", "root root")
+		userClient := jssopb.NewUserClient(e.ClientConn)
+		eventsClient := jssopb.NewEventsClient(e.ClientConn)
+		addUser := func(t *testing.T, username string) {
+			t.Helper()
+			if _, err := userClient.Edit(ctx, &jssopb.EditUserRequest{User: &types.User{Username: username}}); err != nil {
+				t.Fatalf("add user %s: %v", username, err)
+			}
+		}
+		watch := func(t *testing.T, req *jssopb.WatchEventsRequest) (jssopb.Events_WatchClient, func()) {
+			t.Helper()
+			ctx, cancel := context.WithCancel(ctx)
+			stream, err := eventsClient.Watch(ctx, req)
+			if err != nil {
+				cancel()
+				t.Fatalf("watch: %v", err)
+			}
+			return stream, cancel
+		}
+		recv := func(t *testing.T, stream jssopb.Events_WatchClient) (types.Event_Type, string, string) {
+			t.Helper()
+			reply, err := stream.Recv()
+			if err != nil {
+				t.Fatalf("recv: %v", err)
+			}
+			e := reply.GetEvent()
+			return e.GetType(), e.GetCursor(), e.GetAuditEvent().GetTarget().GetUsername()
+		}
+
+		addUser(t, "alice")
+		// Enrollment links are audited, but aren't events.
+		if _, err := userClient.GenerateEnrollmentLink(ctx, &jssopb.GenerateEnrollmentLinkRequest{Target: &types.User{Username: "alice"}}); err != nil {
+			t.Fatalf("generate enrollment link: %v", err)
+		}
+
+		stream, cancel := watch(t, &jssopb.WatchEventsRequest{Cursor: "0"})
+		defer cancel()
+		type event struct {
+			Type           types.Event_Type
+			Cursor, Target string
+		}
+		var got []event
+		typ, cursor, target := recv(t, stream)
+		got = append(got, event{typ, cursor, target})
+		addUser(t, "bob")
+		typ, cursor, target = recv(t, stream)
+		got = append(got, event{typ, cursor, target})
+		want := []event{
+			{types.Event_USER_CHANGED, "1", "alice"},
+			{types.Event_USER_CHANGED, "3", "bob"},
+		}
+		if diff := cmp.Diff(got, want); diff != "" {
+			t.Errorf("events (-got +want):\n%s", diff)
+		}
+
+		stream, cancel = watch(t, &jssopb.WatchEventsRequest{Cursor: "0", Target: &types.User{Username: "bob"}, Types: []types.Event_Type{types.Event_USER_CHANGED}})
+		defer cancel()
+		if _, cursor, target := recv(t, stream); cursor != "3" || target != "bob" {
+			t.Errorf("filtered watch: got event %s for %q, want event 3 for bob", cursor, target)
+		}
+
+		for _, req := range []*jssopb.WatchEventsRequest{{Cursor: "foo"}, {Types: []types.Event_Type{types.Event_TYPE_UNKNOWN}}} {
+			stream, cancel := watch(t, req)
+			defer cancel()
+			if _, err := stream.Recv(); status.Code(err) != codes.InvalidArgument {
+				t.Errorf("watch %v: expected InvalidArgument, got %v", req, err)
+			}
+		}
+	})
+}
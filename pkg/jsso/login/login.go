@@ -4,9 +4,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
+	"strconv"
 
 	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
-	"github.com/jmoiron/sqlx"
+	"github.com/jrockway/jsso2/pkg/audit"
 	"github.com/jrockway/jsso2/pkg/internalauth"
 	"github.com/jrockway/jsso2/pkg/jssopb"
 	"github.com/jrockway/jsso2/pkg/redirecttokens"
@@ -16,12 +18,15 @@ import (
 	"github.com/jrockway/jsso2/pkg/web"
 	"github.com/jrockway/jsso2/pkg/webauthn"
 	"go.uber.org/zap"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
 )
 
 type Service struct {
-	DB          *store.Connection
+	DB          store.Store
 	Permissions *internalauth.Permissions
 	Webauthn    *webauthn.Config
 	Cookies     *sessions.CookieConfig
@@ -45,8 +50,8 @@ func (s *Service) Start(ctx context.Context, req *jssopb.StartLoginRequest) (*js
 	// have credentials enrolled but invalid users don't.  So for now, we just leak the
 	// information in the interest of providing more useful error messages ("that's not your
 	// username" and "you forgot to enroll an authenticator").
-	if err := s.DB.DoTx(ctx, l, true, func(tx *sqlx.Tx) error {
-		return store.LookupUser(ctx, tx, user)
+	if err := s.DB.DoTx(ctx, l, true, func(tx store.Tx) error {
+		return tx.LookupUser(ctx, user)
 	}); err != nil {
 		return emptyReply, store.AsGRPCError(fmt.Errorf("validate username: %w", err))
 	}
@@ -60,9 +65,9 @@ func (s *Service) Start(ctx context.Context, req *jssopb.StartLoginRequest) (*js
 	// browser so it knows what security key (etc.) to try to use.  It is not possible to just
 	// send back an empty list of credentials.
 	var creds []*types.Credential
-	if err := s.DB.DoTx(ctx, l, true, func(tx *sqlx.Tx) error {
+	if err := s.DB.DoTx(ctx, l, true, func(tx store.Tx) error {
 		var err error
-		creds, err = store.GetUserCredentials(ctx, tx, user)
+		creds, err = tx.GetUserCredentials(ctx, user)
 		if err != nil {
 			return fmt.Errorf("lookup user credentials: %w", err)
 		}
@@ -92,11 +97,39 @@ func (s *Service) Start(ctx context.Context, req *jssopb.StartLoginRequest) (*js
 
 	// We store the session last, so that any errors before this point don't write unneeded
 	// sessions to the database.
-	if err := s.DB.DoTx(ctx, l, false, func(tx *sqlx.Tx) error {
-		return store.UpdateSession(ctx, tx, session)
+	if err := s.DB.DoTx(ctx, l, false, func(tx store.Tx) error {
+		return tx.UpdateSession(ctx, session)
 	}); err != nil {
 		return emptyReply, store.AsGRPCError(fmt.Errorf("store session: %w", err))
 	}
+
+	// Give the browser a cookie that binds the eventual set-cookie token to it, so that the
+	// token is useless to anyone who finds it in a log.  Clients that don't keep cookies can
+	// still log in; their set-cookie tokens just aren't bound.
+	binding, err := s.Cookies.NewLoginBindingCookie()
+	if err != nil {
+		return emptyReply, err
+	}
+	if err := grpc.SetHeader(ctx, metadata.Pairs("set-cookie", binding.String())); err != nil {
+		l.Warn("failed to send login binding cookie", zap.Error(err))
+	}
+
+	// Exchange the redirect token for one that only this login attempt can use.  Only unbound
+	// tokens minted for this browser's own denied request are accepted, so a token minted by
+	// someone else, or bound to someone else's login attempt, can't be carried into this one.  A
+	// bad redirect token shouldn't prevent logging in; the user just won't be redirected.
+	if token := req.GetRedirectToken(); token != "" {
+		var nonce []byte
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			nonce = s.Cookies.BrowserNonceFromCookies(sessions.Cookies(md.Get("cookie")...))
+		}
+		bound, err := s.Redirects.Bind(token, session, s.Cookies.LoginBindingFromCookies([]*http.Cookie{binding}), nonce)
+		if err != nil {
+			l.Warn("invalid redirect token", zap.String("token", token), zap.Error(err))
+		} else {
+			reply.RedirectToken = bound
+		}
+	}
 	return reply, nil
 }
 
@@ -106,19 +139,22 @@ func (s *Service) Finish(ctx context.Context, req *jssopb.FinishLoginRequest) (*
 
 	session := sessions.MustFromContext(ctx)
 	if clientError := req.GetError(); clientError != "" {
-		if err := revokeSession(ctx, l, s.DB, session.GetId()); err != nil {
-			return reply, store.AsGRPCError(fmt.Errorf("revoke session after client error %q: %w", clientError, err))
+		err := status.Error(codes.FailedPrecondition, fmt.Sprintf("login failed due to a client error: %q", clientError))
+		if revokeErr := revokeSession(ctx, l, s.DB, session.GetId(), audit.Fail(audit.New(ctx, audit.ActionLogin, session.GetUser()), err)); revokeErr != nil {
+			return reply, store.AsGRPCError(fmt.Errorf("revoke session after client error %q: %w", clientError, revokeErr))
 		}
-		return reply, status.Error(codes.FailedPrecondition, fmt.Sprintf("login failed due to a client error: %q", clientError))
+		return reply, err
 	}
 
 	id := session.GetId()
 	user := session.GetUser()
 
+	// Read the credentials from the primary; a credential that was just enrolled, or a sign
+	// count that was just updated, might not have made it to the read replica yet.
 	var creds []*types.Credential
-	if err := s.DB.DoTx(ctx, l, true, func(tx *sqlx.Tx) error {
+	if err := s.DB.DoTx(store.WithPrimary(ctx), l, true, func(tx store.Tx) error {
 		var err error
-		creds, err = store.GetUserCredentials(ctx, tx, user)
+		creds, err = tx.GetUserCredentials(ctx, user)
 		if err != nil {
 			return fmt.Errorf("lookup user credentials: %w", err)
 		}
@@ -127,34 +163,48 @@ func (s *Service) Finish(ctx context.Context, req *jssopb.FinishLoginRequest) (*
 		return reply, store.AsGRPCError(fmt.Errorf("lookup existing credentials: %w", err))
 	}
 
-	if err := s.finishLoginAndCheckCounter(ctx, l, session, creds, req); err != nil {
-		if revokeErr := revokeSession(ctx, l, s.DB, id); revokeErr != nil {
+	usedCred, err := s.finishLoginAndCheckCounter(ctx, l, session, creds, req)
+	if err != nil {
+		// The failed login is recorded along with the revocation, since nothing else was
+		// written.
+		events := []*types.AuditEvent{audit.Fail(audit.New(ctx, audit.ActionLogin, user), err)}
+		if errors.Is(err, store.ErrSignCountDecreased) {
+			e := audit.Fail(audit.New(ctx, audit.ActionSignCountDecreased, user), err)
+			e.Details = map[string]string{"credential_id": strconv.FormatInt(usedCred.GetId(), 10)}
+			events = append(events, e)
+		}
+		if revokeErr := revokeSession(ctx, l, s.DB, id, events...); revokeErr != nil {
 			l.Warn("failed to revoke session after failed login", zap.Error(err))
 			err = fmt.Errorf("%w (additionally: %v)", err, revokeErr)
 		}
 		return reply, fmt.Errorf("finish login and update counters: %w", err)
 	}
-	if err := untaintSession(ctx, l, s.DB, id); err != nil {
+	e := audit.New(ctx, audit.ActionLogin, user)
+	e.Details = map[string]string{"credential_id": strconv.FormatInt(usedCred.GetId(), 10)}
+	if err := untaintSession(ctx, l, s.DB, id, e); err != nil {
 		return reply, err
 	}
 
+	var binding []byte
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		binding = s.Cookies.LoginBindingFromCookies(sessions.Cookies(md.Get("cookie")...))
+	}
+
 	var redirectTo string
 	if token := req.GetRedirectToken(); token != "" {
-		if dest, err := s.Redirects.Unmarshal(token); err != nil {
+		if redirect, err := s.Redirects.Verify(token, session, binding); err != nil {
 			l.Warn("invalid redirect token", zap.String("token", token), zap.Error(err))
-			redirectTo = ""
-		} else if err := s.Permissions.AllowRedirect(redirectTo); err != nil {
-			l.Warn("not allowed to redirect user", zap.String("redirect_to", redirectTo))
-			redirectTo = ""
+		} else if err := s.Permissions.AllowRedirect(ctx, session, redirect); err != nil {
+			l.Warn("not allowed to redirect user", zap.String("redirect_to", redirect.GetUri()), zap.Error(err))
 		} else {
-			redirectTo = dest
+			redirectTo = redirect.GetUri()
 		}
 	}
 	if redirectTo == "" {
 		redirectTo = s.Linker.Base()
 	}
 
-	token, err := s.Cookies.NewSetCookieRequest(session, redirectTo)
+	token, err := s.Cookies.NewSetCookieRequest(session, redirectTo, binding)
 	if err != nil {
 		return reply, fmt.Errorf("get set-cookie token: %w", err)
 	}
@@ -163,23 +213,27 @@ func (s *Service) Finish(ctx context.Context, req *jssopb.FinishLoginRequest) (*
 	return reply, nil
 }
 
-func (s *Service) finishLoginAndCheckCounter(ctx context.Context, l *zap.Logger, session *types.Session, creds []*types.Credential, req *jssopb.FinishLoginRequest) error {
+// finishLoginAndCheckCounter returns the credential that was used to log in.  If the sign count
+// check fails, the credential is returned along with the error.
+func (s *Service) finishLoginAndCheckCounter(ctx context.Context, l *zap.Logger, session *types.Session, creds []*types.Credential, req *jssopb.FinishLoginRequest) (*types.Credential, error) {
 	usedCred, err := s.Webauthn.FinishLogin(session, creds, req)
 	if err != nil {
-		return fmt.Errorf("finish login: %w", err)
+		return nil, fmt.Errorf("finish login: %w", err)
 	}
-	if err := s.DB.DoTx(ctx, l, false, func(tx *sqlx.Tx) error {
-		return store.CheckAndUpdateSignCount(ctx, tx, usedCred)
+	if err := s.DB.DoTx(ctx, l, false, func(tx store.Tx) error {
+		return tx.CheckAndUpdateSignCount(ctx, usedCred)
 	}); err != nil {
-		return fmt.Errorf("check and update counter: %w", err)
+		return usedCred, fmt.Errorf("check and update counter: %w", err)
 	}
-	return nil
+	return usedCred, nil
 }
 
-func untaintSession(ctx context.Context, l *zap.Logger, db *store.Connection, id []byte) error {
-	if err := db.DoTx(ctx, l, false, func(tx *sqlx.Tx) error {
+// untaintSession upgrades a login session to a full session, recording the provided audit event in
+// the same transaction.
+func untaintSession(ctx context.Context, l *zap.Logger, db store.Store, id []byte, event *types.AuditEvent) error {
+	if err := db.DoTx(ctx, l, false, func(tx store.Tx) error {
 		// Refresh the session in a transaction, since we will be editing it.
-		session, err := store.LookupSession(ctx, tx, id)
+		session, err := tx.LookupSession(ctx, id)
 		if err != nil {
 			return fmt.Errorf("refresh session: %w", err)
 		}
@@ -191,9 +245,21 @@ func untaintSession(ctx context.Context, l *zap.Logger, db *store.Connection, id
 		}
 		session.Taints = newTaints
 		// TODO(jrockway): Add an "upgraded at" timestamp in the metadata.
-		if err := store.UpdateSession(ctx, tx, session); err != nil {
+		if err := tx.UpdateSession(ctx, session); err != nil {
 			return fmt.Errorf("store untainted session: %w", err)
 		}
+		newIP, err := newIPEvent(ctx, tx, event)
+		if err != nil {
+			return fmt.Errorf("check for login from a new ip: %w", err)
+		}
+		if err := tx.AddAuditEvent(ctx, event); err != nil {
+			return fmt.Errorf("add audit event: %w", err)
+		}
+		if newIP != nil {
+			if err := tx.AddAuditEvent(ctx, newIP); err != nil {
+				return fmt.Errorf("add new ip audit event: %w", err)
+			}
+		}
 		return nil
 	}); err != nil {
 		return store.AsGRPCError(fmt.Errorf("upgrade session: %w", err))
@@ -201,10 +267,61 @@ func untaintSession(ctx context.Context, l *zap.Logger, db *store.Connection, id
 	return nil
 }
 
-func revokeSession(ctx context.Context, l *zap.Logger, db *store.Connection, id []byte) error {
+// newIPEvent returns an audit event noting that a successful login came from an IP address that
+// the user has never logged in from before, or nil if it didn't.  A user's first login is not
+// considered to be from a new address.
+func newIPEvent(ctx context.Context, tx store.Tx, login *types.AuditEvent) (*types.AuditEvent, error) {
+	ip, user := login.GetIpAddress(), login.GetTarget()
+	if ip == "" || user.GetId() == 0 {
+		return nil, nil
+	}
+	f := &store.AuditFilter{Action: audit.ActionLogin, Target: &types.User{Id: user.GetId()}, Result: types.AuditEvent_SUCCESS, Limit: 1}
+	previous, err := tx.QueryAuditEvents(ctx, f)
+	if err != nil {
+		return nil, fmt.Errorf("query previous logins: %w", err)
+	}
+	if len(previous) == 0 {
+		return nil, nil
+	}
+	f.IPAddress = ip
+	fromIP, err := tx.QueryAuditEvents(ctx, f)
+	if err != nil {
+		return nil, fmt.Errorf("query previous logins from %s: %w", ip, err)
+	}
+	if len(fromIP) > 0 {
+		return nil, nil
+	}
+	e := proto.Clone(login).(*types.AuditEvent)
+	e.Action = audit.ActionLoginNewIP
+	e.Details = map[string]string{"previous_ip_address": previous[0].GetIpAddress()}
+	return e, nil
+}
+
+// revokeSession revokes a login session, recording the provided audit events and the revocation
+// itself in the same transaction.
+func revokeSession(ctx context.Context, l *zap.Logger, db store.Store, id []byte, events ...*types.AuditEvent) error {
+	const reason = "login aborted"
 	// There is some question as to whether or not we want to revoke an untainted session here.
-	if err := db.DoTx(ctx, l, false, func(tx *sqlx.Tx) error {
-		return store.RevokeSession(ctx, tx, id, "login aborted")
+	if err := db.DoTx(ctx, l, false, func(tx store.Tx) error {
+		current, lookupErr := tx.LookupSession(ctx, id)
+		if err := tx.RevokeSession(ctx, id, reason); err != nil {
+			return err
+		}
+		for _, e := range events {
+			if err := tx.AddAuditEvent(ctx, e); err != nil {
+				return fmt.Errorf("add audit event: %w", err)
+			}
+		}
+		// Only sessions that are still valid are actually revoked, so only those are worth
+		// auditing.
+		if lookupErr == nil {
+			e := audit.New(ctx, audit.ActionRevokeSession, current.GetUser())
+			e.Details = map[string]string{"reason": reason}
+			if err := tx.AddAuditEvent(ctx, e); err != nil {
+				return fmt.Errorf("add audit event: %w", err)
+			}
+		}
+		return nil
 	}); err != nil {
 		return store.AsGRPCError(fmt.Errorf("expire session: %w", err))
 	}
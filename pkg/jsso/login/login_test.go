@@ -0,0 +1,75 @@
+package login
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jrockway/jsso2/pkg/audit"
+	"github.com/jrockway/jsso2/pkg/store"
+	"github.com/jrockway/jsso2/pkg/types"
+	"go.uber.org/zap/zaptest"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestNewIPEvent(t *testing.T) {
+	ctx := context.Background()
+	l := zaptest.NewLogger(t)
+	db := store.NewMemory()
+	alice := &types.User{Id: 1, Username: "alice"}
+	login := func(ip string) *types.AuditEvent {
+		return &types.AuditEvent{
+			CreatedAt: timestamppb.Now(),
+			Action:    audit.ActionLogin,
+			Actor:     alice,
+			Target:    alice,
+			IpAddress: ip,
+			Result:    types.AuditEvent_SUCCESS,
+		}
+	}
+	// check records a login from ip, returning whether it was considered to be from a new IP.
+	check := func(ip string) bool {
+		t.Helper()
+		var newIP *types.AuditEvent
+		if err := db.DoTx(ctx, l, false, func(tx store.Tx) error {
+			e := login(ip)
+			var err error
+			if newIP, err = newIPEvent(ctx, tx, e); err != nil {
+				return err
+			}
+			return tx.AddAuditEvent(ctx, e)
+		}); err != nil {
+			t.Fatalf("login from %q: %v", ip, err)
+		}
+		if newIP != nil && newIP.GetAction() != audit.ActionLoginNewIP {
+			t.Errorf("login from %q: unexpected action %q", ip, newIP.GetAction())
+		}
+		return newIP != nil
+	}
+
+	testData := []struct {
+		ip   string
+		want bool
+	}{
+		{"192.0.2.1", false}, // First login.
+		{"192.0.2.1", false},
+		{"198.51.100.1", true},
+		{"198.51.100.1", false},
+		{"192.0.2.1", false},
+		{"", false},
+	}
+	for i, test := range testData {
+		if got := check(test.ip); got != test.want {
+			t.Errorf("login %d from %q: new ip:\n  got: %v\n want: %v", i, test.ip, got, test.want)
+		}
+	}
+
+	// Failed logins don't count as having logged in from an address.
+	if err := db.DoTx(ctx, l, false, func(tx store.Tx) error {
+		return tx.AddAuditEvent(ctx, audit.Fail(login("203.0.113.1"), context.Canceled))
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if !check("203.0.113.1") {
+		t.Error("login from an address that only failed before: expected a new ip event")
+	}
+}
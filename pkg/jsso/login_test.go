@@ -0,0 +1,138 @@
+package jsso
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/jrockway/jsso2/pkg/client"
+	"github.com/jrockway/jsso2/pkg/jssopb"
+	"github.com/jrockway/jsso2/pkg/jtesting"
+	"github.com/jrockway/jsso2/pkg/sessions"
+	"github.com/jrockway/jsso2/pkg/store"
+	"github.com/jrockway/jsso2/pkg/testserver"
+	"github.com/jrockway/jsso2/pkg/types"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestStartLoginRedirectToken(t *testing.T) {
+	for _, inMemory := range []bool{false, true} {
+		name := "start_login_redirect_token"
+		if inMemory {
+			name += "_in_memory"
+		}
+		testStartLoginRedirectToken(t, name, inMemory)
+	}
+}
+
+func testStartLoginRedirectToken(t *testing.T, name string, inMemory bool) {
+	t.Helper()
+	s := testserver.New()
+	s.InMemory = inMemory
+	r := &jtesting.R{Logger: true, Database: true}
+	s.ToR(r)
+	jtesting.Run(t, name, *r, func(t *testing.T, e *jtesting.E) {
+		cs := client.FromCC(e.ClientConn)
+		rootCtx := metadata.AppendToOutgoingContext(e.Context, "authorization", "root root")
+		edit, err := cs.UserClient.Edit(rootCtx, &jssopb.EditUserRequest{
+			User: &types.User{Username: "alice"},
+		})
+		if err != nil {
+			t.Fatalf("create user: %v", err)
+		}
+		link, err := cs.UserClient.GenerateEnrollmentLink(rootCtx, &jssopb.GenerateEnrollmentLinkRequest{
+			Target: edit.GetUser(),
+		})
+		if err != nil {
+			t.Fatalf("create enrollment link: %v", err)
+		}
+		enrollment, err := sessions.FromBase64(link.GetToken())
+		if err != nil {
+			t.Fatalf("parse enrollment session: %v", err)
+		}
+		if err := s.App.DB.DoTx(e.Context, e.Logger, false, func(tx store.Tx) error {
+			return tx.AddCredential(e.Context, &types.Credential{
+				CredentialId:       []byte("alice's security key"),
+				PublicKey:          []byte("alice's public key"),
+				User:               edit.GetUser(),
+				Name:               "key",
+				CreatedAt:          timestamppb.Now(),
+				CreatedBySessionId: enrollment.GetId(),
+			})
+		}); err != nil {
+			t.Fatalf("add credential: %v", err)
+		}
+
+		// deny returns the redirect token and browser nonce cookie from a denied visit to u by
+		// a browser with the provided cookies.
+		deny := func(u string, cookies ...string) (string, string) {
+			t.Helper()
+			reply, err := cs.SessionClient.AuthorizeHTTP(e.Context, &jssopb.AuthorizeHTTPRequest{
+				RequestMethod: "GET",
+				RequestUri:    u,
+				Cookies:       cookies,
+			})
+			if err != nil {
+				t.Fatalf("authorize %s: %v", u, err)
+			}
+			redirect := reply.GetDeny().GetRedirect().GetRedirectUrl()
+			i := strings.LastIndex(redirect, "/#/login/")
+			if i < 0 {
+				t.Fatalf("authorize %s: redirect url %q has no redirect token", u, redirect)
+			}
+			token, err := url.PathUnescape(redirect[i+len("/#/login/"):])
+			if err != nil {
+				t.Fatalf("authorize %s: unescape redirect token: %v", u, err)
+			}
+			var cookie string
+			for _, h := range reply.GetDeny().GetAddHeaders() {
+				if h.GetKey() == "set-cookie" {
+					cookie = strings.SplitN(h.GetValue(), ";", 2)[0]
+				}
+			}
+			if cookie == "" {
+				t.Fatalf("authorize %s: no browser nonce cookie in %v", u, reply.GetDeny())
+			}
+			return token, cookie
+		}
+		start := func(token string, cookies ...string) string {
+			t.Helper()
+			ctx := e.Context
+			for _, c := range cookies {
+				ctx = metadata.AppendToOutgoingContext(ctx, "cookie", c)
+			}
+			reply, err := jssopb.NewLoginClient(e.ClientConn).Start(ctx, &jssopb.StartLoginRequest{
+				Username:      "alice",
+				RedirectToken: token,
+			})
+			if err != nil {
+				t.Fatalf("start login: %v", err)
+			}
+			return reply.GetRedirectToken()
+		}
+
+		malloryToken, malloryCookie := deny("https://evil.example.com/")
+		aliceToken, aliceCookie := deny("https://app.example.com/")
+		if malloryCookie == aliceCookie {
+			t.Fatalf("two browsers got the same nonce: %v", aliceCookie)
+		}
+		if _, again := deny("https://app.example.com/other", aliceCookie); again != aliceCookie {
+			t.Errorf("browser nonce was not reused:\n  got: %v\n want: %v", again, aliceCookie)
+		}
+
+		// A token minted for another browser is ignored.
+		if got := start(malloryToken, aliceCookie); got != "" {
+			t.Errorf("start with another browser's token: expected no redirect token, got %v", got)
+		}
+		if got := start(malloryToken); got != "" {
+			t.Errorf("start with another browser's token and no nonce: expected no redirect token, got %v", got)
+		}
+		if got := start(aliceToken, malloryCookie); got != "" {
+			t.Errorf("start with the nonce of another browser: expected no redirect token, got %v", got)
+		}
+		if got := start(aliceToken, aliceCookie); got == "" {
+			t.Error("start with this browser's own token: expected a bound redirect token")
+		}
+	})
+}
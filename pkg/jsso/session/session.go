@@ -2,9 +2,13 @@ package session
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"mime"
+	"net/http"
 	"net/url"
+	"strings"
 
 	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
 	"github.com/jrockway/jsso2/pkg/internalauth"
@@ -12,6 +16,7 @@ import (
 	"github.com/jrockway/jsso2/pkg/redirecttokens"
 	"github.com/jrockway/jsso2/pkg/sessions"
 	"github.com/jrockway/jsso2/pkg/store"
+	"github.com/jrockway/jsso2/pkg/tokens"
 	"github.com/jrockway/jsso2/pkg/types"
 	"github.com/jrockway/jsso2/pkg/web"
 	"go.uber.org/zap"
@@ -19,12 +24,62 @@ import (
 	"google.golang.org/grpc/status"
 )
 
+// AssertionHeader is the header that contains a signed types.IdentityAssertion, added to requests
+// that AuthorizeHTTP allows when an assertion keyring is configured.  Upstream services can verify
+// it with tokens.VerifySignedAndUnmarshal and the keys published at /.well-known/jwks.json.
+const AssertionHeader = "x-jsso2-assertion"
+
+// loginRequired is the body of the response sent to unauthenticated API clients.
+type loginRequired struct {
+	Error    string `json:"error"`
+	LoginURL string `json:"login_url"`
+}
+
+// wantsRedirect returns true if the request looks like a browser navigating to a page, which should
+// be redirected to the login page when it's denied.  XHR and fetch requests, non-GET requests, and
+// requests that ask for JSON would just get an HTML login page after following the redirect, so they
+// get an error instead.  Clients that don't say what they want, like curl, get the redirect.
+func wantsRedirect(req *jssopb.AuthorizeHTTPRequest) bool {
+	switch req.GetRequestMethod() {
+	case "", http.MethodGet, http.MethodHead:
+	default:
+		return false
+	}
+	header := http.Header{}
+	for _, h := range req.GetHeaders() {
+		header.Add(h.GetKey(), h.GetValue())
+	}
+	if strings.EqualFold(header.Get("x-requested-with"), "XMLHttpRequest") {
+		return false
+	}
+	if mode := header.Get("sec-fetch-mode"); mode != "" && mode != "navigate" {
+		return false
+	}
+	var wantHTML, wantJSON bool
+	for _, accept := range header.Values("accept") {
+		for _, t := range strings.Split(accept, ",") {
+			mediaType, _, err := mime.ParseMediaType(t)
+			if err != nil {
+				continue
+			}
+			switch mediaType {
+			case "text/html", "application/xhtml+xml":
+				wantHTML = true
+			case "application/json":
+				wantJSON = true
+			}
+		}
+	}
+	return wantHTML || !wantJSON
+}
+
 type Service struct {
-	DB          *store.Connection
+	DB          store.Store
 	Permissions *internalauth.Permissions
 	Linker      *web.Linker
 	Cookies     *sessions.CookieConfig
 	Redirects   *redirecttokens.Config
+	Assertions  *tokens.Keyring // If set, sign identity assertions for allowed requests.
 }
 
 func (s *Service) AuthorizeHTTP(ctx context.Context, req *jssopb.AuthorizeHTTPRequest) (*jssopb.AuthorizeHTTPReply, error) {
@@ -46,11 +101,37 @@ func (s *Service) AuthorizeHTTP(ctx context.Context, req *jssopb.AuthorizeHTTPRe
 		return reply, status.Error(codes.InvalidArgument, fmt.Errorf("parse request uri: %w", err).Error())
 	}
 
-	if redirectToken, err := s.Redirects.New(parsedURL.String()); err != nil {
+	// The redirect token only works for a login started by the browser that was denied, which
+	// the browser nonce cookie set with the denial identifies.  Otherwise, anyone could mint a
+	// token here and send a victim to the login page with it.
+	if nonce, cookie, err := s.Cookies.BrowserNonce(sessions.Cookies(req.GetCookies()...)); err != nil {
+		l.Warn("could not generate browser nonce", zap.Error(err))
+	} else if redirectToken, err := s.Redirects.New(parsedURL.String(), req.GetRequestMethod(), nonce); err != nil {
 		l.Warn("could not mint redirect token", zap.String("url", parsedURL.String()), zap.Error(err))
-		reply.GetDeny().GetRedirect().RedirectUrl = s.Linker.LoginPage()
 	} else {
 		reply.GetDeny().GetRedirect().RedirectUrl = s.Linker.LoginPageWithRedirect(redirectToken)
+		reply.GetDeny().AddHeaders = append(reply.GetDeny().AddHeaders, &types.Header{
+			Key:   "set-cookie",
+			Value: cookie.String(),
+		})
+	}
+	if !wantsRedirect(req) {
+		// API clients can't do anything useful with the HTML login page, so they get an error
+		// that tells a human where to go instead.
+		body, err := json.Marshal(&loginRequired{
+			Error:    "login required",
+			LoginURL: reply.GetDeny().GetRedirect().GetRedirectUrl(),
+		})
+		if err != nil {
+			return reply, fmt.Errorf("marshal login required response: %w", err)
+		}
+		reply.GetDeny().Destination = &jssopb.Deny_Response_{
+			Response: &jssopb.Deny_Response{
+				ContentType: "application/json",
+				Body:        string(body),
+				StatusCode:  http.StatusUnauthorized,
+			},
+		}
 	}
 
 	// Check is the proxy's user is allowed to perform this check.
@@ -62,9 +143,11 @@ func (s *Service) AuthorizeHTTP(ctx context.Context, req *jssopb.AuthorizeHTTPRe
 	ss, unusedAuth, unusedCookies := s.Cookies.SessionsFromAny(req.GetAuthorizationHeaders(), req.GetCookies())
 	session, errs := s.DB.AuthenticateUser(ctx, l, ss, unusedAuth, unusedCookies)
 	if session == nil {
+		reply.GetDeny().Category = jssopb.Deny_INVALID_CREDENTIALS
 		switch len(errs) {
 		case 0:
 			reply.GetDeny().Reason = "no authentication material provided"
+			reply.GetDeny().Category = jssopb.Deny_NO_CREDENTIALS
 		case 1:
 			reply.GetDeny().Reason = fmt.Sprintf("%v", errs[0])
 		default:
@@ -76,11 +159,14 @@ func (s *Service) AuthorizeHTTP(ctx context.Context, req *jssopb.AuthorizeHTTPRe
 	// Check that the access control policy allows this user to visit the target website.
 	if err := s.Permissions.AllowWebVisit(ctx, session, parsedURL); err != nil {
 		reply.GetDeny().Reason = err.Error()
+		reply.GetDeny().Category = jssopb.Deny_POLICY
 		return reply, nil
 	}
 
 	allow := &jssopb.Allow{
-		Username: session.GetUser().GetUsername(),
+		Username:      session.GetUser().GetUsername(),
+		UserId:        session.GetUser().GetId(),
+		SessionHandle: sessions.Handle(session),
 	}
 	for _, u := range unusedAuth {
 		if u.Err == nil || errors.Is(u.Err, sessions.ErrUnknownAuthType) {
@@ -91,13 +177,29 @@ func (s *Service) AuthorizeHTTP(ctx context.Context, req *jssopb.AuthorizeHTTPRe
 		}
 	}
 	for _, u := range unusedCookies {
-		if u.Err == nil {
+		if u.Err == nil && !s.Cookies.IsBrowserNonce(u.Cookie) {
 			allow.AddHeaders = append(allow.AddHeaders, &types.Header{
 				Key:   "cookie",
 				Value: u.Cookie.String(),
 			})
 		}
 	}
+	if s.Assertions != nil {
+		assertion, err := tokens.Sign(&types.IdentityAssertion{
+			User: &types.User{
+				Id:       session.GetUser().GetId(),
+				Username: session.GetUser().GetUsername(),
+			},
+			Audience: parsedURL.Host,
+		}, s.Assertions)
+		if err != nil {
+			return reply, fmt.Errorf("sign identity assertion: %w", err)
+		}
+		allow.AddHeaders = append(allow.AddHeaders, &types.Header{
+			Key:   AssertionHeader,
+			Value: assertion,
+		})
+	}
 	reply = &jssopb.AuthorizeHTTPReply{
 		Decision: &jssopb.AuthorizeHTTPReply_Allow{
 			Allow: allow,
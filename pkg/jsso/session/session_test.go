@@ -0,0 +1,94 @@
+package session
+
+import (
+	"testing"
+
+	"github.com/jrockway/jsso2/pkg/jssopb"
+	"github.com/jrockway/jsso2/pkg/types"
+)
+
+func TestWantsRedirect(t *testing.T) {
+	testData := []struct {
+		name    string
+		method  string
+		headers map[string]string
+		want    bool
+	}{
+		{
+			name: "no information",
+			want: true,
+		},
+		{
+			name:    "curl",
+			method:  "GET",
+			headers: map[string]string{"accept": "*/*"},
+			want:    true,
+		},
+		{
+			name:   "browser navigation",
+			method: "GET",
+			headers: map[string]string{
+				"accept":         "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
+				"sec-fetch-mode": "navigate",
+			},
+			want: true,
+		},
+		{
+			name:    "head",
+			method:  "HEAD",
+			headers: map[string]string{"accept": "text/html"},
+			want:    true,
+		},
+		{
+			name:    "json",
+			method:  "GET",
+			headers: map[string]string{"accept": "application/json"},
+		},
+		{
+			name:    "json with parameters",
+			method:  "GET",
+			headers: map[string]string{"Accept": "application/json; charset=utf-8, */*;q=0.1"},
+		},
+		{
+			name:    "html or json",
+			method:  "GET",
+			headers: map[string]string{"accept": "application/json, text/html"},
+			want:    true,
+		},
+		{
+			name:    "xhr",
+			method:  "GET",
+			headers: map[string]string{"x-requested-with": "XMLHttpRequest"},
+		},
+		{
+			name:   "fetch",
+			method: "GET",
+			headers: map[string]string{
+				"accept":         "*/*",
+				"sec-fetch-mode": "cors",
+			},
+		},
+		{
+			name:    "post",
+			method:  "POST",
+			headers: map[string]string{"accept": "text/html"},
+		},
+		{
+			name:   "delete",
+			method: "DELETE",
+		},
+	}
+	for _, test := range testData {
+		t.Run(test.name, func(t *testing.T) {
+			req := &jssopb.AuthorizeHTTPRequest{
+				RequestMethod: test.method,
+			}
+			for k, v := range test.headers {
+				req.Headers = append(req.Headers, &types.Header{Key: k, Value: v})
+			}
+			if got, want := wantsRedirect(req), test.want; got != want {
+				t.Errorf("wants redirect:\n  got: %v\n want: %v", got, want)
+			}
+		})
+	}
+}
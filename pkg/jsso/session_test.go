@@ -1,11 +1,13 @@
 package jsso
 
 import (
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
-	"github.com/jmoiron/sqlx"
 	"github.com/jrockway/jsso2/pkg/client"
 	"github.com/jrockway/jsso2/pkg/jssopb"
 	"github.com/jrockway/jsso2/pkg/jtesting"
@@ -54,8 +56,8 @@ func TestAuthorizeHTTP(t *testing.T) {
 		tainted := proto.Clone(session).(*types.Session)
 		tainted.Id[0]++
 		tainted.Taints = []string{sessions.TaintStartLogin}
-		if err := db.DoTx(e.Context, e.Logger, false, func(tx *sqlx.Tx) error {
-			return store.UpdateSession(e.Context, tx, tainted)
+		if err := db.DoTx(e.Context, e.Logger, false, func(tx store.Tx) error {
+			return tx.UpdateSession(e.Context, tainted)
 		}); err != nil {
 			t.Fatal(err)
 		}
@@ -109,8 +111,10 @@ func TestAuthorizeHTTP(t *testing.T) {
 					},
 				},
 				wantReply: allow(&jssopb.Allow{
-					AddHeaders: nil,
-					Username:   session.GetUser().GetUsername(),
+					AddHeaders:    nil,
+					Username:      session.GetUser().GetUsername(),
+					UserId:        session.GetUser().GetId(),
+					SessionHandle: sessions.Handle(session),
 				}),
 			},
 			{
@@ -121,8 +125,10 @@ func TestAuthorizeHTTP(t *testing.T) {
 					},
 				},
 				wantReply: allow(&jssopb.Allow{
-					AddHeaders: nil,
-					Username:   session.GetUser().GetUsername(),
+					AddHeaders:    nil,
+					Username:      session.GetUser().GetUsername(),
+					UserId:        session.GetUser().GetId(),
+					SessionHandle: sessions.Handle(session),
 				}),
 			},
 			{
@@ -147,7 +153,9 @@ func TestAuthorizeHTTP(t *testing.T) {
 							Value: "Bearer barbaz",
 						},
 					},
-					Username: session.GetUser().GetUsername(),
+					Username:      session.GetUser().GetUsername(),
+					UserId:        session.GetUser().GetId(),
+					SessionHandle: sessions.Handle(session),
 				}),
 			},
 			{
@@ -182,7 +190,9 @@ func TestAuthorizeHTTP(t *testing.T) {
 							Value: "normal-tracking-cookie=you-got-me-too",
 						},
 					},
-					Username: session.GetUser().GetUsername(),
+					Username:      session.GetUser().GetUsername(),
+					UserId:        session.GetUser().GetId(),
+					SessionHandle: sessions.Handle(session),
 				}),
 			},
 			{
@@ -205,8 +215,10 @@ func TestAuthorizeHTTP(t *testing.T) {
 					},
 				},
 				wantReply: allow(&jssopb.Allow{
-					AddHeaders: []*types.Header{},
-					Username:   session.GetUser().GetUsername(),
+					AddHeaders:    []*types.Header{},
+					Username:      session.GetUser().GetUsername(),
+					UserId:        session.GetUser().GetId(),
+					SessionHandle: sessions.Handle(session),
 				}),
 			},
 			{
@@ -224,7 +236,9 @@ func TestAuthorizeHTTP(t *testing.T) {
 							Value: "foo=bar",
 						},
 					},
-					Username: session.GetUser().GetUsername(),
+					Username:      session.GetUser().GetUsername(),
+					UserId:        session.GetUser().GetId(),
+					SessionHandle: sessions.Handle(session),
 				}),
 			},
 			{
@@ -242,7 +256,9 @@ func TestAuthorizeHTTP(t *testing.T) {
 							Value: "Bearer foobar",
 						},
 					},
-					Username: session.GetUser().GetUsername(),
+					Username:      session.GetUser().GetUsername(),
+					UserId:        session.GetUser().GetId(),
+					SessionHandle: sessions.Handle(session),
 				}),
 			},
 			{
@@ -256,8 +272,10 @@ func TestAuthorizeHTTP(t *testing.T) {
 					},
 				},
 				wantReply: allow(&jssopb.Allow{
-					AddHeaders: []*types.Header{},
-					Username:   session.GetUser().GetUsername(),
+					AddHeaders:    []*types.Header{},
+					Username:      session.GetUser().GetUsername(),
+					UserId:        session.GetUser().GetId(),
+					SessionHandle: sessions.Handle(session),
 				}),
 			},
 		}
@@ -273,5 +291,40 @@ func TestAuthorizeHTTP(t *testing.T) {
 				}
 			})
 		}
+
+		t.Run("api client", func(t *testing.T) {
+			reply, err := cs.SessionClient.AuthorizeHTTP(e.Context, &jssopb.AuthorizeHTTPRequest{
+				RequestMethod: "GET",
+				RequestUri:    "https://app.example.com/api/things?page=2",
+				Headers: []*types.Header{
+					{Key: "accept", Value: "application/json"},
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := reply.GetDeny().GetCategory(), jssopb.Deny_NO_CREDENTIALS; got != want {
+				t.Errorf("category:\n  got: %v\n want: %v", got, want)
+			}
+			res := reply.GetDeny().GetResponse()
+			if res == nil {
+				t.Fatalf("expected a response, got %v", reply)
+			}
+			if got, want := res.GetStatusCode(), int32(http.StatusUnauthorized); got != want {
+				t.Errorf("status:\n  got: %v\n want: %v", got, want)
+			}
+			if got, want := res.GetContentType(), "application/json"; got != want {
+				t.Errorf("content-type:\n  got: %v\n want: %v", got, want)
+			}
+			var body struct {
+				LoginURL string `json:"login_url"`
+			}
+			if err := json.Unmarshal([]byte(res.GetBody()), &body); err != nil {
+				t.Fatalf("unmarshal body: %v", err)
+			}
+			if !strings.Contains(body.LoginURL, "/#/login/") {
+				t.Errorf("login url %q does not include a redirect token", body.LoginURL)
+			}
+		})
 	})
 }
@@ -3,9 +3,10 @@ package user
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
-	"github.com/jmoiron/sqlx"
+	"github.com/jrockway/jsso2/pkg/audit"
 	"github.com/jrockway/jsso2/pkg/internalauth"
 	"github.com/jrockway/jsso2/pkg/jssopb"
 	"github.com/jrockway/jsso2/pkg/sessions"
@@ -14,7 +15,7 @@ import (
 )
 
 type Service struct {
-	DB          *store.Connection
+	DB          store.Store
 	Permissions *internalauth.Permissions
 	Linker      *web.Linker
 }
@@ -26,12 +27,21 @@ func (s *Service) Edit(ctx context.Context, req *jssopb.EditUserRequest) (*jssop
 		return reply, fmt.Errorf("check permissions: %w", err)
 	}
 
-	if err := s.DB.DoTx(ctx, ctxzap.Extract(ctx), false, func(tx *sqlx.Tx) error {
+	if err := s.DB.DoTx(ctx, ctxzap.Extract(ctx), false, func(tx store.Tx) error {
 		user := req.GetUser()
-		err := store.UpdateUser(ctx, tx, user)
+		operation := "update"
+		if user.GetId() == 0 {
+			operation = "create"
+		}
+		err := tx.UpdateUser(ctx, user)
 		if err != nil {
 			return err
 		}
+		e := audit.New(ctx, audit.ActionUserEdit, user)
+		e.Details = map[string]string{"operation": operation}
+		if err := tx.AddAuditEvent(ctx, e); err != nil {
+			return fmt.Errorf("add audit event: %w", err)
+		}
 		reply.User = user
 		return nil
 	}); err != nil {
@@ -42,8 +52,8 @@ func (s *Service) Edit(ctx context.Context, req *jssopb.EditUserRequest) (*jssop
 
 func (s *Service) GenerateEnrollmentLink(ctx context.Context, req *jssopb.GenerateEnrollmentLinkRequest) (*jssopb.GenerateEnrollmentLinkReply, error) {
 	reply := new(jssopb.GenerateEnrollmentLinkReply)
-	if err := s.DB.DoTx(ctx, ctxzap.Extract(ctx), false, func(tx *sqlx.Tx) error {
-		if err := store.LookupUser(ctx, tx, req.GetTarget()); err != nil {
+	if err := s.DB.DoTx(ctx, ctxzap.Extract(ctx), false, func(tx store.Tx) error {
+		if err := tx.LookupUser(ctx, req.GetTarget()); err != nil {
 			return fmt.Errorf("lookup target user: %w", err)
 		}
 		if err := s.Permissions.AllowGenerateEnrollmentLink(ctx, req.GetTarget(), sessions.MustFromContext(ctx)); err != nil {
@@ -53,9 +63,14 @@ func (s *Service) GenerateEnrollmentLink(ctx context.Context, req *jssopb.Genera
 		if err != nil {
 			return fmt.Errorf("generate session prototype: %w", err)
 		}
-		if err := store.UpdateSession(ctx, tx, session); err != nil {
+		if err := tx.UpdateSession(ctx, session); err != nil {
 			return fmt.Errorf("store session: %w", err)
 		}
+		e := audit.New(ctx, audit.ActionGenerateEnrollmentLink, req.GetTarget())
+		e.Details = map[string]string{"expires_at": session.GetExpiresAt().AsTime().Format(time.RFC3339)}
+		if err := tx.AddAuditEvent(ctx, e); err != nil {
+			return fmt.Errorf("add audit event: %w", err)
+		}
 		reply.Token = sessions.ToBase64(session)
 		reply.Url = s.Linker.EnrollmentPage(reply.Token)
 		return nil
@@ -0,0 +1,184 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"github.com/jrockway/jsso2/pkg/internalauth"
+	"github.com/jrockway/jsso2/pkg/jssopb"
+	"github.com/jrockway/jsso2/pkg/sessions"
+	"github.com/jrockway/jsso2/pkg/store"
+	"github.com/jrockway/jsso2/pkg/types"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	defaultListLimit = 100
+	maxListLimit     = 1000
+	secretLength     = 32
+)
+
+type Service struct {
+	DB          store.Store
+	Permissions *internalauth.Permissions
+}
+
+// Add implements jssopb.WebhooksService.
+func (s *Service) Add(ctx context.Context, req *jssopb.AddWebhookRequest) (*jssopb.AddWebhookReply, error) {
+	reply := new(jssopb.AddWebhookReply)
+	if err := s.Permissions.AllowManageWebhooks(ctx, sessions.MustFromContext(ctx)); err != nil {
+		return reply, fmt.Errorf("check permissions: %w", err)
+	}
+	w := req.GetWebhook()
+	u, err := url.Parse(w.GetUrl())
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return reply, status.Error(codes.InvalidArgument, fmt.Sprintf("url %q must be an absolute http or https url", w.GetUrl()))
+	}
+	if len(w.GetEventTypes()) == 0 {
+		return reply, status.Error(codes.InvalidArgument, "at least one event type is required")
+	}
+	for _, t := range w.GetEventTypes() {
+		if _, ok := types.Event_Type_name[int32(t)]; !ok || t == types.Event_TYPE_UNKNOWN {
+			return reply, status.Error(codes.InvalidArgument, fmt.Sprintf("unknown event type %v", t))
+		}
+	}
+	secret := make([]byte, secretLength)
+	if _, err := rand.Read(secret); err != nil {
+		return reply, fmt.Errorf("generate secret: %w", err)
+	}
+	reply.Webhook = &types.Webhook{
+		CreatedAt:   timestamppb.New(time.Now().Truncate(time.Millisecond)),
+		Url:         w.GetUrl(),
+		Description: w.GetDescription(),
+		EventTypes:  w.GetEventTypes(),
+		Secret:      secret,
+	}
+	if err := s.DB.DoTx(ctx, ctxzap.Extract(ctx), false, func(tx store.Tx) error {
+		return tx.AddWebhook(ctx, reply.Webhook)
+	}); err != nil {
+		return reply, store.AsGRPCError(fmt.Errorf("add webhook: %w", err))
+	}
+	return reply, nil
+}
+
+// List implements jssopb.WebhooksService.
+func (s *Service) List(ctx context.Context, req *jssopb.ListWebhooksRequest) (*jssopb.ListWebhooksReply, error) {
+	reply := new(jssopb.ListWebhooksReply)
+	if err := s.Permissions.AllowManageWebhooks(ctx, sessions.MustFromContext(ctx)); err != nil {
+		return reply, fmt.Errorf("check permissions: %w", err)
+	}
+	if err := s.DB.DoTx(ctx, ctxzap.Extract(ctx), true, func(tx store.Tx) (err error) {
+		reply.Webhooks, err = tx.GetWebhooks(ctx)
+		return
+	}); err != nil {
+		return reply, store.AsGRPCError(fmt.Errorf("get webhooks: %w", err))
+	}
+	for _, w := range reply.Webhooks {
+		w.Secret = nil
+	}
+	return reply, nil
+}
+
+// Delete implements jssopb.WebhooksService.
+func (s *Service) Delete(ctx context.Context, req *jssopb.DeleteWebhookRequest) (*jssopb.DeleteWebhookReply, error) {
+	reply := new(jssopb.DeleteWebhookReply)
+	if err := s.Permissions.AllowManageWebhooks(ctx, sessions.MustFromContext(ctx)); err != nil {
+		return reply, fmt.Errorf("check permissions: %w", err)
+	}
+	if err := s.DB.DoTx(ctx, ctxzap.Extract(ctx), false, func(tx store.Tx) error {
+		return tx.DeleteWebhook(ctx, req.GetId())
+	}); err != nil {
+		return reply, store.AsGRPCError(fmt.Errorf("delete webhook %d: %w", req.GetId(), err))
+	}
+	return reply, nil
+}
+
+// ListDeliveries implements jssopb.WebhooksService.
+func (s *Service) ListDeliveries(ctx context.Context, req *jssopb.ListWebhookDeliveriesRequest) (*jssopb.ListWebhookDeliveriesReply, error) {
+	reply := new(jssopb.ListWebhookDeliveriesReply)
+	if err := s.Permissions.AllowManageWebhooks(ctx, sessions.MustFromContext(ctx)); err != nil {
+		return reply, fmt.Errorf("check permissions: %w", err)
+	}
+
+	limit := int(req.GetLimit())
+	if limit < 0 || limit > maxListLimit {
+		return reply, status.Error(codes.InvalidArgument, fmt.Sprintf("limit must be between 0 and %d", maxListLimit))
+	} else if limit == 0 {
+		limit = defaultListLimit
+	}
+	if _, ok := types.WebhookDelivery_State_name[int32(req.GetState())]; !ok {
+		return reply, status.Error(codes.InvalidArgument, fmt.Sprintf("unknown state %v", req.GetState()))
+	}
+	filter := &store.WebhookDeliveryFilter{
+		WebhookID: req.GetWebhookId(),
+		State:     req.GetState(),
+		// Ask for one extra delivery, to see if there's another page.
+		Limit: limit + 1,
+	}
+	if token := req.GetPageToken(); token != "" {
+		id, err := strconv.ParseInt(token, 10, 64)
+		if err != nil || id < 1 {
+			return reply, status.Error(codes.InvalidArgument, fmt.Sprintf("invalid page token %q", token))
+		}
+		filter.BeforeID = id
+	}
+
+	if err := s.DB.DoTx(ctx, ctxzap.Extract(ctx), true, func(tx store.Tx) (err error) {
+		reply.Deliveries, err = tx.QueryWebhookDeliveries(ctx, filter)
+		return
+	}); err != nil {
+		return reply, store.AsGRPCError(fmt.Errorf("query webhook deliveries: %w", err))
+	}
+	if len(reply.Deliveries) > limit {
+		reply.Deliveries = reply.Deliveries[:limit]
+		reply.NextPageToken = strconv.FormatInt(reply.Deliveries[limit-1].GetId(), 10)
+	}
+	return reply, nil
+}
+
+// Retry implements jssopb.WebhooksService.  The delivery gets a fresh set of attempts, so that a
+// dead delivery isn't immediately marked dead again.
+func (s *Service) Retry(ctx context.Context, req *jssopb.RetryWebhookDeliveryRequest) (*jssopb.RetryWebhookDeliveryReply, error) {
+	reply := new(jssopb.RetryWebhookDeliveryReply)
+	if err := s.Permissions.AllowManageWebhooks(ctx, sessions.MustFromContext(ctx)); err != nil {
+		return reply, fmt.Errorf("check permissions: %w", err)
+	}
+	var succeeded bool
+	if err := s.DB.DoTx(ctx, ctxzap.Extract(ctx), false, func(tx store.Tx) error {
+		succeeded = false
+		ds, err := tx.QueryWebhookDeliveries(ctx, &store.WebhookDeliveryFilter{ID: req.GetId()})
+		if err != nil {
+			return fmt.Errorf("lookup delivery: %w", err)
+		}
+		if len(ds) == 0 {
+			return fmt.Errorf("lookup delivery: %w", sql.ErrNoRows)
+		}
+		d := ds[0]
+		if d.GetState() == types.WebhookDelivery_SUCCEEDED {
+			succeeded = true
+			return nil
+		}
+		d.State = types.WebhookDelivery_PENDING
+		d.Attempts = 0
+		d.NextAttemptAt = timestamppb.New(time.Now().Truncate(time.Millisecond))
+		if err := tx.UpdateWebhookDelivery(ctx, d); err != nil {
+			return fmt.Errorf("reschedule delivery: %w", err)
+		}
+		reply.Delivery = d
+		return nil
+	}); err != nil {
+		return reply, store.AsGRPCError(fmt.Errorf("retry delivery %d: %w", req.GetId(), err))
+	}
+	if succeeded {
+		return reply, status.Error(codes.FailedPrecondition, fmt.Sprintf("delivery %d already succeeded", req.GetId()))
+	}
+	return reply, nil
+}
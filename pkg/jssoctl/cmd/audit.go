@@ -0,0 +1,171 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jrockway/jsso2/pkg/jssopb"
+	"github.com/jrockway/jsso2/pkg/types"
+	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+var (
+	auditCmd = &cobra.Command{
+		Use:   "audit",
+		Short: "Read the audit log",
+		Long: `Print audit log events that match all of the provided filters, newest first.
+
+--since and --until accept either an RFC 3339 timestamp, or a duration like 24h, meaning that long ago.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			flags := cmd.Flags()
+			req := &jssopb.QueryAuditRequest{}
+			var err error
+			if req.Action, err = flags.GetString("action"); err != nil {
+				return fmt.Errorf("get action: %w", err)
+			}
+			if req.Actor, err = userFromFlags(cmd, "actor"); err != nil {
+				return err
+			}
+			if req.Target, err = userFromFlags(cmd, "target"); err != nil {
+				return err
+			}
+			if req.Since, err = timeFromFlag(cmd, "since"); err != nil {
+				return err
+			}
+			if req.Until, err = timeFromFlag(cmd, "until"); err != nil {
+				return err
+			}
+			if result, err := flags.GetString("result"); err != nil {
+				return fmt.Errorf("get result: %w", err)
+			} else if result != "" {
+				r, ok := types.AuditEvent_Result_value[strings.ToUpper(result)]
+				if !ok {
+					return fmt.Errorf("unknown result %q; try success or failure", result)
+				}
+				req.Result = types.AuditEvent_Result(r)
+			}
+			if req.Limit, err = flags.GetInt32("limit"); err != nil {
+				return fmt.Errorf("get limit: %w", err)
+			}
+			if req.PageToken, err = flags.GetString("page-token"); err != nil {
+				return fmt.Errorf("get page token: %w", err)
+			}
+
+			reply, err := clientset.AuditClient.Query(cmd.Context(), req)
+			if err != nil {
+				return fmt.Errorf("query audit log: %w", err)
+			}
+			if jsonOutput {
+				fmt.Fprintln(cmd.OutOrStdout(), protojson.Format(reply))
+				fmt.Fprintln(cmd.ErrOrStderr(), "OK")
+				return nil
+			}
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 8, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tTIME\tACTION\tACTOR\tTARGET\tIP\tRESULT\tERROR")
+			for _, e := range reply.GetEvents() {
+				fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", e.GetId(), e.GetCreatedAt().AsTime().Local().Format(time.RFC3339), e.GetAction(), e.GetActor().GetUsername(), e.GetTarget().GetUsername(), e.GetIpAddress(), strings.ToLower(e.GetResult().String()), e.GetError())
+			}
+			if err := w.Flush(); err != nil {
+				return fmt.Errorf("flush output: %w", err)
+			}
+			if token := reply.GetNextPageToken(); token != "" {
+				fmt.Fprintf(cmd.ErrOrStderr(), "More events are available; rerun with --page-token=%s\n", token)
+			}
+			return nil
+		},
+	}
+
+	auditVerifyCmd = &cobra.Command{
+		Use:   "verify",
+		Short: "Check the audit log for tampering",
+		Long: `Walk the entire audit log, checking that each event's hash covers its contents and the previous
+event, and that each signed checkpoint matches the event it refers to.  Exits with an error if
+any problems are found.
+
+Events newer than the last checkpoint can be deleted without detection; the server signs a new
+checkpoint every --audit_checkpoint_interval.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			reply, err := clientset.AuditClient.Verify(cmd.Context(), &jssopb.VerifyAuditRequest{})
+			if err != nil {
+				return fmt.Errorf("verify audit log: %w", err)
+			}
+			if jsonOutput {
+				fmt.Fprintln(cmd.OutOrStdout(), protojson.Format(reply))
+			} else {
+				fmt.Fprintf(cmd.OutOrStdout(), "events checked: %d\n", reply.GetEventsChecked())
+				fmt.Fprintf(cmd.OutOrStdout(), "unchained events: %d\n", reply.GetUnchainedEvents())
+				fmt.Fprintf(cmd.OutOrStdout(), "checkpoints checked: %d\n", reply.GetCheckpointsChecked())
+				fmt.Fprintf(cmd.OutOrStdout(), "events after last checkpoint: %d\n", reply.GetEventsAfterLastCheckpoint())
+				for _, p := range reply.GetProblems() {
+					fmt.Fprintf(cmd.OutOrStdout(), "problem: %s\n", p)
+				}
+			}
+			if n := len(reply.GetProblems()); n > 0 {
+				return fmt.Errorf("audit log failed verification with %d problem(s)", n)
+			}
+			if jsonOutput {
+				fmt.Fprintln(cmd.ErrOrStderr(), "OK")
+			}
+			return nil
+		},
+	}
+)
+
+// userFromFlags returns the user selected by the --<name> and --<name>-id flags, or nil if neither
+// is set.
+func userFromFlags(cmd *cobra.Command, name string) (*types.User, error) {
+	username, err := cmd.Flags().GetString(name)
+	if err != nil {
+		return nil, fmt.Errorf("get %s: %w", name, err)
+	}
+	id, err := cmd.Flags().GetInt64(name + "-id")
+	if err != nil {
+		return nil, fmt.Errorf("get %s-id: %w", name, err)
+	}
+	if username == "" && id == 0 {
+		return nil, nil
+	}
+	return &types.User{Id: id, Username: username}, nil
+}
+
+// timeFromFlag parses a flag containing either an RFC 3339 timestamp or a duration before now.
+func timeFromFlag(cmd *cobra.Command, name string) (*timestamppb.Timestamp, error) {
+	value, err := cmd.Flags().GetString(name)
+	if err != nil {
+		return nil, fmt.Errorf("get %s: %w", name, err)
+	}
+	if value == "" {
+		return nil, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return timestamppb.New(time.Now().Add(-d)), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("parse --%s: %q is neither a duration nor an RFC 3339 timestamp", name, value)
+	}
+	return timestamppb.New(t), nil
+}
+
+func init() {
+	auditCmd.Flags().String("action", "", "only show events with this action, like login.finish")
+	auditCmd.Flags().String("actor", "", "only show events performed by the user with this username")
+	auditCmd.Flags().Int64("actor-id", 0, "only show events performed by the user with this id")
+	auditCmd.Flags().String("target", "", "only show events affecting the user with this username")
+	auditCmd.Flags().Int64("target-id", 0, "only show events affecting the user with this id")
+	auditCmd.Flags().String("since", "", "only show events that happened at or after this time")
+	auditCmd.Flags().String("until", "", "only show events that happened before this time")
+	auditCmd.Flags().String("result", "", "only show events with this result; success or failure")
+	auditCmd.Flags().Int32("limit", 0, "the maximum number of events to show; the server's default is 100")
+	auditCmd.Flags().String("page-token", "", "continue a previous query where it left off")
+	AddClientset(auditCmd)
+
+	AddClientset(auditVerifyCmd)
+	auditCmd.AddCommand(auditVerifyCmd)
+}
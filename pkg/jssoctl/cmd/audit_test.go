@@ -0,0 +1,155 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jrockway/jsso2/pkg/client"
+	"github.com/jrockway/jsso2/pkg/jssopb"
+	"github.com/jrockway/jsso2/pkg/jtesting"
+	"github.com/jrockway/jsso2/pkg/sessions"
+	"github.com/jrockway/jsso2/pkg/testserver"
+	"github.com/jrockway/jsso2/pkg/types"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/testing/protocmp"
+)
+
+func TestAudit(t *testing.T) {
+	for _, inMemory := range []bool{false, true} {
+		name := "audit"
+		if inMemory {
+			name += "_in_memory"
+		}
+		testAudit(t, name, inMemory)
+	}
+}
+
+func testAudit(t *testing.T, name string, inMemory bool) {
+	t.Helper()
+	jsonOutput = true
+	s := testserver.New()
+	s.InMemory = inMemory
+	r := &jtesting.R{Logger: true, Database: true}
+	s.ToR(r)
+	s.Credentials = &client.Credentials{Root: "root"}
+	jtesting.Run(t, name, *r, func(t *testing.T, e *jtesting.E) {
+		clientset = client.FromCC(e.ClientConn)
+		noClose = true
+
+		run := func(t *testing.T, args ...string) *jssopb.QueryAuditReply {
+			t.Helper()
+			rootCmd.SetArgs(args)
+			out := new(bytes.Buffer)
+			rootCmd.SetOut(out)
+			rootCmd.SetErr(new(bytes.Buffer))
+			defer rootCmd.SetOut(os.Stderr)
+			defer rootCmd.SetErr(os.Stderr)
+			if err := rootCmd.ExecuteContext(cmdCtx); err != nil {
+				t.Fatalf("execute %v: %v", args, err)
+			}
+			if args[0] != "audit" {
+				return nil
+			}
+			reply := new(jssopb.QueryAuditReply)
+			if err := protojson.Unmarshal(out.Bytes(), reply); err != nil {
+				t.Fatalf("parse result: %v", err)
+			}
+			// The expiration time of enrollment links varies, so just check that it's there.
+			for _, e := range reply.GetEvents() {
+				if e.GetAction() == "user.generate_enrollment_link" {
+					if e.GetDetails()["expires_at"] == "" {
+						t.Errorf("event %d: no expires_at detail", e.GetId())
+					}
+					delete(e.Details, "expires_at")
+				}
+			}
+			return reply
+		}
+		run(t, "users", "add", "test")
+		run(t, "users", "enroll", "--username=test")
+
+		root := &types.User{Id: sessions.RootUser, Username: sessions.RootUsername}
+		test := &types.User{Id: 1, Username: "test"}
+		edit := &types.AuditEvent{
+			Id:      1,
+			Action:  "user.edit",
+			Actor:   root,
+			Target:  test,
+			Result:  types.AuditEvent_SUCCESS,
+			Details: map[string]string{"operation": "create"},
+		}
+		enroll := &types.AuditEvent{
+			Id:     2,
+			Action: "user.generate_enrollment_link",
+			Actor:  root,
+			Target: test,
+			Result: types.AuditEvent_SUCCESS,
+		}
+		opts := []cmp.Option{
+			protocmp.Transform(),
+			protocmp.IgnoreFields(&types.AuditEvent{}, "created_at", "user_agent", "prev_hash", "hash"),
+		}
+
+		testData := []struct {
+			name string
+			args []string
+			want *jssopb.QueryAuditReply
+		}{
+			{
+				name: "all",
+				args: []string{"audit", "--target=test", "--limit=0", "--page-token="},
+				want: &jssopb.QueryAuditReply{Events: []*types.AuditEvent{enroll, edit}},
+			},
+			{
+				name: "by action",
+				args: []string{"audit", "--action=user.edit", "--target=", "--target-id=1", "--result=success"},
+				want: &jssopb.QueryAuditReply{Events: []*types.AuditEvent{edit}},
+			},
+			{
+				name: "failures",
+				args: []string{"audit", "--action=", "--result=failure"},
+				want: &jssopb.QueryAuditReply{},
+			},
+			{
+				name: "first page",
+				args: []string{"audit", "--action=", "--result=", "--since=1h", "--limit=1"},
+				want: &jssopb.QueryAuditReply{Events: []*types.AuditEvent{enroll}, NextPageToken: "2"},
+			},
+			{
+				name: "second page",
+				args: []string{"audit", "--limit=1", "--page-token=2"},
+				want: &jssopb.QueryAuditReply{Events: []*types.AuditEvent{edit}},
+			},
+		}
+		for _, test := range testData {
+			t.Run(test.name, func(t *testing.T) {
+				got := run(t, test.args...)
+				if diff := cmp.Diff(got, test.want, opts...); diff != "" {
+					t.Errorf("reply (-got +want):\n%s", diff)
+				}
+			})
+		}
+
+		t.Run("verify", func(t *testing.T) {
+			rootCmd.SetArgs([]string{"audit", "verify"})
+			out := new(bytes.Buffer)
+			rootCmd.SetOut(out)
+			rootCmd.SetErr(new(bytes.Buffer))
+			defer rootCmd.SetOut(os.Stderr)
+			defer rootCmd.SetErr(os.Stderr)
+			if err := rootCmd.ExecuteContext(cmdCtx); err != nil {
+				t.Fatalf("execute: %v", err)
+			}
+			got := new(jssopb.VerifyAuditReply)
+			if err := protojson.Unmarshal(out.Bytes(), got); err != nil {
+				t.Fatalf("parse result: %v", err)
+			}
+			want := &jssopb.VerifyAuditReply{EventsChecked: 2, EventsAfterLastCheckpoint: 2}
+			if diff := cmp.Diff(got, want, protocmp.Transform()); diff != "" {
+				t.Errorf("reply (-got +want):\n%s", diff)
+			}
+		})
+	})
+}
@@ -3,6 +3,7 @@ package cmd
 import (
 	"encoding/base64"
 	"fmt"
+	"strings"
 
 	"github.com/jrockway/jsso2/pkg/tokens"
 	"github.com/spf13/cobra"
@@ -16,21 +17,32 @@ var (
 	}
 
 	decryptTokenCmd = &cobra.Command{
-		Use:   "decrypt-token [base64-key|key] [token]",
+		Use:   "decrypt-token [base64-key|key|keyring] [token]",
 		Short: "Decrypt a paseto token generated by the tokens package.",
 		Args:  cobra.ExactArgs(2),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			var key []byte
-			if len(args[0]) == 32 {
-				key = []byte(args[0])
+			var keys *tokens.Keyring
+			if strings.Contains(args[0], ":") {
+				var err error
+				if keys, err = tokens.ParseKeyring(args[0]); err != nil {
+					return err
+				}
 			} else {
-				raw, err := base64.StdEncoding.DecodeString(args[0])
-				if err != nil {
+				key := []byte(args[0])
+				if len(args[0]) != 32 {
+					raw, err := base64.StdEncoding.DecodeString(args[0])
+					if err != nil {
+						return err
+					}
+					key = raw
+				}
+				var base tokens.GeneratorConfig
+				if err := base.SetKey(key); err != nil {
 					return err
 				}
-				key = raw
+				keys = base.Keyring
 			}
-			msg, err := tokens.Decrypt(args[1], key)
+			msg, err := tokens.Decrypt(args[1], keys)
 			if err != nil {
 				return err
 			}
@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/jrockway/jsso2/pkg/jssopb"
+	"github.com/jrockway/jsso2/pkg/types"
+	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+var (
+	eventsCmd = &cobra.Command{
+		Use:   "events",
+		Short: "Watch events as they happen",
+		Long: `Print events as they happen, oldest first, until --count events have been printed or --timeout
+expires.  Pass --timeout=0 to watch forever.
+
+Each event is printed with a cursor; pass it to --cursor to resume where you left off.  With
+--cursor=0, every event that has ever happened is printed first.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			flags := cmd.Flags()
+			req := &jssopb.WatchEventsRequest{}
+			var err error
+			if req.Types, err = eventTypesFromFlag(cmd, "type"); err != nil {
+				return err
+			}
+			if req.Target, err = userFromFlags(cmd, "target"); err != nil {
+				return err
+			}
+			if req.Cursor, err = flags.GetString("cursor"); err != nil {
+				return fmt.Errorf("get cursor: %w", err)
+			}
+			count, err := flags.GetInt("count")
+			if err != nil {
+				return fmt.Errorf("get count: %w", err)
+			}
+
+			ctx := cmd.Context()
+			stream, err := clientset.EventsClient.Watch(ctx, req)
+			if err != nil {
+				return fmt.Errorf("watch events: %w", err)
+			}
+			for n := 0; count == 0 || n < count; n++ {
+				reply, err := stream.Recv()
+				if err == io.EOF || ctx.Err() != nil {
+					return nil
+				}
+				if err != nil {
+					return fmt.Errorf("receive event: %w", err)
+				}
+				e := reply.GetEvent()
+				if jsonOutput {
+					fmt.Fprintln(cmd.OutOrStdout(), protojson.MarshalOptions{}.Format(e))
+					continue
+				}
+				a := e.GetAuditEvent()
+				fmt.Fprintf(cmd.OutOrStdout(), "%s\t%s\t%s\tactor=%s\ttarget=%s\tip=%s\tcursor=%s\n", a.GetCreatedAt().AsTime().Local().Format(time.RFC3339), strings.ToLower(e.GetType().String()), a.GetAction(), a.GetActor().GetUsername(), a.GetTarget().GetUsername(), a.GetIpAddress(), e.GetCursor())
+			}
+			return nil
+		},
+	}
+)
+
+// eventTypesFromFlag parses a flag containing a list of event type names, like login or
+// session_revoked.
+func eventTypesFromFlag(cmd *cobra.Command, name string) ([]types.Event_Type, error) {
+	names, err := cmd.Flags().GetStringSlice(name)
+	if err != nil {
+		return nil, fmt.Errorf("get %s: %w", name, err)
+	}
+	var result []types.Event_Type
+	for _, n := range names {
+		t, ok := types.Event_Type_value[strings.ToUpper(n)]
+		if !ok || t == int32(types.Event_TYPE_UNKNOWN) {
+			return nil, fmt.Errorf("unknown event type %q; try one of login, login_failed, login_from_new_ip, logout, session_revoked, credential_added, or user_changed", n)
+		}
+		result = append(result, types.Event_Type(t))
+	}
+	return result, nil
+}
+
+func init() {
+	eventsCmd.Flags().StringSlice("type", nil, "only show events of these types, like login or session_revoked")
+	eventsCmd.Flags().String("target", "", "only show events affecting the user with this username")
+	eventsCmd.Flags().Int64("target-id", 0, "only show events affecting the user with this id")
+	eventsCmd.Flags().String("cursor", "", "start after the event with this cursor, instead of at the current time")
+	eventsCmd.Flags().Int("count", 0, "exit after printing this many events; 0 means no limit")
+	AddClientset(eventsCmd)
+}
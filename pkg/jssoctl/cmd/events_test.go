@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/jrockway/jsso2/pkg/client"
+	"github.com/jrockway/jsso2/pkg/jtesting"
+	"github.com/jrockway/jsso2/pkg/testserver"
+	"github.com/jrockway/jsso2/pkg/types"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+func TestEvents(t *testing.T) {
+	jsonOutput = true
+	s := testserver.New()
+	s.InMemory = true
+	r := &jtesting.R{Logger: true}
+	s.ToR(r)
+	s.Credentials = &client.Credentials{Root: "root"}
+	jtesting.Run(t, "events", *r, func(t *testing.T, e *jtesting.E) {
+		clientset = client.FromCC(e.ClientConn)
+		noClose = true
+
+		run := func(t *testing.T, args ...string) string {
+			t.Helper()
+			rootCmd.SetArgs(args)
+			out := new(bytes.Buffer)
+			rootCmd.SetOut(out)
+			rootCmd.SetErr(new(bytes.Buffer))
+			defer rootCmd.SetOut(os.Stderr)
+			defer rootCmd.SetErr(os.Stderr)
+			if err := rootCmd.ExecuteContext(cmdCtx); err != nil {
+				t.Fatalf("execute %v: %v", args, err)
+			}
+			return out.String()
+		}
+		run(t, "users", "add", "alice")
+		run(t, "users", "add", "bob")
+
+		lines := strings.Split(strings.TrimSpace(run(t, "events", "--cursor=0", "--count=2", "--type=user_changed")), "\n")
+		var got []string
+		for _, line := range lines {
+			event := new(types.Event)
+			if err := protojson.Unmarshal([]byte(line), event); err != nil {
+				t.Fatalf("parse event %q: %v", line, err)
+			}
+			got = append(got, event.GetCursor()+":"+event.GetAuditEvent().GetTarget().GetUsername())
+		}
+		if want := "1:alice 2:bob"; strings.Join(got, " ") != want {
+			t.Errorf("events:\n  got: %v\n want: %v", got, want)
+		}
+	})
+}
@@ -0,0 +1,195 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/jrockway/jsso2/pkg/tokens"
+	"github.com/spf13/cobra"
+)
+
+var (
+	keyringCmd = &cobra.Command{
+		Use:   "keyring",
+		Short: "Generate and rotate token keyrings",
+		Long: `Manipulate the keyrings passed to the server's --token_keyring flag.  These commands work
+offline; they read the keyring from --keyring (or $JSSOCTL_KEYRING) and print the new keyring.
+
+To rotate keys without logging anyone out or breaking in-flight logins:
+
+  1. Add a new key with "jssoctl keyring add" and deploy the result everywhere.  The new key can
+     verify tokens, but isn't used to issue them yet.
+  2. Make it active with "jssoctl keyring activate <id>" and deploy again.
+  3. Once tokens issued with the old key have expired (a few minutes), remove it with
+     "jssoctl keyring remove <id>" and deploy again.
+
+To switch from --token_key, add the old key with "jssoctl keyring add --token-key=<key>" to a
+newly-generated keyring before activating the new key; tokens issued with the old key have no key
+id, so they're checked against every key in the keyring.
+
+Keyrings passed to --assertion_keyring are managed the same way; their public keys, printed by
+"jssoctl keyring jwks", are what upstream services use to verify identity assertions.`,
+	}
+
+	keyringGenerateCmd = &cobra.Command{
+		Use:   "generate",
+		Short: "Print a new keyring containing one random key",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := cmd.Flags().GetString("id")
+			if err != nil {
+				return fmt.Errorf("get id: %w", err)
+			}
+			k, err := tokens.GenerateKey(id)
+			if err != nil {
+				return fmt.Errorf("generate key: %w", err)
+			}
+			keys, err := tokens.NewKeyring(k)
+			if err != nil {
+				return fmt.Errorf("create keyring: %w", err)
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), keys.String())
+			return nil
+		},
+	}
+
+	keyringAddCmd = &cobra.Command{
+		Use:   "add",
+		Short: "Add an inactive key to a keyring",
+		Long: `Add a key to the keyring, without making it active.  By default, a random key is generated; pass
+--token-key to add the value of an old --token_key flag instead.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			keys, err := keyringFromFlag(cmd)
+			if err != nil {
+				return err
+			}
+			id, err := cmd.Flags().GetString("id")
+			if err != nil {
+				return fmt.Errorf("get id: %w", err)
+			}
+			old, err := cmd.Flags().GetString("token-key")
+			if err != nil {
+				return fmt.Errorf("get token key: %w", err)
+			}
+			var k *tokens.Key
+			if old != "" {
+				if id == "" {
+					return errors.New("--id is required with --token-key")
+				}
+				k = &tokens.Key{ID: id, Secret: []byte(old)}
+			} else if k, err = tokens.GenerateKey(id); err != nil {
+				return fmt.Errorf("generate key: %w", err)
+			}
+			if keys, err = keys.Add(k); err != nil {
+				return fmt.Errorf("add key: %w", err)
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), keys.String())
+			return nil
+		},
+	}
+
+	keyringActivateCmd = &cobra.Command{
+		Use:   "activate <id>",
+		Short: "Make a key the one that issues new tokens",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			keys, err := keyringFromFlag(cmd)
+			if err != nil {
+				return err
+			}
+			if keys, err = keys.Activate(args[0]); err != nil {
+				return fmt.Errorf("activate key: %w", err)
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), keys.String())
+			return nil
+		},
+	}
+
+	keyringRemoveCmd = &cobra.Command{
+		Use:   "remove <id>",
+		Short: "Remove an inactive key from a keyring",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			keys, err := keyringFromFlag(cmd)
+			if err != nil {
+				return err
+			}
+			if keys, err = keys.Remove(args[0]); err != nil {
+				return fmt.Errorf("remove key: %w", err)
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), keys.String())
+			return nil
+		},
+	}
+
+	keyringShowCmd = &cobra.Command{
+		Use:   "show",
+		Short: "Print the ids of the keys in a keyring, without their secrets",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			keys, err := keyringFromFlag(cmd)
+			if err != nil {
+				return err
+			}
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 8, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tSTATE")
+			for i, k := range keys.All() {
+				state := "verify only"
+				if i == 0 {
+					state = "active"
+				}
+				fmt.Fprintf(w, "%s\t%s\n", k.ID, state)
+			}
+			if err := w.Flush(); err != nil {
+				return fmt.Errorf("flush output: %w", err)
+			}
+			return nil
+		},
+	}
+
+	keyringJWKSCmd = &cobra.Command{
+		Use:   "jwks",
+		Short: "Print the public keys of an assertion keyring as a JSON Web Key Set",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			keys, err := keyringFromFlag(cmd)
+			if err != nil {
+				return err
+			}
+			js, err := tokens.MarshalJWKS(keys.PublicKeys())
+			if err != nil {
+				return fmt.Errorf("marshal public keys: %w", err)
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), string(js))
+			return nil
+		},
+	}
+)
+
+// keyringFromFlag parses the keyring passed to --keyring.
+func keyringFromFlag(cmd *cobra.Command) (*tokens.Keyring, error) {
+	raw, err := cmd.Flags().GetString("keyring")
+	if err != nil {
+		return nil, fmt.Errorf("get keyring: %w", err)
+	}
+	if raw == "" {
+		return nil, errors.New("--keyring is required")
+	}
+	keys, err := tokens.ParseKeyring(raw)
+	if err != nil {
+		return nil, fmt.Errorf("parse keyring: %w", err)
+	}
+	return keys, nil
+}
+
+func init() {
+	keyringGenerateCmd.Flags().String("id", "", "the id of the new key; defaults to the current time")
+	keyringAddCmd.Flags().String("id", "", "the id of the new key; defaults to the current time")
+	keyringAddCmd.Flags().String("token-key", "", "add this 32-byte key, the value of an old --token_key flag, instead of generating one")
+	for _, c := range []*cobra.Command{keyringAddCmd, keyringActivateCmd, keyringRemoveCmd, keyringShowCmd, keyringJWKSCmd} {
+		c.Flags().String("keyring", "", "the keyring to modify, as passed to the server's --token_keyring flag")
+	}
+	keyringCmd.AddCommand(keyringGenerateCmd, keyringAddCmd, keyringActivateCmd, keyringRemoveCmd, keyringShowCmd, keyringJWKSCmd)
+}
@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/jrockway/jsso2/pkg/tokens"
+)
+
+func TestKeyring(t *testing.T) {
+	run := func(t *testing.T, args ...string) (string, error) {
+		t.Helper()
+		rootCmd.SetArgs(args)
+		out := new(bytes.Buffer)
+		rootCmd.SetOut(out)
+		rootCmd.SetErr(new(bytes.Buffer))
+		defer rootCmd.SetOut(os.Stderr)
+		defer rootCmd.SetErr(os.Stderr)
+		err := rootCmd.ExecuteContext(cmdCtx)
+		return strings.TrimSpace(out.String()), err
+	}
+	ids := func(t *testing.T, keyring string) []string {
+		t.Helper()
+		keys, err := tokens.ParseKeyring(keyring)
+		if err != nil {
+			t.Fatalf("parse keyring %q: %v", keyring, err)
+		}
+		var result []string
+		for _, k := range keys.All() {
+			result = append(result, k.ID)
+		}
+		return result
+	}
+
+	keyring, err := run(t, "keyring", "generate", "--id=one")
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if got, want := strings.Join(ids(t, keyring), ","), "one"; got != want {
+		t.Errorf("generate:\n  got: %v\n want: %v", got, want)
+	}
+	if keyring, err = run(t, "keyring", "add", "--keyring="+keyring, "--id=two"); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	if keyring, err = run(t, "keyring", "add", "--keyring="+keyring, "--id=legacy", "--token-key=XXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXX"); err != nil {
+		t.Fatalf("add legacy key: %v", err)
+	}
+	if keyring, err = run(t, "keyring", "activate", "--keyring="+keyring, "two"); err != nil {
+		t.Fatalf("activate: %v", err)
+	}
+	if got, want := strings.Join(ids(t, keyring), ","), "two,one,legacy"; got != want {
+		t.Errorf("after activate:\n  got: %v\n want: %v", got, want)
+	}
+	if _, err := run(t, "keyring", "remove", "--keyring="+keyring, "two"); err == nil {
+		t.Error("remove active key: expected error")
+	}
+	if keyring, err = run(t, "keyring", "remove", "--keyring="+keyring, "one"); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	out, err := run(t, "keyring", "show", "--keyring="+keyring)
+	if err != nil {
+		t.Fatalf("show: %v", err)
+	}
+	if strings.Contains(out, strings.Split(keyring, ":")[1]) {
+		t.Error("show: output contains a secret")
+	}
+	if !strings.Contains(out, "legacy") {
+		t.Errorf("show: output does not mention the legacy key:\n%s", out)
+	}
+
+	out, err = run(t, "keyring", "jwks", "--keyring="+keyring)
+	if err != nil {
+		t.Fatalf("jwks: %v", err)
+	}
+	pub, err := tokens.ParseJWKS(strings.NewReader(out))
+	if err != nil {
+		t.Fatalf("parse jwks: %v", err)
+	}
+	if got, want := len(pub), 2; got != want {
+		t.Errorf("jwks keys:\n  got: %v\n want: %v", got, want)
+	}
+}
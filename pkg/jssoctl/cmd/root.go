@@ -48,7 +48,10 @@ It can be used to administer JSSO, or interact with it as a normal user.`,
 )
 
 func Execute() {
-	ctx, c := context.WithTimeout(context.Background(), timeout)
+	ctx, c := context.Background(), func() {}
+	if timeout > 0 {
+		ctx, c = context.WithTimeout(ctx, timeout)
+	}
 	if err := rootCmd.ExecuteContext(ctx); err != nil {
 		fmt.Fprintln(rootCmd.ErrOrStderr(), err)
 		c()
@@ -64,6 +67,6 @@ func init() {
 	rootCmd.PersistentFlags().StringVar(&root, "root", "", "if set, authenticate with this root password")
 	rootCmd.PersistentFlags().StringVar(&session, "session", "", "if set, authenticate with this base64-encoded session id")
 	rootCmd.PersistentFlags().StringVar(&bearer, "bearer", "", "if set, authenticate with this bearer token")
-	rootCmd.PersistentFlags().DurationVar(&timeout, "timeout", 5*time.Second, "time allowed for the command to run, including all network requests")
-	rootCmd.AddCommand(usersCmd, devCmd)
+	rootCmd.PersistentFlags().DurationVar(&timeout, "timeout", 5*time.Second, "time allowed for the command to run, including all network requests; 0 means no limit")
+	rootCmd.AddCommand(usersCmd, devCmd, auditCmd, eventsCmd, webhooksCmd, keyringCmd)
 }
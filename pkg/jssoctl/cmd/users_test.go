@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"bytes"
+	"context"
 	"os"
 	"strings"
 	"testing"
@@ -18,14 +19,31 @@ import (
 	"google.golang.org/protobuf/testing/protocmp"
 )
 
+// cmdCtx is the context that commands run with in tests.  cobra remembers the context that a
+// subcommand was first executed with, so a command run with a per-test context would be stuck with
+// that context after it's cancelled.
+var cmdCtx = context.Background()
+
 func TestUsers(t *testing.T) {
+	for _, inMemory := range []bool{false, true} {
+		name := "users"
+		if inMemory {
+			name += "_in_memory"
+		}
+		testUsers(t, name, inMemory)
+	}
+}
+
+func testUsers(t *testing.T, name string, inMemory bool) {
+	t.Helper()
 	jsonOutput = true
 	s := testserver.New()
+	s.InMemory = inMemory
 	r := &jtesting.R{Logger: true, Database: true}
 	defaultCreds := &client.Credentials{Root: "root"}
 	s.ToR(r)
 	s.Credentials = &client.Credentials{}
-	jtesting.Run(t, "users", *r, func(t *testing.T, e *jtesting.E) {
+	jtesting.Run(t, name, *r, func(t *testing.T, e *jtesting.E) {
 		testData := []struct {
 			name         string
 			args         []string
@@ -131,7 +149,7 @@ func TestUsers(t *testing.T) {
 				s.Credentials.Token = creds.Token
 				s.Credentials.Bearer = creds.Bearer
 
-				if err := rootCmd.ExecuteContext(e.Context); !test.wantFail && err != nil {
+				if err := rootCmd.ExecuteContext(cmdCtx); !test.wantFail && err != nil {
 					t.Fatalf("execute: %v", err)
 				} else if test.wantFail && err == nil {
 					t.Error("execute: expected error")
@@ -0,0 +1,201 @@
+package cmd
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jrockway/jsso2/pkg/jssopb"
+	"github.com/jrockway/jsso2/pkg/types"
+	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+var (
+	webhooksCmd = &cobra.Command{
+		Use:   "webhooks",
+		Short: "Manage outbound webhooks",
+		Long: `Webhooks send identity events, like new credentials or logins from new IP addresses, to HTTP
+endpoints as they happen.
+
+Each delivery is a JSON POST containing the event and a human-readable "text" field, so chat
+services that accept incoming webhooks can display it directly.  Deliveries are signed; the
+X-Jsso2-Signature header contains "v1=" followed by the hex-encoded HMAC-SHA256 of the
+X-Jsso2-Timestamp header, a period, and the body, keyed with the webhook's secret.
+
+Failed deliveries are retried with exponential backoff, and marked dead after too many attempts.`,
+	}
+
+	webhooksAddCmd = &cobra.Command{
+		Use:   "add <url> --type=<event type>...",
+		Short: "Subscribe a URL to events",
+		Long: `Subscribe a URL to events of the provided types.  The signing secret is printed in hex; it can't
+be retrieved later.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			w := &types.Webhook{Url: args[0]}
+			var err error
+			if w.EventTypes, err = eventTypesFromFlag(cmd, "type"); err != nil {
+				return err
+			}
+			if len(w.EventTypes) == 0 {
+				return fmt.Errorf("at least one --type is required")
+			}
+			if w.Description, err = cmd.Flags().GetString("description"); err != nil {
+				return fmt.Errorf("get description: %w", err)
+			}
+			reply, err := clientset.WebhooksClient.Add(cmd.Context(), &jssopb.AddWebhookRequest{Webhook: w})
+			if err != nil {
+				return fmt.Errorf("add webhook: %w", err)
+			}
+			if jsonOutput {
+				fmt.Fprintln(cmd.OutOrStdout(), protojson.Format(reply))
+				fmt.Fprintln(cmd.ErrOrStderr(), "OK")
+				return nil
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "id: %d\n", reply.GetWebhook().GetId())
+			fmt.Fprintf(cmd.OutOrStdout(), "secret: %s\n", hex.EncodeToString(reply.GetWebhook().GetSecret()))
+			return nil
+		},
+	}
+
+	webhooksListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "List webhooks",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			reply, err := clientset.WebhooksClient.List(cmd.Context(), &jssopb.ListWebhooksRequest{})
+			if err != nil {
+				return fmt.Errorf("list webhooks: %w", err)
+			}
+			if jsonOutput {
+				fmt.Fprintln(cmd.OutOrStdout(), protojson.Format(reply))
+				fmt.Fprintln(cmd.ErrOrStderr(), "OK")
+				return nil
+			}
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 8, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tCREATED\tURL\tTYPES\tDESCRIPTION")
+			for _, h := range reply.GetWebhooks() {
+				var names []string
+				for _, t := range h.GetEventTypes() {
+					names = append(names, strings.ToLower(t.String()))
+				}
+				fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", h.GetId(), h.GetCreatedAt().AsTime().Local().Format(time.RFC3339), h.GetUrl(), strings.Join(names, ","), h.GetDescription())
+			}
+			if err := w.Flush(); err != nil {
+				return fmt.Errorf("flush output: %w", err)
+			}
+			return nil
+		},
+	}
+
+	webhooksDeleteCmd = &cobra.Command{
+		Use:   "delete <id>",
+		Short: "Delete a webhook and its deliveries",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("parse id: %w", err)
+			}
+			if _, err := clientset.WebhooksClient.Delete(cmd.Context(), &jssopb.DeleteWebhookRequest{Id: id}); err != nil {
+				return fmt.Errorf("delete webhook: %w", err)
+			}
+			fmt.Fprintln(cmd.ErrOrStderr(), "OK")
+			return nil
+		},
+	}
+
+	webhooksDeliveriesCmd = &cobra.Command{
+		Use:   "deliveries",
+		Short: "Inspect webhook deliveries",
+		Long:  `Print webhook deliveries that match all of the provided filters, newest first.`,
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			flags := cmd.Flags()
+			req := &jssopb.ListWebhookDeliveriesRequest{}
+			var err error
+			if req.WebhookId, err = flags.GetInt64("webhook-id"); err != nil {
+				return fmt.Errorf("get webhook id: %w", err)
+			}
+			if state, err := flags.GetString("state"); err != nil {
+				return fmt.Errorf("get state: %w", err)
+			} else if state != "" {
+				s, ok := types.WebhookDelivery_State_value[strings.ToUpper(state)]
+				if !ok || s == int32(types.WebhookDelivery_STATE_UNKNOWN) {
+					return fmt.Errorf("unknown state %q; try pending, succeeded, or dead", state)
+				}
+				req.State = types.WebhookDelivery_State(s)
+			}
+			if req.Limit, err = flags.GetInt32("limit"); err != nil {
+				return fmt.Errorf("get limit: %w", err)
+			}
+			if req.PageToken, err = flags.GetString("page-token"); err != nil {
+				return fmt.Errorf("get page token: %w", err)
+			}
+
+			reply, err := clientset.WebhooksClient.ListDeliveries(cmd.Context(), req)
+			if err != nil {
+				return fmt.Errorf("list deliveries: %w", err)
+			}
+			if jsonOutput {
+				fmt.Fprintln(cmd.OutOrStdout(), protojson.Format(reply))
+				fmt.Fprintln(cmd.ErrOrStderr(), "OK")
+				return nil
+			}
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 8, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tWEBHOOK\tTYPE\tAUDIT EVENT\tSTATE\tATTEMPTS\tNEXT ATTEMPT\tLAST ERROR")
+			for _, d := range reply.GetDeliveries() {
+				next := "-"
+				if d.GetState() == types.WebhookDelivery_PENDING {
+					next = d.GetNextAttemptAt().AsTime().Local().Format(time.RFC3339)
+				}
+				fmt.Fprintf(w, "%d\t%d\t%s\t%d\t%s\t%d\t%s\t%s\n", d.GetId(), d.GetWebhookId(), strings.ToLower(d.GetEventType().String()), d.GetAuditEventId(), strings.ToLower(d.GetState().String()), d.GetAttempts(), next, d.GetLastError())
+			}
+			if err := w.Flush(); err != nil {
+				return fmt.Errorf("flush output: %w", err)
+			}
+			if token := reply.GetNextPageToken(); token != "" {
+				fmt.Fprintf(cmd.ErrOrStderr(), "More deliveries are available; rerun with --page-token=%s\n", token)
+			}
+			return nil
+		},
+	}
+
+	webhooksRetryCmd = &cobra.Command{
+		Use:   "retry <delivery id>",
+		Short: "Retry a failed or dead delivery as soon as possible",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("parse id: %w", err)
+			}
+			reply, err := clientset.WebhooksClient.Retry(cmd.Context(), &jssopb.RetryWebhookDeliveryRequest{Id: id})
+			if err != nil {
+				return fmt.Errorf("retry delivery: %w", err)
+			}
+			if jsonOutput {
+				fmt.Fprintln(cmd.OutOrStdout(), protojson.Format(reply))
+			}
+			fmt.Fprintln(cmd.ErrOrStderr(), "OK")
+			return nil
+		},
+	}
+)
+
+func init() {
+	webhooksAddCmd.Flags().StringSlice("type", nil, "event types to deliver, like credential_added or login_from_new_ip")
+	webhooksAddCmd.Flags().String("description", "", "a note about what the webhook is for")
+	webhooksDeliveriesCmd.Flags().Int64("webhook-id", 0, "only show deliveries to the webhook with this id")
+	webhooksDeliveriesCmd.Flags().String("state", "", "only show deliveries in this state; pending, succeeded, or dead")
+	webhooksDeliveriesCmd.Flags().Int32("limit", 0, "the maximum number of deliveries to show; the server's default is 100")
+	webhooksDeliveriesCmd.Flags().String("page-token", "", "continue a previous query where it left off")
+	for _, c := range []*cobra.Command{webhooksAddCmd, webhooksListCmd, webhooksDeleteCmd, webhooksDeliveriesCmd, webhooksRetryCmd} {
+		AddClientset(c)
+		webhooksCmd.AddCommand(c)
+	}
+}
@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jrockway/jsso2/pkg/client"
+	"github.com/jrockway/jsso2/pkg/jssopb"
+	"github.com/jrockway/jsso2/pkg/jtesting"
+	"github.com/jrockway/jsso2/pkg/testserver"
+	"github.com/jrockway/jsso2/pkg/types"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/testing/protocmp"
+)
+
+func TestWebhooks(t *testing.T) {
+	jsonOutput = true
+	s := testserver.New()
+	s.InMemory = true
+	r := &jtesting.R{Logger: true}
+	s.ToR(r)
+	s.Credentials = &client.Credentials{Root: "root"}
+	jtesting.Run(t, "webhooks", *r, func(t *testing.T, e *jtesting.E) {
+		clientset = client.FromCC(e.ClientConn)
+		noClose = true
+
+		run := func(t *testing.T, args ...string) ([]byte, error) {
+			t.Helper()
+			rootCmd.SetArgs(args)
+			out := new(bytes.Buffer)
+			rootCmd.SetOut(out)
+			rootCmd.SetErr(new(bytes.Buffer))
+			defer rootCmd.SetOut(os.Stderr)
+			defer rootCmd.SetErr(os.Stderr)
+			err := rootCmd.ExecuteContext(cmdCtx)
+			return out.Bytes(), err
+		}
+
+		if _, err := run(t, "webhooks", "add", "https://chat.example.com/hook"); err == nil {
+			t.Error("add without --type: expected error")
+		}
+		out, err := run(t, "webhooks", "add", "https://chat.example.com/hook", "--type=credential_added,login_from_new_ip", "--description=security alerts")
+		if err != nil {
+			t.Fatalf("add: %v", err)
+		}
+		added := new(jssopb.AddWebhookReply)
+		if err := protojson.Unmarshal(out, added); err != nil {
+			t.Fatalf("unmarshal add reply: %v", err)
+		}
+		if got, want := len(added.GetWebhook().GetSecret()), 32; got != want {
+			t.Errorf("secret length:\n  got: %v\n want: %v", got, want)
+		}
+
+		out, err = run(t, "webhooks", "list")
+		if err != nil {
+			t.Fatalf("list: %v", err)
+		}
+		list := new(jssopb.ListWebhooksReply)
+		if err := protojson.Unmarshal(out, list); err != nil {
+			t.Fatalf("unmarshal list reply: %v", err)
+		}
+		want := &jssopb.ListWebhooksReply{
+			Webhooks: []*types.Webhook{{
+				Id:          added.GetWebhook().GetId(),
+				CreatedAt:   added.GetWebhook().GetCreatedAt(),
+				Url:         "https://chat.example.com/hook",
+				Description: "security alerts",
+				EventTypes:  []types.Event_Type{types.Event_CREDENTIAL_ADDED, types.Event_LOGIN_FROM_NEW_IP},
+			}},
+		}
+		if diff := cmp.Diff(list, want, protocmp.Transform()); diff != "" {
+			t.Errorf("list (-got +want):\n%s", diff)
+		}
+
+		out, err = run(t, "webhooks", "deliveries", "--state=dead")
+		if err != nil {
+			t.Fatalf("deliveries: %v", err)
+		}
+		deliveries := new(jssopb.ListWebhookDeliveriesReply)
+		if err := protojson.Unmarshal(out, deliveries); err != nil {
+			t.Fatalf("unmarshal deliveries reply: %v", err)
+		}
+		if len(deliveries.GetDeliveries()) > 0 {
+			t.Errorf("unexpected deliveries: %v", deliveries.GetDeliveries())
+		}
+		if _, err := run(t, "webhooks", "retry", "1"); err == nil {
+			t.Error("retry missing delivery: expected error")
+		}
+
+		if _, err := run(t, "webhooks", "delete", "1"); err != nil {
+			t.Fatalf("delete: %v", err)
+		}
+		if _, err := run(t, "webhooks", "delete", "1"); err == nil {
+			t.Error("delete twice: expected error")
+		}
+		if _, err := run(t, "webhooks", "add", "not a url", "--type=login"); err == nil {
+			t.Error("add with invalid url: expected error")
+		}
+	})
+}
@@ -640,3 +640,605 @@ type UnstableEnrollmentService interface {
 	Start(context.Context, *StartEnrollmentRequest) (*StartEnrollmentReply, error)
 	Finish(context.Context, *FinishEnrollmentRequest) (*FinishEnrollmentReply, error)
 }
+
+// AuditClient is the client API for Audit service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type AuditClient interface {
+	// Query returns the audit events that match all of the provided filters,
+	// newest first.
+	Query(ctx context.Context, in *QueryAuditRequest, opts ...grpc.CallOption) (*QueryAuditReply, error)
+	// Verify checks the hash chain and signed checkpoints of the entire audit
+	// log, reporting any events that were modified or deleted.
+	Verify(ctx context.Context, in *VerifyAuditRequest, opts ...grpc.CallOption) (*VerifyAuditReply, error)
+}
+
+type auditClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewAuditClient(cc grpc.ClientConnInterface) AuditClient {
+	return &auditClient{cc}
+}
+
+var auditQueryStreamDesc = &grpc.StreamDesc{
+	StreamName: "Query",
+}
+
+func (c *auditClient) Query(ctx context.Context, in *QueryAuditRequest, opts ...grpc.CallOption) (*QueryAuditReply, error) {
+	out := new(QueryAuditReply)
+	err := c.cc.Invoke(ctx, "/jsso.Audit/Query", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+var auditVerifyStreamDesc = &grpc.StreamDesc{
+	StreamName: "Verify",
+}
+
+func (c *auditClient) Verify(ctx context.Context, in *VerifyAuditRequest, opts ...grpc.CallOption) (*VerifyAuditReply, error) {
+	out := new(VerifyAuditReply)
+	err := c.cc.Invoke(ctx, "/jsso.Audit/Verify", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// AuditService is the service API for Audit service.
+// Fields should be assigned to their respective handler implementations only before
+// RegisterAuditService is called.  Any unassigned fields will result in the
+// handler for that method returning an Unimplemented error.
+type AuditService struct {
+	// Query returns the audit events that match all of the provided filters,
+	// newest first.
+	Query func(context.Context, *QueryAuditRequest) (*QueryAuditReply, error)
+	// Verify checks the hash chain and signed checkpoints of the entire audit
+	// log, reporting any events that were modified or deleted.
+	Verify func(context.Context, *VerifyAuditRequest) (*VerifyAuditReply, error)
+}
+
+func (s *AuditService) query(_ interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(QueryAuditRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return s.Query(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     s,
+		FullMethod: "/jsso.Audit/Query",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return s.Query(ctx, req.(*QueryAuditRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+func (s *AuditService) verify(_ interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(VerifyAuditRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return s.Verify(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     s,
+		FullMethod: "/jsso.Audit/Verify",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return s.Verify(ctx, req.(*VerifyAuditRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// RegisterAuditService registers a service implementation with a gRPC server.
+func RegisterAuditService(s grpc.ServiceRegistrar, srv *AuditService) {
+	srvCopy := *srv
+	if srvCopy.Query == nil {
+		srvCopy.Query = func(context.Context, *QueryAuditRequest) (*QueryAuditReply, error) {
+			return nil, status.Errorf(codes.Unimplemented, "method Query not implemented")
+		}
+	}
+	if srvCopy.Verify == nil {
+		srvCopy.Verify = func(context.Context, *VerifyAuditRequest) (*VerifyAuditReply, error) {
+			return nil, status.Errorf(codes.Unimplemented, "method Verify not implemented")
+		}
+	}
+	sd := grpc.ServiceDesc{
+		ServiceName: "jsso.Audit",
+		Methods: []grpc.MethodDesc{
+			{
+				MethodName: "Query",
+				Handler:    srvCopy.query,
+			},
+			{
+				MethodName: "Verify",
+				Handler:    srvCopy.verify,
+			},
+		},
+		Streams:  []grpc.StreamDesc{},
+		Metadata: "jsso.proto",
+	}
+
+	s.RegisterService(&sd, nil)
+}
+
+// NewAuditService creates a new AuditService containing the
+// implemented methods of the Audit service in s.  Any unimplemented
+// methods will result in the gRPC server returning an UNIMPLEMENTED status to the client.
+// This includes situations where the method handler is misspelled or has the wrong
+// signature.  For this reason, this function should be used with great care and
+// is not recommended to be used by most users.
+func NewAuditService(s interface{}) *AuditService {
+	ns := &AuditService{}
+	if h, ok := s.(interface {
+		Query(context.Context, *QueryAuditRequest) (*QueryAuditReply, error)
+	}); ok {
+		ns.Query = h.Query
+	}
+	if h, ok := s.(interface {
+		Verify(context.Context, *VerifyAuditRequest) (*VerifyAuditReply, error)
+	}); ok {
+		ns.Verify = h.Verify
+	}
+	return ns
+}
+
+// UnstableAuditService is the service API for Audit service.
+// New methods may be added to this interface if they are added to the service
+// definition, which is not a backward-compatible change.  For this reason,
+// use of this type is not recommended.
+type UnstableAuditService interface {
+	// Query returns the audit events that match all of the provided filters,
+	// newest first.
+	Query(context.Context, *QueryAuditRequest) (*QueryAuditReply, error)
+	// Verify checks the hash chain and signed checkpoints of the entire audit
+	// log, reporting any events that were modified or deleted.
+	Verify(context.Context, *VerifyAuditRequest) (*VerifyAuditReply, error)
+}
+
+// EventsClient is the client API for Events service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type EventsClient interface {
+	// Watch streams events as they happen, starting after the provided cursor.
+	// Events are delivered in order, at least once.
+	Watch(ctx context.Context, in *WatchEventsRequest, opts ...grpc.CallOption) (Events_WatchClient, error)
+}
+
+type eventsClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewEventsClient(cc grpc.ClientConnInterface) EventsClient {
+	return &eventsClient{cc}
+}
+
+var eventsWatchStreamDesc = &grpc.StreamDesc{
+	StreamName:    "Watch",
+	ServerStreams: true,
+}
+
+func (c *eventsClient) Watch(ctx context.Context, in *WatchEventsRequest, opts ...grpc.CallOption) (Events_WatchClient, error) {
+	stream, err := c.cc.NewStream(ctx, eventsWatchStreamDesc, "/jsso.Events/Watch", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &eventsWatchClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Events_WatchClient interface {
+	Recv() (*WatchEventsReply, error)
+	grpc.ClientStream
+}
+
+type eventsWatchClient struct {
+	grpc.ClientStream
+}
+
+func (x *eventsWatchClient) Recv() (*WatchEventsReply, error) {
+	m := new(WatchEventsReply)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// EventsService is the service API for Events service.
+// Fields should be assigned to their respective handler implementations only before
+// RegisterEventsService is called.  Any unassigned fields will result in the
+// handler for that method returning an Unimplemented error.
+type EventsService struct {
+	// Watch streams events as they happen, starting after the provided cursor.
+	// Events are delivered in order, at least once.
+	Watch func(*WatchEventsRequest, Events_WatchServer) error
+}
+
+func (s *EventsService) watch(_ interface{}, stream grpc.ServerStream) error {
+	m := new(WatchEventsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return s.Watch(m, &eventsWatchServer{stream})
+}
+
+type Events_WatchServer interface {
+	Send(*WatchEventsReply) error
+	grpc.ServerStream
+}
+
+type eventsWatchServer struct {
+	grpc.ServerStream
+}
+
+func (x *eventsWatchServer) Send(m *WatchEventsReply) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// RegisterEventsService registers a service implementation with a gRPC server.
+func RegisterEventsService(s grpc.ServiceRegistrar, srv *EventsService) {
+	srvCopy := *srv
+	if srvCopy.Watch == nil {
+		srvCopy.Watch = func(*WatchEventsRequest, Events_WatchServer) error {
+			return status.Errorf(codes.Unimplemented, "method Watch not implemented")
+		}
+	}
+	sd := grpc.ServiceDesc{
+		ServiceName: "jsso.Events",
+		Methods:     []grpc.MethodDesc{},
+		Streams: []grpc.StreamDesc{
+			{
+				StreamName:    "Watch",
+				Handler:       srvCopy.watch,
+				ServerStreams: true,
+			},
+		},
+		Metadata: "jsso.proto",
+	}
+
+	s.RegisterService(&sd, nil)
+}
+
+// NewEventsService creates a new EventsService containing the
+// implemented methods of the Events service in s.  Any unimplemented
+// methods will result in the gRPC server returning an UNIMPLEMENTED status to the client.
+// This includes situations where the method handler is misspelled or has the wrong
+// signature.  For this reason, this function should be used with great care and
+// is not recommended to be used by most users.
+func NewEventsService(s interface{}) *EventsService {
+	ns := &EventsService{}
+	if h, ok := s.(interface {
+		Watch(*WatchEventsRequest, Events_WatchServer) error
+	}); ok {
+		ns.Watch = h.Watch
+	}
+	return ns
+}
+
+// UnstableEventsService is the service API for Events service.
+// New methods may be added to this interface if they are added to the service
+// definition, which is not a backward-compatible change.  For this reason,
+// use of this type is not recommended.
+type UnstableEventsService interface {
+	// Watch streams events as they happen, starting after the provided cursor.
+	// Events are delivered in order, at least once.
+	Watch(*WatchEventsRequest, Events_WatchServer) error
+}
+
+// WebhooksClient is the client API for Webhooks service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type WebhooksClient interface {
+	// Add subscribes a URL to events.  The reply includes the secret that signs
+	// deliveries, which can't be retrieved later.
+	Add(ctx context.Context, in *AddWebhookRequest, opts ...grpc.CallOption) (*AddWebhookReply, error)
+	// List returns every webhook, without secrets.
+	List(ctx context.Context, in *ListWebhooksRequest, opts ...grpc.CallOption) (*ListWebhooksReply, error)
+	// Delete deletes a webhook and its deliveries.
+	Delete(ctx context.Context, in *DeleteWebhookRequest, opts ...grpc.CallOption) (*DeleteWebhookReply, error)
+	// ListDeliveries returns deliveries, newest first.
+	ListDeliveries(ctx context.Context, in *ListWebhookDeliveriesRequest, opts ...grpc.CallOption) (*ListWebhookDeliveriesReply, error)
+	// Retry schedules a delivery to be attempted again as soon as possible.
+	Retry(ctx context.Context, in *RetryWebhookDeliveryRequest, opts ...grpc.CallOption) (*RetryWebhookDeliveryReply, error)
+}
+
+type webhooksClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewWebhooksClient(cc grpc.ClientConnInterface) WebhooksClient {
+	return &webhooksClient{cc}
+}
+
+var webhooksAddStreamDesc = &grpc.StreamDesc{
+	StreamName: "Add",
+}
+
+func (c *webhooksClient) Add(ctx context.Context, in *AddWebhookRequest, opts ...grpc.CallOption) (*AddWebhookReply, error) {
+	out := new(AddWebhookReply)
+	err := c.cc.Invoke(ctx, "/jsso.Webhooks/Add", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+var webhooksListStreamDesc = &grpc.StreamDesc{
+	StreamName: "List",
+}
+
+func (c *webhooksClient) List(ctx context.Context, in *ListWebhooksRequest, opts ...grpc.CallOption) (*ListWebhooksReply, error) {
+	out := new(ListWebhooksReply)
+	err := c.cc.Invoke(ctx, "/jsso.Webhooks/List", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+var webhooksDeleteStreamDesc = &grpc.StreamDesc{
+	StreamName: "Delete",
+}
+
+func (c *webhooksClient) Delete(ctx context.Context, in *DeleteWebhookRequest, opts ...grpc.CallOption) (*DeleteWebhookReply, error) {
+	out := new(DeleteWebhookReply)
+	err := c.cc.Invoke(ctx, "/jsso.Webhooks/Delete", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+var webhooksListDeliveriesStreamDesc = &grpc.StreamDesc{
+	StreamName: "ListDeliveries",
+}
+
+func (c *webhooksClient) ListDeliveries(ctx context.Context, in *ListWebhookDeliveriesRequest, opts ...grpc.CallOption) (*ListWebhookDeliveriesReply, error) {
+	out := new(ListWebhookDeliveriesReply)
+	err := c.cc.Invoke(ctx, "/jsso.Webhooks/ListDeliveries", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+var webhooksRetryStreamDesc = &grpc.StreamDesc{
+	StreamName: "Retry",
+}
+
+func (c *webhooksClient) Retry(ctx context.Context, in *RetryWebhookDeliveryRequest, opts ...grpc.CallOption) (*RetryWebhookDeliveryReply, error) {
+	out := new(RetryWebhookDeliveryReply)
+	err := c.cc.Invoke(ctx, "/jsso.Webhooks/Retry", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// WebhooksService is the service API for Webhooks service.
+// Fields should be assigned to their respective handler implementations only before
+// RegisterWebhooksService is called.  Any unassigned fields will result in the
+// handler for that method returning an Unimplemented error.
+type WebhooksService struct {
+	// Add subscribes a URL to events.  The reply includes the secret that signs
+	// deliveries, which can't be retrieved later.
+	Add func(context.Context, *AddWebhookRequest) (*AddWebhookReply, error)
+	// List returns every webhook, without secrets.
+	List func(context.Context, *ListWebhooksRequest) (*ListWebhooksReply, error)
+	// Delete deletes a webhook and its deliveries.
+	Delete func(context.Context, *DeleteWebhookRequest) (*DeleteWebhookReply, error)
+	// ListDeliveries returns deliveries, newest first.
+	ListDeliveries func(context.Context, *ListWebhookDeliveriesRequest) (*ListWebhookDeliveriesReply, error)
+	// Retry schedules a delivery to be attempted again as soon as possible.
+	Retry func(context.Context, *RetryWebhookDeliveryRequest) (*RetryWebhookDeliveryReply, error)
+}
+
+func (s *WebhooksService) add(_ interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AddWebhookRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return s.Add(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     s,
+		FullMethod: "/jsso.Webhooks/Add",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return s.Add(ctx, req.(*AddWebhookRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+func (s *WebhooksService) list(_ interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListWebhooksRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return s.List(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     s,
+		FullMethod: "/jsso.Webhooks/List",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return s.List(ctx, req.(*ListWebhooksRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+func (s *WebhooksService) delete(_ interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteWebhookRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return s.Delete(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     s,
+		FullMethod: "/jsso.Webhooks/Delete",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return s.Delete(ctx, req.(*DeleteWebhookRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+func (s *WebhooksService) listDeliveries(_ interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListWebhookDeliveriesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return s.ListDeliveries(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     s,
+		FullMethod: "/jsso.Webhooks/ListDeliveries",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return s.ListDeliveries(ctx, req.(*ListWebhookDeliveriesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+func (s *WebhooksService) retry(_ interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RetryWebhookDeliveryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return s.Retry(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     s,
+		FullMethod: "/jsso.Webhooks/Retry",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return s.Retry(ctx, req.(*RetryWebhookDeliveryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// RegisterWebhooksService registers a service implementation with a gRPC server.
+func RegisterWebhooksService(s grpc.ServiceRegistrar, srv *WebhooksService) {
+	srvCopy := *srv
+	if srvCopy.Add == nil {
+		srvCopy.Add = func(context.Context, *AddWebhookRequest) (*AddWebhookReply, error) {
+			return nil, status.Errorf(codes.Unimplemented, "method Add not implemented")
+		}
+	}
+	if srvCopy.List == nil {
+		srvCopy.List = func(context.Context, *ListWebhooksRequest) (*ListWebhooksReply, error) {
+			return nil, status.Errorf(codes.Unimplemented, "method List not implemented")
+		}
+	}
+	if srvCopy.Delete == nil {
+		srvCopy.Delete = func(context.Context, *DeleteWebhookRequest) (*DeleteWebhookReply, error) {
+			return nil, status.Errorf(codes.Unimplemented, "method Delete not implemented")
+		}
+	}
+	if srvCopy.ListDeliveries == nil {
+		srvCopy.ListDeliveries = func(context.Context, *ListWebhookDeliveriesRequest) (*ListWebhookDeliveriesReply, error) {
+			return nil, status.Errorf(codes.Unimplemented, "method ListDeliveries not implemented")
+		}
+	}
+	if srvCopy.Retry == nil {
+		srvCopy.Retry = func(context.Context, *RetryWebhookDeliveryRequest) (*RetryWebhookDeliveryReply, error) {
+			return nil, status.Errorf(codes.Unimplemented, "method Retry not implemented")
+		}
+	}
+	sd := grpc.ServiceDesc{
+		ServiceName: "jsso.Webhooks",
+		Methods: []grpc.MethodDesc{
+			{
+				MethodName: "Add",
+				Handler:    srvCopy.add,
+			},
+			{
+				MethodName: "List",
+				Handler:    srvCopy.list,
+			},
+			{
+				MethodName: "Delete",
+				Handler:    srvCopy.delete,
+			},
+			{
+				MethodName: "ListDeliveries",
+				Handler:    srvCopy.listDeliveries,
+			},
+			{
+				MethodName: "Retry",
+				Handler:    srvCopy.retry,
+			},
+		},
+		Streams:  []grpc.StreamDesc{},
+		Metadata: "jsso.proto",
+	}
+
+	s.RegisterService(&sd, nil)
+}
+
+// NewWebhooksService creates a new WebhooksService containing the
+// implemented methods of the Webhooks service in s.  Any unimplemented
+// methods will result in the gRPC server returning an UNIMPLEMENTED status to the client.
+// This includes situations where the method handler is misspelled or has the wrong
+// signature.  For this reason, this function should be used with great care and
+// is not recommended to be used by most users.
+func NewWebhooksService(s interface{}) *WebhooksService {
+	ns := &WebhooksService{}
+	if h, ok := s.(interface {
+		Add(context.Context, *AddWebhookRequest) (*AddWebhookReply, error)
+	}); ok {
+		ns.Add = h.Add
+	}
+	if h, ok := s.(interface {
+		List(context.Context, *ListWebhooksRequest) (*ListWebhooksReply, error)
+	}); ok {
+		ns.List = h.List
+	}
+	if h, ok := s.(interface {
+		Delete(context.Context, *DeleteWebhookRequest) (*DeleteWebhookReply, error)
+	}); ok {
+		ns.Delete = h.Delete
+	}
+	if h, ok := s.(interface {
+		ListDeliveries(context.Context, *ListWebhookDeliveriesRequest) (*ListWebhookDeliveriesReply, error)
+	}); ok {
+		ns.ListDeliveries = h.ListDeliveries
+	}
+	if h, ok := s.(interface {
+		Retry(context.Context, *RetryWebhookDeliveryRequest) (*RetryWebhookDeliveryReply, error)
+	}); ok {
+		ns.Retry = h.Retry
+	}
+	return ns
+}
+
+// UnstableWebhooksService is the service API for Webhooks service.
+// New methods may be added to this interface if they are added to the service
+// definition, which is not a backward-compatible change.  For this reason,
+// use of this type is not recommended.
+type UnstableWebhooksService interface {
+	// Add subscribes a URL to events.  The reply includes the secret that signs
+	// deliveries, which can't be retrieved later.
+	Add(context.Context, *AddWebhookRequest) (*AddWebhookReply, error)
+	// List returns every webhook, without secrets.
+	List(context.Context, *ListWebhooksRequest) (*ListWebhooksReply, error)
+	// Delete deletes a webhook and its deliveries.
+	Delete(context.Context, *DeleteWebhookRequest) (*DeleteWebhookReply, error)
+	// ListDeliveries returns deliveries, newest first.
+	ListDeliveries(context.Context, *ListWebhookDeliveriesRequest) (*ListWebhookDeliveriesReply, error)
+	// Retry schedules a delivery to be attempted again as soon as possible.
+	Retry(context.Context, *RetryWebhookDeliveryRequest) (*RetryWebhookDeliveryReply, error)
+}
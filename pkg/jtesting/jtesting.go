@@ -34,7 +34,7 @@ type R struct {
 	Timeout           time.Duration
 	Logger            bool
 	Database          bool
-	DatabaseReady     func(t *testing.T, e *E)
+	DatabaseReady     func(t *testing.T, e *E) // Runs before GRPC; e.DB is only set if Database is.
 	GRPC              func(t *testing.T, e *E, s *grpc.Server)
 	GRPCOptions       func(e *E) []grpc.ServerOption
 	GRPCClientOptions func(e *E) []grpc.DialOption
@@ -50,57 +50,77 @@ type E struct {
 	ClientConn *grpc.ClientConn
 }
 
-// Run runs the provided test function as a subtest with the desired Extras available.
-func Run(t *testing.T, name string, r R, f func(t *testing.T, e *E)) {
-	t.Helper()
-	pc, _, _, pcOk := runtime.Caller(1)
-	t.Run(name, func(t *testing.T) {
-		_, file, _, _ := runtime.Caller(0)
-		envFile := filepath.Clean(filepath.Join(file, "..", "..", "..", "env.jsso2-backend.dev"))
-		if err := godotenv.Load(envFile); err != nil {
-			t.Fatalf("failed to load %s: %v", envFile, err)
-		}
+// setup creates the Extras that don't need a *testing.T: the context, logger, and database.  The
+// returned function must be called when the test is done.
+func setup(tb testing.TB, pc uintptr, pcOk bool, name string, r R) (*E, func()) {
+	tb.Helper()
+	_, file, _, _ := runtime.Caller(0)
+	envFile := filepath.Clean(filepath.Join(file, "..", "..", "..", "env.jsso2-backend.dev"))
+	if err := godotenv.Load(envFile); err != nil {
+		tb.Fatalf("failed to load %s: %v", envFile, err)
+	}
 
-		extras := &E{
-			Config: &Config{
-				SuperuserDSN: os.Getenv("SUPERUSER_DATABASE_URL"),
-			},
+	extras := &E{
+		Config: &Config{
+			SuperuserDSN: os.Getenv("SUPERUSER_DATABASE_URL"),
+		},
+	}
+	var cleanup []func()
+	done := func() {
+		for i := len(cleanup) - 1; i >= 0; i-- {
+			cleanup[i]()
 		}
+	}
+
+	ctx, c := context.WithCancel(context.Background())
+	if r.Timeout > 0 {
+		c()
+		ctx, c = context.WithTimeout(context.Background(), r.Timeout)
+	}
+	cleanup = append(cleanup, c)
+
+	if r.Logger {
+		logger := zaptest.NewLogger(tb, zaptest.Level(zap.DebugLevel))
+		cleanup = append(cleanup, func() { logger.Sync() })
+		restoreLogger := zap.ReplaceGlobals(logger.Named("global"))
+		cleanup = append(cleanup, restoreLogger)
+		extras.Logger = logger.Named("test." + name)
+		ctx = ctxzap.ToContext(ctx, logger)
+	}
+	extras.Context = ctx
 
-		ctx, c := context.WithCancel(context.Background())
-		if r.Timeout > 0 {
-			c()
-			ctx, c = context.WithTimeout(context.Background(), r.Timeout)
+	if r.Database {
+		if !pcOk {
+			done()
+			tb.Fatal("could not determine caller to generate database name")
 		}
-		defer c()
-
-		if r.Logger {
-			logger := zaptest.NewLogger(t, zaptest.Level(zap.DebugLevel))
-			defer logger.Sync()
-			restoreLogger := zap.ReplaceGlobals(logger.Named("global"))
-			defer restoreLogger()
-			extras.Logger = logger.Named("test." + name)
-			ctx = ctxzap.ToContext(ctx, logger)
+		dsn, err := newTestDB(ctx, pc, name, extras.Config.SuperuserDSN)
+		if err != nil {
+			done()
+			tb.Fatalf("creating test database: %v", err)
 		}
-		extras.Context = ctx
+		extras.DSN = dsn
+		db, err := sql.Open("pgx", dsn)
+		if err != nil {
+			done()
+			tb.Fatalf("connect to test database: %v", err)
+		}
+		extras.DB = db
+	}
+	return extras, done
+}
 
-		if r.Database {
-			if !pcOk {
-				t.Fatal("could not determine caller to generate database name")
-			}
-			dsn, err := newTestDB(ctx, pc, name, extras.Config.SuperuserDSN)
-			if err != nil {
-				t.Fatalf("creating test database: %v", err)
-			}
-			extras.DSN = dsn
-			db, err := sql.Open("pgx", dsn)
-			if err != nil {
-				t.Fatalf("connect to test database: %v", err)
-			}
-			extras.DB = db
-			if r.DatabaseReady != nil {
-				r.DatabaseReady(t, extras)
-			}
+// Run runs the provided test function as a subtest with the desired Extras available.
+func Run(t *testing.T, name string, r R, f func(t *testing.T, e *E)) {
+	t.Helper()
+	pc, _, _, pcOk := runtime.Caller(1)
+	t.Run(name, func(t *testing.T) {
+		extras, done := setup(t, pc, pcOk, name, r)
+		defer done()
+		ctx := extras.Context
+
+		if r.DatabaseReady != nil {
+			r.DatabaseReady(t, extras)
 		}
 		if r.GRPC != nil {
 			gen := rand.New(rand.NewSource(time.Now().UnixNano()))
@@ -141,6 +161,21 @@ func Run(t *testing.T, name string, r R, f func(t *testing.T, e *E)) {
 	})
 }
 
+// RunBenchmark runs the provided benchmark as a sub-benchmark with the desired Extras available.
+// Only the Timeout, Logger, and Database extras are supported.
+func RunBenchmark(b *testing.B, name string, r R, f func(b *testing.B, e *E)) {
+	b.Helper()
+	pc, _, _, pcOk := runtime.Caller(1)
+	if r.DatabaseReady != nil || r.GRPC != nil {
+		b.Fatal("RunBenchmark does not support DatabaseReady or GRPC")
+	}
+	b.Run(name, func(b *testing.B) {
+		extras, done := setup(b, pc, pcOk, name, r)
+		defer done()
+		f(b, extras)
+	})
+}
+
 var prefixes = []string{
 	"github.com/jrockway/jsso2/pkg/",
 	"github.com/jrockway/jsso2/",
@@ -5,7 +5,7 @@ import (
 	"net/http"
 
 	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
-	"github.com/jmoiron/sqlx"
+	"github.com/jrockway/jsso2/pkg/audit"
 	"github.com/jrockway/jsso2/pkg/sessions"
 	"github.com/jrockway/jsso2/pkg/store"
 	"github.com/jrockway/jsso2/pkg/web"
@@ -15,7 +15,7 @@ import (
 type Handler struct {
 	Linker  *web.Linker
 	Cookies *sessions.CookieConfig
-	DB      *store.Connection
+	DB      store.Store
 }
 
 func (h *Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
@@ -24,10 +24,18 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 
 	ss, _, _ := h.Cookies.SessionsFromRequest(req)
 	for _, s := range ss {
-		if err := h.DB.DoTx(ctx, l, false, func(tx *sqlx.Tx) error {
-			if err := store.RevokeSession(ctx, tx, s.GetId(), "logout"); err != nil {
+		if err := h.DB.DoTx(ctx, l, false, func(tx store.Tx) error {
+			// Only sessions that are still valid are actually revoked, so only those are
+			// worth auditing.
+			current, lookupErr := tx.LookupSession(ctx, s.GetId())
+			if err := tx.RevokeSession(ctx, s.GetId(), "logout"); err != nil {
 				return fmt.Errorf("revoke session: %w", err)
 			}
+			if lookupErr == nil {
+				if err := tx.AddAuditEvent(ctx, audit.FromRequest(req, current, audit.ActionLogout, current.GetUser())); err != nil {
+					return fmt.Errorf("add audit event: %w", err)
+				}
+			}
 			return nil
 		}); err != nil {
 			l.Info("problem revoking session", zap.Error(err))
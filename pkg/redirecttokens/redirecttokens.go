@@ -1,7 +1,11 @@
 package redirecttokens
 
 import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
 	"fmt"
+	"net/url"
 	"time"
 
 	"github.com/jrockway/jsso2/pkg/tokens"
@@ -10,25 +14,117 @@ import (
 
 const RedirectTokenLifetime = 5 * time.Minute
 
+var (
+	ErrUnbound         = errors.New("redirect token is not bound to a login attempt")
+	ErrBindingMismatch = errors.New("redirect token is bound to a different login attempt")
+	ErrAlreadyBound    = errors.New("redirect token is already bound to a login attempt")
+	ErrWrongBrowser    = errors.New("redirect token was minted for a different browser")
+)
+
 type Config struct {
 	tokens.GeneratorConfig
 }
 
-func (c *Config) New(dest string) (string, error) {
+// New returns an unbound redirect token for a request to dest, which was made with the provided
+// method by the browser with the provided browser nonce (see sessions.CookieConfig.BrowserNonce).
+// It must be bound to a login attempt started by the same browser with Bind before Verify accepts
+// it.
+func (c *Config) New(dest, method string, browserNonce []byte) (string, error) {
+	u, err := url.Parse(dest)
+	if err != nil {
+		return "", fmt.Errorf("parse destination: %w", err)
+	}
+	if len(browserNonce) == 0 {
+		return "", errors.New("cannot mint a redirect token without a browser nonce")
+	}
 	msg := &types.RedirectToken{
-		Uri: dest,
+		Uri:              dest,
+		RequestMethod:    method,
+		RequestHost:      u.Host,
+		BrowserNonceHash: hash(browserNonce),
 	}
-	token, err := tokens.New(msg, c.Key)
+	return c.issue(msg, time.Now())
+}
+
+// Bind verifies an unbound redirect token and returns a new token with the same destination, bound
+// to the provided start_login session and, if non-empty, the browser's login binding cookie.  The
+// new token expires when the original does.
+//
+// Only tokens minted for the browser starting the login, as shown by its browser nonce, are
+// accepted; otherwise, anyone could mint a token for a destination of their choosing and send a
+// victim to the login page with it.  Tokens that are already bound can't be re-bound, so that a
+// token bound to one login attempt can't be moved to another.
+func (c *Config) Bind(token string, session *types.Session, loginBinding, browserNonce []byte) (string, error) {
+	msg, issuedAt, err := c.unmarshal(token)
+	if err != nil {
+		return "", err
+	}
+	if len(msg.GetLoginSessionHash()) > 0 {
+		return "", ErrAlreadyBound
+	}
+	if !equalHash(msg.GetBrowserNonceHash(), browserNonce) {
+		return "", ErrWrongBrowser
+	}
+	if len(session.GetId()) == 0 {
+		return "", errors.New("cannot bind redirect token to a session without an id")
+	}
+	msg.LoginSessionHash = hash(session.GetId())
+	msg.LoginBindingHash = nil
+	if len(loginBinding) > 0 {
+		msg.LoginBindingHash = hash(loginBinding)
+	}
+	return c.issue(msg, issuedAt)
+}
+
+// Verify returns the contents of a redirect token, if it is bound to the provided start_login
+// session and login binding cookie.
+func (c *Config) Verify(token string, session *types.Session, loginBinding []byte) (*types.RedirectToken, error) {
+	msg, _, err := c.unmarshal(token)
+	if err != nil {
+		return nil, err
+	}
+	if len(msg.GetLoginSessionHash()) == 0 {
+		return nil, ErrUnbound
+	}
+	if !equalHash(msg.GetLoginSessionHash(), session.GetId()) {
+		return nil, ErrBindingMismatch
+	}
+	if want := msg.GetLoginBindingHash(); len(want) > 0 && !equalHash(want, loginBinding) {
+		return nil, ErrBindingMismatch
+	}
+	return msg, nil
+}
+
+func (c *Config) issue(msg *types.RedirectToken, issuedAt time.Time) (string, error) {
+	token, err := tokens.NewIssuedAt(msg, c.Keyring, issuedAt)
 	if err != nil {
 		return "", fmt.Errorf("generate redirect token: %w", err)
 	}
 	return token, nil
 }
 
-func (c *Config) Unmarshal(token string) (string, error) {
+// unmarshal verifies a redirect token and returns its contents and issue time.
+func (c *Config) unmarshal(token string) (*types.RedirectToken, time.Time, error) {
 	msg := &types.RedirectToken{}
-	if err := tokens.VerifyAndUnmarshal(msg, token, RedirectTokenLifetime, c.Key); err != nil {
-		return "", fmt.Errorf("verify and unmarshal redirect token: %w", err)
+	if err := tokens.VerifyAndUnmarshal(msg, token, RedirectTokenLifetime, c.Keyring); err != nil {
+		return nil, time.Time{}, fmt.Errorf("verify and unmarshal redirect token: %w", err)
+	}
+	wrapper, err := tokens.Decrypt(token, c.Keyring)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("decrypt redirect token: %w", err)
+	}
+	return msg, wrapper.GetIssuedAt().AsTime(), nil
+}
+
+func hash(x []byte) []byte {
+	h := sha256.Sum256(x)
+	return h[:]
+}
+
+// equalHash returns true if want is the hash of x.  An empty x never matches.
+func equalHash(want, x []byte) bool {
+	if len(x) == 0 {
+		return false
 	}
-	return msg.GetUri(), nil
+	return subtle.ConstantTimeCompare(want, hash(x)) == 1
 }
@@ -0,0 +1,128 @@
+package redirecttokens
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jrockway/jsso2/pkg/tokens"
+	"github.com/jrockway/jsso2/pkg/types"
+	"google.golang.org/protobuf/testing/protocmp"
+)
+
+func TestBinding(t *testing.T) {
+	c := new(Config)
+	if err := c.SetKey([]byte("XXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXX")); err != nil {
+		t.Fatal(err)
+	}
+	aliceNonce := []byte("alice's browser nonce")
+	if _, err := c.New("https://app.example.com/", "GET", nil); err == nil {
+		t.Error("new without a browser nonce: expected error")
+	}
+	unbound, err := c.New("https://app.example.com/foo?bar=baz", "POST", aliceNonce)
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	alice := &types.Session{Id: []byte("alice's login session")}
+	mallory := &types.Session{Id: []byte("mallory's login session")}
+	aliceBrowser := []byte("alice's browser")
+
+	if _, err := c.Verify(unbound, alice, aliceBrowser); !errors.Is(err, ErrUnbound) {
+		t.Errorf("verify unbound token:\n  got: %v\n want: %v", err, ErrUnbound)
+	}
+	if _, err := c.Bind(unbound, &types.Session{}, aliceBrowser, aliceNonce); err == nil {
+		t.Error("bind to a session without an id: expected error")
+	}
+
+	// Only the browser that the token was minted for can bind it.
+	if _, err := c.Bind(unbound, mallory, []byte("mallory's browser"), []byte("mallory's browser nonce")); !errors.Is(err, ErrWrongBrowser) {
+		t.Errorf("bind from another browser:\n  got: %v\n want: %v", err, ErrWrongBrowser)
+	}
+	if _, err := c.Bind(unbound, alice, aliceBrowser, nil); !errors.Is(err, ErrWrongBrowser) {
+		t.Errorf("bind without a browser nonce:\n  got: %v\n want: %v", err, ErrWrongBrowser)
+	}
+
+	bound, err := c.Bind(unbound, alice, aliceBrowser, aliceNonce)
+	if err != nil {
+		t.Fatalf("bind: %v", err)
+	}
+	got, err := c.Verify(bound, alice, aliceBrowser)
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	want := &types.RedirectToken{
+		Uri:              "https://app.example.com/foo?bar=baz",
+		RequestMethod:    "POST",
+		RequestHost:      "app.example.com",
+		LoginSessionHash: hash(alice.GetId()),
+		LoginBindingHash: hash(aliceBrowser),
+		BrowserNonceHash: hash(aliceNonce),
+	}
+	if diff := cmp.Diff(got, want, protocmp.Transform()); diff != "" {
+		t.Errorf("verified token (-got +want):\n%s", diff)
+	}
+
+	if _, err := c.Verify(bound, mallory, aliceBrowser); !errors.Is(err, ErrBindingMismatch) {
+		t.Errorf("verify with another session:\n  got: %v\n want: %v", err, ErrBindingMismatch)
+	}
+	if _, err := c.Verify(bound, alice, []byte("mallory's browser")); !errors.Is(err, ErrBindingMismatch) {
+		t.Errorf("verify from another browser:\n  got: %v\n want: %v", err, ErrBindingMismatch)
+	}
+	if _, err := c.Verify(bound, alice, nil); !errors.Is(err, ErrBindingMismatch) {
+		t.Errorf("verify without a binding cookie:\n  got: %v\n want: %v", err, ErrBindingMismatch)
+	}
+
+	// Clients without cookies get tokens bound only to the session.
+	sessionOnly, err := c.Bind(unbound, alice, nil, aliceNonce)
+	if err != nil {
+		t.Fatalf("bind without cookie: %v", err)
+	}
+	if _, err := c.Verify(sessionOnly, alice, nil); err != nil {
+		t.Errorf("verify token bound only to a session: %v", err)
+	}
+	if _, err := c.Verify(sessionOnly, mallory, nil); !errors.Is(err, ErrBindingMismatch) {
+		t.Errorf("verify token bound only to a session, with another session:\n  got: %v\n want: %v", err, ErrBindingMismatch)
+	}
+
+	// A bound token can't be moved to another login attempt.
+	if _, err := c.Bind(bound, mallory, []byte("mallory's browser"), aliceNonce); !errors.Is(err, ErrAlreadyBound) {
+		t.Errorf("re-bind a bound token:\n  got: %v\n want: %v", err, ErrAlreadyBound)
+	}
+	if _, err := c.Bind(bound, alice, aliceBrowser, aliceNonce); !errors.Is(err, ErrAlreadyBound) {
+		t.Errorf("re-bind a bound token to the same session:\n  got: %v\n want: %v", err, ErrAlreadyBound)
+	}
+}
+
+func TestBindKeepsExpiration(t *testing.T) {
+	c := new(Config)
+	if err := c.SetKey([]byte("XXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXX")); err != nil {
+		t.Fatal(err)
+	}
+	nonce := []byte("alice's browser nonce")
+	msg := &types.RedirectToken{Uri: "https://app.example.com/", BrowserNonceHash: hash(nonce)}
+	issuedAt := time.Now().Add(-RedirectTokenLifetime + time.Minute).Truncate(time.Second)
+	unbound, err := tokens.NewIssuedAt(msg, c.Keyring, issuedAt)
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	bound, err := c.Bind(unbound, &types.Session{Id: []byte("alice's login session")}, nil, nonce)
+	if err != nil {
+		t.Fatalf("bind: %v", err)
+	}
+	wrapper, err := tokens.Decrypt(bound, c.Keyring)
+	if err != nil {
+		t.Fatalf("decrypt bound token: %v", err)
+	}
+	if got, want := wrapper.GetIssuedAt().AsTime(), issuedAt; !got.Equal(want) {
+		t.Errorf("bound token issued_at:\n  got: %v\n want: %v", got, want)
+	}
+
+	expired, err := tokens.NewIssuedAt(msg, c.Keyring, time.Now().Add(-RedirectTokenLifetime-time.Second))
+	if err != nil {
+		t.Fatalf("new expired: %v", err)
+	}
+	if _, err := c.Bind(expired, &types.Session{Id: []byte("alice's login session")}, nil, nonce); !errors.Is(err, tokens.ErrTooOld) {
+		t.Errorf("bind expired token:\n  got: %v\n want: %v", err, tokens.ErrTooOld)
+	}
+}
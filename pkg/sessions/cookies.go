@@ -1,6 +1,12 @@
 package sessions
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
@@ -16,27 +22,60 @@ import (
 // skew issues.
 const SetCookieTokenLifetime = time.Minute
 
+// How long a browser keeps its login binding cookie.  It only needs to last from starting a login
+// to redeeming the set-cookie token at the end of it.
+const LoginBindingLifetime = time.Hour
+
+// How long a browser keeps its browser nonce cookie.  Every denied request refreshes it, so it only
+// needs to outlive the redirect tokens minted since the last one.
+const BrowserNonceLifetime = time.Hour
+
+var (
+	ErrTokenReused          = errors.New("set-cookie token has already been used")
+	ErrLoginBindingMismatch = errors.New("set-cookie token was issued to a different browser")
+)
+
+// NonceRedeemer records the nonces of set-cookie tokens that have been redeemed.
+type NonceRedeemer interface {
+	// RedeemNonce records that nonce has been used, returning an error that wraps
+	// ErrTokenReused if it already was.  The record need only be kept until expiresAt.
+	RedeemNonce(ctx context.Context, nonce []byte, expiresAt time.Time) error
+}
+
 // CookieConfig configures the session cookies (and set-cookie tokens) we produce.
 type CookieConfig struct {
 	tokens.GeneratorConfig
-	Name   string      // The name of the cookie (like "jsso-session-id").
-	Domain string      // The domain that the cookie should be valid on.  ("sso.example.com" might choose "example.com" here.)
-	Linker *web.Linker // A Linker for generating links to the set-cookie handler.
+	Name   string        // The name of the cookie (like "jsso-session-id").
+	Domain string        // The domain that the cookie should be valid on.  ("sso.example.com" might choose "example.com" here.)
+	Linker *web.Linker   // A Linker for generating links to the set-cookie handler.
+	Nonces NonceRedeemer // If set, each set-cookie token can only be redeemed once.
 }
 
 // NewSetCookieRequest returns a paseto token (a "set-cookie token") that, when provided to the
 // HandleSetCookie http Handler below, causes a session cookie to be set for the provided session.
 // (It also redirects to the redirectURL after setting the cookie.)  We sign+encrypt the token so
-// that random people on the Internet can't induce the handler to set an arbitrary cookie.  We do
-// not care about replay attacks -- while one of these tokens can't be revoked, the underlying
-// session can be, so a compromised token is not particularly harmful.
-func (c *CookieConfig) NewSetCookieRequest(s *types.Session, redirectURL string) (string, error) {
+// that random people on the Internet can't induce the handler to set an arbitrary cookie.
+//
+// The link to the handler ends up in browser history, proxy logs, and Referer headers, so each
+// token carries a nonce that HandleSetCookie records, and is rejected the second time it's used.
+// If loginBinding is non-empty (see LoginBindingFromCookies), the token is also bound to the
+// browser that started the login, and can only be redeemed by it.
+func (c *CookieConfig) NewSetCookieRequest(s *types.Session, redirectURL string, loginBinding []byte) (string, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("generate nonce: %w", err)
+	}
 	req := &types.SetCookieRequest{
 		SessionId:        s.GetId(),
 		SessionExpiresAt: s.GetExpiresAt(),
 		RedirectUrl:      redirectURL,
+		Nonce:            nonce,
 	}
-	token, err := tokens.New(req, c.Key)
+	if len(loginBinding) > 0 {
+		h := sha256.Sum256(loginBinding)
+		req.LoginBindingHash = h[:]
+	}
+	token, err := tokens.New(req, c.Keyring)
 	if err != nil {
 		return "", fmt.Errorf("generate set-cookie token: %w", err)
 	}
@@ -47,12 +86,19 @@ func (c *CookieConfig) NewSetCookieRequest(s *types.Session, redirectURL string)
 // in the "set" query parameter with a Set-Cookie header and a redirect to the redirect_url inside
 // the token.  If the redirect_url is empty, we just respond with "ok".
 func (c *CookieConfig) HandleSetCookie(w http.ResponseWriter, req *http.Request) {
-	cookie, redirect, err := c.cookieFromToken(req.URL.Query().Get("set"))
+	cookie, redirect, err := c.cookieFromToken(req, req.URL.Query().Get("set"))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		code := http.StatusBadRequest
+		if errors.Is(err, errRedeemNonce) {
+			code = http.StatusServiceUnavailable
+		}
+		http.Error(w, err.Error(), code)
 		return
 	}
 	http.SetCookie(w, cookie)
+	if _, err := req.Cookie(c.loginBindingName()); err == nil {
+		http.SetCookie(w, c.emptyLoginBindingCookie())
+	}
 	if redirect == "" {
 		w.Header().Set("content-type", "text/plain")
 		w.WriteHeader(http.StatusOK)
@@ -73,17 +119,132 @@ func (c *CookieConfig) EmptyCookie() *http.Cookie {
 	}
 }
 
-func (c *CookieConfig) cookieFromToken(token string) (*http.Cookie, string, error) {
+// errRedeemNonce wraps errors from the NonceRedeemer other than ErrTokenReused; they mean that we
+// couldn't tell whether the token was valid, rather than that it wasn't.
+var errRedeemNonce = errors.New("redeem nonce")
+
+func (c *CookieConfig) cookieFromToken(httpReq *http.Request, token string) (*http.Cookie, string, error) {
 	req := &types.SetCookieRequest{}
-	if err := tokens.VerifyAndUnmarshal(req, token, SetCookieTokenLifetime, c.Key); err != nil {
+	if err := tokens.VerifyAndUnmarshal(req, token, SetCookieTokenLifetime, c.Keyring); err != nil {
 		return nil, "", fmt.Errorf("verify and unmarshal set-cookie token: %w", err)
 	}
+	if want := req.GetLoginBindingHash(); len(want) > 0 {
+		binding := c.LoginBindingFromCookies(httpReq.Cookies())
+		got := sha256.Sum256(binding)
+		if len(binding) == 0 || subtle.ConstantTimeCompare(got[:], want) != 1 {
+			return nil, "", ErrLoginBindingMismatch
+		}
+	}
+	// Tokens without a nonce were issued by a version of jsso2 that didn't add them; they expire
+	// within SetCookieTokenLifetime of upgrading.
+	if nonce := req.GetNonce(); c.Nonces != nil && len(nonce) > 0 {
+		err := c.Nonces.RedeemNonce(httpReq.Context(), nonce, time.Now().Add(SetCookieTokenLifetime))
+		if errors.Is(err, ErrTokenReused) {
+			return nil, "", err
+		} else if err != nil {
+			return nil, "", fmt.Errorf("%w: %v", errRedeemNonce, err)
+		}
+	}
 	cookie := c.EmptyCookie()
 	cookie.Expires = req.GetSessionExpiresAt().AsTime()
 	cookie.Value = ToBase64(&types.Session{Id: req.GetSessionId()})
 	return cookie, req.GetRedirectUrl(), nil
 }
 
+func (c *CookieConfig) loginBindingName() string {
+	return c.Name + "-login-binding"
+}
+
+// NewLoginBindingCookie returns a cookie containing a random value that binds a login to the browser
+// that started it.  Pass the value back to NewSetCookieRequest to issue a set-cookie token that
+// only that browser can redeem.
+func (c *CookieConfig) NewLoginBindingCookie() (*http.Cookie, error) {
+	value := make([]byte, 32)
+	if _, err := rand.Read(value); err != nil {
+		return nil, fmt.Errorf("generate login binding: %w", err)
+	}
+	return &http.Cookie{
+		Name:     c.loginBindingName(),
+		Value:    base64.RawURLEncoding.EncodeToString(value),
+		Path:     "/",
+		MaxAge:   int(LoginBindingLifetime.Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		Secure:   c.Linker != nil && c.Linker.BaseURL != nil && c.Linker.BaseURL.Scheme == "https",
+	}, nil
+}
+
+func (c *CookieConfig) emptyLoginBindingCookie() *http.Cookie {
+	return &http.Cookie{
+		Name:     c.loginBindingName(),
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// LoginBindingFromCookies returns the value of the login binding cookie among the provided cookies,
+// or nil if there isn't a valid one.
+func (c *CookieConfig) LoginBindingFromCookies(cookies []*http.Cookie) []byte {
+	return binaryCookie(cookies, c.loginBindingName())
+}
+
+func (c *CookieConfig) browserNonceName() string {
+	return c.Name + "-browser-nonce"
+}
+
+// IsBrowserNonce returns true if cookie is a browser nonce cookie.  It means nothing to anything
+// but jsso2, so it shouldn't be sent to upstream applications.
+func (c *CookieConfig) IsBrowserNonce(cookie *http.Cookie) bool {
+	return cookie.Name == c.browserNonceName()
+}
+
+// BrowserNonceFromCookies returns the value of the browser nonce cookie among the provided cookies,
+// or nil if there isn't a valid one.
+func (c *CookieConfig) BrowserNonceFromCookies(cookies []*http.Cookie) []byte {
+	return binaryCookie(cookies, c.browserNonceName())
+}
+
+// BrowserNonce returns the browser nonce among the provided cookies, or a new random one if there
+// isn't one, along with a cookie that (re)sets it for BrowserNonceLifetime.  Redirect tokens minted
+// for a denied request are bound to the nonce, so that a login can only use a redirect token that
+// was minted for the same browser.  Unlike the login binding cookie, it's set on the cookie domain,
+// because it's set by responses from the applications that jsso2 protects.
+func (c *CookieConfig) BrowserNonce(cookies []*http.Cookie) ([]byte, *http.Cookie, error) {
+	value := c.BrowserNonceFromCookies(cookies)
+	if len(value) == 0 {
+		value = make([]byte, 32)
+		if _, err := rand.Read(value); err != nil {
+			return nil, nil, fmt.Errorf("generate browser nonce: %w", err)
+		}
+	}
+	return value, &http.Cookie{
+		Name:     c.browserNonceName(),
+		Value:    base64.RawURLEncoding.EncodeToString(value),
+		Domain:   c.Domain,
+		Path:     "/",
+		MaxAge:   int(BrowserNonceLifetime.Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		Secure:   c.Linker != nil && c.Linker.BaseURL != nil && c.Linker.BaseURL.Scheme == "https",
+	}, nil
+}
+
+// binaryCookie returns the base64-decoded value of the named cookie among the provided cookies, or
+// nil if there isn't a valid one.
+func binaryCookie(cookies []*http.Cookie, name string) []byte {
+	for _, cookie := range cookies {
+		if cookie.Name != name {
+			continue
+		}
+		if value, err := base64.RawURLEncoding.DecodeString(cookie.Value); err == nil && len(value) > 0 {
+			return value
+		}
+	}
+	return nil
+}
+
 // Cookies returns the cookie objects in the provided string.
 func Cookies(header ...string) []*http.Cookie {
 	req := &http.Request{Header: http.Header{"Cookie": header}}
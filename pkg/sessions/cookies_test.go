@@ -1,6 +1,8 @@
 package sessions
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -31,7 +33,7 @@ func TestRoundTrip(t *testing.T) {
 		Id:        []byte("SSSSSSSSSSSSSSSSSSSSSSSSSSSSSSSSSSSSSSSSSSSSSSSSSSSSSSSSSSSSSSSS"),
 		ExpiresAt: timestamppb.New(time.Now().Add(time.Hour)),
 	}
-	token, err := cfg.NewSetCookieRequest(session, "")
+	token, err := cfg.NewSetCookieRequest(session, "", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -84,11 +86,11 @@ func TestSessionsFromRequest(t *testing.T) {
 		t.Fatal(err)
 	}
 	s := &types.Session{Id: id}
-	token, err := cfg.NewSetCookieRequest(s, "")
+	token, err := cfg.NewSetCookieRequest(s, "", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
-	cookie, _, err := cfg.cookieFromToken(token)
+	cookie, _, err := cfg.cookieFromToken(httptest.NewRequest("GET", "/set-cookie", nil), token)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -215,3 +217,146 @@ func TestSessionsFromRequest(t *testing.T) {
 		})
 	}
 }
+
+// memoryNonces is a NonceRedeemer backed by a map.
+type memoryNonces struct {
+	used map[string]bool
+	err  error
+}
+
+func (m *memoryNonces) RedeemNonce(ctx context.Context, nonce []byte, expiresAt time.Time) error {
+	if m.err != nil {
+		return m.err
+	}
+	if m.used[string(nonce)] {
+		return ErrTokenReused
+	}
+	m.used[string(nonce)] = true
+	return nil
+}
+
+func TestSetCookieReplay(t *testing.T) {
+	nonces := &memoryNonces{used: make(map[string]bool)}
+	cfg := &CookieConfig{
+		Domain: "localhost",
+		Name:   "jsso-session-id",
+		Linker: &web.Linker{
+			BaseURL: &url.URL{Host: "localhost", Scheme: "http"},
+		},
+		Nonces: nonces,
+	}
+	if err := cfg.SetKey([]byte("XXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXX")); err != nil {
+		t.Fatal(err)
+	}
+	id, err := GenerateID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &types.Session{Id: id, ExpiresAt: timestamppb.New(time.Now().Add(time.Hour))}
+	binding, err := cfg.NewLoginBindingCookie()
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherBinding, err := cfg.NewLoginBindingCookie()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// visit redeems the token, returning the status code and the names of the cookies that were
+	// set or cleared.
+	visit := func(token string, cookies ...*http.Cookie) (int, []string) {
+		req := httptest.NewRequest("GET", cfg.LinkToSetCookie(token), nil)
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		rec := httptest.NewRecorder()
+		cfg.HandleSetCookie(rec, req)
+		var names []string
+		for _, c := range rec.Result().Cookies() {
+			names = append(names, c.Name)
+		}
+		return rec.Code, names
+	}
+
+	token, err := cfg.NewSetCookieRequest(s, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := visit(token); got != http.StatusOK {
+		t.Errorf("first use: status %v", got)
+	}
+	if got, _ := visit(token); got != http.StatusBadRequest {
+		t.Errorf("second use: status %v", got)
+	}
+
+	token, err = cfg.NewSetCookieRequest(s, "", cfg.LoginBindingFromCookies([]*http.Cookie{binding}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := visit(token); got != http.StatusBadRequest {
+		t.Errorf("bound token without binding cookie: status %v", got)
+	}
+	if got, _ := visit(token, otherBinding); got != http.StatusBadRequest {
+		t.Errorf("bound token from another browser: status %v", got)
+	}
+	got, names := visit(token, binding)
+	if got != http.StatusOK {
+		t.Errorf("bound token from the right browser: status %v", got)
+	}
+	if diff := cmp.Diff(names, []string{"jsso-session-id", "jsso-session-id-login-binding"}); diff != "" {
+		t.Errorf("cookies set (-got +want):\n%s", diff)
+	}
+
+	nonces.err = errors.New("database is down")
+	token, err = cfg.NewSetCookieRequest(s, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := visit(token); got != http.StatusServiceUnavailable {
+		t.Errorf("redeemer error: status %v", got)
+	}
+}
+
+func TestBrowserNonce(t *testing.T) {
+	cfg := &CookieConfig{
+		Domain: "example.com",
+		Name:   "jsso-session-id",
+		Linker: &web.Linker{
+			BaseURL: &url.URL{Host: "sso.example.com", Scheme: "https"},
+		},
+	}
+	nonce, cookie, err := cfg.BrowserNonce(nil)
+	if err != nil {
+		t.Fatalf("new nonce: %v", err)
+	}
+	if got, want := len(nonce), 32; got != want {
+		t.Errorf("nonce length:\n  got: %v\n want: %v", got, want)
+	}
+	if !cfg.IsBrowserNonce(cookie) {
+		t.Errorf("cookie %v is not a browser nonce", cookie)
+	}
+	if got, want := cookie.Domain, "example.com"; got != want {
+		t.Errorf("cookie domain:\n  got: %v\n want: %v", got, want)
+	}
+	if !cookie.Secure || !cookie.HttpOnly {
+		t.Errorf("cookie should be secure and http-only: %v", cookie)
+	}
+
+	again, _, err := cfg.BrowserNonce([]*http.Cookie{{Name: "foo", Value: "bar"}, cookie})
+	if err != nil {
+		t.Fatalf("reuse nonce: %v", err)
+	}
+	if diff := cmp.Diff(again, nonce); diff != "" {
+		t.Errorf("nonce was not reused (-got +want):\n%s", diff)
+	}
+	if diff := cmp.Diff(cfg.BrowserNonceFromCookies([]*http.Cookie{cookie}), nonce); diff != "" {
+		t.Errorf("nonce from cookies (-got +want):\n%s", diff)
+	}
+
+	other, _, err := cfg.BrowserNonce([]*http.Cookie{{Name: cookie.Name, Value: "!!!"}})
+	if err != nil {
+		t.Fatalf("replace invalid nonce: %v", err)
+	}
+	if len(other) != 32 || cmp.Equal(other, nonce) {
+		t.Errorf("invalid nonce was not replaced with a new one: %x", other)
+	}
+}
@@ -3,7 +3,9 @@ package sessions
 import (
 	"context"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"strings"
@@ -83,6 +85,16 @@ func ToBase64(s *types.Session) string {
 	return encoder.EncodeToString(s.Id)
 }
 
+// Handle returns a non-secret identifier for a session, which can be logged to correlate the
+// requests it made without giving anyone who can read the logs the ability to use the session.
+func Handle(s *types.Session) string {
+	if len(s.GetId()) == 0 {
+		return ""
+	}
+	h := sha256.Sum256(s.GetId())
+	return hex.EncodeToString(h[:16])
+}
+
 // FromHeaderString extracts a session from an HTTP header.
 func FromHeaderString(header string) (*types.Session, error) {
 	parts := strings.SplitN(header, " ", 2)
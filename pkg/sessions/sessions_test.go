@@ -1,6 +1,8 @@
 package sessions
 
 import (
+	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -168,3 +170,24 @@ func TestSpecial(t *testing.T) {
 		t.Errorf("anonmymous session is missing taint: %#v", anon)
 	}
 }
+
+func TestHandle(t *testing.T) {
+	s, err := GenerateID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	session := &types.Session{Id: s}
+	h := Handle(session)
+	if got, want := len(h), 32; got != want {
+		t.Errorf("handle length:\n  got: %v\n want: %v", got, want)
+	}
+	if got, want := Handle(&types.Session{Id: s}), h; got != want {
+		t.Errorf("handle is not stable:\n  got: %v\n want: %v", got, want)
+	}
+	if strings.Contains(ToBase64(session), h) || strings.Contains(fmt.Sprintf("%x", s), h) {
+		t.Error("handle contains the session id")
+	}
+	if got := Handle(nil); got != "" {
+		t.Errorf("handle of nil session: got %q, want empty", got)
+	}
+}
@@ -0,0 +1,394 @@
+package store
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/jrockway/jsso2/pkg/types"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// AuditFilter selects audit events for QueryAuditEvents.  Zero-valued fields match every event.
+type AuditFilter struct {
+	Action string
+	// Actor and Target are matched by ID if it's set, or otherwise by the username that was
+	// recorded with the event.
+	Actor, Target *types.User
+	// Since is inclusive and Until is exclusive.
+	Since, Until time.Time
+	Result       types.AuditEvent_Result
+	IPAddress    string
+	// BeforeID and AfterID only match events with a lower or higher ID, for paginating through
+	// results.
+	BeforeID, AfterID int64
+	// Limit is the maximum number of events to return; 0 means no limit.
+	Limit int
+	// OldestFirst returns events in ascending order of ID, rather than newest first.
+	OldestFirst bool
+}
+
+type rawAuditEvent struct {
+	ID             int64     `db:"id"`
+	CreatedAt      time.Time `db:"created_at"`
+	Action         string    `db:"action"`
+	ActorUserID    int64     `db:"actor_user_id"`
+	ActorUsername  string    `db:"actor_username"`
+	ActorSessionID []byte    `db:"actor_session_id"`
+	TargetUserID   int64     `db:"target_user_id"`
+	TargetUsername string    `db:"target_username"`
+	IPAddress      string    `db:"ip_address"`
+	UserAgent      string    `db:"user_agent"`
+	Result         string    `db:"result"`
+	Error          string    `db:"error"`
+	Details        []byte    `db:"details"`
+	PrevHash       []byte    `db:"prev_hash"`
+	Hash           []byte    `db:"hash"`
+}
+
+const auditEventColumns = `id, created_at, action, actor_user_id, actor_username, actor_session_id,
+    target_user_id, target_username, ip_address, user_agent, result, error, details, prev_hash, hash`
+
+type rawAuditCheckpoint struct {
+	ID           int64     `db:"id"`
+	CreatedAt    time.Time `db:"created_at"`
+	AuditEventID int64     `db:"audit_event_id"`
+	Hash         []byte    `db:"hash"`
+	Signature    []byte    `db:"signature"`
+}
+
+func (raw *rawAuditCheckpoint) toAuditCheckpoint() *types.AuditCheckpoint {
+	return &types.AuditCheckpoint{
+		Id:           raw.ID,
+		CreatedAt:    timestamppb.New(raw.CreatedAt),
+		AuditEventId: raw.AuditEventID,
+		Hash:         raw.Hash,
+		Signature:    raw.Signature,
+	}
+}
+
+var auditResults = map[types.AuditEvent_Result]string{
+	types.AuditEvent_SUCCESS: "success",
+	types.AuditEvent_FAILURE: "failure",
+}
+
+// checkAddAuditEvent returns an error if an event passed to AddAuditEvent is missing required
+// fields.
+func checkAddAuditEvent(e *types.AuditEvent) error {
+	if e == nil {
+		return &ErrEmpty{Field: "audit_event"}
+	}
+	if e.GetCreatedAt() == nil {
+		return &ErrEmpty{Field: "audit_event.created_at"}
+	}
+	if e.GetAction() == "" {
+		return &ErrEmpty{Field: "audit_event.action"}
+	}
+	if _, ok := auditResults[e.GetResult()]; !ok {
+		return &ErrEmpty{Field: "audit_event.result"}
+	}
+	return nil
+}
+
+// AuditEventHash returns the hash of an audit event that follows the event with hash prev.  Every
+// field except the ID and the hashes themselves is covered, with the creation time truncated to the
+// millisecond precision that the database stores.
+func AuditEventHash(prev []byte, e *types.AuditEvent) []byte {
+	h := sha256.New()
+	// Every value is written with a fixed size or a length prefix, so that no two events hash
+	// the same input.
+	writeInt := func(i int64) {
+		var buf [8]byte
+		binary.BigEndian.PutUint64(buf[:], uint64(i))
+		h.Write(buf[:])
+	}
+	writeBytes := func(b []byte) {
+		writeInt(int64(len(b)))
+		h.Write(b)
+	}
+	writeString := func(s string) { writeBytes([]byte(s)) }
+
+	writeBytes(prev)
+	writeInt(toMillis(e.GetCreatedAt().AsTime()))
+	writeString(e.GetAction())
+	writeInt(e.GetActor().GetId())
+	writeString(e.GetActor().GetUsername())
+	writeBytes(e.GetActorSessionId())
+	writeInt(e.GetTarget().GetId())
+	writeString(e.GetTarget().GetUsername())
+	writeString(e.GetIpAddress())
+	writeString(e.GetUserAgent())
+	writeInt(int64(e.GetResult()))
+	writeString(e.GetError())
+	keys := make([]string, 0, len(e.GetDetails()))
+	for k := range e.GetDetails() {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	writeInt(int64(len(keys)))
+	for _, k := range keys {
+		writeString(k)
+		writeString(e.GetDetails()[k])
+	}
+	return h.Sum(nil)
+}
+
+// chainAuditEvent sets the hashes of an event that follows the event with hash prev.  The creation
+// time is truncated first, so that the database doesn't round it to a value with a different hash.
+func chainAuditEvent(prev []byte, e *types.AuditEvent) {
+	if len(prev) == 0 {
+		prev = nil
+	}
+	e.CreatedAt = timestamppb.New(e.GetCreatedAt().AsTime().Truncate(time.Millisecond))
+	e.PrevHash = prev
+	e.Hash = AuditEventHash(prev, e)
+}
+
+// checkAddAuditCheckpoint returns an error if a checkpoint passed to AddAuditCheckpoint is missing
+// required fields.
+func checkAddAuditCheckpoint(c *types.AuditCheckpoint) error {
+	if c == nil {
+		return &ErrEmpty{Field: "audit_checkpoint"}
+	}
+	if c.GetCreatedAt() == nil {
+		return &ErrEmpty{Field: "audit_checkpoint.created_at"}
+	}
+	if c.GetAuditEventId() < 1 {
+		return &ErrEmpty{Field: "audit_checkpoint.audit_event_id"}
+	}
+	if len(c.GetHash()) == 0 {
+		return &ErrEmpty{Field: "audit_checkpoint.hash"}
+	}
+	if len(c.GetSignature()) == 0 {
+		return &ErrEmpty{Field: "audit_checkpoint.signature"}
+	}
+	return nil
+}
+
+func fromAuditEvent(e *types.AuditEvent) (*rawAuditEvent, error) {
+	details := e.GetDetails()
+	if details == nil {
+		details = map[string]string{}
+	}
+	detailsJSON, err := json.Marshal(details)
+	if err != nil {
+		return nil, fmt.Errorf("marshal details: %w", err)
+	}
+	result := &rawAuditEvent{
+		CreatedAt:      e.GetCreatedAt().AsTime(),
+		Action:         e.GetAction(),
+		ActorUserID:    e.GetActor().GetId(),
+		ActorUsername:  e.GetActor().GetUsername(),
+		TargetUserID:   e.GetTarget().GetId(),
+		TargetUsername: e.GetTarget().GetUsername(),
+		IPAddress:      e.GetIpAddress(),
+		UserAgent:      e.GetUserAgent(),
+		Result:         auditResults[e.GetResult()],
+		Error:          e.GetError(),
+		Details:        detailsJSON,
+		PrevHash:       e.GetPrevHash(),
+		Hash:           e.GetHash(),
+	}
+	if id := e.GetActorSessionId(); len(id) > 0 {
+		result.ActorSessionID = id
+	}
+	return result, nil
+}
+
+func (raw *rawAuditEvent) toAuditEvent() (*types.AuditEvent, error) {
+	result := &types.AuditEvent{
+		Id:             raw.ID,
+		CreatedAt:      timestamppb.New(raw.CreatedAt),
+		Action:         raw.Action,
+		ActorSessionId: raw.ActorSessionID,
+		IpAddress:      raw.IPAddress,
+		UserAgent:      raw.UserAgent,
+		Error:          raw.Error,
+		PrevHash:       raw.PrevHash,
+		Hash:           raw.Hash,
+	}
+	if raw.ActorUserID != 0 || raw.ActorUsername != "" {
+		result.Actor = &types.User{Id: raw.ActorUserID, Username: raw.ActorUsername}
+	}
+	if raw.TargetUserID != 0 || raw.TargetUsername != "" {
+		result.Target = &types.User{Id: raw.TargetUserID, Username: raw.TargetUsername}
+	}
+	for r, name := range auditResults {
+		if name == raw.Result {
+			result.Result = r
+		}
+	}
+	if err := json.Unmarshal(raw.Details, &result.Details); err != nil {
+		return nil, fmt.Errorf("unmarshal details: %w", err)
+	}
+	if len(result.Details) == 0 {
+		result.Details = nil
+	}
+	return result, nil
+}
+
+// auditQuery builds a query for the events that f selects, with ? placeholders.  toTime converts a
+// time to the representation that the database stores.
+func auditQuery(f *AuditFilter, toTime func(time.Time) interface{}) (string, []interface{}, error) {
+	if f == nil {
+		return "", nil, &ErrEmpty{Field: "filter"}
+	}
+	var conds []string
+	var args []interface{}
+	add := func(cond string, arg interface{}) {
+		conds = append(conds, cond)
+		args = append(args, arg)
+	}
+	addUser := func(column string, u *types.User) {
+		if id := u.GetId(); id != 0 {
+			add(column+"_user_id=?", id)
+		} else if username := u.GetUsername(); username != "" {
+			add(column+"_username=?", username)
+		}
+	}
+	if a := f.Action; a != "" {
+		add("action=?", a)
+	}
+	addUser("actor", f.Actor)
+	addUser("target", f.Target)
+	if !f.Since.IsZero() {
+		add("created_at>=?", toTime(f.Since))
+	}
+	if !f.Until.IsZero() {
+		add("created_at<?", toTime(f.Until))
+	}
+	if r := f.Result; r != types.AuditEvent_RESULT_UNKNOWN {
+		name, ok := auditResults[r]
+		if !ok {
+			return "", nil, fmt.Errorf("unknown result %v", r)
+		}
+		add("result=?", name)
+	}
+	if ip := f.IPAddress; ip != "" {
+		add("ip_address=?", ip)
+	}
+	if id := f.BeforeID; id > 0 {
+		add("id<?", id)
+	}
+	if id := f.AfterID; id > 0 {
+		add("id>?", id)
+	}
+	query := new(strings.Builder)
+	query.WriteString("select " + auditEventColumns + " from audit_event")
+	if len(conds) > 0 {
+		query.WriteString(" where " + strings.Join(conds, " and "))
+	}
+	if f.OldestFirst {
+		query.WriteString(" order by id asc")
+	} else {
+		query.WriteString(" order by id desc")
+	}
+	if n := f.Limit; n > 0 {
+		query.WriteString(" limit ?")
+		args = append(args, n)
+	}
+	return query.String(), args, nil
+}
+
+// AddAuditEvent appends an event to the audit log, filling in its ID and hashes.  Call it in the
+// same transaction as the change that the event describes.  Serializable isolation guarantees that
+// two concurrent transactions can't chain an event to the same previous event.
+func AddAuditEvent(ctx context.Context, db sqlx.ExtContext, e *types.AuditEvent) error {
+	if err := checkAddAuditEvent(e); err != nil {
+		return err
+	}
+	var prev []byte
+	if err := db.QueryRowxContext(ctx, `select hash from audit_event where hash is not null order by id desc limit 1`).Scan(&prev); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("read previous hash: %w", err)
+	}
+	chainAuditEvent(prev, e)
+	obj, err := fromAuditEvent(e)
+	if err != nil {
+		return fmt.Errorf("marshal audit event: %w", err)
+	}
+	rows, err := sqlx.NamedQueryContext(ctx, db, `insert into audit_event
+                  ( created_at,  action,  actor_user_id,  actor_username,  actor_session_id,  target_user_id,  target_username,  ip_address,  user_agent,  result,  error,  details,  prev_hash,  hash)
+            values(:created_at, :action, :actor_user_id, :actor_username, :actor_session_id, :target_user_id, :target_username, :ip_address, :user_agent, :result, :error, :details, :prev_hash, :hash)
+            returning (id)`, obj)
+	if err != nil {
+		return fmt.Errorf("insert: %w", err)
+	}
+	defer rows.Close()
+	if ok := rows.Next(); !ok {
+		return errors.New("insert: no id returned")
+	}
+	if err := rows.Scan(&e.Id); err != nil {
+		return fmt.Errorf("insert: scan id: %w", err)
+	}
+	return nil
+}
+
+// QueryAuditEvents returns the audit events that match the filter, newest first.
+func QueryAuditEvents(ctx context.Context, db sqlx.ExtContext, f *AuditFilter) ([]*types.AuditEvent, error) {
+	query, args, err := auditQuery(f, func(t time.Time) interface{} { return t })
+	if err != nil {
+		return nil, fmt.Errorf("build query: %w", err)
+	}
+	rows, err := db.QueryxContext(ctx, db.Rebind(query), args...)
+	if err != nil {
+		return nil, fmt.Errorf("select: %w", err)
+	}
+	defer rows.Close()
+	var result []*types.AuditEvent
+	for rows.Next() {
+		raw := &rawAuditEvent{}
+		if err := rows.StructScan(raw); err != nil {
+			return nil, fmt.Errorf("select: scan: %w", err)
+		}
+		e, err := raw.toAuditEvent()
+		if err != nil {
+			return nil, fmt.Errorf("convert to *types.AuditEvent: %w", err)
+		}
+		result = append(result, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("select: iterate over rows: %w", err)
+	}
+	return result, nil
+}
+
+// AddAuditCheckpoint records a signed checkpoint of the audit log.
+func AddAuditCheckpoint(ctx context.Context, db sqlx.ExtContext, c *types.AuditCheckpoint) error {
+	if err := checkAddAuditCheckpoint(c); err != nil {
+		return err
+	}
+	if err := db.QueryRowxContext(ctx, `insert into audit_checkpoint (created_at, audit_event_id, hash, signature) values ($1, $2, $3, $4) returning id`,
+		c.GetCreatedAt().AsTime(), c.GetAuditEventId(), c.GetHash(), c.GetSignature()).Scan(&c.Id); err != nil {
+		return fmt.Errorf("insert: %w", err)
+	}
+	return nil
+}
+
+// GetAuditCheckpoints returns every audit log checkpoint, oldest first.
+func GetAuditCheckpoints(ctx context.Context, db sqlx.ExtContext) ([]*types.AuditCheckpoint, error) {
+	rows, err := db.QueryxContext(ctx, `select id, created_at, audit_event_id, hash, signature from audit_checkpoint order by id`)
+	if err != nil {
+		return nil, fmt.Errorf("select: %w", err)
+	}
+	defer rows.Close()
+	var result []*types.AuditCheckpoint
+	for rows.Next() {
+		raw := &rawAuditCheckpoint{}
+		if err := rows.StructScan(raw); err != nil {
+			return nil, fmt.Errorf("select: scan: %w", err)
+		}
+		result = append(result, raw.toAuditCheckpoint())
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("select: iterate over rows: %w", err)
+	}
+	return result, nil
+}
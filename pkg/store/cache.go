@@ -0,0 +1,287 @@
+package store
+
+import (
+	"container/list"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jrockway/jsso2/pkg/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+)
+
+// sessionChangedChannel is the channel that the triggers in migrations/003_session_notify.sql
+// notify when a session or user changes.
+const sessionChangedChannel = "jsso2_session_changed"
+
+var (
+	cacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "jsso2_session_cache_requests",
+		Help: "Number of session lookups that consulted the session cache, by result.",
+	}, []string{"result"})
+	cacheInvalidations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "jsso2_session_cache_invalidations",
+		Help: "Number of invalidation events processed by the session cache, by type.",
+	}, []string{"type"})
+	cacheEvictions = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "jsso2_session_cache_evictions",
+		Help: "Number of sessions evicted from the session cache because it was full.",
+	})
+	cacheSize = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "jsso2_session_cache_size",
+		Help: "Number of sessions currently in the session cache.",
+	})
+)
+
+type cacheEntry struct {
+	key      string
+	session  *types.Session
+	cachedAt time.Time
+}
+
+// sessionCache is a bounded LRU cache of sessions.  Entries are only served while the cache is
+// enabled, which is only true while we are listening for invalidations from the database.
+//
+// Sessions read from a read replica may predate an invalidation that has already arrived, so the
+// cache also remembers what it invalidated within the last replicaDelay; see addReplicated.
+type sessionCache struct {
+	sync.Mutex
+	size    int
+	ttl     time.Duration
+	enabled bool
+	gen     uint64 // Incremented on every invalidation; see generation().
+	entries map[string]*list.Element
+	byUser  map[int64]map[string]struct{}
+	lru     *list.List
+
+	replicaDelay    time.Duration // How far behind the primary a replica read can be.
+	changedSessions map[string]time.Time
+	changedUsers    map[int64]time.Time
+	flushedAt       time.Time
+}
+
+func newSessionCache(size int, ttl time.Duration) *sessionCache {
+	return &sessionCache{
+		size:    size,
+		ttl:     ttl,
+		entries: make(map[string]*list.Element),
+		byUser:  make(map[int64]map[string]struct{}),
+		lru:     list.New(),
+
+		changedSessions: make(map[string]time.Time),
+		changedUsers:    make(map[int64]time.Time),
+	}
+}
+
+// generation returns a token to pass to add.  Read it before reading a session from the database;
+// if any invalidation arrives between then and the add, the add is ignored, because the session
+// that was read might be the stale version.
+func (c *sessionCache) generation() uint64 {
+	c.Lock()
+	defer c.Unlock()
+	return c.gen
+}
+
+// get returns a copy of the cached session with the provided ID.
+func (c *sessionCache) get(id []byte) (*types.Session, bool) {
+	c.Lock()
+	defer c.Unlock()
+	if !c.enabled {
+		return nil, false
+	}
+	el, ok := c.entries[string(id)]
+	if !ok {
+		cacheRequests.WithLabelValues("miss").Inc()
+		return nil, false
+	}
+	entry := el.Value.(*cacheEntry)
+	if time.Since(entry.cachedAt) > c.ttl {
+		c.removeLocked(el)
+		cacheRequests.WithLabelValues("expired").Inc()
+		return nil, false
+	}
+	c.lru.MoveToFront(el)
+	cacheRequests.WithLabelValues("hit").Inc()
+	return proto.Clone(entry.session).(*types.Session), true
+}
+
+// add adds a session to the cache, if no invalidations have happened since gen was obtained.
+func (c *sessionCache) add(s *types.Session, gen uint64) {
+	c.Lock()
+	defer c.Unlock()
+	c.addLocked(s, gen)
+}
+
+// addReplicated adds a session that was read from a read replica by a transaction started at
+// readAt.  On top of the generation check that add does, the session is not cached if it, its user,
+// or the whole cache was invalidated in the replicaDelay before readAt, because the replica may not
+// have replayed that change when the session was read.
+func (c *sessionCache) addReplicated(s *types.Session, gen uint64, readAt time.Time) {
+	c.Lock()
+	defer c.Unlock()
+	since := readAt.Add(-c.replicaDelay)
+	if c.flushedAt.After(since) || c.changedSessions[string(s.GetId())].After(since) || c.changedUsers[s.GetUser().GetId()].After(since) {
+		return
+	}
+	c.addLocked(s, gen)
+}
+
+func (c *sessionCache) addLocked(s *types.Session, gen uint64) {
+	if !c.enabled || gen != c.gen || c.size < 1 {
+		return
+	}
+	key := string(s.GetId())
+	if el, ok := c.entries[key]; ok {
+		c.removeLocked(el)
+	}
+	for c.lru.Len() >= c.size {
+		c.removeLocked(c.lru.Back())
+		cacheEvictions.Inc()
+	}
+	c.entries[key] = c.lru.PushFront(&cacheEntry{
+		key:      key,
+		session:  proto.Clone(s).(*types.Session),
+		cachedAt: time.Now(),
+	})
+	uid := s.GetUser().GetId()
+	if c.byUser[uid] == nil {
+		c.byUser[uid] = make(map[string]struct{})
+	}
+	c.byUser[uid][key] = struct{}{}
+	cacheSize.Set(float64(c.lru.Len()))
+}
+
+func (c *sessionCache) removeLocked(el *list.Element) {
+	entry := c.lru.Remove(el).(*cacheEntry)
+	delete(c.entries, entry.key)
+	uid := entry.session.GetUser().GetId()
+	delete(c.byUser[uid], entry.key)
+	if len(c.byUser[uid]) == 0 {
+		delete(c.byUser, uid)
+	}
+	cacheSize.Set(float64(c.lru.Len()))
+}
+
+// recordChangesLocked forgets changes too old to matter to addReplicated, and returns the current
+// time to record a new change at.
+func (c *sessionCache) recordChangesLocked() time.Time {
+	now := time.Now()
+	for k, t := range c.changedSessions {
+		if now.Sub(t) > c.replicaDelay {
+			delete(c.changedSessions, k)
+		}
+	}
+	for k, t := range c.changedUsers {
+		if now.Sub(t) > c.replicaDelay {
+			delete(c.changedUsers, k)
+		}
+	}
+	return now
+}
+
+func (c *sessionCache) invalidateSession(id []byte) {
+	c.Lock()
+	defer c.Unlock()
+	c.gen++
+	c.changedSessions[string(id)] = c.recordChangesLocked()
+	cacheInvalidations.WithLabelValues("session").Inc()
+	if el, ok := c.entries[string(id)]; ok {
+		c.removeLocked(el)
+	}
+}
+
+func (c *sessionCache) invalidateUser(id int64) {
+	c.Lock()
+	defer c.Unlock()
+	c.gen++
+	c.changedUsers[id] = c.recordChangesLocked()
+	cacheInvalidations.WithLabelValues("user").Inc()
+	for key := range c.byUser[id] {
+		c.removeLocked(c.entries[key])
+	}
+}
+
+// setEnabled empties the cache and starts or stops serving from it.
+func (c *sessionCache) setEnabled(enabled bool) {
+	c.Lock()
+	defer c.Unlock()
+	c.gen++
+	c.flushedAt = c.recordChangesLocked()
+	cacheInvalidations.WithLabelValues("flush").Inc()
+	c.enabled = enabled
+	c.entries = make(map[string]*list.Element)
+	c.byUser = make(map[int64]map[string]struct{})
+	c.lru.Init()
+	cacheSize.Set(0)
+}
+
+// handleNotification processes the payload of a notification from the database.
+func (c *sessionCache) handleNotification(payload string) error {
+	parts := strings.SplitN(payload, ":", 2)
+	if len(parts) != 2 {
+		c.setEnabled(true)
+		return fmt.Errorf("malformed payload %q; flushed cache", payload)
+	}
+	switch parts[0] {
+	case "s":
+		id, err := hex.DecodeString(parts[1])
+		if err != nil {
+			c.setEnabled(true)
+			return fmt.Errorf("decode session id in payload %q: %w; flushed cache", payload, err)
+		}
+		c.invalidateSession(id)
+	case "u":
+		id, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			c.setEnabled(true)
+			return fmt.Errorf("parse user id in payload %q: %w; flushed cache", payload, err)
+		}
+		c.invalidateUser(id)
+	default:
+		c.setEnabled(true)
+		return fmt.Errorf("unknown payload type in %q; flushed cache", payload)
+	}
+	return nil
+}
+
+// listen listens for session changes and invalidates the cache accordingly, until the connection
+// fails or the context is cancelled.  The cache is only enabled while we are listening.
+func (c *Connection) listen(ctx context.Context, l *zap.Logger) error {
+	defer c.cache.setEnabled(false)
+	return c.listenChannel(ctx, l, sessionChangedChannel, func() {
+		c.cache.setEnabled(true)
+		l.Info("session cache listening for invalidations")
+	}, func(payload string) {
+		if err := c.cache.handleNotification(payload); err != nil {
+			l.Warn("problem handling session invalidation", zap.Error(err))
+		}
+	})
+}
+
+// EnableSessionCache configures an in-memory cache of sessions for AuthenticateUser, holding up to
+// size sessions for at most ttl.  The cache is only used while ListenForSessionChanges is
+// connected to the database; if that connection breaks, the cache is emptied and bypassed until it
+// reconnects.  It must be called before the Connection is used.
+//
+// Sessions read from the read replica are cached too, unless they changed within the replica's
+// maximum lag (plus one check interval) of being read.
+func (c *Connection) EnableSessionCache(size int, ttl time.Duration) {
+	c.cache = newSessionCache(size, ttl)
+	c.cache.replicaDelay = c.replicaDelay
+}
+
+// ListenForSessionChanges keeps the session cache up to date with changes made to sessions by any
+// replica.  It returns when the context is cancelled.
+func (c *Connection) ListenForSessionChanges(ctx context.Context, l *zap.Logger) {
+	if c.cache == nil {
+		return
+	}
+	keepListening(ctx, l, func() error { return c.listen(ctx, l) })
+}
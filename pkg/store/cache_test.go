@@ -0,0 +1,187 @@
+package store
+
+import (
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/jrockway/jsso2/pkg/jtesting"
+	"github.com/jrockway/jsso2/pkg/types"
+)
+
+func testSession(id byte, user int64) *types.Session {
+	sid := make([]byte, 64)
+	sid[0] = id
+	return &types.Session{Id: sid, User: &types.User{Id: user}}
+}
+
+func TestSessionCache(t *testing.T) {
+	c := newSessionCache(2, time.Minute)
+	a, b, d := testSession(1, 1), testSession(2, 1), testSession(3, 2)
+
+	c.add(a, c.generation())
+	if _, ok := c.get(a.GetId()); ok {
+		t.Error("disabled cache: unexpected hit")
+	}
+
+	c.setEnabled(true)
+	c.add(a, c.generation())
+	if _, ok := c.get(a.GetId()); !ok {
+		t.Error("enabled cache: expected hit")
+	}
+
+	// An invalidation between reading the generation and adding causes the add to be ignored.
+	gen := c.generation()
+	c.invalidateSession(b.GetId())
+	c.add(b, gen)
+	if _, ok := c.get(b.GetId()); ok {
+		t.Error("add after invalidation: unexpected hit")
+	}
+
+	// Filling the cache evicts the least recently used entry.
+	c.add(b, c.generation())
+	c.get(a.GetId())
+	c.add(d, c.generation())
+	if _, ok := c.get(b.GetId()); ok {
+		t.Error("evicted entry: unexpected hit")
+	}
+	if _, ok := c.get(a.GetId()); !ok {
+		t.Error("recently used entry: expected hit")
+	}
+
+	// Invalidating a user removes their sessions.
+	if err := c.handleNotification("u:1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.get(a.GetId()); ok {
+		t.Error("session of invalidated user: unexpected hit")
+	}
+	if _, ok := c.get(d.GetId()); !ok {
+		t.Error("session of other user: expected hit")
+	}
+
+	// Invalidating a session removes only that session.
+	c.add(a, c.generation())
+	if err := c.handleNotification("s:" + hex.EncodeToString(d.GetId())); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.get(d.GetId()); ok {
+		t.Error("invalidated session: unexpected hit")
+	}
+	if _, ok := c.get(a.GetId()); !ok {
+		t.Error("other session: expected hit")
+	}
+
+	// Malformed notifications flush the cache.
+	c.add(a, c.generation())
+	if err := c.handleNotification("garbage"); err == nil {
+		t.Error("malformed notification: expected error")
+	}
+	if _, ok := c.get(a.GetId()); ok {
+		t.Error("after flush: unexpected hit")
+	}
+
+	// Entries older than the TTL are not served.
+	c.ttl = -time.Second
+	c.add(a, c.generation())
+	if _, ok := c.get(a.GetId()); ok {
+		t.Error("expired entry: unexpected hit")
+	}
+}
+
+func TestSessionCacheReplicated(t *testing.T) {
+	c := newSessionCache(10, time.Minute)
+	c.replicaDelay = time.Minute
+	c.setEnabled(true)
+	a, b, d := testSession(1, 1), testSession(2, 2), testSession(3, 3)
+
+	// Right after the cache is enabled, the replica might be missing changes that happened
+	// while nothing was listening.
+	c.addReplicated(a, c.generation(), time.Now())
+	if _, ok := c.get(a.GetId()); ok {
+		t.Error("replicated session read right after enabling: unexpected hit")
+	}
+
+	// Once the replica has had time to catch up, sessions read from it are cached.
+	c.flushedAt = time.Now().Add(-2 * time.Minute)
+	c.addReplicated(a, c.generation(), time.Now())
+	if _, ok := c.get(a.GetId()); !ok {
+		t.Error("replicated session: expected hit")
+	}
+
+	// Sessions and users that changed recently are not cached from the replica, even though
+	// the invalidation arrived before the read.
+	c.invalidateSession(b.GetId())
+	c.invalidateUser(d.GetUser().GetId())
+	gen := c.generation()
+	c.addReplicated(b, gen, time.Now())
+	c.addReplicated(d, gen, time.Now())
+	if _, ok := c.get(b.GetId()); ok {
+		t.Error("recently invalidated session from replica: unexpected hit")
+	}
+	if _, ok := c.get(d.GetId()); ok {
+		t.Error("session of recently invalidated user from replica: unexpected hit")
+	}
+
+	// Sessions read from the primary are unaffected.
+	c.add(b, gen)
+	if _, ok := c.get(b.GetId()); !ok {
+		t.Error("recently invalidated session from primary: expected hit")
+	}
+
+	// Old changes are forgotten.
+	c.replicaDelay = 0
+	c.invalidateSession(a.GetId())
+	if got := len(c.changedSessions) + len(c.changedUsers); got != 1 {
+		t.Errorf("remembered changes: got %d, want 1", got)
+	}
+}
+
+func TestSessionCacheInvalidation(t *testing.T) {
+	jtesting.Run(t, "sessioncache", jtesting.R{Logger: true, Database: true}, func(t *testing.T, e *jtesting.E) {
+		c := MustGetTestDB(t, e)
+		c.EnableSessionCache(10, time.Hour)
+		go c.ListenForSessionChanges(e.Context, e.Logger.Named("listener"))
+		for i := 0; ; i++ {
+			c.cache.Lock()
+			enabled := c.cache.enabled
+			c.cache.Unlock()
+			if enabled {
+				break
+			}
+			if i > 100 {
+				t.Fatal("cache never started listening")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		session := ValidSession(t, e, c)
+		if got, errs := c.AuthenticateUser(e.Context, e.Logger, []*types.Session{{Id: session.GetId()}}, nil, nil); got == nil {
+			t.Fatalf("authenticate: %v", errs)
+		}
+		if _, ok := c.cache.get(session.GetId()); !ok {
+			t.Fatal("session not cached after authentication")
+		}
+
+		if err := c.doTx(e.Context, e.Logger, false, func(tx *sqlx.Tx) error {
+			return RevokeSession(e.Context, tx, session.GetId(), "test")
+		}); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; ; i++ {
+			if _, ok := c.cache.get(session.GetId()); !ok {
+				break
+			}
+			if i > 100 {
+				t.Fatal("revoked session never invalidated")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if got, errs := c.AuthenticateUser(e.Context, e.Logger, []*types.Session{{Id: session.GetId()}}, nil, nil); got != nil {
+			t.Error("authenticate with revoked session: unexpected success")
+		} else if len(errs) != 1 {
+			t.Errorf("authenticate with revoked session: unexpected errors %v", errs)
+		}
+	})
+}
@@ -0,0 +1,696 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jrockway/jsso2/pkg/jtesting"
+	"github.com/jrockway/jsso2/pkg/sessions"
+	"github.com/jrockway/jsso2/pkg/types"
+	"go.uber.org/zap/zaptest"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/testing/protocmp"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestMemoryConformance(t *testing.T) {
+	ctx, c := context.WithTimeout(context.Background(), 10*time.Second)
+	defer c()
+	testConformance(ctx, t, NewMemory())
+}
+
+func TestRoundTime(t *testing.T) {
+	// A session created at this time must be valid immediately, so its creation time must not be
+	// rounded up to the next millisecond.
+	ts := time.Date(2020, 1, 1, 0, 0, 0, 999999999, time.UTC)
+	if got, want := roundTime(timestamppb.New(ts)).AsTime(), time.Date(2020, 1, 1, 0, 0, 0, 999000000, time.UTC); !got.Equal(want) {
+		t.Errorf("round time:\n  got: %v\n want: %v", got, want)
+	}
+}
+
+func TestPostgresConformance(t *testing.T) {
+	jtesting.Run(t, "conformance", jtesting.R{Logger: true, Database: true}, func(t *testing.T, e *jtesting.E) {
+		db := MustGetTestDB(t, e)
+		go db.ListenForAuditEvents(e.Context, e.Logger.Named("audit_listener"))
+		testConformance(e.Context, t, db)
+	})
+}
+
+// testConformance checks that a Store behaves like the Postgres implementation.  The store must be
+// empty.
+func testConformance(ctx context.Context, t *testing.T, s Store) {
+	t.Helper()
+	l := zaptest.NewLogger(t)
+	doTx := func(t *testing.T, readOnly bool, f func(tx Tx) error) error {
+		t.Helper()
+		return s.DoTx(ctx, l, readOnly, f)
+	}
+	now := time.Now().Round(time.Millisecond)
+
+	user := &types.User{Username: "Test"}
+	t.Run("users", func(t *testing.T) {
+		if err := doTx(t, false, func(tx Tx) error { return tx.UpdateUser(ctx, user) }); err != nil {
+			t.Fatalf("create user: %v", err)
+		}
+		if user.GetId() == 0 {
+			t.Error("user id not updated in place")
+		}
+
+		err := doTx(t, false, func(tx Tx) error { return tx.UpdateUser(ctx, &types.User{Username: "test"}) })
+		if got, want := status.Code(AsGRPCError(err)), codes.AlreadyExists; got != want {
+			t.Errorf("create duplicate user: code:\n  got: %v\n want: %v\n  err: %v", got, want, err)
+		}
+
+		err = doTx(t, false, func(tx Tx) error { return tx.UpdateUser(ctx, &types.User{Id: 999, Username: "nobody"}) })
+		if got, want := err, ErrNothingToUpdate; !errors.Is(got, want) {
+			t.Errorf("update nonexistent user:\n  got: %v\n want: %v", got, want)
+		}
+
+		got := &types.User{Username: "TEST"}
+		if err := doTx(t, true, func(tx Tx) error { return tx.LookupUser(ctx, got) }); err != nil {
+			t.Fatalf("lookup user by username: %v", err)
+		}
+		if got, want := got.GetId(), user.GetId(); got != want {
+			t.Errorf("lookup user by username: id:\n  got: %v\n want: %v", got, want)
+		}
+		got = &types.User{Id: user.GetId()}
+		if err := doTx(t, true, func(tx Tx) error { return tx.LookupUser(ctx, got) }); err != nil {
+			t.Fatalf("lookup user by id: %v", err)
+		}
+		if got, want := got.GetUsername(), "Test"; got != want {
+			t.Errorf("lookup user by id: username:\n  got: %v\n want: %v", got, want)
+		}
+
+		err = doTx(t, true, func(tx Tx) error { return tx.LookupUser(ctx, &types.User{Username: "nobody"}) })
+		if got, want := err, sql.ErrNoRows; !errors.Is(got, want) {
+			t.Errorf("lookup nonexistent user:\n  got: %v\n want: %v", got, want)
+		}
+
+		err = doTx(t, true, func(tx Tx) error { return tx.UpdateUser(ctx, &types.User{Username: "read only"}) })
+		if err == nil {
+			t.Error("write in read-only transaction: expected error")
+		}
+	})
+
+	t.Run("rollback", func(t *testing.T) {
+		err := doTx(t, false, func(tx Tx) error {
+			if err := tx.UpdateUser(ctx, &types.User{Username: "rolled back"}); err != nil {
+				return err
+			}
+			return errors.New("roll back")
+		})
+		if err == nil {
+			t.Fatal("expected error")
+		}
+		err = doTx(t, true, func(tx Tx) error { return tx.LookupUser(ctx, &types.User{Username: "rolled back"}) })
+		if got, want := err, sql.ErrNoRows; !errors.Is(got, want) {
+			t.Errorf("lookup rolled-back user:\n  got: %v\n want: %v", got, want)
+		}
+	})
+
+	id, err := sessions.GenerateID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	session := &types.Session{
+		Id:        id,
+		User:      &types.User{Id: user.GetId()},
+		Taints:    []string{"z", "a"},
+		CreatedAt: timestamppb.New(now.Add(-time.Minute)),
+		ExpiresAt: timestamppb.New(now.Add(time.Hour)),
+	}
+	t.Run("sessions", func(t *testing.T) {
+		if err := doTx(t, false, func(tx Tx) error { return tx.UpdateSession(ctx, session) }); err != nil {
+			t.Fatalf("create session: %v", err)
+		}
+		var got *types.Session
+		if err := doTx(t, true, func(tx Tx) (err error) {
+			got, err = tx.LookupSession(ctx, id)
+			return
+		}); err != nil {
+			t.Fatalf("lookup session: %v", err)
+		}
+		want := &types.Session{
+			Id:        id,
+			User:      &types.User{Id: user.GetId(), Username: "Test"},
+			Metadata:  &types.SessionMetadata{},
+			Taints:    []string{"a", "z"},
+			CreatedAt: session.GetCreatedAt(),
+			ExpiresAt: session.GetExpiresAt(),
+		}
+		if diff := cmp.Diff(got, want, protocmp.Transform()); diff != "" {
+			t.Errorf("lookup session:\n%s", diff)
+		}
+
+		// Updates only change metadata, taints, and expiry.
+		update := &types.Session{
+			Id:        id,
+			User:      &types.User{Id: user.GetId()},
+			Metadata:  &types.SessionMetadata{IpAddress: "127.0.0.1"},
+			CreatedAt: timestamppb.New(now),
+			ExpiresAt: timestamppb.New(now.Add(2 * time.Hour)),
+		}
+		if err := doTx(t, false, func(tx Tx) error { return tx.UpdateSession(ctx, update) }); err != nil {
+			t.Fatalf("update session: %v", err)
+		}
+		if err := doTx(t, true, func(tx Tx) (err error) {
+			got, err = tx.LookupSession(ctx, id)
+			return
+		}); err != nil {
+			t.Fatalf("lookup session: %v", err)
+		}
+		want.Metadata = update.GetMetadata()
+		want.Taints = nil
+		want.ExpiresAt = update.GetExpiresAt()
+		if diff := cmp.Diff(got, want, protocmp.Transform()); diff != "" {
+			t.Errorf("lookup updated session:\n%s", diff)
+		}
+
+		err := doTx(t, true, func(tx Tx) error {
+			_, err := tx.LookupSession(ctx, []byte("short"))
+			return err
+		})
+		if got, want := err, ErrSessionIDInvalid; !errors.Is(got, want) {
+			t.Errorf("lookup invalid session id:\n  got: %v\n want: %v", got, want)
+		}
+
+		orphanID, err := sessions.GenerateID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = doTx(t, false, func(tx Tx) error {
+			return tx.UpdateSession(ctx, &types.Session{Id: orphanID, User: &types.User{Id: 999}, CreatedAt: timestamppb.New(now), ExpiresAt: timestamppb.New(now)})
+		})
+		if err == nil {
+			t.Error("create session for nonexistent user: expected error")
+		}
+	})
+
+	t.Run("credentials", func(t *testing.T) {
+		cred := &types.Credential{
+			User:               &types.User{Id: user.GetId()},
+			CreatedBySessionId: id,
+			CreatedAt:          timestamppb.New(now),
+			CredentialId:       []byte("AAAAAAAAAAAAAAAA"),
+			PublicKey:          []byte("public key of some sort"),
+			Aaguid:             []byte("aaguid"),
+			SignCount:          42,
+			Name:               "key",
+		}
+		if err := doTx(t, false, func(tx Tx) error { return tx.AddCredential(ctx, cred) }); err != nil {
+			t.Fatalf("add credential: %v", err)
+		}
+		if cred.GetId() == 0 {
+			t.Error("credential id not updated in place")
+		}
+
+		err := doTx(t, false, func(tx Tx) error {
+			return tx.AddCredential(ctx, &types.Credential{
+				User:               &types.User{Id: user.GetId()},
+				CreatedBySessionId: id,
+				CreatedAt:          timestamppb.New(now),
+				CredentialId:       []byte("short"),
+				PublicKey:          []byte("public key"),
+			})
+		})
+		if got, want := status.Code(AsGRPCError(err)), codes.FailedPrecondition; got != want {
+			t.Errorf("add credential with short id: code:\n  got: %v\n want: %v\n  err: %v", got, want, err)
+		}
+
+		var got []*types.Credential
+		if err := doTx(t, true, func(tx Tx) (err error) {
+			got, err = tx.GetUserCredentials(ctx, user)
+			return
+		}); err != nil {
+			t.Fatalf("get credentials: %v", err)
+		}
+		want := []*types.Credential{{
+			Id:           cred.GetId(),
+			User:         &types.User{Id: user.GetId(), Username: "Test"},
+			CreatedAt:    cred.GetCreatedAt(),
+			CredentialId: cred.GetCredentialId(),
+			PublicKey:    cred.GetPublicKey(),
+			Aaguid:       cred.GetAaguid(),
+			SignCount:    42,
+			Name:         "key",
+		}}
+		if diff := cmp.Diff(got, want, protocmp.Transform()); diff != "" {
+			t.Errorf("get credentials:\n%s", diff)
+		}
+
+		err = doTx(t, false, func(tx Tx) error {
+			return tx.CheckAndUpdateSignCount(ctx, &types.Credential{Id: cred.GetId(), SignCount: 42})
+		})
+		if got, want := err, ErrSignCountDecreased; !errors.Is(got, want) {
+			t.Errorf("reuse sign count:\n  got: %v\n want: %v", got, want)
+		}
+		if err := doTx(t, false, func(tx Tx) error {
+			return tx.CheckAndUpdateSignCount(ctx, &types.Credential{Id: cred.GetId(), SignCount: 43})
+		}); err != nil {
+			t.Errorf("increase sign count: %v", err)
+		}
+	})
+
+	t.Run("authenticate", func(t *testing.T) {
+		taintedID, err := sessions.GenerateID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := doTx(t, false, func(tx Tx) error {
+			return tx.UpdateSession(ctx, &types.Session{
+				Id:        taintedID,
+				User:      &types.User{Id: user.GetId()},
+				Taints:    []string{sessions.TaintStartLogin},
+				CreatedAt: timestamppb.New(now),
+				ExpiresAt: timestamppb.New(now.Add(time.Hour)),
+			})
+		}); err != nil {
+			t.Fatalf("create tainted session: %v", err)
+		}
+		got, errs := s.AuthenticateUser(ctx, l, []*types.Session{{Id: taintedID}, {Id: id}}, nil, nil)
+		if got == nil {
+			t.Fatalf("authenticate: %v", errs)
+		}
+		if got, want := got.GetId(), id; !cmp.Equal(got, want) {
+			t.Errorf("authenticate: preferred tainted session")
+		}
+		if got, want := got.GetUser().GetUsername(), "Test"; got != want {
+			t.Errorf("authenticate: username:\n  got: %v\n want: %v", got, want)
+		}
+
+		if err := doTx(t, false, func(tx Tx) error { return tx.RevokeSession(ctx, id, "test") }); err != nil {
+			t.Fatalf("revoke session: %v", err)
+		}
+		// The expiration time is rounded to the nearest millisecond, so it might be slightly
+		// in the future.
+		time.Sleep(time.Millisecond)
+		missing, err := sessions.GenerateID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, errs = s.AuthenticateUser(ctx, l, []*types.Session{{Id: id}, {Id: missing}}, nil, nil)
+		if got != nil {
+			t.Fatalf("authenticate with revoked session: unexpectedly got session %v", got)
+		}
+		if len(errs) != 2 {
+			t.Fatalf("authenticate with revoked session: expected 2 errors, got %v", errs)
+		}
+		// AuthenticateUser doesn't wrap errors, so compare messages instead.
+		if got, want := errs[0].Error(), "validate session 1/2: "+ErrSessionExpired.Error(); got != want {
+			t.Errorf("revoked session:\n  got: %v\n want: %v", got, want)
+		}
+		if got, want := errs[1].Error(), "validate session 2/2: read session: "+sql.ErrNoRows.Error(); got != want {
+			t.Errorf("missing session:\n  got: %v\n want: %v", got, want)
+		}
+	})
+
+	t.Run("audit", func(t *testing.T) {
+		events := []*types.AuditEvent{
+			{
+				CreatedAt: timestamppb.New(now.Add(-time.Hour)),
+				Action:    "user.edit",
+				Actor:     &types.User{Id: sessions.RootUser, Username: sessions.RootUsername},
+				Target:    &types.User{Id: user.GetId(), Username: "Test"},
+				IpAddress: "192.0.2.1",
+				Result:    types.AuditEvent_SUCCESS,
+			},
+			{
+				CreatedAt:      timestamppb.New(now),
+				Action:         "login.finish",
+				Actor:          &types.User{Id: user.GetId(), Username: "Test"},
+				ActorSessionId: id,
+				Target:         &types.User{Id: user.GetId(), Username: "Test"},
+				UserAgent:      "test",
+				Result:         types.AuditEvent_FAILURE,
+				Error:          "bad signature",
+				Details:        map[string]string{"credential_id": "1"},
+			},
+			{
+				CreatedAt: timestamppb.New(now),
+				Action:    "login.finish",
+				Actor:     &types.User{Id: user.GetId(), Username: "Test"},
+				Result:    types.AuditEvent_SUCCESS,
+			},
+		}
+		for i, e := range events {
+			if err := doTx(t, false, func(tx Tx) error { return tx.AddAuditEvent(ctx, e) }); err != nil {
+				t.Fatalf("add event %d: %v", i, err)
+			}
+			if e.GetId() == 0 {
+				t.Errorf("add event %d: id not updated in place", i)
+			}
+		}
+
+		err := doTx(t, false, func(tx Tx) error {
+			return tx.AddAuditEvent(ctx, &types.AuditEvent{CreatedAt: timestamppb.New(now), Action: "test"})
+		})
+		if !IsErrEmpty(err) {
+			t.Errorf("add event without result: expected ErrEmpty, got %v", err)
+		}
+		err = doTx(t, true, func(tx Tx) error {
+			return tx.AddAuditEvent(ctx, &types.AuditEvent{CreatedAt: timestamppb.New(now), Action: "test", Result: types.AuditEvent_SUCCESS})
+		})
+		if err == nil {
+			t.Error("add event in read-only transaction: expected error")
+		}
+
+		var prev []byte
+		for i, e := range events {
+			if got, want := e.GetPrevHash(), prev; !bytes.Equal(got, want) {
+				t.Errorf("event %d: prev hash:\n  got: %x\n want: %x", i, got, want)
+			}
+			if got, want := e.GetHash(), AuditEventHash(prev, e); !bytes.Equal(got, want) {
+				t.Errorf("event %d: hash:\n  got: %x\n want: %x", i, got, want)
+			}
+			prev = e.GetHash()
+		}
+
+		checkpoint := &types.AuditCheckpoint{
+			CreatedAt:    timestamppb.New(now),
+			AuditEventId: events[2].GetId(),
+			Hash:         events[2].GetHash(),
+			Signature:    []byte("signature"),
+		}
+		if err := doTx(t, false, func(tx Tx) error { return tx.AddAuditCheckpoint(ctx, checkpoint) }); err != nil {
+			t.Fatalf("add checkpoint: %v", err)
+		}
+		if checkpoint.GetId() == 0 {
+			t.Error("add checkpoint: id not updated in place")
+		}
+		err = doTx(t, false, func(tx Tx) error {
+			return tx.AddAuditCheckpoint(ctx, &types.AuditCheckpoint{CreatedAt: timestamppb.New(now), AuditEventId: events[2].GetId()})
+		})
+		if !IsErrEmpty(err) {
+			t.Errorf("add checkpoint without hash: expected ErrEmpty, got %v", err)
+		}
+		var checkpoints []*types.AuditCheckpoint
+		if err := doTx(t, true, func(tx Tx) (err error) {
+			checkpoints, err = tx.GetAuditCheckpoints(ctx)
+			return
+		}); err != nil {
+			t.Fatalf("get checkpoints: %v", err)
+		}
+		if diff := cmp.Diff(checkpoints, []*types.AuditCheckpoint{checkpoint}, protocmp.Transform()); diff != "" {
+			t.Errorf("checkpoints (-got +want):\n%s", diff)
+		}
+
+		testData := []struct {
+			name   string
+			filter *AuditFilter
+			want   []*types.AuditEvent
+		}{
+			{
+				name:   "all",
+				filter: &AuditFilter{},
+				want:   []*types.AuditEvent{events[2], events[1], events[0]},
+			},
+			{
+				name:   "action",
+				filter: &AuditFilter{Action: "login.finish"},
+				want:   []*types.AuditEvent{events[2], events[1]},
+			},
+			{
+				name:   "actor by id",
+				filter: &AuditFilter{Actor: &types.User{Id: sessions.RootUser}},
+				want:   []*types.AuditEvent{events[0]},
+			},
+			{
+				name:   "actor by username",
+				filter: &AuditFilter{Actor: &types.User{Username: "test"}},
+				want:   []*types.AuditEvent{events[2], events[1]},
+			},
+			{
+				name:   "target",
+				filter: &AuditFilter{Target: &types.User{Id: user.GetId()}},
+				want:   []*types.AuditEvent{events[1], events[0]},
+			},
+			{
+				name:   "time range",
+				filter: &AuditFilter{Since: now.Add(-2 * time.Hour), Until: now},
+				want:   []*types.AuditEvent{events[0]},
+			},
+			{
+				name:   "result",
+				filter: &AuditFilter{Result: types.AuditEvent_FAILURE},
+				want:   []*types.AuditEvent{events[1]},
+			},
+			{
+				name:   "ip address",
+				filter: &AuditFilter{IPAddress: "192.0.2.1"},
+				want:   []*types.AuditEvent{events[0]},
+			},
+			{
+				name:   "page",
+				filter: &AuditFilter{BeforeID: events[2].GetId(), Limit: 1},
+				want:   []*types.AuditEvent{events[1]},
+			},
+			{
+				name:   "oldest first",
+				filter: &AuditFilter{AfterID: events[0].GetId(), OldestFirst: true},
+				want:   []*types.AuditEvent{events[1], events[2]},
+			},
+		}
+		for _, test := range testData {
+			t.Run(test.name, func(t *testing.T) {
+				var got []*types.AuditEvent
+				if err := doTx(t, true, func(tx Tx) (err error) {
+					got, err = tx.QueryAuditEvents(ctx, test.filter)
+					return
+				}); err != nil {
+					t.Fatalf("query: %v", err)
+				}
+				if diff := cmp.Diff(got, test.want, protocmp.Transform()); diff != "" {
+					t.Errorf("events (-got +want):\n%s", diff)
+				}
+			})
+		}
+	})
+
+	t.Run("audit notifications", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		ch := s.SubscribeAuditEvents(ctx)
+		e := &types.AuditEvent{CreatedAt: timestamppb.New(now), Action: "test", Result: types.AuditEvent_SUCCESS}
+		if err := doTx(t, false, func(tx Tx) error { return tx.AddAuditEvent(ctx, e) }); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			t.Fatal("no notification after adding an audit event")
+		}
+	})
+	t.Run("nonces", func(t *testing.T) {
+		redeem := func(nonce []byte, expiresAt time.Time) error {
+			return doTx(t, false, func(tx Tx) error { return tx.RedeemNonce(ctx, nonce, expiresAt) })
+		}
+		nonce := bytes.Repeat([]byte{'n'}, 16)
+		if err := redeem(nonce, now.Add(time.Minute)); err != nil {
+			t.Fatalf("redeem: %v", err)
+		}
+		if err := redeem(nonce, now.Add(time.Minute)); !errors.Is(err, ErrNonceReused) {
+			t.Errorf("redeem twice: expected ErrNonceReused, got %v", err)
+		}
+		// Expired nonces are forgotten.
+		expired := bytes.Repeat([]byte{'e'}, 16)
+		if err := redeem(expired, now.Add(-time.Minute)); err != nil {
+			t.Fatalf("redeem expired: %v", err)
+		}
+		if err := redeem(expired, now.Add(time.Minute)); err != nil {
+			t.Errorf("redeem after expiration: %v", err)
+		}
+		if err := redeem([]byte("short"), now.Add(time.Minute)); err == nil {
+			t.Error("redeem short nonce: expected error")
+		}
+		if err := doTx(t, true, func(tx Tx) error { return tx.RedeemNonce(ctx, nonce, now) }); err == nil {
+			t.Error("redeem in read-only transaction: expected error")
+		}
+	})
+	t.Run("webhooks", func(t *testing.T) {
+		if err := doTx(t, true, func(tx Tx) error {
+			_, err := tx.GetWebhookCursor(ctx)
+			return err
+		}); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("get unset cursor: expected sql.ErrNoRows, got %v", err)
+		}
+		for _, id := range []int64{42, 43} {
+			if err := doTx(t, false, func(tx Tx) error { return tx.SetWebhookCursor(ctx, id) }); err != nil {
+				t.Fatalf("set cursor to %d: %v", id, err)
+			}
+		}
+		var cursor int64
+		if err := doTx(t, true, func(tx Tx) (err error) {
+			cursor, err = tx.GetWebhookCursor(ctx)
+			return
+		}); err != nil {
+			t.Fatalf("get cursor: %v", err)
+		}
+		if got, want := cursor, int64(43); got != want {
+			t.Errorf("cursor:\n  got: %v\n want: %v", got, want)
+		}
+
+		webhook := &types.Webhook{
+			CreatedAt:   timestamppb.New(now),
+			Url:         "https://chat.example.com/hooks/1",
+			Description: "alerts",
+			EventTypes:  []types.Event_Type{types.Event_CREDENTIAL_ADDED, types.Event_LOGIN_FROM_NEW_IP},
+			Secret:      bytes.Repeat([]byte{'s'}, 32),
+		}
+		if err := doTx(t, false, func(tx Tx) error { return tx.AddWebhook(ctx, webhook) }); err != nil {
+			t.Fatalf("add webhook: %v", err)
+		}
+		if webhook.GetId() == 0 {
+			t.Error("webhook id not updated in place")
+		}
+		err := doTx(t, false, func(tx Tx) error {
+			return tx.AddWebhook(ctx, &types.Webhook{CreatedAt: timestamppb.New(now), Url: "https://example.com/", EventTypes: []types.Event_Type{types.Event_LOGIN}})
+		})
+		if !IsErrEmpty(err) {
+			t.Errorf("add webhook without secret: expected ErrEmpty, got %v", err)
+		}
+		var webhooks []*types.Webhook
+		if err := doTx(t, true, func(tx Tx) (err error) {
+			webhooks, err = tx.GetWebhooks(ctx)
+			return
+		}); err != nil {
+			t.Fatalf("get webhooks: %v", err)
+		}
+		if diff := cmp.Diff(webhooks, []*types.Webhook{webhook}, protocmp.Transform()); diff != "" {
+			t.Errorf("webhooks (-got +want):\n%s", diff)
+		}
+
+		deliveries := []*types.WebhookDelivery{
+			{
+				WebhookId:     webhook.GetId(),
+				AuditEventId:  1,
+				EventType:     types.Event_CREDENTIAL_ADDED,
+				State:         types.WebhookDelivery_PENDING,
+				CreatedAt:     timestamppb.New(now),
+				NextAttemptAt: timestamppb.New(now),
+			},
+			{
+				WebhookId:     webhook.GetId(),
+				AuditEventId:  2,
+				EventType:     types.Event_LOGIN_FROM_NEW_IP,
+				State:         types.WebhookDelivery_PENDING,
+				CreatedAt:     timestamppb.New(now),
+				NextAttemptAt: timestamppb.New(now.Add(time.Hour)),
+			},
+		}
+		if err := doTx(t, false, func(tx Tx) error {
+			for i, d := range deliveries {
+				if err := tx.AddWebhookDelivery(ctx, d); err != nil {
+					return fmt.Errorf("add delivery %d: %w", i, err)
+				}
+			}
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		err = doTx(t, false, func(tx Tx) error {
+			d := proto.Clone(deliveries[0]).(*types.WebhookDelivery)
+			d.WebhookId = webhook.GetId() + 1
+			return tx.AddWebhookDelivery(ctx, d)
+		})
+		if got, want := status.Code(AsGRPCError(err)), codes.FailedPrecondition; got != want {
+			t.Errorf("add delivery for missing webhook: code:\n  got: %v\n want: %v\n  err: %v", got, want, err)
+		}
+
+		deliveries[0].State = types.WebhookDelivery_DEAD
+		deliveries[0].Attempts = 3
+		deliveries[0].LastAttemptAt = timestamppb.New(now)
+		deliveries[0].LastError = "500 Internal Server Error"
+		if err := doTx(t, false, func(tx Tx) error { return tx.UpdateWebhookDelivery(ctx, deliveries[0]) }); err != nil {
+			t.Fatalf("update delivery: %v", err)
+		}
+		err = doTx(t, false, func(tx Tx) error {
+			d := proto.Clone(deliveries[0]).(*types.WebhookDelivery)
+			d.Id = deliveries[1].GetId() + 1
+			return tx.UpdateWebhookDelivery(ctx, d)
+		})
+		if !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("update missing delivery: expected sql.ErrNoRows, got %v", err)
+		}
+
+		testData := []struct {
+			name   string
+			filter *WebhookDeliveryFilter
+			want   []*types.WebhookDelivery
+		}{
+			{
+				name:   "all",
+				filter: &WebhookDeliveryFilter{},
+				want:   []*types.WebhookDelivery{deliveries[1], deliveries[0]},
+			},
+			{
+				name:   "by id",
+				filter: &WebhookDeliveryFilter{ID: deliveries[0].GetId()},
+				want:   []*types.WebhookDelivery{deliveries[0]},
+			},
+			{
+				name:   "by webhook",
+				filter: &WebhookDeliveryFilter{WebhookID: webhook.GetId() + 1},
+				want:   nil,
+			},
+			{
+				name:   "state",
+				filter: &WebhookDeliveryFilter{State: types.WebhookDelivery_DEAD},
+				want:   []*types.WebhookDelivery{deliveries[0]},
+			},
+			{
+				name:   "due",
+				filter: &WebhookDeliveryFilter{DueBefore: now.Add(time.Minute)},
+				want:   []*types.WebhookDelivery{deliveries[0]},
+			},
+			{
+				name:   "page",
+				filter: &WebhookDeliveryFilter{BeforeID: deliveries[1].GetId(), Limit: 1},
+				want:   []*types.WebhookDelivery{deliveries[0]},
+			},
+			{
+				name:   "oldest first",
+				filter: &WebhookDeliveryFilter{OldestFirst: true, Limit: 1},
+				want:   []*types.WebhookDelivery{deliveries[0]},
+			},
+		}
+		for _, test := range testData {
+			t.Run(test.name, func(t *testing.T) {
+				var got []*types.WebhookDelivery
+				if err := doTx(t, true, func(tx Tx) (err error) {
+					got, err = tx.QueryWebhookDeliveries(ctx, test.filter)
+					return
+				}); err != nil {
+					t.Fatalf("query: %v", err)
+				}
+				if diff := cmp.Diff(got, test.want, protocmp.Transform()); diff != "" {
+					t.Errorf("deliveries (-got +want):\n%s", diff)
+				}
+			})
+		}
+
+		if err := doTx(t, false, func(tx Tx) error { return tx.DeleteWebhook(ctx, webhook.GetId()) }); err != nil {
+			t.Fatalf("delete webhook: %v", err)
+		}
+		if err := doTx(t, false, func(tx Tx) error { return tx.DeleteWebhook(ctx, webhook.GetId()) }); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("delete webhook again: expected sql.ErrNoRows, got %v", err)
+		}
+		var remaining []*types.WebhookDelivery
+		if err := doTx(t, true, func(tx Tx) (err error) {
+			remaining, err = tx.QueryWebhookDeliveries(ctx, &WebhookDeliveryFilter{})
+			return
+		}); err != nil {
+			t.Fatalf("query deliveries after delete: %v", err)
+		}
+		if len(remaining) > 0 {
+			t.Errorf("deliveries remain after deleting their webhook: %v", remaining)
+		}
+	})
+}
@@ -50,26 +50,8 @@ func (raw *rawCredential) toCredential() *types.Credential {
 // AddCredential adds a credential to the database.  The credential object must refer to a valid
 // user and session.
 func AddCredential(ctx context.Context, db sqlx.ExtContext, c *types.Credential) error {
-	if c == nil {
-		return &ErrEmpty{Field: "credential"}
-	}
-	if len(c.GetCredentialId()) == 0 {
-		return &ErrEmpty{Field: "credential.credential_id"}
-	}
-	if len(c.GetPublicKey()) == 0 {
-		return &ErrEmpty{Field: "credential.public_key"}
-	}
-	if c.GetUser() == nil {
-		return &ErrEmpty{Field: "credential.user"}
-	}
-	if c.GetUser().GetId() < 1 {
-		return &ErrEmpty{Field: "credential.user.id"}
-	}
-	if sessions.IsZero(c.GetCreatedBySessionId()) {
-		return &ErrEmpty{Field: "credential.created_by_session_id"}
-	}
-	if c.GetId() != 0 {
-		return fmt.Errorf("editing an existing credential is not supported: %w", ErrUnimplemented)
+	if err := checkAddCredential(c); err != nil {
+		return err
 	}
 	obj := &rawCredential{
 		CredentialID:       c.GetCredentialId(),
@@ -95,6 +77,33 @@ func AddCredential(ctx context.Context, db sqlx.ExtContext, c *types.Credential)
 	return nil
 }
 
+// checkAddCredential returns an error if a credential passed to AddCredential is missing required
+// fields.
+func checkAddCredential(c *types.Credential) error {
+	if c == nil {
+		return &ErrEmpty{Field: "credential"}
+	}
+	if len(c.GetCredentialId()) == 0 {
+		return &ErrEmpty{Field: "credential.credential_id"}
+	}
+	if len(c.GetPublicKey()) == 0 {
+		return &ErrEmpty{Field: "credential.public_key"}
+	}
+	if c.GetUser() == nil {
+		return &ErrEmpty{Field: "credential.user"}
+	}
+	if c.GetUser().GetId() < 1 {
+		return &ErrEmpty{Field: "credential.user.id"}
+	}
+	if sessions.IsZero(c.GetCreatedBySessionId()) {
+		return &ErrEmpty{Field: "credential.created_by_session_id"}
+	}
+	if c.GetId() != 0 {
+		return fmt.Errorf("editing an existing credential is not supported: %w", ErrUnimplemented)
+	}
+	return nil
+}
+
 // GetUserCredentials returns a list of all currently-valid credentials associated with the provided
 // user.
 func GetUserCredentials(ctx context.Context, db sqlx.ExtContext, u *types.User) ([]*types.Credential, error) {
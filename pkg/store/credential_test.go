@@ -158,30 +158,30 @@ func TestSignCount(t *testing.T) {
 		}
 
 		cred.SignCount = 1
-		if err := c.DoTx(e.Context, e.Logger, false, func(tx *sqlx.Tx) error {
+		if err := c.doTx(e.Context, e.Logger, false, func(tx *sqlx.Tx) error {
 			return CheckAndUpdateSignCount(e.Context, tx, cred)
 		}); err != nil {
 			t.Error(err)
 		}
-		if err := c.DoTx(e.Context, e.Logger, false, func(tx *sqlx.Tx) error {
+		if err := c.doTx(e.Context, e.Logger, false, func(tx *sqlx.Tx) error {
 			return CheckAndUpdateSignCount(e.Context, tx, cred)
 		}); err == nil {
 			t.Error("expected sign count validation error")
 		}
 		cred.SignCount = 99
-		if err := c.DoTx(e.Context, e.Logger, false, func(tx *sqlx.Tx) error {
+		if err := c.doTx(e.Context, e.Logger, false, func(tx *sqlx.Tx) error {
 			return CheckAndUpdateSignCount(e.Context, tx, cred)
 		}); err != nil {
 			t.Error(err)
 		}
 		cred.SignCount = 2
-		if err := c.DoTx(e.Context, e.Logger, false, func(tx *sqlx.Tx) error {
+		if err := c.doTx(e.Context, e.Logger, false, func(tx *sqlx.Tx) error {
 			return CheckAndUpdateSignCount(e.Context, tx, cred)
 		}); err == nil {
 			t.Error("expected sign count validation error")
 		}
 		cred.SignCount = 100
-		if err := c.DoTx(e.Context, e.Logger, false, func(tx *sqlx.Tx) error {
+		if err := c.doTx(e.Context, e.Logger, false, func(tx *sqlx.Tx) error {
 			return CheckAndUpdateSignCount(e.Context, tx, cred)
 		}); err != nil {
 			t.Error(err)
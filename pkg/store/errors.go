@@ -4,10 +4,13 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
-	"strings"
 
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgerrcode"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
 )
 
 var (
@@ -31,6 +34,79 @@ func IsErrEmpty(err error) bool {
 	return errors.As(err, &target)
 }
 
+// ErrConstraint is returned by the in-memory store when a write would violate a constraint that
+// the database schema enforces.
+type ErrConstraint struct {
+	Constraint string
+	Unique     bool
+}
+
+func (e *ErrConstraint) Error() string {
+	if e.Unique {
+		return fmt.Sprintf("duplicate key value violates unique constraint %q", e.Constraint)
+	}
+	return fmt.Sprintf("write violates constraint %q", e.Constraint)
+}
+
+// pgError returns the Postgres error wrapped by err, or nil if err did not come from the server.
+func pgError(err error) *pgconn.PgError {
+	target := &pgconn.PgError{}
+	if errors.As(err, &target) {
+		return target
+	}
+	return nil
+}
+
+// sqlStateClass returns the two-character class of a SQLSTATE code.
+func sqlStateClass(code string) string {
+	if len(code) < 2 {
+		return ""
+	}
+	return code[:2]
+}
+
+// isRetryablePgError returns true if a transaction that failed with the provided Postgres error
+// might succeed if run again.
+func isRetryablePgError(err *pgconn.PgError) bool {
+	switch err.Code {
+	case pgerrcode.SerializationFailure, pgerrcode.DeadlockDetected:
+		return true
+	case pgerrcode.QueryCanceled:
+		// statement_timeout or an explicit cancellation; running the query again won't
+		// make it any faster.
+		return false
+	}
+	switch sqlStateClass(err.Code) {
+	case "08": // Connection exception.
+		return true
+	case "57": // Operator intervention; "terminating connection due to administrator command", etc.
+		return true
+	}
+	return false
+}
+
+// sqliteCode returns the extended result code of the SQLite error wrapped by err, and false if err
+// did not come from SQLite.
+func sqliteCode(err error) (int, bool) {
+	target := &sqlite.Error{}
+	if errors.As(err, &target) {
+		return target.Code(), true
+	}
+	return 0, false
+}
+
+// isRetryableSQLiteCode returns true if a transaction that failed with the provided SQLite result
+// code might succeed if run again.
+func isRetryableSQLiteCode(code int) bool {
+	// The primary result code is the low byte of the extended result code.
+	switch code & 0xff {
+	case sqlite3.SQLITE_BUSY, sqlite3.SQLITE_LOCKED:
+		// Another connection held a lock for longer than busy_timeout.
+		return true
+	}
+	return false
+}
+
 // AsGRPCError converts a store error to one with a gRPC status code.  Is is valid to call with a
 // nil error.
 func AsGRPCError(err error) error {
@@ -50,10 +126,28 @@ func AsGRPCError(err error) error {
 		// From codes: "Use Unavailable if the client can retry just the failing call."
 		return status.Error(codes.Unavailable, err.Error())
 	}
-	// SQLSTATE 23XXX is a referential integrity violation; duplicate unique index, null where
-	// the schema dictates non-null, etc.
-	if strings.Contains(err.Error(), "(SQLSTATE 23") {
+	if code, ok := sqliteCode(err); ok && code&0xff == sqlite3.SQLITE_CONSTRAINT {
+		switch code {
+		case sqlite3.SQLITE_CONSTRAINT_UNIQUE, sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY:
+			return status.Error(codes.AlreadyExists, err.Error())
+		}
 		return status.Error(codes.FailedPrecondition, err.Error())
 	}
+	if cErr := (&ErrConstraint{}); errors.As(err, &cErr) {
+		if cErr.Unique {
+			return status.Error(codes.AlreadyExists, err.Error())
+		}
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+	if pgErr := pgError(err); pgErr != nil {
+		if pgErr.Code == pgerrcode.UniqueViolation {
+			return status.Error(codes.AlreadyExists, fmt.Sprintf("unique constraint %q violated: %v", pgErr.ConstraintName, err))
+		}
+		// SQLSTATE 23XXX is an integrity constraint violation; null where the schema
+		// dictates non-null, a foreign key pointing nowhere, etc.
+		if sqlStateClass(pgErr.Code) == "23" {
+			return status.Error(codes.FailedPrecondition, err.Error())
+		}
+	}
 	return status.Error(codes.Unknown, err.Error())
 }
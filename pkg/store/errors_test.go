@@ -0,0 +1,68 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgconn"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestAsGRPCError(t *testing.T) {
+	testData := []struct {
+		name     string
+		err      error
+		wantCode codes.Code
+		wantMsg  string
+	}{
+		{"nil", nil, codes.OK, ""},
+		{"no rows", fmt.Errorf("select: %w", sql.ErrNoRows), codes.NotFound, ""},
+		{"empty field", &ErrEmpty{Field: "user"}, codes.FailedPrecondition, ""},
+		{
+			name:     "serialization failure",
+			err:      fmt.Errorf("insert: %w", &pgconn.PgError{Code: "40001"}),
+			wantCode: codes.Unavailable,
+		},
+		{
+			name:     "unique violation",
+			err:      fmt.Errorf("insert: %w", &pgconn.PgError{Code: "23505", ConstraintName: "user_username_key"}),
+			wantCode: codes.AlreadyExists,
+			wantMsg:  `"user_username_key"`,
+		},
+		{
+			name:     "not null violation",
+			err:      fmt.Errorf("insert: %w", &pgconn.PgError{Code: "23502"}),
+			wantCode: codes.FailedPrecondition,
+		},
+		{
+			name:     "syntax error",
+			err:      fmt.Errorf("select: %w", &pgconn.PgError{Code: "42601"}),
+			wantCode: codes.Unknown,
+		},
+		{
+			// Errors that merely mention a SQLSTATE aren't classified by it.
+			name:     "string that looks like a pg error",
+			err:      errors.New("something (SQLSTATE 23505)"),
+			wantCode: codes.Unknown,
+		},
+	}
+	for _, test := range testData {
+		t.Run(test.name, func(t *testing.T) {
+			err := AsGRPCError(test.err)
+			s, ok := status.FromError(err)
+			if !ok {
+				t.Fatalf("not a status error: %v", err)
+			}
+			if got, want := s.Code(), test.wantCode; got != want {
+				t.Errorf("code:\n  got: %v\n want: %v", got, want)
+			}
+			if !strings.Contains(s.Message(), test.wantMsg) {
+				t.Errorf("message %q does not contain %q", s.Message(), test.wantMsg)
+			}
+		})
+	}
+}
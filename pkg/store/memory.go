@@ -0,0 +1,726 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jrockway/jsso2/pkg/sessions"
+	"github.com/jrockway/jsso2/pkg/types"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// errReadOnly is returned when a read-only transaction against a Memory store attempts a write.
+var errReadOnly = errors.New("cannot write in a read-only transaction")
+
+// Memory is a Store that keeps everything in memory.  It is intended for tests and local demos;
+// nothing survives a restart.  Transactions are serialized, and a transaction that returns an
+// error leaves the store unchanged.
+type Memory struct {
+	sync.RWMutex
+	Retry RetryConfig // How to retry failed transactions; NewMemory sets DefaultRetryConfig.
+
+	state       *memoryState
+	auditEvents broadcaster
+}
+
+type memoryUser struct {
+	id       int64
+	username string
+}
+
+type memoryCredential struct {
+	credential *types.Credential // User contains only the user ID.
+	deleted    bool
+}
+
+type memoryState struct {
+	nextUserID       int64
+	nextCredentialID int64
+	users            map[int64]*memoryUser
+	sessions         map[string]*types.Session // User contains only the user ID.
+	credentials      map[int64]*memoryCredential
+	auditEvents      []*types.AuditEvent      // In ID order; never modified once appended.
+	auditCheckpoints []*types.AuditCheckpoint // In ID order; never modified once appended.
+
+	nextWebhookID         int64
+	nextWebhookDeliveryID int64
+	webhooks              map[int64]*types.Webhook
+	webhookDeliveries     []*types.WebhookDelivery // In ID order; elements are replaced, never modified.
+	webhookCursor         *int64                   // Nil until SetWebhookCursor is called.
+
+	usedNonces map[string]time.Time // Nonce to expiration time.
+}
+
+// NewMemory returns an empty in-memory Store.
+func NewMemory() *Memory {
+	return &Memory{
+		Retry: DefaultRetryConfig,
+		state: &memoryState{
+			nextUserID:       1,
+			nextCredentialID: 1,
+			users:            make(map[int64]*memoryUser),
+			sessions:         make(map[string]*types.Session),
+			credentials:      make(map[int64]*memoryCredential),
+
+			nextWebhookID:         1,
+			nextWebhookDeliveryID: 1,
+			webhooks:              make(map[int64]*types.Webhook),
+
+			usedNonces: make(map[string]time.Time),
+		},
+	}
+}
+
+// clone returns a copy of the state for a read-write transaction to modify.  The append-only audit
+// log and the webhook deliveries, which grow without bound, are shared with the original rather
+// than copied.  That's safe because nothing modifies their elements, and appending to a shared
+// slice only writes past the end of the original's length, where the original never looks.
+func (s *memoryState) clone() *memoryState {
+	result := &memoryState{
+		nextUserID:       s.nextUserID,
+		nextCredentialID: s.nextCredentialID,
+		users:            make(map[int64]*memoryUser, len(s.users)),
+		sessions:         make(map[string]*types.Session, len(s.sessions)),
+		credentials:      make(map[int64]*memoryCredential, len(s.credentials)),
+		auditEvents:      s.auditEvents,
+		auditCheckpoints: s.auditCheckpoints,
+
+		nextWebhookID:         s.nextWebhookID,
+		nextWebhookDeliveryID: s.nextWebhookDeliveryID,
+		webhooks:              make(map[int64]*types.Webhook, len(s.webhooks)),
+		webhookDeliveries:     s.webhookDeliveries,
+		webhookCursor:         s.webhookCursor,
+
+		usedNonces: make(map[string]time.Time, len(s.usedNonces)),
+	}
+	for n, exp := range s.usedNonces {
+		result.usedNonces[n] = exp
+	}
+	for id, w := range s.webhooks {
+		result.webhooks[id] = proto.Clone(w).(*types.Webhook)
+	}
+	for id, u := range s.users {
+		result.users[id] = &memoryUser{id: u.id, username: u.username}
+	}
+	for id, session := range s.sessions {
+		result.sessions[id] = proto.Clone(session).(*types.Session)
+	}
+	for id, c := range s.credentials {
+		result.credentials[id] = &memoryCredential{
+			credential: proto.Clone(c.credential).(*types.Credential),
+			deleted:    c.deleted,
+		}
+	}
+	return result
+}
+
+// DoTx implements Store.  Read-write transactions operate on a copy of the data, which replaces the
+// original when f returns nil.  Transactions that fail with a retryable error are retried as
+// m.Retry says, just like they are against a real database.
+func (m *Memory) DoTx(ctx context.Context, l *zap.Logger, readOnly bool, f func(tx Tx) error) error {
+	attempts := m.Retry.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	var errs []error
+	for i := 0; i < attempts; i++ {
+		if i != 0 {
+			delay := m.Retry.backoff(i)
+			if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+				l.Debug("DoTx: not retrying transaction; the delay would exceed the context deadline", zap.Int("attempt", i), zap.Duration("delay", delay), zap.Time("deadline", deadline))
+				break
+			}
+			t := time.NewTimer(delay)
+			select {
+			case <-ctx.Done():
+				t.Stop()
+			case <-t.C:
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			if len(errs) > 0 {
+				break
+			}
+			return fmt.Errorf("attempt %d: begin tx: non-retryable error: %w", i, err)
+		}
+		err := m.doTx(readOnly, f)
+		if err == nil {
+			if len(errs) > 0 {
+				l.Debug("DoTx: early return hides some errors", zap.Errors("errors", errs))
+			}
+			return nil
+		}
+		if !isRetryable(err) {
+			return fmt.Errorf("attempt %d: user function: non-retryable error: %w", i, err)
+		}
+		errs = append(errs, fmt.Errorf("attempt %d: user function: %w", i, err))
+	}
+	err := errs[len(errs)-1]
+	if len(errs) > 1 {
+		l.Debug("DoTx: returned error hides earlier attempts", zap.Errors("errors", errs[:len(errs)-1]))
+	}
+	return fmt.Errorf("transaction failed after %d attempts: %w", len(errs), err)
+}
+
+func (m *Memory) doTx(readOnly bool, f func(tx Tx) error) error {
+	if readOnly {
+		m.RLock()
+		defer m.RUnlock()
+		return f(&memoryTx{state: m.state, readOnly: true})
+	}
+	m.Lock()
+	defer m.Unlock()
+	state := m.state.clone()
+	if err := f(&memoryTx{state: state}); err != nil {
+		return err
+	}
+	if len(state.auditEvents) > len(m.state.auditEvents) {
+		defer m.auditEvents.broadcast()
+	}
+	m.state = state
+	return nil
+}
+
+// AuthenticateUser implements Store.
+func (m *Memory) AuthenticateUser(ctx context.Context, l *zap.Logger, ss []*types.Session, unusedHeaders []*sessions.UnusedHeader, unusedCookies []*sessions.UnusedCookie) (*types.Session, []error) {
+	errs := unusedMaterialErrors(unusedHeaders, unusedCookies)
+	if len(ss) == 0 {
+		errs = append(errs, errors.New("no sessions provided"))
+		return nil, errs
+	}
+	found := make([]*types.Session, len(ss))
+	sessionErrs := make([]error, len(ss))
+	m.RLock()
+	tx := &memoryTx{state: m.state, readOnly: true}
+	for i, s := range ss {
+		session, err := tx.getSession(s.GetId())
+		if errors.Is(err, sql.ErrNoRows) {
+			sessionErrs[i] = fmt.Errorf("read session: %w", sql.ErrNoRows)
+			continue
+		} else if err != nil {
+			sessionErrs[i] = err
+			continue
+		}
+		found[i] = session
+	}
+	m.RUnlock()
+	return chooseSession(ss, found, sessionErrs, errs)
+}
+
+// memoryTx implements Tx against a memoryState.  Its methods check their arguments the same way as
+// the Postgres implementation, and enforce the constraints that the schema enforces.
+type memoryTx struct {
+	state    *memoryState
+	readOnly bool
+}
+
+// roundTime truncates a timestamp to millisecond precision, which every store can represent.  It must
+// not round up; a session created "now" would then not be valid until the next millisecond.
+func roundTime(ts *timestamppb.Timestamp) *timestamppb.Timestamp {
+	return timestamppb.New(ts.AsTime().Truncate(time.Millisecond))
+}
+
+func (t *memoryTx) findUsername(username string) *memoryUser {
+	// Usernames are case-insensitive, like the citext column they're stored in.
+	for _, u := range t.state.users {
+		if strings.EqualFold(u.username, username) {
+			return u
+		}
+	}
+	return nil
+}
+
+func (t *memoryTx) LookupUser(ctx context.Context, user *types.User) error {
+	if id := user.GetId(); id != 0 {
+		u, ok := t.state.users[id]
+		if !ok {
+			return fmt.Errorf("get user by id: %w", sql.ErrNoRows)
+		}
+		user.Username = u.username
+		return nil
+	}
+	if username := user.GetUsername(); username != "" {
+		u := t.findUsername(username)
+		if u == nil {
+			return fmt.Errorf("get user by username: %w", sql.ErrNoRows)
+		}
+		user.Id = u.id
+		return nil
+	}
+	return &ErrEmpty{Field: "(oneof:user.id,user.username)"}
+}
+
+func (t *memoryTx) UpdateUser(ctx context.Context, user *types.User) error {
+	if user.Username == "" {
+		return &ErrEmpty{Field: "username"}
+	}
+	if t.readOnly {
+		return errReadOnly
+	}
+	if user.Id == 0 {
+		if t.findUsername(user.Username) != nil {
+			return fmt.Errorf("insert: %w", &ErrConstraint{Constraint: "idx_unique_user_username", Unique: true})
+		}
+		user.Id = t.state.nextUserID
+		t.state.nextUserID++
+		t.state.users[user.Id] = &memoryUser{id: user.Id, username: user.Username}
+		return nil
+	}
+	u, ok := t.state.users[user.Id]
+	if !ok {
+		return ErrNothingToUpdate
+	}
+	if other := t.findUsername(user.Username); other != nil && other.id != u.id {
+		return fmt.Errorf("update: %w", &ErrConstraint{Constraint: "idx_unique_user_username", Unique: true})
+	}
+	u.username = user.Username
+	return nil
+}
+
+// getSession returns a copy of the stored session, with the user's username filled in.
+func (t *memoryTx) getSession(id []byte) (*types.Session, error) {
+	if len(id) != 64 {
+		return nil, fmt.Errorf("session id %s: %w", id, ErrSessionIDInvalid)
+	}
+	s, ok := t.state.sessions[string(id)]
+	if !ok {
+		return nil, fmt.Errorf("select: %w", sql.ErrNoRows)
+	}
+	result := proto.Clone(s).(*types.Session)
+	if u, ok := t.state.users[result.GetUser().GetId()]; ok {
+		result.User.Username = u.username
+	}
+	return result, nil
+}
+
+func (t *memoryTx) LookupSession(ctx context.Context, id []byte) (*types.Session, error) {
+	session, err := t.getSession(id)
+	if err != nil {
+		return nil, fmt.Errorf("read session: %w", err)
+	}
+	if err := checkSessionTimes(session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+func (t *memoryTx) UpdateSession(ctx context.Context, s *types.Session) error {
+	if err := checkUpdateSession(s); err != nil {
+		return err
+	}
+	if t.readOnly {
+		return errReadOnly
+	}
+	sort.Strings(s.Taints)
+	metadata := s.GetMetadata()
+	if metadata == nil {
+		metadata = &types.SessionMetadata{}
+	} else {
+		metadata = proto.Clone(metadata).(*types.SessionMetadata)
+	}
+	taints := append([]string(nil), s.GetTaints()...)
+
+	if existing, ok := t.state.sessions[string(s.GetId())]; ok {
+		existing.Metadata = metadata
+		existing.Taints = taints
+		existing.ExpiresAt = roundTime(s.GetExpiresAt())
+		return nil
+	}
+	if len(s.GetId()) != 64 {
+		return fmt.Errorf("insert: %w", &ErrConstraint{Constraint: "session_id_check"})
+	}
+	if _, ok := t.state.users[s.GetUser().GetId()]; !ok {
+		return fmt.Errorf("insert: %w", &ErrConstraint{Constraint: "fk_user"})
+	}
+	t.state.sessions[string(s.GetId())] = &types.Session{
+		Id:        append([]byte(nil), s.GetId()...),
+		User:      &types.User{Id: s.GetUser().GetId()},
+		Metadata:  metadata,
+		Taints:    taints,
+		CreatedAt: roundTime(s.GetCreatedAt()),
+		ExpiresAt: roundTime(s.GetExpiresAt()),
+	}
+	return nil
+}
+
+func (t *memoryTx) RevokeSession(ctx context.Context, id []byte, reason string) error {
+	session, err := t.getSession(id)
+	if err != nil {
+		return fmt.Errorf("refresh session: %w", err)
+	}
+	if !revoke(session, reason) {
+		return nil
+	}
+	if err := t.UpdateSession(ctx, session); err != nil {
+		return fmt.Errorf("store expired session: %w", err)
+	}
+	return nil
+}
+
+func (t *memoryTx) AddCredential(ctx context.Context, c *types.Credential) error {
+	if err := checkAddCredential(c); err != nil {
+		return err
+	}
+	if t.readOnly {
+		return errReadOnly
+	}
+	if len(c.GetCredentialId()) < 16 {
+		return fmt.Errorf("insert: %w", &ErrConstraint{Constraint: "credential_credential_id_check"})
+	}
+	if _, ok := t.state.users[c.GetUser().GetId()]; !ok {
+		return fmt.Errorf("insert: %w", &ErrConstraint{Constraint: "fk_user"})
+	}
+	if _, ok := t.state.sessions[string(c.GetCreatedBySessionId())]; !ok {
+		return fmt.Errorf("insert: %w", &ErrConstraint{Constraint: "fk_session"})
+	}
+	stored := &types.Credential{
+		Id:                 t.state.nextCredentialID,
+		CredentialId:       append([]byte(nil), c.GetCredentialId()...),
+		PublicKey:          append([]byte(nil), c.GetPublicKey()...),
+		User:               &types.User{Id: c.GetUser().GetId()},
+		Name:               c.GetName(),
+		CreatedAt:          roundTime(c.GetCreatedAt()),
+		CreatedBySessionId: append([]byte(nil), c.GetCreatedBySessionId()...),
+		Aaguid:             append([]byte(nil), c.GetAaguid()...),
+		SignCount:          c.GetSignCount(),
+	}
+	t.state.nextCredentialID++
+	t.state.credentials[stored.Id] = &memoryCredential{credential: stored}
+	c.Id = stored.Id
+	return nil
+}
+
+func (t *memoryTx) GetUserCredentials(ctx context.Context, u *types.User) ([]*types.Credential, error) {
+	if u == nil {
+		return nil, &ErrEmpty{Field: "user"}
+	}
+	if u.GetId() < 1 {
+		return nil, &ErrEmpty{Field: "user.id"}
+	}
+	var result []*types.Credential
+	for _, c := range t.state.credentials {
+		if c.deleted || c.credential.GetUser().GetId() != u.GetId() {
+			continue
+		}
+		cred := proto.Clone(c.credential).(*types.Credential)
+		// The Postgres implementation does not select these columns.
+		cred.CreatedBySessionId = nil
+		if user, ok := t.state.users[u.GetId()]; ok {
+			cred.User.Username = user.username
+		}
+		result = append(result, cred)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].GetId() < result[j].GetId() })
+	return result, nil
+}
+
+func (t *memoryTx) CheckAndUpdateSignCount(ctx context.Context, c *types.Credential) error {
+	stored, ok := t.state.credentials[c.GetId()]
+	if !ok {
+		return fmt.Errorf("retrieve sign count: %w", sql.ErrNoRows)
+	}
+	signCount := stored.credential.GetSignCount()
+	if signCount != 0 && c.GetSignCount() != 0 && signCount >= c.GetSignCount() {
+		return fmt.Errorf("%w: authenticator's count: %d, stored count: %d", ErrSignCountDecreased, c.GetSignCount(), signCount)
+	}
+	if t.readOnly {
+		return errReadOnly
+	}
+	stored.credential.SignCount = c.GetSignCount()
+	return nil
+}
+
+func (t *memoryTx) AddAuditEvent(ctx context.Context, e *types.AuditEvent) error {
+	if err := checkAddAuditEvent(e); err != nil {
+		return err
+	}
+	if t.readOnly {
+		return errReadOnly
+	}
+	stored := proto.Clone(e).(*types.AuditEvent)
+	stored.Id = int64(len(t.state.auditEvents)) + 1
+	if len(stored.GetActorSessionId()) == 0 {
+		stored.ActorSessionId = nil
+	}
+	if len(stored.GetDetails()) == 0 {
+		stored.Details = nil
+	}
+	stored.Actor = auditUser(e.GetActor())
+	stored.Target = auditUser(e.GetTarget())
+	var prev []byte
+	if n := len(t.state.auditEvents); n > 0 {
+		prev = t.state.auditEvents[n-1].GetHash()
+	}
+	chainAuditEvent(prev, stored)
+	t.state.auditEvents = append(t.state.auditEvents, stored)
+	e.Id, e.CreatedAt, e.PrevHash, e.Hash = stored.Id, stored.CreatedAt, stored.PrevHash, stored.Hash
+	return nil
+}
+
+// auditUser returns the parts of a user that are stored with an audit event, or nil if there is
+// nothing to store.
+func auditUser(u *types.User) *types.User {
+	if u.GetId() == 0 && u.GetUsername() == "" {
+		return nil
+	}
+	return &types.User{Id: u.GetId(), Username: u.GetUsername()}
+}
+
+// matchAuditEvent returns true if the filter selects the event.
+func matchAuditEvent(f *AuditFilter, e *types.AuditEvent) bool {
+	matchUser := func(want, got *types.User) bool {
+		if id := want.GetId(); id != 0 {
+			return got.GetId() == id
+		}
+		if username := want.GetUsername(); username != "" {
+			return strings.EqualFold(got.GetUsername(), username)
+		}
+		return true
+	}
+	createdAt := e.GetCreatedAt().AsTime()
+	switch {
+	case f.Action != "" && e.GetAction() != f.Action:
+	case !matchUser(f.Actor, e.GetActor()):
+	case !matchUser(f.Target, e.GetTarget()):
+	case !f.Since.IsZero() && createdAt.Before(f.Since):
+	case !f.Until.IsZero() && !createdAt.Before(f.Until):
+	case f.Result != types.AuditEvent_RESULT_UNKNOWN && e.GetResult() != f.Result:
+	case f.IPAddress != "" && e.GetIpAddress() != f.IPAddress:
+	case f.BeforeID > 0 && e.GetId() >= f.BeforeID:
+	case f.AfterID > 0 && e.GetId() <= f.AfterID:
+	default:
+		return true
+	}
+	return false
+}
+
+func (t *memoryTx) QueryAuditEvents(ctx context.Context, f *AuditFilter) ([]*types.AuditEvent, error) {
+	if _, _, err := auditQuery(f, func(t time.Time) interface{} { return t }); err != nil {
+		return nil, fmt.Errorf("build query: %w", err)
+	}
+	var result []*types.AuditEvent
+	n := len(t.state.auditEvents)
+	for i := 0; i < n; i++ {
+		if f.Limit > 0 && len(result) >= f.Limit {
+			break
+		}
+		e := t.state.auditEvents[n-1-i]
+		if f.OldestFirst {
+			e = t.state.auditEvents[i]
+		}
+		if matchAuditEvent(f, e) {
+			result = append(result, proto.Clone(e).(*types.AuditEvent))
+		}
+	}
+	return result, nil
+}
+
+func (t *memoryTx) AddAuditCheckpoint(ctx context.Context, c *types.AuditCheckpoint) error {
+	if err := checkAddAuditCheckpoint(c); err != nil {
+		return err
+	}
+	if t.readOnly {
+		return errReadOnly
+	}
+	stored := proto.Clone(c).(*types.AuditCheckpoint)
+	stored.Id = int64(len(t.state.auditCheckpoints)) + 1
+	stored.CreatedAt = roundTime(c.GetCreatedAt())
+	t.state.auditCheckpoints = append(t.state.auditCheckpoints, stored)
+	c.Id = stored.Id
+	return nil
+}
+
+func (t *memoryTx) GetAuditCheckpoints(ctx context.Context) ([]*types.AuditCheckpoint, error) {
+	var result []*types.AuditCheckpoint
+	for _, c := range t.state.auditCheckpoints {
+		result = append(result, proto.Clone(c).(*types.AuditCheckpoint))
+	}
+	return result, nil
+}
+
+func (t *memoryTx) AddWebhook(ctx context.Context, w *types.Webhook) error {
+	if err := checkAddWebhook(w); err != nil {
+		return err
+	}
+	if _, err := fromWebhook(w); err != nil {
+		return fmt.Errorf("marshal webhook: %w", err)
+	}
+	if t.readOnly {
+		return errReadOnly
+	}
+	stored := proto.Clone(w).(*types.Webhook)
+	stored.Id = t.state.nextWebhookID
+	stored.CreatedAt = roundTime(w.GetCreatedAt())
+	t.state.nextWebhookID++
+	t.state.webhooks[stored.Id] = stored
+	w.Id = stored.Id
+	return nil
+}
+
+func (t *memoryTx) GetWebhooks(ctx context.Context) ([]*types.Webhook, error) {
+	var result []*types.Webhook
+	for _, w := range t.state.webhooks {
+		result = append(result, proto.Clone(w).(*types.Webhook))
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].GetId() < result[j].GetId() })
+	return result, nil
+}
+
+func (t *memoryTx) DeleteWebhook(ctx context.Context, id int64) error {
+	if t.readOnly {
+		return errReadOnly
+	}
+	if _, ok := t.state.webhooks[id]; !ok {
+		return fmt.Errorf("delete: %w", sql.ErrNoRows)
+	}
+	delete(t.state.webhooks, id)
+	// The slice is shared with the committed state, so it can't be filtered in place.
+	var deliveries []*types.WebhookDelivery
+	for _, d := range t.state.webhookDeliveries {
+		if d.GetWebhookId() != id {
+			deliveries = append(deliveries, d)
+		}
+	}
+	t.state.webhookDeliveries = deliveries
+	return nil
+}
+
+func (t *memoryTx) GetWebhookCursor(ctx context.Context) (int64, error) {
+	if t.state.webhookCursor == nil {
+		return 0, fmt.Errorf("select: %w", sql.ErrNoRows)
+	}
+	return *t.state.webhookCursor, nil
+}
+
+func (t *memoryTx) SetWebhookCursor(ctx context.Context, id int64) error {
+	if t.readOnly {
+		return errReadOnly
+	}
+	t.state.webhookCursor = &id
+	return nil
+}
+
+func (t *memoryTx) RedeemNonce(ctx context.Context, nonce []byte, expiresAt time.Time) error {
+	if t.readOnly {
+		return errReadOnly
+	}
+	if err := checkNonce(nonce); err != nil {
+		return err
+	}
+	// The memory store has no reaper, so expired nonces are forgotten here instead.
+	now := time.Now()
+	for n, exp := range t.state.usedNonces {
+		if exp.Before(now) {
+			delete(t.state.usedNonces, n)
+		}
+	}
+	if _, ok := t.state.usedNonces[string(nonce)]; ok {
+		return ErrNonceReused
+	}
+	t.state.usedNonces[string(nonce)] = expiresAt
+	return nil
+}
+
+// storedWebhookDelivery returns a copy of d as the database would store it.
+func storedWebhookDelivery(d *types.WebhookDelivery) *types.WebhookDelivery {
+	stored := proto.Clone(d).(*types.WebhookDelivery)
+	stored.CreatedAt = roundTime(d.GetCreatedAt())
+	stored.NextAttemptAt = roundTime(d.GetNextAttemptAt())
+	if d.GetLastAttemptAt() != nil {
+		stored.LastAttemptAt = roundTime(d.GetLastAttemptAt())
+	}
+	return stored
+}
+
+func (t *memoryTx) AddWebhookDelivery(ctx context.Context, d *types.WebhookDelivery) error {
+	if err := checkWebhookDelivery(d); err != nil {
+		return err
+	}
+	if t.readOnly {
+		return errReadOnly
+	}
+	if _, ok := t.state.webhooks[d.GetWebhookId()]; !ok {
+		return fmt.Errorf("insert: %w", &ErrConstraint{Constraint: "webhook_delivery_webhook_id_fkey"})
+	}
+	stored := storedWebhookDelivery(d)
+	stored.Id = t.state.nextWebhookDeliveryID
+	t.state.nextWebhookDeliveryID++
+	t.state.webhookDeliveries = append(t.state.webhookDeliveries, stored)
+	d.Id = stored.Id
+	return nil
+}
+
+// matchWebhookDelivery returns true if the filter selects the delivery.
+func matchWebhookDelivery(f *WebhookDeliveryFilter, d *types.WebhookDelivery) bool {
+	switch {
+	case f.ID > 0 && d.GetId() != f.ID:
+	case f.WebhookID > 0 && d.GetWebhookId() != f.WebhookID:
+	case f.State != types.WebhookDelivery_STATE_UNKNOWN && d.GetState() != f.State:
+	case !f.DueBefore.IsZero() && d.GetNextAttemptAt().AsTime().After(f.DueBefore):
+	case f.BeforeID > 0 && d.GetId() >= f.BeforeID:
+	default:
+		return true
+	}
+	return false
+}
+
+func (t *memoryTx) QueryWebhookDeliveries(ctx context.Context, f *WebhookDeliveryFilter) ([]*types.WebhookDelivery, error) {
+	if _, _, err := webhookDeliveryQuery(f, func(t time.Time) interface{} { return t }); err != nil {
+		return nil, fmt.Errorf("build query: %w", err)
+	}
+	var result []*types.WebhookDelivery
+	n := len(t.state.webhookDeliveries)
+	for i := 0; i < n; i++ {
+		if f.Limit > 0 && len(result) >= f.Limit {
+			break
+		}
+		d := t.state.webhookDeliveries[n-1-i]
+		if f.OldestFirst {
+			d = t.state.webhookDeliveries[i]
+		}
+		if matchWebhookDelivery(f, d) {
+			result = append(result, proto.Clone(d).(*types.WebhookDelivery))
+		}
+	}
+	return result, nil
+}
+
+func (t *memoryTx) UpdateWebhookDelivery(ctx context.Context, d *types.WebhookDelivery) error {
+	if err := checkWebhookDelivery(d); err != nil {
+		return err
+	}
+	if t.readOnly {
+		return errReadOnly
+	}
+	for i, stored := range t.state.webhookDeliveries {
+		if stored.GetId() != d.GetId() {
+			continue
+		}
+		updated := storedWebhookDelivery(d)
+		replacement := proto.Clone(stored).(*types.WebhookDelivery)
+		replacement.State = updated.GetState()
+		replacement.Attempts = updated.GetAttempts()
+		replacement.NextAttemptAt = updated.GetNextAttemptAt()
+		replacement.LastAttemptAt = updated.GetLastAttemptAt()
+		replacement.LastError = updated.GetLastError()
+		// The slice and the delivery are shared with the committed state, so copy the slice
+		// and replace the delivery instead of changing either in place.
+		deliveries := make([]*types.WebhookDelivery, len(t.state.webhookDeliveries))
+		copy(deliveries, t.state.webhookDeliveries)
+		deliveries[i] = replacement
+		t.state.webhookDeliveries = deliveries
+		return nil
+	}
+	return fmt.Errorf("update: %w", sql.ErrNoRows)
+}
+
+var _ Store = (*Memory)(nil)
+var _ Store = (*Connection)(nil)
@@ -2,79 +2,166 @@ package store
 
 import (
 	"context"
-	"errors"
 	"fmt"
+	"io/fs"
 	"os"
-	"path/filepath"
-	"strings"
 
 	"github.com/jackc/pgx/v4/stdlib"
 	"github.com/jackc/tern/migrate"
+	"github.com/jrockway/jsso2/migrations"
 )
 
-const (
-	versionTable  = "public.schema_version"
-	migrationPath = "migrations"
-)
+const versionTable = "public.schema_version"
 
-func findMigrations() (string, error) {
-	cwd, err := os.Getwd()
-	if err != nil {
-		return "", err
-	}
-	start, err := filepath.Abs(cwd)
+// migratorFS adapts an fs.FS to tern's migrate.MigratorFS.
+type migratorFS struct {
+	fs.FS
+}
+
+func (f migratorFS) ReadDir(dirname string) ([]os.FileInfo, error) {
+	entries, err := fs.ReadDir(f.FS, dirname)
 	if err != nil {
-		return "", fmt.Errorf("abs: %w", err)
-	}
-	parts := strings.Split(start, string(filepath.Separator))
-	if len(parts) > 0 {
-		// filepath.Join really wants a / there, not ""
-		parts[0] = string(filepath.Separator)
+		return nil, err
 	}
-
-	var lookedAt []string
-	for i := len(parts); i > 0; i-- {
-		target := filepath.Join(filepath.Join(parts[0:i]...), migrationPath)
-		lookedAt = append(lookedAt, target)
-		info, err := os.Stat(target)
+	result := make([]os.FileInfo, 0, len(entries))
+	for _, e := range entries {
+		info, err := e.Info()
 		if err != nil {
-			if errors.Is(err, os.ErrNotExist) {
-				continue
-			}
-			return "", err
-		}
-		if info.IsDir() {
-			return target, nil
+			return nil, fmt.Errorf("stat %s: %w", e.Name(), err)
 		}
+		result = append(result, info)
 	}
-	return "", fmt.Errorf("no migrations found; looked in %v", lookedAt)
+	return result, nil
 }
 
-func (c *Connection) MigrateDB(ctx context.Context) error {
+func (f migratorFS) ReadFile(filename string) ([]byte, error) {
+	return fs.ReadFile(f.FS, filename)
+}
+
+func (f migratorFS) Glob(pattern string) ([]string, error) {
+	return fs.Glob(f.FS, pattern)
+}
+
+// RequiredSchemaVersion returns the schema version that this binary expects; that is, the number
+// of migrations compiled into it.
+func RequiredSchemaVersion() (int32, error) {
+	paths, err := migrate.FindMigrationsEx(".", migratorFS{migrations.FS})
+	if err != nil {
+		return 0, fmt.Errorf("find embedded migrations: %w", err)
+	}
+	return int32(len(paths)), nil
+}
+
+// withMigrator runs f with a tern migrator that has the embedded migrations loaded.
+func (c *Connection) withMigrator(ctx context.Context, f func(m *migrate.Migrator) error) error {
 	conn, err := c.db.DB.Conn(ctx)
 	if err != nil {
 		return fmt.Errorf("get raw connection: %w", err)
 	}
-	err = conn.Raw(func(driverConn interface{}) error {
+	defer conn.Close()
+	return conn.Raw(func(driverConn interface{}) error {
 		conn := driverConn.(*stdlib.Conn).Conn()
-		m, err := migrate.NewMigrator(ctx, conn, versionTable)
+		m, err := migrate.NewMigratorEx(ctx, conn, versionTable, &migrate.MigratorOptions{
+			MigratorFS: migratorFS{migrations.FS},
+		})
 		if err != nil {
 			return fmt.Errorf("new migrator: %w", err)
 		}
-		path, err := findMigrations()
-		if err != nil {
-			return fmt.Errorf("find migrations: %w", err)
-		}
-		if err := m.LoadMigrations(path); err != nil {
-			return fmt.Errorf("load migrations from ./migrations: %w", err)
+		if err := m.LoadMigrations("."); err != nil {
+			return fmt.Errorf("load embedded migrations: %w", err)
 		}
+		return f(m)
+	})
+}
+
+// MigrateDB migrates the database to the latest schema version.
+func (c *Connection) MigrateDB(ctx context.Context) error {
+	if err := c.withMigrator(ctx, func(m *migrate.Migrator) error {
 		if err := m.Migrate(ctx); err != nil {
 			return fmt.Errorf("migrate: %w", err)
 		}
 		return nil
-	})
-	if err != nil {
+	}); err != nil {
+		return fmt.Errorf("run migrations: %w", err)
+	}
+	return nil
+}
+
+// MigrateTo migrates the database up or down to the provided schema version.  Version 0 is an
+// empty database.
+func (c *Connection) MigrateTo(ctx context.Context, version int32) error {
+	if err := c.withMigrator(ctx, func(m *migrate.Migrator) error {
+		if err := m.MigrateTo(ctx, version); err != nil {
+			return fmt.Errorf("migrate to version %d: %w", version, err)
+		}
+		return nil
+	}); err != nil {
 		return fmt.Errorf("run migrations: %w", err)
 	}
 	return nil
 }
+
+// Migration describes one migration compiled into the binary.
+type Migration struct {
+	Version int32
+	Name    string
+	Applied bool
+}
+
+// MigrationStatus describes the state of the database schema relative to this binary.
+type MigrationStatus struct {
+	Current    int32 // The version recorded in the schema_version table.
+	Required   int32 // The version that this binary expects.
+	Migrations []Migration
+}
+
+// MigrationStatus reads the current schema version from the database.
+func (c *Connection) MigrationStatus(ctx context.Context) (*MigrationStatus, error) {
+	result := new(MigrationStatus)
+	if err := c.withMigrator(ctx, func(m *migrate.Migrator) error {
+		v, err := m.GetCurrentVersion(ctx)
+		if err != nil {
+			return fmt.Errorf("get current version: %w", err)
+		}
+		result.Current = v
+		result.Required = int32(len(m.Migrations))
+		for _, mig := range m.Migrations {
+			result.Migrations = append(result.Migrations, Migration{
+				Version: mig.Sequence,
+				Name:    mig.Name,
+				Applied: mig.Sequence <= v,
+			})
+		}
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("read migration status: %w", err)
+	}
+	return result, nil
+}
+
+// ErrSchemaBehind is returned by CheckSchema when the database needs to be migrated before this
+// binary can use it.
+type ErrSchemaBehind struct {
+	Current, Required int32
+}
+
+func (e *ErrSchemaBehind) Error() string {
+	return fmt.Sprintf("database schema is at version %d, but version %d is required; run \"jsso2 migrate up\" or start with --run_migrations", e.Current, e.Required)
+}
+
+// CheckSchema returns an *ErrSchemaBehind if the database schema is older than the one this binary
+// was built for.  A newer schema is allowed, so that old replicas keep running while a new
+// version is rolled out.
+func (c *Connection) CheckSchema(ctx context.Context) (*MigrationStatus, error) {
+	return checkSchema(c.MigrationStatus(ctx))
+}
+
+func checkSchema(status *MigrationStatus, err error) (*MigrationStatus, error) {
+	if err != nil {
+		return nil, err
+	}
+	if status.Current < status.Required {
+		return status, &ErrSchemaBehind{Current: status.Current, Required: status.Required}
+	}
+	return status, nil
+}
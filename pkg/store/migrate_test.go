@@ -0,0 +1,69 @@
+package store
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+
+	"github.com/jrockway/jsso2/migrations"
+	"github.com/jrockway/jsso2/pkg/jtesting"
+)
+
+func TestRequiredSchemaVersion(t *testing.T) {
+	files, err := fs.Glob(migrations.FS, "*.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no migrations embedded")
+	}
+	v, err := RequiredSchemaVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := v, int32(len(files)); got != want {
+		t.Errorf("required schema version:\n  got: %v\n want: %v", got, want)
+	}
+}
+
+func TestMigrations(t *testing.T) {
+	jtesting.Run(t, "migrations", jtesting.R{Logger: true, Database: true}, func(t *testing.T, e *jtesting.E) {
+		c := MustGetTestDB(t, e)
+		required, err := RequiredSchemaVersion()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		status, err := c.CheckSchema(e.Context)
+		if err != nil {
+			t.Fatalf("check migrated schema: %v", err)
+		}
+		if got, want := status.Current, required; got != want {
+			t.Errorf("current version:\n  got: %v\n want: %v", got, want)
+		}
+		for _, m := range status.Migrations {
+			if !m.Applied {
+				t.Errorf("migration %d (%s) not applied", m.Version, m.Name)
+			}
+		}
+
+		if err := c.MigrateTo(e.Context, 1); err != nil {
+			t.Fatalf("migrate down: %v", err)
+		}
+		_, err = c.CheckSchema(e.Context)
+		target := &ErrSchemaBehind{}
+		if !errors.As(err, &target) {
+			t.Fatalf("check old schema: expected ErrSchemaBehind, got %v", err)
+		}
+		if got, want := *target, (ErrSchemaBehind{Current: 1, Required: required}); got != want {
+			t.Errorf("schema behind:\n  got: %#v\n want: %#v", got, want)
+		}
+
+		if err := c.MigrateDB(e.Context); err != nil {
+			t.Fatalf("migrate up: %v", err)
+		}
+		if _, err := c.CheckSchema(e.Context); err != nil {
+			t.Errorf("check re-migrated schema: %v", err)
+		}
+	})
+}
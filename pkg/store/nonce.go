@@ -0,0 +1,70 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"github.com/jmoiron/sqlx"
+	"github.com/jrockway/jsso2/pkg/sessions"
+)
+
+// ErrNonceReused is returned by RedeemNonce when the nonce has already been redeemed.
+var ErrNonceReused = errors.New("nonce has already been used")
+
+// minNonceLength is the shortest nonce that the schema accepts.
+const minNonceLength = 16
+
+func checkNonce(nonce []byte) error {
+	if len(nonce) < minNonceLength {
+		return fmt.Errorf("nonce must be at least %d bytes", minNonceLength)
+	}
+	return nil
+}
+
+// RedeemNonce records that the provided nonce has been used, returning ErrNonceReused if it was
+// already used.  The record is kept until expiresAt, after which the nonce could be reused; callers
+// must ensure that whatever carries the nonce is no longer valid by then.  Expired records are
+// deleted by the reaper; see ReapSessions.
+func RedeemNonce(ctx context.Context, db sqlx.ExtContext, nonce []byte, expiresAt time.Time) error {
+	if err := checkNonce(nonce); err != nil {
+		return err
+	}
+	// A record that has expired but not yet been reaped is reused.
+	result, err := db.ExecContext(ctx, `insert into used_nonce (nonce, expires_at) values ($1, $2)
+            on conflict (nonce) do update set expires_at = excluded.expires_at where used_nonce.expires_at < now()`, nonce, expiresAt)
+	if err != nil {
+		return fmt.Errorf("insert: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("get affected rows: %w", err)
+	}
+	if n == 0 {
+		return ErrNonceReused
+	}
+	return nil
+}
+
+// NonceStore adapts a Store to sessions.NonceRedeemer, so that set-cookie tokens can only be used
+// once across every replica that shares the database.
+type NonceStore struct {
+	DB Store
+}
+
+var _ sessions.NonceRedeemer = (*NonceStore)(nil)
+
+// RedeemNonce implements sessions.NonceRedeemer.
+func (s *NonceStore) RedeemNonce(ctx context.Context, nonce []byte, expiresAt time.Time) error {
+	if err := s.DB.DoTx(ctx, ctxzap.Extract(ctx), false, func(tx Tx) error {
+		return tx.RedeemNonce(ctx, nonce, expiresAt)
+	}); err != nil {
+		if errors.Is(err, ErrNonceReused) {
+			return fmt.Errorf("%w: %v", sessions.ErrTokenReused, err)
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v4/stdlib"
+	"go.uber.org/zap"
+)
+
+// auditEventAddedChannel is the channel that the trigger in migrations/006_audit_notify.sql
+// notifies when an audit event is added.
+const auditEventAddedChannel = "jsso2_audit_event_added"
+
+// broadcaster wakes up every subscriber when broadcast is called.  The zero value is ready to use.
+type broadcaster struct {
+	sync.Mutex
+	subscribers map[chan struct{}]struct{}
+}
+
+// subscribe returns a channel that receives a value after each call to broadcast, until ctx is
+// done.  Broadcasts that happen while a previous one is unread are coalesced.
+func (b *broadcaster) subscribe(ctx context.Context) <-chan struct{} {
+	ch := make(chan struct{}, 1)
+	b.Lock()
+	if b.subscribers == nil {
+		b.subscribers = make(map[chan struct{}]struct{})
+	}
+	b.subscribers[ch] = struct{}{}
+	b.Unlock()
+	go func() {
+		<-ctx.Done()
+		b.Lock()
+		delete(b.subscribers, ch)
+		b.Unlock()
+	}()
+	return ch
+}
+
+// broadcast wakes up every subscriber.
+func (b *broadcaster) broadcast() {
+	b.Lock()
+	defer b.Unlock()
+	for ch := range b.subscribers {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// listenChannel listens on a Postgres notification channel, calling handle with the payload of
+// each notification, until the connection fails or the context is cancelled.  ready is called once
+// the listen has taken effect.
+func (c *Connection) listenChannel(ctx context.Context, l *zap.Logger, channel string, ready func(), handle func(payload string)) error {
+	conn, err := c.db.DB.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("get raw connection: %w", err)
+	}
+	defer conn.Close()
+	return conn.Raw(func(driverConn interface{}) error {
+		pc := driverConn.(*stdlib.Conn).Conn()
+		if _, err := pc.Exec(ctx, "listen "+channel); err != nil {
+			return fmt.Errorf("listen: %w", err)
+		}
+		defer func() {
+			if pc.IsClosed() {
+				return
+			}
+			// Don't return a listening connection to the pool.
+			unlistenCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			if _, err := pc.Exec(unlistenCtx, "unlisten *"); err != nil {
+				l.Debug("problem unlistening", zap.Error(err))
+			}
+		}()
+		ready()
+		for {
+			n, err := pc.WaitForNotification(ctx)
+			if err != nil {
+				return fmt.Errorf("wait for notification: %w", err)
+			}
+			handle(n.Payload)
+		}
+	})
+}
+
+// keepListening calls listen until the context is cancelled, backing off between attempts that
+// fail quickly.
+func keepListening(ctx context.Context, l *zap.Logger, listen func() error) {
+	backoff := TxDelay
+	for {
+		start := time.Now()
+		err := listen()
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+		if time.Since(start) > time.Minute {
+			backoff = TxDelay
+		}
+		l.Warn("listener exited; retrying after a delay", zap.Duration("delay", backoff), zap.Error(err))
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff < 10*time.Second {
+			backoff *= 2
+		}
+	}
+}
+
+// ListenForAuditEvents wakes up SubscribeAuditEvents subscribers whenever any replica adds an audit
+// event.  It returns when the context is cancelled.
+func (c *Connection) ListenForAuditEvents(ctx context.Context, l *zap.Logger) {
+	keepListening(ctx, l, func() error {
+		return c.listenChannel(ctx, l, auditEventAddedChannel, func() {
+			l.Info("listening for audit events")
+			// Events added while we weren't listening would otherwise go unnoticed.
+			c.auditEvents.broadcast()
+		}, func(string) {
+			c.auditEvents.broadcast()
+		})
+	})
+}
+
+// SubscribeAuditEvents implements Store.  Notifications are only sent while ListenForAuditEvents
+// is running.
+func (c *Connection) SubscribeAuditEvents(ctx context.Context) <-chan struct{} {
+	return c.auditEvents.subscribe(ctx)
+}
+
+// SubscribeAuditEvents implements Store.
+func (m *Memory) SubscribeAuditEvents(ctx context.Context) <-chan struct{} {
+	return m.auditEvents.subscribe(ctx)
+}
+
+// SubscribeAuditEvents implements Store.  Only events added by this process are noticed.
+func (s *SQLite) SubscribeAuditEvents(ctx context.Context) <-chan struct{} {
+	return s.auditEvents.subscribe(ctx)
+}
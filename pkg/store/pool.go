@@ -0,0 +1,208 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgconn/stmtcache"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/stdlib"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// PoolConfig configures the pool of connections to the database.
+type PoolConfig struct {
+	MaxOpenConns          int           `long:"db_max_open_conns" description:"The maximum number of open connections to the database; 0 means unlimited." default:"20" env:"DB_MAX_OPEN_CONNS"`
+	MaxIdleConns          int           `long:"db_max_idle_conns" description:"The maximum number of idle connections to keep open." default:"10" env:"DB_MAX_IDLE_CONNS"`
+	ConnMaxLifetime       time.Duration `long:"db_conn_max_lifetime" description:"How long a connection may be reused for; 0 means forever." default:"30m" env:"DB_CONN_MAX_LIFETIME"`
+	ConnMaxIdleTime       time.Duration `long:"db_conn_max_idle_time" description:"How long a connection may sit idle before being closed; 0 means forever." default:"5m" env:"DB_CONN_MAX_IDLE_TIME"`
+	MaxConcurrentConnects int           `long:"db_max_concurrent_connects" description:"The maximum number of new connections that may be in the process of being established at once; 0 means unlimited." default:"4" env:"DB_MAX_CONCURRENT_CONNECTS"`
+	StatementTimeout      time.Duration `long:"db_statement_timeout" description:"If non-zero, the server-side statement_timeout to set on each connection." env:"DB_STATEMENT_TIMEOUT"`
+	StatementCacheSize    int           `long:"db_statement_cache_size" description:"The number of prepared statements to cache on each connection; 0 disables preparing statements." default:"512" env:"DB_STATEMENT_CACHE_SIZE"`
+}
+
+var (
+	connectsStarted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "jsso2_db_connects_started",
+		Help: "Number of attempts to open a new connection to the database, by pool.",
+	}, []string{"pool"})
+	connectsFailed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "jsso2_db_connects_failed",
+		Help: "Number of attempts to open a new connection to the database that failed, by pool.",
+	}, []string{"pool"})
+	connectWaitSeconds = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "jsso2_db_connect_wait_seconds",
+		Help: "Total time spent waiting for permission to open a new connection to the database, by pool.",
+	}, []string{"pool"})
+)
+
+// connector is a driver.Connector that limits the number of connections that can be in the
+// process of being established at once, so that a burst of demand (like every replica starting at
+// the same time) doesn't overwhelm the database server.
+type connector struct {
+	driver.Connector
+	pool       string
+	sem        chan struct{}
+	configName string  // The name that pgx's stdlib registered our pgx.ConnConfig under.
+	db         *sql.DB // The pool using this connector, if its statistics are being exported.
+}
+
+// Close is called by sql.DB.Close.  It forgets the pgx.ConnConfig registered by newConnector, which
+// pgx would otherwise keep forever, and stops exporting statistics for the closed pool.  (pgx never
+// reuses a registration name, so this can't affect other pools.)
+func (c *connector) Close() error {
+	if c.configName != "" {
+		stdlib.UnregisterConnConfig(c.configName)
+	}
+	if c.db != nil {
+		poolStats.remove(c.pool, c.db)
+	}
+	return nil
+}
+
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	if c.sem != nil {
+		start := time.Now()
+		select {
+		case c.sem <- struct{}{}:
+		case <-ctx.Done():
+			return nil, fmt.Errorf("wait to connect: %w", ctx.Err())
+		}
+		defer func() { <-c.sem }()
+		connectWaitSeconds.WithLabelValues(c.pool).Add(time.Since(start).Seconds())
+	}
+	connectsStarted.WithLabelValues(c.pool).Inc()
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		connectsFailed.WithLabelValues(c.pool).Inc()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// newConnector returns a connector to the database at dsn, configured according to cfg.
+func newConnector(pool, dsn string, cfg *PoolConfig) (*connector, error) {
+	connConfig, err := pgx.ParseConfig(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("parse database url: %w", err)
+	}
+	if cfg.StatementTimeout > 0 {
+		connConfig.RuntimeParams["statement_timeout"] = strconv.FormatInt(cfg.StatementTimeout.Milliseconds(), 10)
+	}
+	if size := cfg.StatementCacheSize; size > 0 {
+		connConfig.BuildStatementCache = func(conn *pgconn.PgConn) stmtcache.Cache {
+			return stmtcache.New(conn, stmtcache.ModePrepare, size)
+		}
+	} else {
+		connConfig.BuildStatementCache = nil
+	}
+
+	d, ok := stdlib.GetDefaultDriver().(*stdlib.Driver)
+	if !ok {
+		return nil, fmt.Errorf("unexpected pgx driver type %T", stdlib.GetDefaultDriver())
+	}
+	name := stdlib.RegisterConnConfig(connConfig)
+	base, err := d.OpenConnector(name)
+	if err != nil {
+		stdlib.UnregisterConnConfig(name)
+		return nil, fmt.Errorf("create connector: %w", err)
+	}
+	c := &connector{Connector: base, pool: pool, configName: name}
+	if n := cfg.MaxConcurrentConnects; n > 0 {
+		c.sem = make(chan struct{}, n)
+	}
+	return c, nil
+}
+
+// openDB returns a pool of connections to the database at dsn, configured according to cfg.  The
+// pool's statistics are exported under the provided name.
+func openDB(pool, dsn string, cfg *PoolConfig) (*sql.DB, error) {
+	c, err := newConnector(pool, dsn, cfg)
+	if err != nil {
+		return nil, err
+	}
+	db := sql.OpenDB(c)
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+	c.db = db
+	poolStats.add(pool, db)
+	return db, nil
+}
+
+var (
+	poolOpenDesc              = prometheus.NewDesc("jsso2_db_pool_open_connections", "Number of established connections to the database, both in use and idle.", []string{"pool"}, nil)
+	poolInUseDesc             = prometheus.NewDesc("jsso2_db_pool_in_use_connections", "Number of connections to the database that are currently in use.", []string{"pool"}, nil)
+	poolIdleDesc              = prometheus.NewDesc("jsso2_db_pool_idle_connections", "Number of idle connections to the database.", []string{"pool"}, nil)
+	poolMaxOpenDesc           = prometheus.NewDesc("jsso2_db_pool_max_open_connections", "The configured maximum number of open connections to the database.", []string{"pool"}, nil)
+	poolWaitCountDesc         = prometheus.NewDesc("jsso2_db_pool_wait_count", "Number of times a query had to wait for a free connection.", []string{"pool"}, nil)
+	poolWaitSecondsDesc       = prometheus.NewDesc("jsso2_db_pool_wait_seconds", "Total time spent waiting for a free connection.", []string{"pool"}, nil)
+	poolMaxIdleClosedDesc     = prometheus.NewDesc("jsso2_db_pool_max_idle_closed", "Number of connections closed because there were too many idle connections.", []string{"pool"}, nil)
+	poolMaxIdleTimeClosedDesc = prometheus.NewDesc("jsso2_db_pool_max_idle_time_closed", "Number of connections closed because they were idle for too long.", []string{"pool"}, nil)
+	poolMaxLifetimeClosedDesc = prometheus.NewDesc("jsso2_db_pool_max_lifetime_closed", "Number of connections closed because they reached their maximum lifetime.", []string{"pool"}, nil)
+)
+
+// poolCollector exports sql.DBStats for every pool opened by openDB.
+type poolCollector struct {
+	sync.Mutex
+	pools map[string]*sql.DB
+}
+
+var poolStats = &poolCollector{pools: make(map[string]*sql.DB)}
+
+func init() {
+	prometheus.MustRegister(poolStats)
+}
+
+func (c *poolCollector) add(name string, db *sql.DB) {
+	c.Lock()
+	defer c.Unlock()
+	c.pools[name] = db
+}
+
+// remove stops exporting statistics for db.  If another pool has since been added under the same
+// name, it is left alone.
+func (c *poolCollector) remove(name string, db *sql.DB) {
+	c.Lock()
+	defer c.Unlock()
+	if c.pools[name] == db {
+		delete(c.pools, name)
+	}
+}
+
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- poolOpenDesc
+	ch <- poolInUseDesc
+	ch <- poolIdleDesc
+	ch <- poolMaxOpenDesc
+	ch <- poolWaitCountDesc
+	ch <- poolWaitSecondsDesc
+	ch <- poolMaxIdleClosedDesc
+	ch <- poolMaxIdleTimeClosedDesc
+	ch <- poolMaxLifetimeClosedDesc
+}
+
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	c.Lock()
+	defer c.Unlock()
+	for name, db := range c.pools {
+		s := db.Stats()
+		ch <- prometheus.MustNewConstMetric(poolOpenDesc, prometheus.GaugeValue, float64(s.OpenConnections), name)
+		ch <- prometheus.MustNewConstMetric(poolInUseDesc, prometheus.GaugeValue, float64(s.InUse), name)
+		ch <- prometheus.MustNewConstMetric(poolIdleDesc, prometheus.GaugeValue, float64(s.Idle), name)
+		ch <- prometheus.MustNewConstMetric(poolMaxOpenDesc, prometheus.GaugeValue, float64(s.MaxOpenConnections), name)
+		ch <- prometheus.MustNewConstMetric(poolWaitCountDesc, prometheus.CounterValue, float64(s.WaitCount), name)
+		ch <- prometheus.MustNewConstMetric(poolWaitSecondsDesc, prometheus.CounterValue, s.WaitDuration.Seconds(), name)
+		ch <- prometheus.MustNewConstMetric(poolMaxIdleClosedDesc, prometheus.CounterValue, float64(s.MaxIdleClosed), name)
+		ch <- prometheus.MustNewConstMetric(poolMaxIdleTimeClosedDesc, prometheus.CounterValue, float64(s.MaxIdleTimeClosed), name)
+		ch <- prometheus.MustNewConstMetric(poolMaxLifetimeClosedDesc, prometheus.CounterValue, float64(s.MaxLifetimeClosed), name)
+	}
+}
@@ -0,0 +1,135 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type slowConnector struct {
+	sync.Mutex
+	active, maxActive int
+}
+
+func (c *slowConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	c.Lock()
+	c.active++
+	if c.active > c.maxActive {
+		c.maxActive = c.active
+	}
+	c.Unlock()
+	time.Sleep(10 * time.Millisecond)
+	c.Lock()
+	c.active--
+	c.Unlock()
+	return nil, errors.New("slow connector never connects")
+}
+
+func (c *slowConnector) Driver() driver.Driver { return nil }
+
+func TestConnectorLimitsConcurrentConnects(t *testing.T) {
+	base := &slowConnector{}
+	c := &connector{Connector: base, pool: "test", sem: make(chan struct{}, 2)}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.Connect(context.Background())
+		}()
+	}
+	wg.Wait()
+	if got, want := base.maxActive, 2; got != want {
+		t.Errorf("max concurrent connects:\n  got: %v\n want: %v", got, want)
+	}
+	if got, want := testutil.ToFloat64(connectsFailed.WithLabelValues("test")), 10.0; got != want {
+		t.Errorf("failed connects:\n  got: %v\n want: %v", got, want)
+	}
+
+	// Waiting for permission to connect respects the context.
+	c.sem <- struct{}{}
+	c.sem <- struct{}{}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := c.Connect(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("connect with full semaphore: expected deadline exceeded, got %v", err)
+	}
+}
+
+func TestOpenDB(t *testing.T) {
+	if _, err := openDB("test", "this is not a valid :// dsn", &PoolConfig{}); err == nil {
+		t.Error("invalid dsn: expected error")
+	}
+	db, err := openDB("test", "postgres://localhost:1/jsso?connect_timeout=1", &PoolConfig{
+		MaxOpenConns:       3,
+		StatementTimeout:   time.Second,
+		StatementCacheSize: 0,
+	})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+	if got, want := db.Stats().MaxOpenConnections, 3; got != want {
+		t.Errorf("max open connections:\n  got: %v\n want: %v", got, want)
+	}
+	if got, want := testutil.CollectAndCount(poolStats), 9; got < want {
+		t.Errorf("pool metrics:\n  got: %v\n want: at least %v", got, want)
+	}
+}
+
+func TestCloseUnregistersConnConfig(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	c, err := newConnector("test", "postgres://localhost:1/jsso?connect_timeout=1", &PoolConfig{})
+	if err != nil {
+		t.Fatalf("new connector: %v", err)
+	}
+	// Connecting fails either way, but only for lack of a server while the config is registered.
+	if _, err := c.Connect(ctx); err == nil || strings.Contains(err.Error(), "cannot parse") {
+		t.Fatalf("connect with registered config: expected a connection error, got %v", err)
+	}
+	if err := sql.OpenDB(c).Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if _, err := c.Connect(ctx); err == nil || !strings.Contains(err.Error(), "cannot parse") {
+		t.Errorf("connect after close: expected the config to be unregistered, got %v", err)
+	}
+}
+
+func TestClosedPoolsStopExportingStats(t *testing.T) {
+	dsn := "postgres://localhost:1/jsso?connect_timeout=1"
+	old, err := openDB("test-close", dsn, &PoolConfig{})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	replacement, err := openDB("test-close", dsn, &PoolConfig{})
+	if err != nil {
+		t.Fatalf("open replacement db: %v", err)
+	}
+	// Closing a pool that has been replaced under the same name leaves the replacement alone.
+	if err := old.Close(); err != nil {
+		t.Fatalf("close old db: %v", err)
+	}
+	poolStats.Lock()
+	got := poolStats.pools["test-close"]
+	poolStats.Unlock()
+	if got != replacement {
+		t.Errorf("after closing the replaced pool: expected the replacement to still be exported")
+	}
+	if err := replacement.Close(); err != nil {
+		t.Fatalf("close replacement db: %v", err)
+	}
+	poolStats.Lock()
+	_, ok := poolStats.pools["test-close"]
+	poolStats.Unlock()
+	if ok {
+		t.Errorf("after closing the replacement: expected the pool to no longer be exported")
+	}
+}
@@ -0,0 +1,160 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+)
+
+// reaperLockID is the Postgres advisory lock that the reaper holds while deleting rows.  Only one
+// replica can hold it at a time.  (It's "jsso2" in ASCII.)
+const reaperLockID = 0x6a73736f32
+
+var (
+	reaperRuns = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "jsso2_reaper_runs",
+		Help: "Number of times the session reaper ran, by outcome.",
+	}, []string{"status"})
+	reaperSessionsDeleted = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "jsso2_reaper_sessions_deleted",
+		Help: "Number of sessions deleted by the session reaper.",
+	})
+	reaperNoncesDeleted = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "jsso2_reaper_nonces_deleted",
+		Help: "Number of expired used nonces deleted by the session reaper.",
+	})
+	reaperLastSuccess = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "jsso2_reaper_last_success_timestamp_seconds",
+		Help: "Unix time at which the session reaper last finished successfully.",
+	})
+)
+
+// ErrReaperLocked is returned when another replica is already reaping sessions.
+var ErrReaperLocked = errors.New("another replica holds the reaper lock")
+
+// ReaperConfig configures the background deletion of dead sessions and expired nonces.
+type ReaperConfig struct {
+	Interval                time.Duration `long:"reap_interval" env:"REAP_INTERVAL" default:"10m" description:"How often to delete dead sessions and expired nonces from the database.  0 disables the reaper."`
+	ExpiredSessionRetention time.Duration `long:"expired_session_retention" env:"EXPIRED_SESSION_RETENTION" default:"720h" description:"How long to keep expired or revoked sessions after they expire."`
+	AbandonedLoginRetention time.Duration `long:"abandoned_login_retention" env:"ABANDONED_LOGIN_RETENTION" default:"1h" description:"How long to keep sessions created by a login attempt that never finished."`
+	BatchSize               int           `long:"reap_batch_size" env:"REAP_BATCH_SIZE" default:"1000" description:"The maximum number of sessions, and of nonces, to delete in one transaction."`
+}
+
+// reapBatch deletes at most one batch of dead sessions and one batch of nonces that expired before
+// now, returning the number of each deleted.  Sessions referenced by a credential's
+// created_by_session_id are kept forever, since they are the only record of how that credential
+// was enrolled.
+func (c *Connection) reapBatch(ctx context.Context, l *zap.Logger, cfg *ReaperConfig, now time.Time) (int64, int64, error) {
+	var n, nonces int64
+	err := c.doTx(ctx, l, false, func(tx *sqlx.Tx) error {
+		var locked bool
+		if err := tx.QueryRowxContext(ctx, `select pg_try_advisory_xact_lock($1)`, reaperLockID).Scan(&locked); err != nil {
+			return fmt.Errorf("acquire advisory lock: %w", err)
+		}
+		if !locked {
+			return ErrReaperLocked
+		}
+		result, err := tx.ExecContext(ctx, `delete from session where id in (
+                select s.id from session s
+                where (s.expires_at < $1 or (s.taints @> '["start_login"]' and s.created_at < $2))
+                and not exists (select 1 from credential c where c.created_by_session_id = s.id)
+                limit $3
+            )`, now.Add(-cfg.ExpiredSessionRetention), now.Add(-cfg.AbandonedLoginRetention), cfg.BatchSize)
+		if err != nil {
+			return fmt.Errorf("delete sessions: %w", err)
+		}
+		n, err = result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("get affected rows: %w", err)
+		}
+		result, err = tx.ExecContext(ctx, `delete from used_nonce where nonce in (
+                select nonce from used_nonce where expires_at < $1 limit $2
+            )`, now, cfg.BatchSize)
+		if err != nil {
+			return fmt.Errorf("delete nonces: %w", err)
+		}
+		nonces, err = result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("get affected nonce rows: %w", err)
+		}
+		return nil
+	})
+	return n, nonces, err
+}
+
+// batchReaper is a store that can delete a batch of dead sessions and expired nonces.
+type batchReaper interface {
+	reapBatch(ctx context.Context, l *zap.Logger, cfg *ReaperConfig, now time.Time) (int64, int64, error)
+}
+
+// ReapSessions deletes expired, revoked, and abandoned sessions, and expired used nonces, in
+// batches until there is nothing left to delete.  It returns the number of sessions deleted, and
+// ErrReaperLocked if another replica is already doing this work.
+func (c *Connection) ReapSessions(ctx context.Context, l *zap.Logger, cfg *ReaperConfig) (int64, error) {
+	return reapSessions(ctx, l, c, cfg)
+}
+
+// RunReaper runs ReapSessions every cfg.Interval until the context is cancelled.
+func (c *Connection) RunReaper(ctx context.Context, l *zap.Logger, cfg *ReaperConfig) {
+	runReaper(ctx, l, c, cfg)
+}
+
+func reapSessions(ctx context.Context, l *zap.Logger, r batchReaper, cfg *ReaperConfig) (int64, error) {
+	if cfg.BatchSize < 1 {
+		return 0, fmt.Errorf("invalid batch size %d", cfg.BatchSize)
+	}
+	now := time.Now()
+	var total int64
+	for {
+		n, nonces, err := r.reapBatch(ctx, l, cfg, now)
+		total += n
+		reaperSessionsDeleted.Add(float64(n))
+		reaperNoncesDeleted.Add(float64(nonces))
+		if err != nil {
+			return total, err
+		}
+		if n < int64(cfg.BatchSize) && nonces < int64(cfg.BatchSize) {
+			return total, nil
+		}
+		select {
+		case <-ctx.Done():
+			return total, ctx.Err()
+		default:
+		}
+	}
+}
+
+func runReaper(ctx context.Context, l *zap.Logger, r batchReaper, cfg *ReaperConfig) {
+	if cfg.Interval <= 0 {
+		l.Info("session reaper disabled")
+		return
+	}
+	t := time.NewTicker(cfg.Interval)
+	defer t.Stop()
+	for {
+		n, err := reapSessions(ctx, l, r, cfg)
+		switch {
+		case errors.Is(err, ErrReaperLocked):
+			reaperRuns.WithLabelValues("locked").Inc()
+			l.Debug("another replica is reaping sessions", zap.Int64("deleted", n))
+		case err != nil:
+			reaperRuns.WithLabelValues("error").Inc()
+			l.Warn("problem reaping sessions", zap.Int64("deleted", n), zap.Error(err))
+		default:
+			reaperRuns.WithLabelValues("ok").Inc()
+			reaperLastSuccess.SetToCurrentTime()
+			l.Debug("reaped sessions", zap.Int64("deleted", n))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
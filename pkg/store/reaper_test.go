@@ -0,0 +1,125 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jrockway/jsso2/pkg/jtesting"
+	"github.com/jrockway/jsso2/pkg/sessions"
+	"github.com/jrockway/jsso2/pkg/types"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestReapSessions(t *testing.T) {
+	jtesting.Run(t, "reaper", jtesting.R{Logger: true, Database: true}, func(t *testing.T, e *jtesting.E) {
+		c := MustGetTestDB(t, e)
+		user := &types.User{Username: "test"}
+		if err := UpdateUser(e.Context, c.db, user); err != nil {
+			t.Fatal(err)
+		}
+		now := time.Now()
+		newSession := func(t *testing.T, created, expires time.Time, taints ...string) *types.Session {
+			t.Helper()
+			id, err := sessions.GenerateID()
+			if err != nil {
+				t.Fatal(err)
+			}
+			s := &types.Session{
+				Id:        id,
+				User:      user,
+				CreatedAt: timestamppb.New(created),
+				ExpiresAt: timestamppb.New(expires),
+				Taints:    taints,
+			}
+			if err := UpdateSession(e.Context, c.db, s); err != nil {
+				t.Fatal(err)
+			}
+			return s
+		}
+
+		valid := newSession(t, now.Add(-time.Hour), now.Add(time.Hour))
+		longExpired := newSession(t, now.Add(-72*time.Hour), now.Add(-48*time.Hour))
+		recentlyExpired := newSession(t, now.Add(-2*time.Hour), now.Add(-time.Minute))
+		abandonedLogin := newSession(t, now.Add(-2*time.Hour), now.Add(16*time.Hour), sessions.TaintStartLogin)
+		pendingLogin := newSession(t, now.Add(-time.Minute), now.Add(18*time.Hour), sessions.TaintStartLogin)
+		enrollment := newSession(t, now.Add(-72*time.Hour), now.Add(-48*time.Hour), sessions.TaintEnrollment)
+		if err := AddCredential(e.Context, c.db, &types.Credential{
+			User:               user,
+			CreatedBySessionId: enrollment.GetId(),
+			CreatedAt:          timestamppb.New(now.Add(-72 * time.Hour)),
+			CredentialId:       []byte("AAAAAAAAAAAAAAAA"),
+			PublicKey:          []byte("public key"),
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, nonce := range [][]byte{[]byte("expired nonce 01"), []byte("expired nonce 02")} {
+			if err := RedeemNonce(e.Context, c.db, nonce, now.Add(-time.Minute)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := RedeemNonce(e.Context, c.db, []byte("live nonce 00001"), now.Add(time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+
+		cfg := &ReaperConfig{
+			ExpiredSessionRetention: time.Hour,
+			AbandonedLoginRetention: time.Hour,
+			BatchSize:               1,
+		}
+		n, err := c.ReapSessions(e.Context, e.Logger, cfg)
+		if err != nil {
+			t.Fatalf("reap sessions: %v", err)
+		}
+		if got, want := n, int64(2); got != want {
+			t.Errorf("deleted sessions:\n  got: %v\n want: %v", got, want)
+		}
+
+		for _, test := range []struct {
+			name     string
+			session  *types.Session
+			wantKept bool
+		}{
+			{"valid", valid, true},
+			{"long expired", longExpired, false},
+			{"recently expired", recentlyExpired, true},
+			{"abandoned login", abandonedLogin, false},
+			{"pending login", pendingLogin, true},
+			{"referenced by credential", enrollment, true},
+		} {
+			_, err := getSession(e.Context, c.db, test.session.GetId())
+			if test.wantKept && err != nil {
+				t.Errorf("%s: expected session to be kept; got error %v", test.name, err)
+			}
+			if !test.wantKept && !errors.Is(err, sql.ErrNoRows) {
+				t.Errorf("%s: expected session to be deleted; got error %v", test.name, err)
+			}
+		}
+
+		var nonces int
+		if err := c.db.QueryRowxContext(e.Context, `select count(*) from used_nonce`).Scan(&nonces); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := nonces, 1; got != want {
+			t.Errorf("nonces left after reaping:\n  got: %v\n want: %v", got, want)
+		}
+
+		// Nothing should happen if another replica holds the lock.
+		tx, err := c.db.BeginTxx(e.Context, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer tx.Rollback()
+		if _, err := tx.ExecContext(e.Context, `select pg_advisory_xact_lock($1)`, reaperLockID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.ReapSessions(e.Context, e.Logger, cfg); !errors.Is(err, ErrReaperLocked) {
+			t.Errorf("reap sessions while locked: expected ErrReaperLocked, got %v", err)
+		}
+		if err := tx.Rollback(); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
@@ -0,0 +1,135 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+)
+
+var (
+	txRouted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "jsso2_db_tx_routed",
+		Help: "Number of transactions started via DoTx, by the pool they were sent to.",
+	}, []string{"pool"})
+	replicaLag = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "jsso2_db_replica_lag_seconds",
+		Help: "How far behind the primary the read replica was at the last check.",
+	})
+	replicaHealthy = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "jsso2_db_replica_healthy",
+		Help: "1 if read-only transactions are currently being sent to the read replica, 0 otherwise.",
+	})
+)
+
+type primaryKey struct{}
+
+// WithPrimary returns a context that causes all transactions started with it to use the primary
+// database, even if they are read-only.  Use it when a read must observe a write that was just
+// made, since the read replica may not have replayed it yet.
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+func primaryRequired(ctx context.Context) bool {
+	v, _ := ctx.Value(primaryKey{}).(bool)
+	return v
+}
+
+// usesReplica returns true if a transaction started with the provided context and read-only flag
+// would be sent to the read replica.
+func (c *Connection) usesReplica(ctx context.Context, readOnly bool) bool {
+	return readOnly && c.replica != nil && atomic.LoadInt32(&c.replicaOK) == 1 && !primaryRequired(ctx)
+}
+
+// dbFor returns the database that a transaction should run against, and the options it should be
+// started with.  Hot standbys don't support serializable transactions, but since transactions sent
+// to the replica are read-only, repeatable read gives the same guarantees.
+func (c *Connection) dbFor(ctx context.Context, readOnly bool) (*sqlx.DB, *sql.TxOptions, string) {
+	if c.usesReplica(ctx, readOnly) {
+		return c.replica, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true}, "replica"
+	}
+	return c.db, &sql.TxOptions{Isolation: sql.LevelSerializable, ReadOnly: readOnly}, "primary"
+}
+
+// markReplica records whether or not the replica should be used.
+func (c *Connection) markReplica(ok bool) {
+	if ok {
+		atomic.StoreInt32(&c.replicaOK, 1)
+		replicaHealthy.Set(1)
+	} else {
+		atomic.StoreInt32(&c.replicaOK, 0)
+		replicaHealthy.Set(0)
+	}
+}
+
+// checkReplica measures the replica's replication lag and marks it healthy or unhealthy.
+func (c *Connection) checkReplica(ctx context.Context, l *zap.Logger, maxLag time.Duration) {
+	var lag sql.NullFloat64
+	// pg_last_xact_replay_timestamp is null on a primary (or a replica that hasn't replayed
+	// anything yet); on an idle system it grows even though nothing is missing, which just
+	// sends reads to the primary until the next write is replayed.
+	err := c.replica.QueryRowxContext(ctx, `select extract(epoch from now() - pg_last_xact_replay_timestamp())`).Scan(&lag)
+	switch {
+	case err != nil:
+		l.Debug("problem checking replica lag; using primary for reads", zap.Error(err))
+		c.markReplica(false)
+	case !lag.Valid:
+		l.Debug("replica has not replayed any transactions; using primary for reads")
+		c.markReplica(false)
+	default:
+		replicaLag.Set(lag.Float64)
+		d := time.Duration(lag.Float64 * float64(time.Second))
+		if d > maxLag {
+			l.Debug("replica is lagging; using primary for reads", zap.Duration("lag", d), zap.Duration("max_lag", maxLag))
+		}
+		c.markReplica(d <= maxLag)
+	}
+}
+
+// MonitorReplica periodically checks the read replica's replication lag, routing read-only
+// transactions to it only while it is no more than cfg.MaxReplicaLag behind the primary.  Until
+// the first check succeeds, all transactions go to the primary.  It returns when the context is
+// cancelled.
+func (c *Connection) MonitorReplica(ctx context.Context, l *zap.Logger, cfg *Config) {
+	if c.replica == nil {
+		return
+	}
+	t := time.NewTicker(cfg.ReplicaCheckInterval)
+	defer t.Stop()
+	for {
+		checkCtx, cancel := context.WithTimeout(ctx, cfg.ReplicaCheckInterval)
+		c.checkReplica(checkCtx, l, cfg.MaxReplicaLag)
+		cancel()
+		select {
+		case <-ctx.Done():
+			c.markReplica(false)
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// connectReplica opens the pool of connections to the read replica, if one is configured.  The
+// replica is not used until MonitorReplica has checked it.
+func (c *Connection) connectReplica(cfg *Config) error {
+	if cfg.ReplicaDatabaseURL == "" {
+		return nil
+	}
+	if cfg.ReplicaCheckInterval <= 0 {
+		return fmt.Errorf("replica_check_interval must be positive; got %v", cfg.ReplicaCheckInterval)
+	}
+	db, err := openDB("replica", cfg.ReplicaDatabaseURL, &cfg.PoolConfig)
+	if err != nil {
+		return fmt.Errorf("open replica: %w", err)
+	}
+	c.replica = sqlx.NewDb(db, "pgx")
+	c.replicaDelay = cfg.MaxReplicaLag + cfg.ReplicaCheckInterval
+	return nil
+}
@@ -0,0 +1,111 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/jrockway/jsso2/pkg/jtesting"
+	"github.com/jrockway/jsso2/pkg/sessions"
+	"github.com/jrockway/jsso2/pkg/types"
+)
+
+func TestDBFor(t *testing.T) {
+	// Neither of these databases exist, but nothing connects until a query is made.
+	primary, err := sqlx.Open("pgx", "postgres://localhost:1/primary")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer primary.Close()
+	replica, err := sqlx.Open("pgx", "postgres://localhost:1/replica")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer replica.Close()
+	ctx := context.Background()
+
+	testData := []struct {
+		name        string
+		replica     *sqlx.DB
+		healthy     bool
+		ctx         context.Context
+		readOnly    bool
+		wantPool    string
+		wantIsolate sql.IsolationLevel
+	}{
+		{"no replica", nil, false, ctx, true, "primary", sql.LevelSerializable},
+		{"unhealthy replica", replica, false, ctx, true, "primary", sql.LevelSerializable},
+		{"read-write", replica, true, ctx, false, "primary", sql.LevelSerializable},
+		{"read-only", replica, true, ctx, true, "replica", sql.LevelRepeatableRead},
+		{"primary required", replica, true, WithPrimary(ctx), true, "primary", sql.LevelSerializable},
+	}
+	for _, test := range testData {
+		t.Run(test.name, func(t *testing.T) {
+			c := &Connection{db: primary, replica: test.replica}
+			c.markReplica(test.healthy)
+			db, opts, pool := c.dbFor(test.ctx, test.readOnly)
+			if got, want := pool, test.wantPool; got != want {
+				t.Errorf("pool:\n  got: %v\n want: %v", got, want)
+			}
+			if got, want := db == replica, test.wantPool == "replica"; got != want {
+				t.Errorf("returned replica:\n  got: %v\n want: %v", got, want)
+			}
+			if got, want := opts.Isolation, test.wantIsolate; got != want {
+				t.Errorf("isolation:\n  got: %v\n want: %v", got, want)
+			}
+			if got, want := opts.ReadOnly, test.readOnly; got != want {
+				t.Errorf("read only:\n  got: %v\n want: %v", got, want)
+			}
+		})
+	}
+}
+
+func TestReplicaFallback(t *testing.T) {
+	jtesting.Run(t, "replica", jtesting.R{Logger: true, Database: true}, func(t *testing.T, e *jtesting.E) {
+		c := MustGetTestDB(t, e)
+
+		// The test database is not a replica, so it should never be considered healthy.
+		c.replica = c.db
+		c.markReplica(true)
+		c.checkReplica(e.Context, e.Logger, time.Hour)
+		if c.usesReplica(e.Context, true) {
+			t.Error("primary passed the replica lag check")
+		}
+
+		// Pretend it's a replica, and check that tainted sessions are re-read from the
+		// primary, and that both kinds of reads are cached.
+		c.markReplica(true)
+		c.replicaDelay = time.Minute
+		c.EnableSessionCache(10, time.Hour)
+		c.cache.setEnabled(true)
+		c.cache.flushedAt = time.Now().Add(-time.Hour)
+		user := &types.User{Username: "test"}
+		if err := UpdateUser(e.Context, c.db, user); err != nil {
+			t.Fatal(err)
+		}
+		now := time.Now()
+		valid := addTestSession(t, e, c, user, now.Add(-time.Minute), now.Add(time.Hour))
+		tainted := addTestSession(t, e, c, user, now.Add(-time.Minute), now.Add(time.Hour), sessions.TaintStartLogin)
+		got, errs := c.AuthenticateUser(e.Context, e.Logger, []*types.Session{{Id: valid.GetId()}, {Id: tainted.GetId()}}, nil, nil)
+		if got == nil {
+			t.Fatalf("authenticate: %v", errs)
+		}
+		if _, ok := c.cache.get(valid.GetId()); !ok {
+			t.Error("session read from replica was not cached")
+		}
+		if _, ok := c.cache.get(tainted.GetId()); !ok {
+			t.Error("session re-read from primary was not cached")
+		}
+
+		// A session that just changed might be stale on the replica, so it isn't cached.
+		c.cache.invalidateSession(valid.GetId())
+		if got, errs := c.AuthenticateUser(e.Context, e.Logger, []*types.Session{{Id: valid.GetId()}}, nil, nil); got == nil {
+			t.Fatalf("authenticate after invalidation: %v", errs)
+		}
+		if _, ok := c.cache.get(valid.GetId()); ok {
+			t.Error("recently changed session read from replica was cached")
+		}
+	})
+}
@@ -3,6 +3,7 @@ package store
 import (
 	"bytes"
 	"context"
+	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -29,17 +30,8 @@ type rawSession struct {
 
 // UpdateSession writes a session to the database.
 func UpdateSession(ctx context.Context, db sqlx.ExtContext, s *types.Session) error {
-	if s == nil {
-		return &ErrEmpty{Field: "session"}
-	}
-	if s.GetUser() == nil {
-		return &ErrEmpty{Field: "session.user"}
-	}
-	if s.GetUser().GetId() < 1 {
-		return &ErrEmpty{Field: "session.user.id"}
-	}
-	if sessions.IsZero(s.GetId()) {
-		return &ErrEmpty{Field: "session.id"}
+	if err := checkUpdateSession(s); err != nil {
+		return err
 	}
 	obj, err := fromSession(s)
 	if err != nil {
@@ -56,6 +48,24 @@ func UpdateSession(ctx context.Context, db sqlx.ExtContext, s *types.Session) er
 	return nil
 }
 
+// checkUpdateSession returns an error if a session passed to UpdateSession is missing required
+// fields.
+func checkUpdateSession(s *types.Session) error {
+	if s == nil {
+		return &ErrEmpty{Field: "session"}
+	}
+	if s.GetUser() == nil {
+		return &ErrEmpty{Field: "session.user"}
+	}
+	if s.GetUser().GetId() < 1 {
+		return &ErrEmpty{Field: "session.user.id"}
+	}
+	if sessions.IsZero(s.GetId()) {
+		return &ErrEmpty{Field: "session.id"}
+	}
+	return nil
+}
+
 func fromSession(s *types.Session) (*rawSession, error) {
 	result := &rawSession{}
 
@@ -129,21 +139,177 @@ func LookupSession(ctx context.Context, db sqlx.ExtContext, id []byte) (*types.S
 	if err != nil {
 		return nil, fmt.Errorf("read session: %w", err)
 	}
+	if err := checkSessionTimes(session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// checkSessionTimes returns an error if the session is not valid at the current time.
+func checkSessionTimes(session *types.Session) error {
 	if session.GetExpiresAt().AsTime().Before(time.Now()) {
-		return nil, ErrSessionExpired
+		return ErrSessionExpired
 	}
 	if session.GetCreatedAt().AsTime().After(time.Now()) {
-		return nil, ErrSessionNotYetCreated
+		return ErrSessionNotYetCreated
 	}
-	return session, nil
+	return nil
+}
+
+// getSessions reads every session with one of the provided IDs in a single query, returning them
+// keyed by ID.  IDs that don't exist are absent from the result.
+func getSessions(ctx context.Context, db sqlx.ExtContext, ids [][]byte) (map[string]*types.Session, error) {
+	result := make(map[string]*types.Session, len(ids))
+	if len(ids) == 0 {
+		return result, nil
+	}
+	rows, err := db.QueryxContext(ctx, `select
+            s.id AS id, s.metadata AS metadata, s.taints AS taints, s.created_at AS created_at, s.expires_at AS expires_at,
+            u.id AS user_id, u.username as username
+            from session s left join "user" u on u.id=s.user_id where s.id=any($1)`, ids)
+	if err != nil {
+		return nil, fmt.Errorf("select: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		raw := &rawSession{}
+		if err := rows.StructScan(raw); err != nil {
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+		session, err := raw.toSession()
+		if err != nil {
+			return nil, fmt.Errorf("convert to *types.Session: %w", err)
+		}
+		result[string(session.GetId())] = session
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate over rows: %w", err)
+	}
+	return result, nil
+}
+
+// readSessions reads the sessions with the provided IDs in a read-only transaction.
+func (c *Connection) readSessions(ctx context.Context, l *zap.Logger, ids [][]byte) (map[string]*types.Session, error) {
+	var result map[string]*types.Session
+	if err := c.doTx(ctx, l, true, func(tx *sqlx.Tx) error {
+		var err error
+		result, err = getSessions(ctx, tx, ids)
+		if err != nil {
+			return fmt.Errorf("read sessions: %w", err)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// betterSession returns true if a should be preferred over b when a request presents both.
+// Untainted sessions win, then newer sessions; the session ID breaks any remaining tie so that the
+// choice is deterministic.
+func betterSession(a, b *types.Session) bool {
+	if ta, tb := len(a.GetTaints()) == 0, len(b.GetTaints()) == 0; ta != tb {
+		return ta
+	}
+	if ca, cb := a.GetCreatedAt().AsTime(), b.GetCreatedAt().AsTime(); !ca.Equal(cb) {
+		return ca.After(cb)
+	}
+	return bytes.Compare(a.GetId(), b.GetId()) < 0
 }
 
 // AuthenticateUser checks the database for a valid session in the provided sessions.  The provided
-// sessions need only contain a session ID.  Each lookup is done in a separate transaction.
+// sessions need only contain a session ID.  Sessions are served from the session cache if possible,
+// and the rest are read in a single query, from the read replica if one is in use.  Sessions that
+// the replica reports as missing, invalid, or tainted are re-read from the primary, since the
+// replica may simply not have caught up yet.  Valid sessions from the replica are cached unless
+// they changed recently enough that the replica might not have seen the change; see
+// sessionCache.addReplicated.  If more than one session is valid, the best one according to
+// betterSession is returned.
 func (c *Connection) AuthenticateUser(ctx context.Context, l *zap.Logger, ss []*types.Session, unusedHeaders []*sessions.UnusedHeader, unusedCookies []*sessions.UnusedCookie) (*types.Session, []error) {
-	var errs []error
+	errs := unusedMaterialErrors(unusedHeaders, unusedCookies)
+	if len(ss) == 0 {
+		errs = append(errs, errors.New("no sessions provided"))
+		return nil, errs
+	}
+
+	// Resolve as many sessions as possible from the cache, and collect the IDs of the rest.
+	found := make([]*types.Session, len(ss))
+	sessionErrs := make([]error, len(ss))
+	var gen uint64
+	if c.cache != nil {
+		gen = c.cache.generation()
+	}
+	var missing [][]byte
+	for i, s := range ss {
+		id := s.GetId()
+		if len(id) != 64 {
+			sessionErrs[i] = fmt.Errorf("session id %s: %w", id, ErrSessionIDInvalid)
+			continue
+		}
+		if c.cache != nil {
+			if session, ok := c.cache.get(id); ok {
+				found[i] = session
+				continue
+			}
+		}
+		missing = append(missing, id)
+	}
 
-	// Collect errors about unused authentication material.
+	// Read the remaining sessions from the database.
+	if len(missing) > 0 {
+		readAt := time.Now()
+		onReplica := c.usesReplica(ctx, true)
+		fromDB, err := c.readSessions(ctx, l, missing)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("lookup %d session(s): %v", len(missing), err))
+		}
+		fromPrimary := fromDB
+		if err == nil && onReplica {
+			// The replica may not have replayed a session that was just created or
+			// untainted, so re-read anything that looks unusable from the primary.
+			var recheck [][]byte
+			for _, id := range missing {
+				if session, ok := fromDB[string(id)]; !ok || len(session.GetTaints()) > 0 || checkSessionTimes(session) != nil {
+					recheck = append(recheck, id)
+				}
+			}
+			fromPrimary = nil
+			if len(recheck) > 0 {
+				fromPrimary, err = c.readSessions(WithPrimary(ctx), l, recheck)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("lookup %d session(s) on primary: %v", len(recheck), err))
+				}
+				for id, session := range fromPrimary {
+					fromDB[id] = session
+				}
+			}
+		}
+		for i, s := range ss {
+			if found[i] != nil || len(s.GetId()) != 64 {
+				continue
+			}
+			if session, ok := fromDB[string(s.GetId())]; ok {
+				found[i] = session
+				if c.cache != nil {
+					if _, ok := fromPrimary[string(s.GetId())]; ok {
+						c.cache.add(session, gen)
+					} else {
+						c.cache.addReplicated(session, gen, readAt)
+					}
+				}
+			} else if fromDB != nil {
+				sessionErrs[i] = fmt.Errorf("read session: %w", sql.ErrNoRows)
+			}
+		}
+	}
+
+	return chooseSession(ss, found, sessionErrs, errs)
+}
+
+// unusedMaterialErrors returns errors about authentication material that could not be parsed into
+// a session.
+func unusedMaterialErrors(unusedHeaders []*sessions.UnusedHeader, unusedCookies []*sessions.UnusedCookie) []error {
+	var errs []error
 	for _, u := range unusedHeaders {
 		if u.Err != nil && !errors.Is(u.Err, sessions.ErrUnknownAuthType) {
 			errs = append(errs, fmt.Errorf("spurious unparseable authorization header %q: %v", u.Value, u.Err))
@@ -154,30 +320,33 @@ func (c *Connection) AuthenticateUser(ctx context.Context, l *zap.Logger, ss []*
 			errs = append(errs, fmt.Errorf("spurious unparseable session cookie %q: %v", u.Cookie.String(), u.Err))
 		}
 	}
-	if len(ss) == 0 {
-		errs = append(errs, errors.New("no sessions provided"))
-		return nil, errs
-	}
+	return errs
+}
 
-	// Check for all sessions for validity.
-	for i, s := range ss {
-		if err := c.DoTx(ctx, l, true, func(tx *sqlx.Tx) error {
-			var err error
-			session, err := LookupSession(ctx, tx, s.GetId())
-			if err != nil {
-				return fmt.Errorf("lookup session: %w", err)
-			}
-			ss[i] = session
-			return nil
-		}); err != nil {
-			ss[i] = nil
-			errs = append(errs, fmt.Errorf("validate session %d/%d: %v", i+1, len(ss), err))
+// chooseSession returns the best valid session in found, which holds the stored version of each
+// session in ss (or nil if it couldn't be read, with the reason in the same position in
+// sessionErrs).  If there is no valid session, errs is returned with an error for each session
+// appended.
+func chooseSession(ss, found []*types.Session, sessionErrs, errs []error) (*types.Session, []error) {
+	var best *types.Session
+	for i, session := range found {
+		if session == nil {
+			continue
+		}
+		if err := checkSessionTimes(session); err != nil {
+			sessionErrs[i] = err
+			continue
+		}
+		if best == nil || betterSession(session, best) {
+			best = session
 		}
 	}
-	// Look for at least one valid session.
-	for _, s := range ss {
-		if s != nil {
-			return s, nil
+	if best != nil {
+		return best, nil
+	}
+	for i, err := range sessionErrs {
+		if err != nil {
+			errs = append(errs, fmt.Errorf("validate session %d/%d: %v", i+1, len(ss), err))
 		}
 	}
 	return nil, errs
@@ -189,17 +358,25 @@ func RevokeSession(ctx context.Context, tx *sqlx.Tx, id []byte, reason string) e
 	if err != nil {
 		return fmt.Errorf("refresh session: %w", err)
 	}
-	if time.Until(session.ExpiresAt.AsTime()) < 0 {
-		// Already expired.
+	if !revoke(session, reason) {
 		return nil
 	}
+	if err := UpdateSession(ctx, tx, session); err != nil {
+		return fmt.Errorf("store expired session: %w", err)
+	}
+	return nil
+}
 
+// revoke expires the session now, recording the reason it was revoked.  It returns false if the
+// session has already expired and does not need to be updated.
+func revoke(session *types.Session, reason string) bool {
+	if time.Until(session.ExpiresAt.AsTime()) < 0 {
+		// Already expired.
+		return false
+	}
 	if session.GetMetadata().GetRevocationReason() == "" {
 		session.GetMetadata().RevocationReason = reason
 	}
 	session.ExpiresAt = timestamppb.Now()
-	if err := UpdateSession(ctx, tx, session); err != nil {
-		return fmt.Errorf("store expired session: %w", err)
-	}
-	return nil
+	return true
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"regexp"
 	"testing"
 	"time"
@@ -13,6 +14,7 @@ import (
 	"github.com/jrockway/jsso2/pkg/jtesting"
 	"github.com/jrockway/jsso2/pkg/sessions"
 	"github.com/jrockway/jsso2/pkg/types"
+	"go.uber.org/zap"
 	"google.golang.org/protobuf/testing/protocmp"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
@@ -154,7 +156,7 @@ func TestSessions(t *testing.T) {
 		}
 
 		// Try expiring the original session.
-		if err := c.DoTx(e.Context, e.Logger, false, func(tx *sqlx.Tx) error {
+		if err := c.doTx(e.Context, e.Logger, false, func(tx *sqlx.Tx) error {
 			return RevokeSession(e.Context, tx, session.GetId(), "revoked")
 		}); err != nil {
 			t.Fatal(err)
@@ -166,10 +168,183 @@ func TestSessions(t *testing.T) {
 		}
 
 		// Ensure it's possible to expire an expired session.
-		if err := c.DoTx(e.Context, e.Logger, false, func(tx *sqlx.Tx) error {
+		if err := c.doTx(e.Context, e.Logger, false, func(tx *sqlx.Tx) error {
 			return RevokeSession(e.Context, tx, session.GetId(), "revoked")
 		}); err != nil {
 			t.Fatal(err)
 		}
 	})
 }
+
+func TestBetterSession(t *testing.T) {
+	now := time.Now()
+	older := &types.Session{Id: []byte{1}, CreatedAt: timestamppb.New(now.Add(-time.Hour))}
+	newer := &types.Session{Id: []byte{2}, CreatedAt: timestamppb.New(now)}
+	tainted := &types.Session{Id: []byte{3}, CreatedAt: timestamppb.New(now.Add(time.Hour)), Taints: []string{"foo"}}
+	twin := &types.Session{Id: []byte{4}, CreatedAt: timestamppb.New(now)}
+
+	testData := []struct {
+		name string
+		a, b *types.Session
+		want bool
+	}{
+		{"newer over older", newer, older, true},
+		{"older over newer", older, newer, false},
+		{"untainted over tainted", older, tainted, true},
+		{"tainted over untainted", tainted, older, false},
+		{"lower id breaks tie", newer, twin, true},
+		{"higher id breaks tie", twin, newer, false},
+	}
+	for _, test := range testData {
+		t.Run(test.name, func(t *testing.T) {
+			if got, want := betterSession(test.a, test.b), test.want; got != want {
+				t.Errorf("betterSession:\n  got: %v\n want: %v", got, want)
+			}
+		})
+	}
+}
+
+// addTestSession adds a session for the provided user with the provided times and taints.
+func addTestSession(t testing.TB, e *jtesting.E, c *Connection, user *types.User, created, expires time.Time, taints ...string) *types.Session {
+	t.Helper()
+	id, err := sessions.GenerateID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &types.Session{
+		Id:        id,
+		User:      user,
+		Metadata:  &types.SessionMetadata{},
+		CreatedAt: timestamppb.New(created.Round(time.Millisecond)),
+		ExpiresAt: timestamppb.New(expires.Round(time.Millisecond)),
+		Taints:    taints,
+	}
+	if err := UpdateSession(e.Context, c.db, s); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestAuthenticateUser(t *testing.T) {
+	jtesting.Run(t, "authenticate", jtesting.R{Logger: true, Database: true}, func(t *testing.T, e *jtesting.E) {
+		c := MustGetTestDB(t, e)
+		user := &types.User{Username: "test"}
+		if err := UpdateUser(e.Context, c.db, user); err != nil {
+			t.Fatal(err)
+		}
+		now := time.Now()
+		expired := addTestSession(t, e, c, user, now.Add(-2*time.Hour), now.Add(-time.Hour))
+		older := addTestSession(t, e, c, user, now.Add(-time.Hour), now.Add(time.Hour))
+		newer := addTestSession(t, e, c, user, now.Add(-time.Minute), now.Add(time.Hour))
+		tainted := addTestSession(t, e, c, user, now, now.Add(time.Hour), sessions.TaintStartLogin)
+		unknownID, err := sessions.GenerateID()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		testData := []struct {
+			name     string
+			ids      [][]byte
+			want     *types.Session
+			wantErrs []string
+		}{
+			{
+				name:     "no valid sessions",
+				ids:      [][]byte{expired.GetId(), unknownID, []byte("short")},
+				wantErrs: []string{"validate session 1/3: .*expired", "validate session 2/3: .*no rows", "validate session 3/3: .*invalid"},
+			},
+			{
+				name: "one valid session among stale ones",
+				ids:  [][]byte{expired.GetId(), unknownID, older.GetId()},
+				want: older,
+			},
+			{
+				name: "newest session wins",
+				ids:  [][]byte{older.GetId(), newer.GetId()},
+				want: newer,
+			},
+			{
+				name: "untainted session wins",
+				ids:  [][]byte{tainted.GetId(), older.GetId()},
+				want: older,
+			},
+			{
+				name: "tainted session is better than nothing",
+				ids:  [][]byte{expired.GetId(), tainted.GetId()},
+				want: tainted,
+			},
+		}
+		for _, test := range testData {
+			t.Run(test.name, func(t *testing.T) {
+				var ss []*types.Session
+				for _, id := range test.ids {
+					ss = append(ss, &types.Session{Id: id})
+				}
+				got, errs := c.AuthenticateUser(e.Context, e.Logger, ss, nil, nil)
+				if diff := cmp.Diff(got, test.want, protocmp.Transform()); diff != "" {
+					t.Errorf("session:\n%s", diff)
+				}
+				if got, want := len(errs), len(test.wantErrs); got != want {
+					t.Fatalf("errors: %v\n  got %d errors, want %d", errs, got, want)
+				}
+				for i, err := range errs {
+					if ok, _ := regexp.MatchString(test.wantErrs[i], err.Error()); !ok {
+						t.Errorf("error %d:\n  got: %v\n want: /%v/", i, err, test.wantErrs[i])
+					}
+				}
+			})
+		}
+	})
+}
+
+func BenchmarkAuthenticateUser(b *testing.B) {
+	jtesting.RunBenchmark(b, "authenticate", jtesting.R{Database: true}, func(b *testing.B, e *jtesting.E) {
+		c, err := Wrap(e.Context, e.DB)
+		if err != nil {
+			b.Fatalf("wrap: %v", err)
+		}
+		if err := c.MigrateDB(e.Context); err != nil {
+			b.Fatalf("migrate: %v", err)
+		}
+		l := zap.NewNop()
+		user := &types.User{Username: "test"}
+		if err := UpdateUser(e.Context, c.db, user); err != nil {
+			b.Fatal(err)
+		}
+		now := time.Now()
+		valid := addTestSession(b, e, c, user, now, now.Add(time.Hour))
+		var stale []*types.Session
+		for i := 0; i < 7; i++ {
+			stale = append(stale, addTestSession(b, e, c, user, now.Add(-2*time.Hour), now.Add(-time.Hour)))
+		}
+
+		for _, n := range []int{1, 2, 4, 8} {
+			for _, cache := range []bool{false, true} {
+				name := fmt.Sprintf("sessions=%d/cache=%v", n, cache)
+				b.Run(name, func(b *testing.B) {
+					c.cache = nil
+					if cache {
+						// The listener isn't running, so enable the cache directly.
+						c.EnableSessionCache(100, time.Hour)
+						c.cache.setEnabled(true)
+					}
+					ids := [][]byte{valid.GetId()}
+					for _, s := range stale[:n-1] {
+						ids = append(ids, s.GetId())
+					}
+					b.ResetTimer()
+					for i := 0; i < b.N; i++ {
+						ss := make([]*types.Session, len(ids))
+						for j, id := range ids {
+							ss[j] = &types.Session{Id: id}
+						}
+						if got, errs := c.AuthenticateUser(e.Context, l, ss, nil, nil); got == nil {
+							b.Fatalf("authenticate: %v", errs)
+						}
+					}
+				})
+			}
+		}
+		c.cache = nil
+	})
+}
@@ -0,0 +1,704 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/jrockway/jsso2/pkg/sessions"
+	"github.com/jrockway/jsso2/pkg/types"
+	"go.uber.org/zap"
+	_ "modernc.org/sqlite" // Pure Go, so the binary can still be built with CGO_ENABLED=0.
+)
+
+const sqliteScheme = "sqlite:"
+
+// SQLite is a Store backed by a SQLite database file, for small deployments where running Postgres
+// is overkill.  Select it with a database_url like "sqlite:///var/lib/jsso2/jsso2.db".
+//
+// Read-write transactions begin with BEGIN IMMEDIATE, so they run one at a time, and the database
+// runs in WAL mode, so read-only transactions see a consistent snapshot without blocking writers.
+// Together, these give the same serializable semantics as DoTx against Postgres.
+type SQLite struct {
+	db          *sqlx.DB
+	retry       RetryConfig
+	auditEvents broadcaster
+}
+
+var _ Store = (*SQLite)(nil)
+
+// IsSQLiteURL returns true if the provided database URL refers to a SQLite database.
+func IsSQLiteURL(u string) bool {
+	return strings.HasPrefix(u, sqliteScheme)
+}
+
+// sqliteDSN converts a URL like sqlite:///path/to/db or sqlite:relative/path to a DSN for the
+// SQLite driver, adding the options that the SQLite store depends on.  Query parameters in the URL
+// are passed to the driver.
+func sqliteDSN(u string) (string, error) {
+	if !IsSQLiteURL(u) {
+		return "", fmt.Errorf("%q is not a sqlite: URL", u)
+	}
+	path := strings.TrimPrefix(strings.TrimPrefix(u, sqliteScheme), "//")
+	var query string
+	if i := strings.IndexByte(path, '?'); i >= 0 {
+		path, query = path[:i], path[i+1:]
+	}
+	if path == "" {
+		return "", fmt.Errorf("%q does not include the path to a database file", u)
+	}
+	q, err := url.ParseQuery(query)
+	if err != nil {
+		return "", fmt.Errorf("parse query parameters: %w", err)
+	}
+	q.Add("_pragma", "foreign_keys(1)")
+	q.Add("_pragma", "journal_mode(wal)")
+	q.Add("_pragma", "busy_timeout(5000)")
+	q.Set("_txlock", "immediate")
+	return path + "?" + q.Encode(), nil
+}
+
+// ConnectSQLite opens the SQLite database named by cfg.DatabaseURL, creating it if necessary.
+func ConnectSQLite(ctx context.Context, cfg *Config) (*SQLite, error) {
+	if cfg.ReplicaDatabaseURL != "" {
+		return nil, errors.New("read replicas are not supported with SQLite")
+	}
+	if cfg.MaxAttempts < 1 {
+		return nil, fmt.Errorf("tx_max_attempts must be at least 1; got %d", cfg.MaxAttempts)
+	}
+	dsn, err := sqliteDSN(cfg.DatabaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("parse database url: %w", err)
+	}
+	db, err := sqlx.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("open database: %w", err)
+	}
+	// The "sqlite3" name tells sqlx to use ? placeholders.
+	db = sqlx.NewDb(db.DB, "sqlite3")
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("ping: %w", err)
+	}
+	return &SQLite{db: db, retry: cfg.RetryConfig}, nil
+}
+
+// Close closes the underlying database.
+func (s *SQLite) Close() error {
+	return s.db.Close()
+}
+
+// DoTx implements Store.
+func (s *SQLite) DoTx(ctx context.Context, l *zap.Logger, readOnly bool, f func(tx Tx) error) error {
+	var added bool
+	if err := s.doTx(ctx, l, readOnly, func(tx *sqlx.Tx) error {
+		t := &sqliteTx{tx: tx, readOnly: readOnly}
+		err := f(t)
+		added = t.addedAuditEvent
+		return err
+	}); err != nil {
+		return err
+	}
+	if added {
+		s.auditEvents.broadcast()
+	}
+	return nil
+}
+
+func (s *SQLite) doTx(ctx context.Context, l *zap.Logger, readOnly bool, f func(tx *sqlx.Tx) error) error {
+	return runTx(ctx, l, &s.retry, func(ctx context.Context) (*sqlx.Tx, error) {
+		return s.db.BeginTxx(ctx, &sql.TxOptions{ReadOnly: readOnly})
+	}, f)
+}
+
+// AuthenticateUser implements Store.
+func (s *SQLite) AuthenticateUser(ctx context.Context, l *zap.Logger, ss []*types.Session, unusedHeaders []*sessions.UnusedHeader, unusedCookies []*sessions.UnusedCookie) (*types.Session, []error) {
+	errs := unusedMaterialErrors(unusedHeaders, unusedCookies)
+	if len(ss) == 0 {
+		errs = append(errs, errors.New("no sessions provided"))
+		return nil, errs
+	}
+
+	found := make([]*types.Session, len(ss))
+	sessionErrs := make([]error, len(ss))
+	var ids [][]byte
+	for i, session := range ss {
+		if id := session.GetId(); len(id) != 64 {
+			sessionErrs[i] = fmt.Errorf("session id %s: %w", id, ErrSessionIDInvalid)
+			continue
+		}
+		ids = append(ids, session.GetId())
+	}
+	if len(ids) > 0 {
+		var fromDB map[string]*types.Session
+		if err := s.doTx(ctx, l, true, func(tx *sqlx.Tx) (err error) {
+			fromDB, err = getSQLiteSessions(ctx, tx, ids)
+			return
+		}); err != nil {
+			errs = append(errs, fmt.Errorf("lookup %d session(s): %v", len(ids), err))
+		}
+		for i, session := range ss {
+			if sessionErrs[i] != nil {
+				continue
+			}
+			if stored, ok := fromDB[string(session.GetId())]; ok {
+				found[i] = stored
+			} else if fromDB != nil {
+				sessionErrs[i] = fmt.Errorf("read session: %w", sql.ErrNoRows)
+			}
+		}
+	}
+	return chooseSession(ss, found, sessionErrs, errs)
+}
+
+// toMillis converts a timestamp to milliseconds since the Unix epoch, which is how the SQLite
+// schema stores times.  Times too far in the past or future to represent are clamped.  Times are
+// truncated, not rounded, so that a session created "now" isn't stored as created in the future.
+func toMillis(t time.Time) int64 {
+	const maxSeconds = math.MaxInt64/1000 - 1
+	if s := t.Unix(); s > maxSeconds {
+		return math.MaxInt64
+	} else if s < -maxSeconds {
+		return math.MinInt64
+	}
+	t = t.Truncate(time.Millisecond)
+	return t.Unix()*1000 + int64(t.Nanosecond()/int(time.Millisecond))
+}
+
+func fromMillis(ms int64) time.Time {
+	return time.Unix(ms/1000, (ms%1000)*int64(time.Millisecond))
+}
+
+// sqliteTx implements Tx for SQLite.
+type sqliteTx struct {
+	tx       *sqlx.Tx
+	readOnly bool
+
+	addedAuditEvent bool // Whether to wake up SubscribeAuditEvents subscribers after commit.
+}
+
+func (t *sqliteTx) LookupUser(ctx context.Context, user *types.User) error {
+	if id := user.GetId(); id != 0 {
+		if err := t.tx.QueryRowxContext(ctx, `select username from "user" where id=?`, id).Scan(&user.Username); err != nil {
+			return fmt.Errorf("get user by id: %w", err)
+		}
+		return nil
+	}
+	if username := user.GetUsername(); username != "" {
+		if err := t.tx.QueryRowxContext(ctx, `select id from "user" where username=?`, username).Scan(&user.Id); err != nil {
+			return fmt.Errorf("get user by username: %w", err)
+		}
+		return nil
+	}
+	return &ErrEmpty{Field: "(oneof:user.id,user.username)"}
+}
+
+func (t *sqliteTx) UpdateUser(ctx context.Context, user *types.User) error {
+	if user.Username == "" {
+		return &ErrEmpty{Field: "username"}
+	}
+	if t.readOnly {
+		return errReadOnly
+	}
+	if user.Id == 0 {
+		if err := t.tx.QueryRowxContext(ctx, `insert into "user" (username) values (?) returning id`, user.Username).Scan(&user.Id); err != nil {
+			return fmt.Errorf("insert: %w", err)
+		}
+		return nil
+	}
+	info, err := t.tx.ExecContext(ctx, `update "user" set username=? where id=?`, user.Username, user.Id)
+	if err != nil {
+		return fmt.Errorf("update: %w", err)
+	}
+	affected, err := info.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("update: get affected rows: %w", err)
+	}
+	if got, want := affected, int64(1); got != want {
+		if got == 0 {
+			return ErrNothingToUpdate
+		}
+		return fmt.Errorf("update: affected rows: got %v want %v", got, want)
+	}
+	return nil
+}
+
+const sqliteSelectSession = `select
+    s.id, s.metadata, s.taints, s.created_at, s.expires_at, u.id, u.username
+    from session s left join "user" u on u.id=s.user_id`
+
+// scanSQLiteSession reads one row selected by sqliteSelectSession.
+func scanSQLiteSession(row interface{ Scan(...interface{}) error }) (*types.Session, error) {
+	raw := &rawSession{}
+	var metadata, taints string
+	var createdAt, expiresAt int64
+	if err := row.Scan(&raw.ID, &metadata, &taints, &createdAt, &expiresAt, &raw.UserID, &raw.Username); err != nil {
+		return nil, fmt.Errorf("select: %w", err)
+	}
+	raw.Metadata = []byte(metadata)
+	raw.Taints = []byte(taints)
+	raw.CreatedAt = fromMillis(createdAt)
+	raw.ExpiresAt = fromMillis(expiresAt)
+	session, err := raw.toSession()
+	if err != nil {
+		return nil, fmt.Errorf("convert to *types.Session: %w", err)
+	}
+	return session, nil
+}
+
+func (t *sqliteTx) getSession(ctx context.Context, id []byte) (*types.Session, error) {
+	if len(id) != 64 {
+		return nil, fmt.Errorf("session id %s: %w", id, ErrSessionIDInvalid)
+	}
+	return scanSQLiteSession(t.tx.QueryRowxContext(ctx, sqliteSelectSession+` where s.id=?`, id))
+}
+
+// getSQLiteSessions reads the sessions with the provided IDs, keyed by ID.  Sessions that don't
+// exist are omitted.
+func getSQLiteSessions(ctx context.Context, tx *sqlx.Tx, ids [][]byte) (map[string]*types.Session, error) {
+	result := make(map[string]*types.Session, len(ids))
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	rows, err := tx.QueryxContext(ctx, sqliteSelectSession+` where s.id in (?`+strings.Repeat(`, ?`, len(ids)-1)+`)`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("select: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		session, err := scanSQLiteSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		result[string(session.GetId())] = session
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate over rows: %w", err)
+	}
+	return result, nil
+}
+
+func (t *sqliteTx) LookupSession(ctx context.Context, id []byte) (*types.Session, error) {
+	session, err := t.getSession(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("read session: %w", err)
+	}
+	if err := checkSessionTimes(session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+func (t *sqliteTx) UpdateSession(ctx context.Context, s *types.Session) error {
+	if err := checkUpdateSession(s); err != nil {
+		return err
+	}
+	if t.readOnly {
+		return errReadOnly
+	}
+	obj, err := fromSession(s)
+	if err != nil {
+		return fmt.Errorf("marshal session: %w", err)
+	}
+	if _, err := t.tx.ExecContext(ctx, `insert into session
+                  (id, user_id, metadata, taints, created_at, expires_at)
+            values(?, ?, ?, ?, ?, ?)
+            on conflict (id)
+            do update set metadata=excluded.metadata, taints=excluded.taints, expires_at=excluded.expires_at`,
+		obj.ID, obj.UserID, string(obj.Metadata), string(obj.Taints), toMillis(obj.CreatedAt), toMillis(obj.ExpiresAt)); err != nil {
+		return fmt.Errorf("insert: %w", err)
+	}
+	return nil
+}
+
+func (t *sqliteTx) RevokeSession(ctx context.Context, id []byte, reason string) error {
+	session, err := t.getSession(ctx, id)
+	if err != nil {
+		return fmt.Errorf("refresh session: %w", err)
+	}
+	if !revoke(session, reason) {
+		return nil
+	}
+	if err := t.UpdateSession(ctx, session); err != nil {
+		return fmt.Errorf("store expired session: %w", err)
+	}
+	return nil
+}
+
+func (t *sqliteTx) AddCredential(ctx context.Context, c *types.Credential) error {
+	if err := checkAddCredential(c); err != nil {
+		return err
+	}
+	if t.readOnly {
+		return errReadOnly
+	}
+	if err := t.tx.QueryRowxContext(ctx, `insert into credential
+                  (user_id, credential_id, public_key, name, created_at, created_by_session_id, aaguid, sign_count)
+            values(?, ?, ?, ?, ?, ?, ?, ?) returning id`,
+		c.GetUser().GetId(), c.GetCredentialId(), c.GetPublicKey(), c.GetName(), toMillis(c.GetCreatedAt().AsTime()), c.GetCreatedBySessionId(), c.GetAaguid(), c.GetSignCount()).Scan(&c.Id); err != nil {
+		return fmt.Errorf("insert: %w", err)
+	}
+	return nil
+}
+
+func (t *sqliteTx) GetUserCredentials(ctx context.Context, u *types.User) ([]*types.Credential, error) {
+	if u == nil {
+		return nil, &ErrEmpty{Field: "user"}
+	}
+	if u.GetId() < 1 {
+		return nil, &ErrEmpty{Field: "user.id"}
+	}
+	rows, err := t.tx.QueryxContext(ctx, `select
+            c.id, c.credential_id, c.public_key, c.name, c.created_at, c.aaguid, c.sign_count, u.id, u.username
+            from credential c left join "user" u on u.id=c.user_id
+            where c.deleted_at is null and c.user_id=? order by c.id`, u.GetId())
+	if err != nil {
+		return nil, fmt.Errorf("select: %w", err)
+	}
+	defer rows.Close()
+	var result []*types.Credential
+	for rows.Next() {
+		raw := &rawCredential{}
+		var createdAt int64
+		if err := rows.Scan(&raw.ID, &raw.CredentialID, &raw.PublicKey, &raw.Name, &createdAt, &raw.AAGUID, &raw.SignCount, &raw.UserID, &raw.Username); err != nil {
+			return nil, fmt.Errorf("select: scan: %w", err)
+		}
+		raw.CreatedAt = fromMillis(createdAt)
+		result = append(result, raw.toCredential())
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("select: iterate over rows: %w", err)
+	}
+	return result, nil
+}
+
+func (t *sqliteTx) CheckAndUpdateSignCount(ctx context.Context, c *types.Credential) error {
+	var signCount int64
+	if err := t.tx.QueryRowxContext(ctx, `select sign_count from credential where id=?`, c.GetId()).Scan(&signCount); err != nil {
+		return fmt.Errorf("retrieve sign count: %w", err)
+	}
+	if signCount != 0 && c.GetSignCount() != 0 && signCount >= c.GetSignCount() {
+		return fmt.Errorf("%w: authenticator's count: %d, stored count: %d", ErrSignCountDecreased, c.GetSignCount(), signCount)
+	}
+	if t.readOnly {
+		return errReadOnly
+	}
+	if _, err := t.tx.ExecContext(ctx, `update credential set sign_count=? where id=?`, c.GetSignCount(), c.GetId()); err != nil {
+		return fmt.Errorf("store new sign count: %w", err)
+	}
+	return nil
+}
+
+func (t *sqliteTx) AddAuditEvent(ctx context.Context, e *types.AuditEvent) error {
+	if err := checkAddAuditEvent(e); err != nil {
+		return err
+	}
+	if t.readOnly {
+		return errReadOnly
+	}
+	var prev []byte
+	if err := t.tx.QueryRowxContext(ctx, `select hash from audit_event where hash is not null order by id desc limit 1`).Scan(&prev); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("read previous hash: %w", err)
+	}
+	chainAuditEvent(prev, e)
+	obj, err := fromAuditEvent(e)
+	if err != nil {
+		return fmt.Errorf("marshal audit event: %w", err)
+	}
+	if err := t.tx.QueryRowxContext(ctx, `insert into audit_event
+                  (created_at, action, actor_user_id, actor_username, actor_session_id, target_user_id, target_username, ip_address, user_agent, result, error, details, prev_hash, hash)
+            values(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) returning id`,
+		toMillis(obj.CreatedAt), obj.Action, obj.ActorUserID, obj.ActorUsername, obj.ActorSessionID, obj.TargetUserID, obj.TargetUsername, obj.IPAddress, obj.UserAgent, obj.Result, obj.Error, string(obj.Details), obj.PrevHash, obj.Hash).Scan(&e.Id); err != nil {
+		return fmt.Errorf("insert: %w", err)
+	}
+	t.addedAuditEvent = true
+	return nil
+}
+
+func (t *sqliteTx) QueryAuditEvents(ctx context.Context, f *AuditFilter) ([]*types.AuditEvent, error) {
+	query, args, err := auditQuery(f, func(t time.Time) interface{} { return toMillis(t) })
+	if err != nil {
+		return nil, fmt.Errorf("build query: %w", err)
+	}
+	rows, err := t.tx.QueryxContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("select: %w", err)
+	}
+	defer rows.Close()
+	var result []*types.AuditEvent
+	for rows.Next() {
+		raw := &rawAuditEvent{}
+		var createdAt int64
+		var details string
+		if err := rows.Scan(&raw.ID, &createdAt, &raw.Action, &raw.ActorUserID, &raw.ActorUsername, &raw.ActorSessionID, &raw.TargetUserID, &raw.TargetUsername, &raw.IPAddress, &raw.UserAgent, &raw.Result, &raw.Error, &details, &raw.PrevHash, &raw.Hash); err != nil {
+			return nil, fmt.Errorf("select: scan: %w", err)
+		}
+		raw.CreatedAt = fromMillis(createdAt)
+		raw.Details = []byte(details)
+		e, err := raw.toAuditEvent()
+		if err != nil {
+			return nil, fmt.Errorf("convert to *types.AuditEvent: %w", err)
+		}
+		result = append(result, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("select: iterate over rows: %w", err)
+	}
+	return result, nil
+}
+
+func (t *sqliteTx) AddAuditCheckpoint(ctx context.Context, c *types.AuditCheckpoint) error {
+	if err := checkAddAuditCheckpoint(c); err != nil {
+		return err
+	}
+	if t.readOnly {
+		return errReadOnly
+	}
+	if err := t.tx.QueryRowxContext(ctx, `insert into audit_checkpoint (created_at, audit_event_id, hash, signature) values (?, ?, ?, ?) returning id`,
+		toMillis(c.GetCreatedAt().AsTime()), c.GetAuditEventId(), c.GetHash(), c.GetSignature()).Scan(&c.Id); err != nil {
+		return fmt.Errorf("insert: %w", err)
+	}
+	return nil
+}
+
+func (t *sqliteTx) GetAuditCheckpoints(ctx context.Context) ([]*types.AuditCheckpoint, error) {
+	rows, err := t.tx.QueryxContext(ctx, `select id, created_at, audit_event_id, hash, signature from audit_checkpoint order by id`)
+	if err != nil {
+		return nil, fmt.Errorf("select: %w", err)
+	}
+	defer rows.Close()
+	var result []*types.AuditCheckpoint
+	for rows.Next() {
+		raw := &rawAuditCheckpoint{}
+		var createdAt int64
+		if err := rows.Scan(&raw.ID, &createdAt, &raw.AuditEventID, &raw.Hash, &raw.Signature); err != nil {
+			return nil, fmt.Errorf("select: scan: %w", err)
+		}
+		raw.CreatedAt = fromMillis(createdAt)
+		result = append(result, raw.toAuditCheckpoint())
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("select: iterate over rows: %w", err)
+	}
+	return result, nil
+}
+
+func (t *sqliteTx) AddWebhook(ctx context.Context, w *types.Webhook) error {
+	if err := checkAddWebhook(w); err != nil {
+		return err
+	}
+	if t.readOnly {
+		return errReadOnly
+	}
+	obj, err := fromWebhook(w)
+	if err != nil {
+		return fmt.Errorf("marshal webhook: %w", err)
+	}
+	if err := t.tx.QueryRowxContext(ctx, `insert into webhook (created_at, url, description, event_types, secret) values (?, ?, ?, ?, ?) returning id`,
+		toMillis(obj.CreatedAt), obj.URL, obj.Description, string(obj.EventTypes), obj.Secret).Scan(&w.Id); err != nil {
+		return fmt.Errorf("insert: %w", err)
+	}
+	return nil
+}
+
+func (t *sqliteTx) GetWebhooks(ctx context.Context) ([]*types.Webhook, error) {
+	rows, err := t.tx.QueryxContext(ctx, `select `+webhookColumns+` from webhook order by id`)
+	if err != nil {
+		return nil, fmt.Errorf("select: %w", err)
+	}
+	defer rows.Close()
+	var result []*types.Webhook
+	for rows.Next() {
+		raw := &rawWebhook{}
+		var createdAt int64
+		var eventTypes string
+		if err := rows.Scan(&raw.ID, &createdAt, &raw.URL, &raw.Description, &eventTypes, &raw.Secret); err != nil {
+			return nil, fmt.Errorf("select: scan: %w", err)
+		}
+		raw.CreatedAt = fromMillis(createdAt)
+		raw.EventTypes = []byte(eventTypes)
+		w, err := raw.toWebhook()
+		if err != nil {
+			return nil, fmt.Errorf("convert to *types.Webhook: %w", err)
+		}
+		result = append(result, w)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("select: iterate over rows: %w", err)
+	}
+	return result, nil
+}
+
+func (t *sqliteTx) DeleteWebhook(ctx context.Context, id int64) error {
+	if t.readOnly {
+		return errReadOnly
+	}
+	return DeleteWebhook(ctx, t.tx, id)
+}
+
+func (t *sqliteTx) GetWebhookCursor(ctx context.Context) (int64, error) {
+	return GetWebhookCursor(ctx, t.tx)
+}
+
+func (t *sqliteTx) SetWebhookCursor(ctx context.Context, id int64) error {
+	if t.readOnly {
+		return errReadOnly
+	}
+	return SetWebhookCursor(ctx, t.tx, id)
+}
+
+func (t *sqliteTx) RedeemNonce(ctx context.Context, nonce []byte, expiresAt time.Time) error {
+	if t.readOnly {
+		return errReadOnly
+	}
+	if err := checkNonce(nonce); err != nil {
+		return err
+	}
+	result, err := t.tx.ExecContext(ctx, `insert into used_nonce (nonce, expires_at) values (?, ?)
+            on conflict (nonce) do update set expires_at = excluded.expires_at where used_nonce.expires_at < ?`, nonce, toMillis(expiresAt), toMillis(time.Now()))
+	if err != nil {
+		return fmt.Errorf("insert: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("get affected rows: %w", err)
+	}
+	if n == 0 {
+		return ErrNonceReused
+	}
+	return nil
+}
+
+// sqliteWebhookDeliveryArgs returns the columns of a delivery that AddWebhookDelivery and
+// UpdateWebhookDelivery write, in the order that they write them.
+func sqliteWebhookDeliveryArgs(d *types.WebhookDelivery) []interface{} {
+	obj := fromWebhookDelivery(d)
+	var lastAttemptAt interface{}
+	if obj.LastAttemptAt.Valid {
+		lastAttemptAt = toMillis(obj.LastAttemptAt.Time)
+	}
+	return []interface{}{obj.State, obj.Attempts, toMillis(obj.NextAttemptAt), lastAttemptAt, obj.LastError}
+}
+
+func (t *sqliteTx) AddWebhookDelivery(ctx context.Context, d *types.WebhookDelivery) error {
+	if err := checkWebhookDelivery(d); err != nil {
+		return err
+	}
+	if t.readOnly {
+		return errReadOnly
+	}
+	eventType, _ := eventTypeName(d.GetEventType())
+	args := append([]interface{}{d.GetWebhookId(), d.GetAuditEventId(), eventType, toMillis(d.GetCreatedAt().AsTime())}, sqliteWebhookDeliveryArgs(d)...)
+	if err := t.tx.QueryRowxContext(ctx, `insert into webhook_delivery
+                  (webhook_id, audit_event_id, event_type, created_at, state, attempts, next_attempt_at, last_attempt_at, last_error)
+            values(?, ?, ?, ?, ?, ?, ?, ?, ?) returning id`, args...).Scan(&d.Id); err != nil {
+		return fmt.Errorf("insert: %w", err)
+	}
+	return nil
+}
+
+func (t *sqliteTx) QueryWebhookDeliveries(ctx context.Context, f *WebhookDeliveryFilter) ([]*types.WebhookDelivery, error) {
+	query, args, err := webhookDeliveryQuery(f, func(t time.Time) interface{} { return toMillis(t) })
+	if err != nil {
+		return nil, fmt.Errorf("build query: %w", err)
+	}
+	rows, err := t.tx.QueryxContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("select: %w", err)
+	}
+	defer rows.Close()
+	var result []*types.WebhookDelivery
+	for rows.Next() {
+		raw := &rawWebhookDelivery{}
+		var createdAt, nextAttemptAt int64
+		var lastAttemptAt sql.NullInt64
+		if err := rows.Scan(&raw.ID, &raw.WebhookID, &raw.AuditEventID, &raw.EventType, &raw.State, &createdAt, &raw.Attempts, &nextAttemptAt, &lastAttemptAt, &raw.LastError); err != nil {
+			return nil, fmt.Errorf("select: scan: %w", err)
+		}
+		raw.CreatedAt = fromMillis(createdAt)
+		raw.NextAttemptAt = fromMillis(nextAttemptAt)
+		if lastAttemptAt.Valid {
+			raw.LastAttemptAt = sql.NullTime{Time: fromMillis(lastAttemptAt.Int64), Valid: true}
+		}
+		result = append(result, raw.toWebhookDelivery())
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("select: iterate over rows: %w", err)
+	}
+	return result, nil
+}
+
+func (t *sqliteTx) UpdateWebhookDelivery(ctx context.Context, d *types.WebhookDelivery) error {
+	if err := checkWebhookDelivery(d); err != nil {
+		return err
+	}
+	if t.readOnly {
+		return errReadOnly
+	}
+	args := append(sqliteWebhookDeliveryArgs(d), d.GetId())
+	result, err := t.tx.ExecContext(ctx, `update webhook_delivery set state=?, attempts=?, next_attempt_at=?, last_attempt_at=?, last_error=? where id=?`, args...)
+	if err != nil {
+		return fmt.Errorf("update: %w", err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("update: rows affected: %w", err)
+	} else if n == 0 {
+		return fmt.Errorf("update: %w", sql.ErrNoRows)
+	}
+	return nil
+}
+
+// reapBatch implements batchReaper.  SQLite databases are not shared between replicas, so there is
+// no lock to take.
+func (s *SQLite) reapBatch(ctx context.Context, l *zap.Logger, cfg *ReaperConfig, now time.Time) (int64, int64, error) {
+	var n, nonces int64
+	err := s.doTx(ctx, l, false, func(tx *sqlx.Tx) error {
+		result, err := tx.ExecContext(ctx, `delete from session where id in (
+                select s.id from session s
+                where (s.expires_at < ? or (exists (select 1 from json_each(s.taints) where value = 'start_login') and s.created_at < ?))
+                and not exists (select 1 from credential c where c.created_by_session_id = s.id)
+                limit ?
+            )`, toMillis(now.Add(-cfg.ExpiredSessionRetention)), toMillis(now.Add(-cfg.AbandonedLoginRetention)), cfg.BatchSize)
+		if err != nil {
+			return fmt.Errorf("delete sessions: %w", err)
+		}
+		n, err = result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("get affected rows: %w", err)
+		}
+		result, err = tx.ExecContext(ctx, `delete from used_nonce where nonce in (
+                select nonce from used_nonce where expires_at < ? limit ?
+            )`, toMillis(now), cfg.BatchSize)
+		if err != nil {
+			return fmt.Errorf("delete nonces: %w", err)
+		}
+		nonces, err = result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("get affected nonce rows: %w", err)
+		}
+		return nil
+	})
+	return n, nonces, err
+}
+
+// ReapSessions deletes expired, revoked, and abandoned sessions, and expired used nonces; see
+// (*Connection).ReapSessions.
+func (s *SQLite) ReapSessions(ctx context.Context, l *zap.Logger, cfg *ReaperConfig) (int64, error) {
+	return reapSessions(ctx, l, s, cfg)
+}
+
+// RunReaper runs ReapSessions every cfg.Interval until the context is cancelled.
+func (s *SQLite) RunReaper(ctx context.Context, l *zap.Logger, cfg *ReaperConfig) {
+	runReaper(ctx, l, s, cfg)
+}
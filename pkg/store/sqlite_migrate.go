@@ -0,0 +1,163 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/jrockway/jsso2/migrations"
+	"go.uber.org/zap"
+)
+
+// ternSeparator separates the up and down halves of a migration file.
+const ternSeparator = "---- create above / drop below ----"
+
+// sqliteMigration is one migration from migrations.SQLiteFS.  tern only supports Postgres, so the
+// SQLite store reads the same file format itself.
+type sqliteMigration struct {
+	Migration
+	up, down string
+}
+
+// loadSQLiteMigrations reads the embedded SQLite migrations, which must be numbered from 1 with no
+// gaps.
+func loadSQLiteMigrations() ([]*sqliteMigration, error) {
+	paths, err := fs.Glob(migrations.SQLiteFS, "sqlite/*.sql")
+	if err != nil {
+		return nil, fmt.Errorf("find embedded migrations: %w", err)
+	}
+	sort.Strings(paths)
+	result := make([]*sqliteMigration, 0, len(paths))
+	for i, p := range paths {
+		name := path.Base(p)
+		n, err := strconv.Atoi(strings.SplitN(name, "_", 2)[0])
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: parse sequence number: %w", name, err)
+		}
+		if n != i+1 {
+			return nil, fmt.Errorf("migration %s: out of sequence; expected %03d", name, i+1)
+		}
+		content, err := fs.ReadFile(migrations.SQLiteFS, p)
+		if err != nil {
+			return nil, fmt.Errorf("read migration %s: %w", name, err)
+		}
+		parts := strings.SplitN(string(content), ternSeparator, 2)
+		m := &sqliteMigration{
+			Migration: Migration{Version: int32(n), Name: name},
+			up:        parts[0],
+		}
+		if len(parts) == 2 {
+			m.down = parts[1]
+		}
+		result = append(result, m)
+	}
+	return result, nil
+}
+
+// sqliteSchemaVersion returns the version recorded in the schema_version table, creating it if
+// necessary.
+func sqliteSchemaVersion(ctx context.Context, tx *sqlx.Tx) (int32, error) {
+	if _, err := tx.ExecContext(ctx, `create table if not exists schema_version (version integer not null)`); err != nil {
+		return 0, fmt.Errorf("create version table: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `insert into schema_version (version) select 0 where not exists (select 1 from schema_version)`); err != nil {
+		return 0, fmt.Errorf("initialize version table: %w", err)
+	}
+	var v int32
+	if err := tx.QueryRowxContext(ctx, `select version from schema_version`).Scan(&v); err != nil {
+		return 0, fmt.Errorf("read version: %w", err)
+	}
+	return v, nil
+}
+
+// MigrateDB migrates the database to the latest schema version.
+func (s *SQLite) MigrateDB(ctx context.Context) error {
+	ms, err := loadSQLiteMigrations()
+	if err != nil {
+		return fmt.Errorf("run migrations: %w", err)
+	}
+	return s.MigrateTo(ctx, int32(len(ms)))
+}
+
+// MigrateTo migrates the database up or down to the provided schema version.  Version 0 is an
+// empty database.  Each migration runs in its own transaction.
+func (s *SQLite) MigrateTo(ctx context.Context, version int32) error {
+	ms, err := loadSQLiteMigrations()
+	if err != nil {
+		return fmt.Errorf("run migrations: %w", err)
+	}
+	if version < 0 || int(version) > len(ms) {
+		return fmt.Errorf("run migrations: destination version %d is outside the valid range 0-%d", version, len(ms))
+	}
+	for {
+		done := false
+		if err := s.doTx(ctx, zap.NewNop(), false, func(tx *sqlx.Tx) error {
+			current, err := sqliteSchemaVersion(ctx, tx)
+			if err != nil {
+				return err
+			}
+			var m *sqliteMigration
+			var sql string
+			next := current
+			switch {
+			case current < version:
+				m, sql, next = ms[current], ms[current].up, current+1
+			case current > version:
+				if int(current) > len(ms) {
+					return fmt.Errorf("database is at version %d, but this binary only knows about %d migrations", current, len(ms))
+				}
+				m, sql, next = ms[current-1], ms[current-1].down, current-1
+				if strings.TrimSpace(sql) == "" {
+					return fmt.Errorf("irreversible migration: %d - %s", m.Version, m.Name)
+				}
+			default:
+				done = true
+				return nil
+			}
+			if _, err := tx.ExecContext(ctx, sql); err != nil {
+				return fmt.Errorf("migration %s: %w", m.Name, err)
+			}
+			if _, err := tx.ExecContext(ctx, `update schema_version set version=?`, next); err != nil {
+				return fmt.Errorf("migration %s: update version: %w", m.Name, err)
+			}
+			return nil
+		}); err != nil {
+			return fmt.Errorf("run migrations: migrate to version %d: %w", version, err)
+		}
+		if done {
+			return nil
+		}
+	}
+}
+
+// MigrationStatus reads the current schema version from the database.
+func (s *SQLite) MigrationStatus(ctx context.Context) (*MigrationStatus, error) {
+	ms, err := loadSQLiteMigrations()
+	if err != nil {
+		return nil, fmt.Errorf("read migration status: %w", err)
+	}
+	result := &MigrationStatus{Required: int32(len(ms))}
+	if err := s.doTx(ctx, zap.NewNop(), false, func(tx *sqlx.Tx) (err error) {
+		result.Current, err = sqliteSchemaVersion(ctx, tx)
+		return
+	}); err != nil {
+		return nil, fmt.Errorf("read migration status: %w", err)
+	}
+	for _, m := range ms {
+		mig := m.Migration
+		mig.Applied = m.Version <= result.Current
+		result.Migrations = append(result.Migrations, mig)
+	}
+	return result, nil
+}
+
+// CheckSchema returns an *ErrSchemaBehind if the database schema is older than the one this binary
+// was built for.
+func (s *SQLite) CheckSchema(ctx context.Context) (*MigrationStatus, error) {
+	return checkSchema(s.MigrationStatus(ctx))
+}
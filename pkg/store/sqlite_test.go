@@ -0,0 +1,272 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/jrockway/jsso2/pkg/sessions"
+	"github.com/jrockway/jsso2/pkg/types"
+	"go.uber.org/zap/zaptest"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// mustGetTestSQLite returns a migrated SQLite database in a temporary directory.
+func mustGetTestSQLite(ctx context.Context, t *testing.T) *SQLite {
+	t.Helper()
+	cfg := &Config{
+		DatabaseURL: "sqlite://" + filepath.Join(t.TempDir(), "jsso2.db"),
+		PoolConfig:  PoolConfig{MaxOpenConns: 4, MaxIdleConns: 4},
+		RetryConfig: DefaultRetryConfig,
+	}
+	s, err := ConnectSQLite(ctx, cfg)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	if err := s.MigrateDB(ctx); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return s
+}
+
+func TestSQLiteDSN(t *testing.T) {
+	const opts = "_pragma=foreign_keys%281%29&_pragma=journal_mode%28wal%29&_pragma=busy_timeout%285000%29&_txlock=immediate"
+	testData := []struct {
+		url, want string
+		wantErr   bool
+	}{
+		{url: "sqlite:///var/lib/jsso2.db", want: "/var/lib/jsso2.db?" + opts},
+		{url: "sqlite://jsso2.db", want: "jsso2.db?" + opts},
+		{url: "sqlite:jsso2.db", want: "jsso2.db?" + opts},
+		{url: "sqlite:///jsso2.db?cache=shared", want: "/jsso2.db?" + opts + "&cache=shared"},
+		{url: "sqlite://", wantErr: true},
+		{url: "postgres://localhost/jsso2", wantErr: true},
+	}
+	for _, test := range testData {
+		t.Run(test.url, func(t *testing.T) {
+			got, err := sqliteDSN(test.url)
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("expected error, got %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := test.want; got != want {
+				t.Errorf("dsn:\n  got: %v\n want: %v", got, want)
+			}
+		})
+	}
+}
+
+func TestSQLiteConformance(t *testing.T) {
+	ctx, c := context.WithTimeout(context.Background(), 10*time.Second)
+	defer c()
+	testConformance(ctx, t, mustGetTestSQLite(ctx, t))
+}
+
+func TestToMillis(t *testing.T) {
+	ts := time.Date(2020, 1, 1, 0, 0, 0, 999999999, time.UTC)
+	if got, want := fromMillis(toMillis(ts)), time.Date(2020, 1, 1, 0, 0, 0, 999000000, time.UTC); !got.Equal(want) {
+		t.Errorf("round trip:\n  got: %v\n want: %v", got, want)
+	}
+}
+
+func TestSQLiteMigrations(t *testing.T) {
+	ctx, c := context.WithTimeout(context.Background(), 10*time.Second)
+	defer c()
+	s := mustGetTestSQLite(ctx, t)
+	ms, err := loadSQLiteMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	required := int32(len(ms))
+
+	status, err := s.CheckSchema(ctx)
+	if err != nil {
+		t.Fatalf("check migrated schema: %v", err)
+	}
+	if got, want := status.Current, required; got != want {
+		t.Errorf("current version:\n  got: %v\n want: %v", got, want)
+	}
+
+	if err := s.MigrateTo(ctx, 0); err != nil {
+		t.Fatalf("migrate down: %v", err)
+	}
+	_, err = s.CheckSchema(ctx)
+	target := &ErrSchemaBehind{}
+	if !errors.As(err, &target) {
+		t.Fatalf("check old schema: expected ErrSchemaBehind, got %v", err)
+	}
+	if got, want := *target, (ErrSchemaBehind{Current: 0, Required: required}); got != want {
+		t.Errorf("schema behind:\n  got: %#v\n want: %#v", got, want)
+	}
+
+	if err := s.MigrateDB(ctx); err != nil {
+		t.Fatalf("migrate up again: %v", err)
+	}
+	if _, err := s.CheckSchema(ctx); err != nil {
+		t.Errorf("check re-migrated schema: %v", err)
+	}
+}
+
+func TestSQLiteConcurrentWrites(t *testing.T) {
+	ctx, c := context.WithTimeout(context.Background(), 10*time.Second)
+	defer c()
+	s := mustGetTestSQLite(ctx, t)
+	l := zaptest.NewLogger(t)
+	user := &types.User{Username: "test"}
+	if err := s.DoTx(ctx, l, false, func(tx Tx) error { return tx.UpdateUser(ctx, user) }); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each transaction reads the username and appends to it; if transactions were not
+	// serialized, some appends would be lost.
+	const n = 20
+	var wg sync.WaitGroup
+	errCh := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errCh <- s.DoTx(ctx, l, false, func(tx Tx) error {
+				u := &types.User{Id: user.GetId()}
+				if err := tx.LookupUser(ctx, u); err != nil {
+					return err
+				}
+				u.Username += "x"
+				return tx.UpdateUser(ctx, u)
+			})
+		}()
+	}
+	wg.Wait()
+	close(errCh)
+	for err := range errCh {
+		if err != nil {
+			t.Errorf("update: %v", err)
+		}
+	}
+	got := &types.User{Id: user.GetId()}
+	if err := s.DoTx(ctx, l, true, func(tx Tx) error { return tx.LookupUser(ctx, got) }); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(got.GetUsername()), len("test")+n; got != want {
+		t.Errorf("username length:\n  got: %v\n want: %v", got, want)
+	}
+}
+
+func TestSQLiteReapSessions(t *testing.T) {
+	ctx, c := context.WithTimeout(context.Background(), 10*time.Second)
+	defer c()
+	s := mustGetTestSQLite(ctx, t)
+	l := zaptest.NewLogger(t)
+	user := &types.User{Username: "test"}
+	if err := s.DoTx(ctx, l, false, func(tx Tx) error { return tx.UpdateUser(ctx, user) }); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	newSession := func(t *testing.T, created, expires time.Time, taints ...string) []byte {
+		t.Helper()
+		id, err := sessions.GenerateID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.DoTx(ctx, l, false, func(tx Tx) error {
+			return tx.UpdateSession(ctx, &types.Session{
+				Id:        id,
+				User:      user,
+				CreatedAt: timestamppb.New(created),
+				ExpiresAt: timestamppb.New(expires),
+				Taints:    taints,
+			})
+		}); err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+
+	valid := newSession(t, now.Add(-time.Hour), now.Add(time.Hour))
+	newSession(t, now.Add(-72*time.Hour), now.Add(-48*time.Hour))
+	newSession(t, now.Add(-2*time.Hour), now.Add(16*time.Hour), sessions.TaintStartLogin)
+	pendingLogin := newSession(t, now.Add(-time.Minute), now.Add(18*time.Hour), sessions.TaintStartLogin)
+	enrollment := newSession(t, now.Add(-72*time.Hour), now.Add(-48*time.Hour), sessions.TaintEnrollment)
+	if err := s.DoTx(ctx, l, false, func(tx Tx) error {
+		return tx.AddCredential(ctx, &types.Credential{
+			User:               user,
+			CreatedBySessionId: enrollment,
+			CreatedAt:          timestamppb.New(now.Add(-72 * time.Hour)),
+			CredentialId:       []byte("AAAAAAAAAAAAAAAA"),
+			PublicKey:          []byte("public key"),
+		})
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	expiredNonces := [][]byte{[]byte("expired nonce 01"), []byte("expired nonce 02"), []byte("expired nonce 03")}
+	liveNonce := []byte("live nonce 00001")
+	if err := s.DoTx(ctx, l, false, func(tx Tx) error {
+		for _, nonce := range expiredNonces {
+			if err := tx.RedeemNonce(ctx, nonce, now.Add(-time.Minute)); err != nil {
+				return err
+			}
+		}
+		return tx.RedeemNonce(ctx, liveNonce, now.Add(time.Minute))
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := s.ReapSessions(ctx, l, &ReaperConfig{
+		ExpiredSessionRetention: time.Hour,
+		AbandonedLoginRetention: time.Hour,
+		BatchSize:               1,
+	})
+	if err != nil {
+		t.Fatalf("reap: %v", err)
+	}
+	if got, want := n, int64(2); got != want {
+		t.Errorf("deleted:\n  got: %v\n want: %v", got, want)
+	}
+	var nonces int
+	if err := s.doTx(ctx, l, true, func(tx *sqlx.Tx) error {
+		return tx.QueryRowxContext(ctx, `select count(*) from used_nonce`).Scan(&nonces)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := nonces, 1; got != want {
+		t.Errorf("nonces left after reaping:\n  got: %v\n want: %v", got, want)
+	}
+	for _, id := range [][]byte{valid, pendingLogin, enrollment} {
+		if err := s.DoTx(ctx, l, true, func(tx Tx) error {
+			_, err := tx.(*sqliteTx).getSession(ctx, id)
+			return err
+		}); err != nil {
+			t.Errorf("session that should have been kept: %v", err)
+		}
+	}
+}
+
+func TestSQLiteAuditAppendOnly(t *testing.T) {
+	ctx, c := context.WithTimeout(context.Background(), 10*time.Second)
+	defer c()
+	s := mustGetTestSQLite(ctx, t)
+	l := zaptest.NewLogger(t)
+	e := &types.AuditEvent{CreatedAt: timestamppb.Now(), Action: "test", Result: types.AuditEvent_SUCCESS}
+	if err := s.DoTx(ctx, l, false, func(tx Tx) error { return tx.AddAuditEvent(ctx, e) }); err != nil {
+		t.Fatal(err)
+	}
+	for _, query := range []string{`update audit_event set action='edited' where id=?`, `delete from audit_event where id=?`} {
+		if err := s.doTx(ctx, l, false, func(tx *sqlx.Tx) error {
+			_, err := tx.ExecContext(ctx, query, e.GetId())
+			return err
+		}); err == nil {
+			t.Errorf("%s: expected error", query)
+		}
+	}
+}
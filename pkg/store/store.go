@@ -6,40 +6,137 @@ import (
 	"fmt"
 	"time"
 
-	_ "github.com/jackc/pgx/v4/stdlib" // This is the only driver we support.
+	_ "github.com/jackc/pgx/v4/stdlib" // The Postgres driver; see sqlite.go for SQLite.
 	"github.com/jmoiron/sqlx"
+	"github.com/jrockway/jsso2/pkg/sessions"
+	"github.com/jrockway/jsso2/pkg/types"
+	"go.uber.org/zap"
 )
 
 const (
-	MaxRetries = 3
+	MaxRetries = 5
 	TxDelay    = 10 * time.Millisecond
+	MaxTxDelay = time.Second
 )
 
 // Config is environment/command-line config for storage.
 type Config struct {
-	DatabaseURL   string `long:"database_url" description:"Postgres connection string pointing at the database" env:"DATABASE_URL"`
+	DatabaseURL   string `long:"database_url" description:"Postgres connection string pointing at the database, or sqlite:///path/to/file.db to use SQLite" env:"DATABASE_URL"`
 	RunMigrations bool   `long:"run_migrations" description:"If true, migrate the database after connecting." env:"RUN_MIGRATIONS"`
+	InMemory      bool   `long:"in_memory" description:"If true, keep all data in memory instead of connecting to Postgres.  Everything is lost when the server exits; for local demos only." env:"IN_MEMORY"`
+	PoolConfig
+	RetryConfig
+
+	ReplicaDatabaseURL   string        `long:"replica_database_url" description:"If set, a Postgres connection string pointing at a read replica to send read-only transactions to." env:"REPLICA_DATABASE_URL"`
+	MaxReplicaLag        time.Duration `long:"max_replica_lag" description:"Send reads to the primary while the replica is further behind than this." default:"5s" env:"MAX_REPLICA_LAG"`
+	ReplicaCheckInterval time.Duration `long:"replica_check_interval" description:"How often to check the replica's replication lag." default:"1s" env:"REPLICA_CHECK_INTERVAL"`
+
+	SessionCacheSize int           `long:"session_cache_size" description:"The maximum number of sessions to cache in memory; 0 disables the cache." default:"10000" env:"SESSION_CACHE_SIZE"`
+	SessionCacheTTL  time.Duration `long:"session_cache_ttl" description:"The maximum amount of time to cache a session for, in case an invalidation is missed." default:"1m" env:"SESSION_CACHE_TTL"`
+}
+
+// Store is storage for users, sessions, credentials, and the audit log.  *Connection stores them in Postgres,
+// *SQLite in a SQLite database file, and *Memory in memory.
+type Store interface {
+	// DoTx executes the provided function in a transaction, retrying it if it fails with a
+	// retryable error.  Return an error from f to roll back, or nil to commit.
+	DoTx(ctx context.Context, l *zap.Logger, readOnly bool, f func(tx Tx) error) error
+
+	// AuthenticateUser returns the best valid session among the provided sessions, which need
+	// only contain a session ID, or a list of reasons why none of them are valid.
+	AuthenticateUser(ctx context.Context, l *zap.Logger, ss []*types.Session, unusedHeaders []*sessions.UnusedHeader, unusedCookies []*sessions.UnusedCookie) (*types.Session, []error)
+
+	// SubscribeAuditEvents returns a channel that receives a value after audit events may have
+	// been added, until the context is done.  Notifications are coalesced, and may be spurious
+	// or missed, so watchers should also poll occasionally.
+	SubscribeAuditEvents(ctx context.Context) <-chan struct{}
+}
+
+// Tx is a transaction against a Store.  The methods behave like the package-level functions of the
+// same name.
+type Tx interface {
+	LookupUser(ctx context.Context, user *types.User) error
+	UpdateUser(ctx context.Context, user *types.User) error
+
+	LookupSession(ctx context.Context, id []byte) (*types.Session, error)
+	UpdateSession(ctx context.Context, s *types.Session) error
+	RevokeSession(ctx context.Context, id []byte, reason string) error
+
+	AddCredential(ctx context.Context, c *types.Credential) error
+	GetUserCredentials(ctx context.Context, u *types.User) ([]*types.Credential, error)
+	CheckAndUpdateSignCount(ctx context.Context, c *types.Credential) error
+
+	AddAuditEvent(ctx context.Context, e *types.AuditEvent) error
+	QueryAuditEvents(ctx context.Context, f *AuditFilter) ([]*types.AuditEvent, error)
+	AddAuditCheckpoint(ctx context.Context, c *types.AuditCheckpoint) error
+	GetAuditCheckpoints(ctx context.Context) ([]*types.AuditCheckpoint, error)
+
+	AddWebhook(ctx context.Context, w *types.Webhook) error
+	GetWebhooks(ctx context.Context) ([]*types.Webhook, error)
+	DeleteWebhook(ctx context.Context, id int64) error
+	GetWebhookCursor(ctx context.Context) (int64, error)
+	SetWebhookCursor(ctx context.Context, id int64) error
+	AddWebhookDelivery(ctx context.Context, d *types.WebhookDelivery) error
+	QueryWebhookDeliveries(ctx context.Context, f *WebhookDeliveryFilter) ([]*types.WebhookDelivery, error)
+	UpdateWebhookDelivery(ctx context.Context, d *types.WebhookDelivery) error
+
+	RedeemNonce(ctx context.Context, nonce []byte, expiresAt time.Time) error
 }
 
 // Connection is a connection to storage for jsso.
 type Connection struct {
-	db *sqlx.DB
+	db           *sqlx.DB
+	replica      *sqlx.DB      // Optional; see replica.go.
+	replicaOK    int32         // Accessed atomically; 1 if the replica is fit to use.
+	replicaDelay time.Duration // The most that a replica in use can be behind the primary.
+	cache        *sessionCache
+	retry        RetryConfig
+
+	auditEvents broadcaster // See ListenForAuditEvents.
 }
 
 // Wrap wraps an existing connection to the database.
 func Wrap(ctx context.Context, db *sql.DB) (*Connection, error) {
-	c := &Connection{db: sqlx.NewDb(db, "pgx")}
+	c := &Connection{db: sqlx.NewDb(db, "pgx"), retry: DefaultRetryConfig}
 	if err := c.db.PingContext(ctx); err != nil {
 		return nil, fmt.Errorf("sqlx ping: %w", err)
 	}
 	return c, nil
 }
 
+// Close closes the connections to the primary database and the read replica, if any.
+func (c *Connection) Close() error {
+	if c.replica != nil {
+		if err := c.replica.Close(); err != nil {
+			c.db.Close()
+			return fmt.Errorf("close replica: %w", err)
+		}
+	}
+	if err := c.db.Close(); err != nil {
+		return fmt.Errorf("close primary: %w", err)
+	}
+	return nil
+}
+
 // Connect connects to the database.
-func Connect(ctx context.Context, dsn string) (*Connection, error) {
-	db, err := sqlx.ConnectContext(ctx, "pgx", dsn)
+func Connect(ctx context.Context, cfg *Config) (*Connection, error) {
+	db, err := openDB("primary", cfg.DatabaseURL, &cfg.PoolConfig)
 	if err != nil {
-		return nil, fmt.Errorf("sqlx connect: %w", err)
+		return nil, fmt.Errorf("open database: %w", err)
 	}
-	return &Connection{db: db}, nil
+	c, err := Wrap(ctx, db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	if cfg.MaxAttempts < 1 {
+		db.Close()
+		return nil, fmt.Errorf("tx_max_attempts must be at least 1; got %d", cfg.MaxAttempts)
+	}
+	c.retry = cfg.RetryConfig
+	if err := c.connectReplica(cfg); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return c, nil
 }
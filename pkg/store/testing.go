@@ -54,17 +54,18 @@ func (EmptyDB) ExecContext(_ context.Context, _ string, _ ...interface{}) (sql.R
 	return EmptyResult{}, ErrUnimplemented
 }
 
-func ValidSession(t *testing.T, e *jtesting.E, c *Connection) *types.Session {
+// ValidSession creates a user named "test" and a session for that user that never expires.
+func ValidSession(t *testing.T, e *jtesting.E, s Store) *types.Session {
 	session := new(types.Session)
 	session.CreatedAt = timestamppb.Now()
 	session.ExpiresAt = &timestamppb.Timestamp{
 		Seconds: 1<<57 - 1,
 	}
-	err := c.DoTx(e.Context, e.Logger, false, func(tx *sqlx.Tx) error {
+	err := s.DoTx(e.Context, e.Logger, false, func(tx Tx) error {
 		user := &types.User{
 			Username: "test",
 		}
-		if err := UpdateUser(e.Context, tx, user); err != nil {
+		if err := tx.UpdateUser(e.Context, user); err != nil {
 			return fmt.Errorf("create user: %w", err)
 		}
 		session.User = user
@@ -73,7 +74,7 @@ func ValidSession(t *testing.T, e *jtesting.E, c *Connection) *types.Session {
 			return fmt.Errorf("generate session id: %w", err)
 		}
 		session.Id = id
-		if err := UpdateSession(e.Context, tx, session); err != nil {
+		if err := tx.UpdateSession(e.Context, session); err != nil {
 			return fmt.Errorf("add session: %w", err)
 		}
 		return nil
@@ -6,10 +6,12 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math/rand"
 	"strings"
 	"time"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/jrockway/jsso2/pkg/types"
 	"github.com/opentracing/opentracing-go"
 	"github.com/opentracing/opentracing-go/ext"
 	"github.com/prometheus/client_golang/prometheus"
@@ -54,8 +56,11 @@ func isRetryable(err error) bool {
 	if errors.Is(err, sql.ErrTxDone) {
 		return true
 	}
-	if strings.Contains(err.Error(), "SQLSTATE 57") { // "terminating connection due to administrator command", etc.
-		return true
+	if pgErr := pgError(err); pgErr != nil {
+		return isRetryablePgError(pgErr)
+	}
+	if code, ok := sqliteCode(err); ok {
+		return isRetryableSQLiteCode(code)
 	}
 	if errors.Is(err, io.ErrUnexpectedEOF) {
 		return true
@@ -63,10 +68,155 @@ func isRetryable(err error) bool {
 	return false
 }
 
-// DoTx executes the provied function in a transaction, retrying it if it rolls back.  You should
+// RetryConfig controls how DoTx retries failed transactions.
+type RetryConfig struct {
+	MaxAttempts    int           `long:"tx_max_attempts" description:"The maximum number of times to try a transaction that fails with a retryable error." default:"5" env:"TX_MAX_ATTEMPTS"`
+	InitialBackoff time.Duration `long:"tx_initial_backoff" description:"The maximum time to wait before the first retry of a failed transaction; doubles with each retry." default:"10ms" env:"TX_INITIAL_BACKOFF"`
+	MaxBackoff     time.Duration `long:"tx_max_backoff" description:"The maximum time to wait between retries of a failed transaction." default:"1s" env:"TX_MAX_BACKOFF"`
+}
+
+// DefaultRetryConfig is the RetryConfig used by connections created with Wrap.
+var DefaultRetryConfig = RetryConfig{
+	MaxAttempts:    MaxRetries,
+	InitialBackoff: TxDelay,
+	MaxBackoff:     MaxTxDelay,
+}
+
+// backoff returns how long to wait before the nth retry.  The delay is chosen uniformly at random
+// from zero to an exponentially-increasing cap, so that transactions that conflicted with each
+// other don't retry in lockstep.
+func (r *RetryConfig) backoff(n int) time.Duration {
+	max := r.MaxBackoff
+	if n <= 30 {
+		if d := r.InitialBackoff << (n - 1); d > 0 && d < max {
+			max = d
+		}
+	}
+	if max <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(max) + 1))
+}
+
+// DoTx implements Store.
+func (c *Connection) DoTx(ctx context.Context, l *zap.Logger, readOnly bool, f func(tx Tx) error) error {
+	return c.doTx(ctx, l, readOnly, func(tx *sqlx.Tx) error {
+		return f(&sqlTx{tx: tx})
+	})
+}
+
+// sqlTx implements Tx with the package-level functions.
+type sqlTx struct {
+	tx *sqlx.Tx
+}
+
+func (t *sqlTx) LookupUser(ctx context.Context, user *types.User) error {
+	return LookupUser(ctx, t.tx, user)
+}
+
+func (t *sqlTx) UpdateUser(ctx context.Context, user *types.User) error {
+	return UpdateUser(ctx, t.tx, user)
+}
+
+func (t *sqlTx) LookupSession(ctx context.Context, id []byte) (*types.Session, error) {
+	return LookupSession(ctx, t.tx, id)
+}
+
+func (t *sqlTx) UpdateSession(ctx context.Context, s *types.Session) error {
+	return UpdateSession(ctx, t.tx, s)
+}
+
+func (t *sqlTx) RevokeSession(ctx context.Context, id []byte, reason string) error {
+	return RevokeSession(ctx, t.tx, id, reason)
+}
+
+func (t *sqlTx) AddCredential(ctx context.Context, c *types.Credential) error {
+	return AddCredential(ctx, t.tx, c)
+}
+
+func (t *sqlTx) GetUserCredentials(ctx context.Context, u *types.User) ([]*types.Credential, error) {
+	return GetUserCredentials(ctx, t.tx, u)
+}
+
+func (t *sqlTx) CheckAndUpdateSignCount(ctx context.Context, c *types.Credential) error {
+	return CheckAndUpdateSignCount(ctx, t.tx, c)
+}
+
+func (t *sqlTx) AddAuditEvent(ctx context.Context, e *types.AuditEvent) error {
+	return AddAuditEvent(ctx, t.tx, e)
+}
+
+func (t *sqlTx) QueryAuditEvents(ctx context.Context, f *AuditFilter) ([]*types.AuditEvent, error) {
+	return QueryAuditEvents(ctx, t.tx, f)
+}
+
+func (t *sqlTx) AddAuditCheckpoint(ctx context.Context, c *types.AuditCheckpoint) error {
+	return AddAuditCheckpoint(ctx, t.tx, c)
+}
+
+func (t *sqlTx) GetAuditCheckpoints(ctx context.Context) ([]*types.AuditCheckpoint, error) {
+	return GetAuditCheckpoints(ctx, t.tx)
+}
+
+func (t *sqlTx) AddWebhook(ctx context.Context, w *types.Webhook) error {
+	return AddWebhook(ctx, t.tx, w)
+}
+
+func (t *sqlTx) GetWebhooks(ctx context.Context) ([]*types.Webhook, error) {
+	return GetWebhooks(ctx, t.tx)
+}
+
+func (t *sqlTx) DeleteWebhook(ctx context.Context, id int64) error {
+	return DeleteWebhook(ctx, t.tx, id)
+}
+
+func (t *sqlTx) GetWebhookCursor(ctx context.Context) (int64, error) {
+	return GetWebhookCursor(ctx, t.tx)
+}
+
+func (t *sqlTx) SetWebhookCursor(ctx context.Context, id int64) error {
+	return SetWebhookCursor(ctx, t.tx, id)
+}
+
+func (t *sqlTx) AddWebhookDelivery(ctx context.Context, d *types.WebhookDelivery) error {
+	return AddWebhookDelivery(ctx, t.tx, d)
+}
+
+func (t *sqlTx) QueryWebhookDeliveries(ctx context.Context, f *WebhookDeliveryFilter) ([]*types.WebhookDelivery, error) {
+	return QueryWebhookDeliveries(ctx, t.tx, f)
+}
+
+func (t *sqlTx) UpdateWebhookDelivery(ctx context.Context, d *types.WebhookDelivery) error {
+	return UpdateWebhookDelivery(ctx, t.tx, d)
+}
+
+func (t *sqlTx) RedeemNonce(ctx context.Context, nonce []byte, expiresAt time.Time) error {
+	return RedeemNonce(ctx, t.tx, nonce, expiresAt)
+}
+
+// doTx executes the provied function in a transaction, retrying it if it rolls back.  You should
 // not manually commit or roll back the provided transaction; return an error to roll back or return
 // nil to commit.
-func (c *Connection) DoTx(origCtx context.Context, l *zap.Logger, readOnly bool, f func(tx *sqlx.Tx) error) error {
+func (c *Connection) doTx(ctx context.Context, l *zap.Logger, readOnly bool, f func(tx *sqlx.Tx) error) error {
+	return runTx(ctx, l, &c.retry, func(ctx context.Context) (*sqlx.Tx, error) {
+		db, opts, pool := c.dbFor(ctx, readOnly)
+		txRouted.WithLabelValues(pool).Inc()
+		tx, err := db.BeginTxx(ctx, opts)
+		if err != nil && pool == "replica" {
+			// Stop using the replica until the next successful lag check, and retry on the
+			// primary right away.
+			l.Debug("DoTx: problem starting transaction on replica; falling back to primary", zap.Error(err))
+			c.markReplica(false)
+			db, opts, pool = c.dbFor(ctx, readOnly)
+			txRouted.WithLabelValues(pool).Inc()
+			tx, err = db.BeginTxx(ctx, opts)
+		}
+		return tx, err
+	}, f)
+}
+
+// runTx runs f in a transaction started by begin, retrying according to retry.
+func runTx(origCtx context.Context, l *zap.Logger, retry *RetryConfig, begin func(ctx context.Context) (*sqlx.Tx, error), f func(tx *sqlx.Tx) error) error {
 	span, ctx := opentracing.StartSpanFromContext(origCtx, "do_tx")
 	var errs []error
 	defer span.Finish()
@@ -78,17 +228,32 @@ func (c *Connection) DoTx(origCtx context.Context, l *zap.Logger, readOnly bool,
 			l.Debug("DoTx: early return hides some errors", zap.Errors("errors", errs))
 		}
 	}()
-	for i := 0; i < MaxRetries; i++ {
+	attempts := retry.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	for i := 0; i < attempts; i++ {
 		span.LogKV("attempt", i)
 		if i != 0 {
-			l.Debug("DoTx: retrying transaction after a delay", zap.Int("attempt", i), zap.Int("max_attempts", MaxRetries), zap.Errors("errors", errs), zap.Duration("delay", TxDelay))
-			time.Sleep(TxDelay)
+			delay := retry.backoff(i)
+			if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+				l.Debug("DoTx: not retrying transaction; the delay would exceed the context deadline", zap.Int("attempt", i), zap.Duration("delay", delay), zap.Time("deadline", deadline))
+				break
+			}
+			l.Debug("DoTx: retrying transaction after a delay", zap.Int("attempt", i), zap.Int("max_attempts", attempts), zap.Errors("errors", errs), zap.Duration("delay", delay))
+			t := time.NewTimer(delay)
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				l.Debug("DoTx: context done while waiting to retry transaction", zap.Error(ctx.Err()))
+			case <-t.C:
+			}
+			if ctx.Err() != nil {
+				break
+			}
 		}
 		txStarted.Inc()
-		tx, err := c.db.BeginTxx(ctx, &sql.TxOptions{
-			Isolation: sql.LevelSerializable,
-			ReadOnly:  readOnly,
-		})
+		tx, err := begin(ctx)
 		if err != nil {
 			txFinished.WithLabelValues("failed_start").Inc()
 			if isRetryable(err) {
@@ -117,6 +282,7 @@ func (c *Connection) DoTx(origCtx context.Context, l *zap.Logger, readOnly bool,
 				errs = append(errs, fmt.Errorf("attempt %d: commit: %w", i, err))
 				continue
 			}
+			return fmt.Errorf("attempt %d: commit: non-retryable error: %w", i, err)
 		}
 		txFinished.WithLabelValues("commit").Inc()
 		return nil
@@ -133,7 +299,7 @@ func (c *Connection) DoTx(origCtx context.Context, l *zap.Logger, readOnly bool,
 	} else {
 		// We do this dance so that Unwrap on the returned error yields the error from the last attempt.
 		msg := new(strings.Builder)
-		msg.WriteString(fmt.Sprintf("transaction failed after %d attempts: \n", MaxRetries))
+		msg.WriteString(fmt.Sprintf("transaction failed after %d attempts: \n", len(errs)))
 		for i := 0; i < len(errs)-1; i++ {
 			msg.WriteString("    ")
 			msg.WriteString(errs[i].Error())
@@ -1,11 +1,23 @@
 package store
 
 import (
+	"context"
+	"database/sql"
 	"errors"
+	"fmt"
+	"io"
 	"testing"
+	"time"
 
+	"github.com/jackc/pgconn"
 	"github.com/jmoiron/sqlx"
 	"github.com/jrockway/jsso2/pkg/jtesting"
+	"github.com/jrockway/jsso2/pkg/types"
+	"go.uber.org/zap/zaptest"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 func TestDoTx(t *testing.T) {
@@ -14,7 +26,7 @@ func TestDoTx(t *testing.T) {
 
 		// Don't retry non-retryable errors.
 		var n int
-		err := c.DoTx(e.Context, e.Logger, false, func(tx *sqlx.Tx) error {
+		err := c.doTx(e.Context, e.Logger, false, func(tx *sqlx.Tx) error {
 			n++
 			return errors.New("oh no")
 		})
@@ -27,7 +39,7 @@ func TestDoTx(t *testing.T) {
 
 		// Retry retryable errors.
 		n = 0
-		err = c.DoTx(e.Context, e.Logger, false, func(tx *sqlx.Tx) error {
+		err = c.doTx(e.Context, e.Logger, false, func(tx *sqlx.Tx) error {
 			n++
 			return WrapRetryable(errors.New("oh no"))
 		})
@@ -40,7 +52,7 @@ func TestDoTx(t *testing.T) {
 
 		// Retry if the transaction gets into the "already committed or rolled back" state.
 		n = 0
-		err = c.DoTx(e.Context, e.Logger, false, func(tx *sqlx.Tx) error {
+		err = c.doTx(e.Context, e.Logger, false, func(tx *sqlx.Tx) error {
 			n++
 			if n < 2 {
 				tx.Rollback()
@@ -55,3 +67,167 @@ func TestDoTx(t *testing.T) {
 		}
 	})
 }
+
+func TestIsRetryable(t *testing.T) {
+	testData := []struct {
+		err  error
+		want bool
+	}{
+		{errors.New("oh no"), false},
+		{WrapRetryable(errors.New("oh no")), true},
+		{fmt.Errorf("commit: %w", sql.ErrTxDone), true},
+		{fmt.Errorf("read: %w", io.ErrUnexpectedEOF), true},
+		{fmt.Errorf("insert: %w", &pgconn.PgError{Code: "40001"}), true},
+		{fmt.Errorf("insert: %w", &pgconn.PgError{Code: "40P01"}), true},
+		{fmt.Errorf("insert: %w", &pgconn.PgError{Code: "57P01"}), true},
+		{fmt.Errorf("insert: %w", &pgconn.PgError{Code: "08006"}), true},
+		{fmt.Errorf("select: %w", &pgconn.PgError{Code: "57014"}), false},
+		{fmt.Errorf("insert: %w", &pgconn.PgError{Code: "23505"}), false},
+		{errors.New("ERROR: terminating connection due to administrator command (SQLSTATE 57P01)"), false},
+	}
+	for _, test := range testData {
+		if got, want := isRetryable(test.err), test.want; got != want {
+			t.Errorf("isRetryable(%v):\n  got: %v\n want: %v", test.err, got, want)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	r := &RetryConfig{InitialBackoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond}
+	for n, max := range []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 40 * time.Millisecond, 50 * time.Millisecond, 50 * time.Millisecond} {
+		for i := 0; i < 100; i++ {
+			if got := r.backoff(n + 1); got < 0 || got > max {
+				t.Errorf("backoff(%d) = %v, want [0, %v]", n+1, got, max)
+			}
+		}
+	}
+	if got := r.backoff(1000); got < 0 || got > r.MaxBackoff {
+		t.Errorf("backoff(1000) = %v, want [0, %v]", got, r.MaxBackoff)
+	}
+	if got := (&RetryConfig{}).backoff(1); got != 0 {
+		t.Errorf("zero config: backoff(1) = %v, want 0", got)
+	}
+}
+
+func TestDoTxRespectsDeadline(t *testing.T) {
+	jtesting.Run(t, "deadline", jtesting.R{Logger: true, Database: true}, func(t *testing.T, e *jtesting.E) {
+		c := MustGetTestDB(t, e)
+		c.retry = RetryConfig{MaxAttempts: 100, InitialBackoff: time.Second, MaxBackoff: time.Second}
+		ctx, cancel := context.WithTimeout(e.Context, 100*time.Millisecond)
+		defer cancel()
+		var n int
+		start := time.Now()
+		err := c.doTx(ctx, e.Logger, false, func(tx *sqlx.Tx) error {
+			n++
+			return &pgconn.PgError{Code: "40001"}
+		})
+		if err == nil {
+			t.Fatal("DoTx should have errored")
+		}
+		if got, want := time.Since(start), time.Second; got >= want {
+			t.Errorf("DoTx took %v, longer than the context deadline allows", got)
+		}
+		if n >= 100 {
+			t.Errorf("DoTx tried %d times; expected it to give up at the deadline", n)
+		}
+		if s, _ := status.FromError(AsGRPCError(err)); s.Code() != codes.Unavailable {
+			t.Errorf("serialization failure: expected Unavailable, got %v", s.Code())
+		}
+	})
+}
+
+func TestMemoryDoTxRetries(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	m := NewMemory()
+	m.Retry = RetryConfig{MaxAttempts: 3}
+	l := zaptest.NewLogger(t)
+
+	var n int
+	if err := m.DoTx(ctx, l, false, func(tx Tx) error {
+		n++
+		return WrapRetryable(errors.New("try again"))
+	}); err == nil {
+		t.Error("retryable error: expected error")
+	}
+	if got, want := n, 3; got != want {
+		t.Errorf("attempts at a retryable error:\n  got: %v\n want: %v", got, want)
+	}
+
+	n = 0
+	if err := m.DoTx(ctx, l, false, func(tx Tx) error {
+		n++
+		return errors.New("oh no")
+	}); err == nil {
+		t.Error("non-retryable error: expected error")
+	}
+	if got, want := n, 1; got != want {
+		t.Errorf("attempts at a non-retryable error:\n  got: %v\n want: %v", got, want)
+	}
+}
+
+func TestMemoryRollbackSharedTables(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	m := NewMemory()
+	l := zaptest.NewLogger(t)
+	now := time.Now().Round(time.Millisecond)
+
+	event := func(action string) *types.AuditEvent {
+		return &types.AuditEvent{CreatedAt: timestamppb.New(now), Action: action, Result: types.AuditEvent_SUCCESS}
+	}
+	webhook := &types.Webhook{CreatedAt: timestamppb.New(now), Url: "https://example.com/", EventTypes: []types.Event_Type{types.Event_LOGIN}, Secret: make([]byte, 32)}
+	delivery := &types.WebhookDelivery{AuditEventId: 1, EventType: types.Event_LOGIN, State: types.WebhookDelivery_PENDING, CreatedAt: timestamppb.New(now), NextAttemptAt: timestamppb.New(now)}
+	if err := m.DoTx(ctx, l, false, func(tx Tx) error {
+		if err := tx.AddAuditEvent(ctx, event("committed")); err != nil {
+			return err
+		}
+		if err := tx.AddWebhook(ctx, webhook); err != nil {
+			return err
+		}
+		delivery.WebhookId = webhook.GetId()
+		return tx.AddWebhookDelivery(ctx, delivery)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Changes to the tables that transactions share with the committed state are rolled back
+	// like any other change.
+	if err := m.DoTx(ctx, l, false, func(tx Tx) error {
+		if err := tx.AddAuditEvent(ctx, event("rolled back")); err != nil {
+			return err
+		}
+		dead := proto.Clone(delivery).(*types.WebhookDelivery)
+		dead.State = types.WebhookDelivery_DEAD
+		if err := tx.UpdateWebhookDelivery(ctx, dead); err != nil {
+			return err
+		}
+		if err := tx.DeleteWebhook(ctx, webhook.GetId()); err != nil {
+			return err
+		}
+		return errors.New("roll back")
+	}); err == nil {
+		t.Fatal("expected error")
+	}
+
+	var events []*types.AuditEvent
+	var deliveries []*types.WebhookDelivery
+	if err := m.DoTx(ctx, l, true, func(tx Tx) (err error) {
+		if events, err = tx.QueryAuditEvents(ctx, &AuditFilter{}); err != nil {
+			return err
+		}
+		deliveries, err = tx.QueryWebhookDeliveries(ctx, &WebhookDeliveryFilter{})
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(events), 1; got != want {
+		t.Errorf("audit events after rollback:\n  got: %v\n want: %v", got, want)
+	}
+	if got, want := len(deliveries), 1; got != want {
+		t.Fatalf("webhook deliveries after rollback:\n  got: %v\n want: %v", got, want)
+	}
+	if got, want := deliveries[0].GetState(), types.WebhookDelivery_PENDING; got != want {
+		t.Errorf("webhook delivery state after rollback:\n  got: %v\n want: %v", got, want)
+	}
+}
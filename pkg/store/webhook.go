@@ -0,0 +1,397 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/jrockway/jsso2/pkg/types"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// WebhookDeliveryFilter selects webhook deliveries for QueryWebhookDeliveries.  Zero-valued fields
+// match every delivery.
+type WebhookDeliveryFilter struct {
+	ID, WebhookID int64
+	State         types.WebhookDelivery_State
+	// DueBefore only matches deliveries whose next attempt is due at or before this time.
+	DueBefore time.Time
+	// BeforeID only matches deliveries with a lower ID, for paginating through results.
+	BeforeID int64
+	// Limit is the maximum number of deliveries to return; 0 means no limit.
+	Limit int
+	// OldestFirst returns deliveries in ascending order of ID, rather than newest first.
+	OldestFirst bool
+}
+
+var webhookDeliveryStates = map[types.WebhookDelivery_State]string{
+	types.WebhookDelivery_PENDING:   "pending",
+	types.WebhookDelivery_SUCCEEDED: "succeeded",
+	types.WebhookDelivery_DEAD:      "dead",
+}
+
+// eventTypeName returns the name that the database stores for an event type.
+func eventTypeName(t types.Event_Type) (string, error) {
+	name, ok := types.Event_Type_name[int32(t)]
+	if !ok || t == types.Event_TYPE_UNKNOWN {
+		return "", fmt.Errorf("unknown event type %v", t)
+	}
+	return strings.ToLower(name), nil
+}
+
+// eventTypeFromName is the inverse of eventTypeName.  Unknown names, perhaps written by a newer
+// version, become TYPE_UNKNOWN.
+func eventTypeFromName(name string) types.Event_Type {
+	return types.Event_Type(types.Event_Type_value[strings.ToUpper(name)])
+}
+
+type rawWebhook struct {
+	ID          int64     `db:"id"`
+	CreatedAt   time.Time `db:"created_at"`
+	URL         string    `db:"url"`
+	Description string    `db:"description"`
+	EventTypes  []byte    `db:"event_types"`
+	Secret      []byte    `db:"secret"`
+}
+
+const webhookColumns = `id, created_at, url, description, event_types, secret`
+
+// checkAddWebhook returns an error if a webhook passed to AddWebhook is missing required fields.
+func checkAddWebhook(w *types.Webhook) error {
+	if w == nil {
+		return &ErrEmpty{Field: "webhook"}
+	}
+	if w.GetCreatedAt() == nil {
+		return &ErrEmpty{Field: "webhook.created_at"}
+	}
+	if w.GetUrl() == "" {
+		return &ErrEmpty{Field: "webhook.url"}
+	}
+	if len(w.GetEventTypes()) == 0 {
+		return &ErrEmpty{Field: "webhook.event_types"}
+	}
+	if len(w.GetSecret()) < 32 {
+		return &ErrEmpty{Field: "webhook.secret"}
+	}
+	return nil
+}
+
+func fromWebhook(w *types.Webhook) (*rawWebhook, error) {
+	names := make([]string, 0, len(w.GetEventTypes()))
+	for _, t := range w.GetEventTypes() {
+		name, err := eventTypeName(t)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	eventTypes, err := json.Marshal(names)
+	if err != nil {
+		return nil, fmt.Errorf("marshal event types: %w", err)
+	}
+	return &rawWebhook{
+		CreatedAt:   w.GetCreatedAt().AsTime(),
+		URL:         w.GetUrl(),
+		Description: w.GetDescription(),
+		EventTypes:  eventTypes,
+		Secret:      w.GetSecret(),
+	}, nil
+}
+
+func (raw *rawWebhook) toWebhook() (*types.Webhook, error) {
+	var names []string
+	if err := json.Unmarshal(raw.EventTypes, &names); err != nil {
+		return nil, fmt.Errorf("unmarshal event types: %w", err)
+	}
+	result := &types.Webhook{
+		Id:          raw.ID,
+		CreatedAt:   timestamppb.New(raw.CreatedAt),
+		Url:         raw.URL,
+		Description: raw.Description,
+		Secret:      raw.Secret,
+	}
+	for _, name := range names {
+		result.EventTypes = append(result.EventTypes, eventTypeFromName(name))
+	}
+	return result, nil
+}
+
+type rawWebhookDelivery struct {
+	ID            int64        `db:"id"`
+	WebhookID     int64        `db:"webhook_id"`
+	AuditEventID  int64        `db:"audit_event_id"`
+	EventType     string       `db:"event_type"`
+	State         string       `db:"state"`
+	CreatedAt     time.Time    `db:"created_at"`
+	Attempts      int32        `db:"attempts"`
+	NextAttemptAt time.Time    `db:"next_attempt_at"`
+	LastAttemptAt sql.NullTime `db:"last_attempt_at"`
+	LastError     string       `db:"last_error"`
+}
+
+const webhookDeliveryColumns = `id, webhook_id, audit_event_id, event_type, state, created_at, attempts,
+    next_attempt_at, last_attempt_at, last_error`
+
+// checkWebhookDelivery returns an error if a delivery passed to AddWebhookDelivery or
+// UpdateWebhookDelivery is missing required fields.
+func checkWebhookDelivery(d *types.WebhookDelivery) error {
+	if d == nil {
+		return &ErrEmpty{Field: "webhook_delivery"}
+	}
+	if d.GetWebhookId() == 0 {
+		return &ErrEmpty{Field: "webhook_delivery.webhook_id"}
+	}
+	if d.GetAuditEventId() == 0 {
+		return &ErrEmpty{Field: "webhook_delivery.audit_event_id"}
+	}
+	if _, err := eventTypeName(d.GetEventType()); err != nil {
+		return &ErrEmpty{Field: "webhook_delivery.event_type"}
+	}
+	if _, ok := webhookDeliveryStates[d.GetState()]; !ok {
+		return &ErrEmpty{Field: "webhook_delivery.state"}
+	}
+	if d.GetCreatedAt() == nil {
+		return &ErrEmpty{Field: "webhook_delivery.created_at"}
+	}
+	if d.GetNextAttemptAt() == nil {
+		return &ErrEmpty{Field: "webhook_delivery.next_attempt_at"}
+	}
+	return nil
+}
+
+func fromWebhookDelivery(d *types.WebhookDelivery) *rawWebhookDelivery {
+	eventType, _ := eventTypeName(d.GetEventType())
+	result := &rawWebhookDelivery{
+		ID:            d.GetId(),
+		WebhookID:     d.GetWebhookId(),
+		AuditEventID:  d.GetAuditEventId(),
+		EventType:     eventType,
+		State:         webhookDeliveryStates[d.GetState()],
+		CreatedAt:     d.GetCreatedAt().AsTime(),
+		Attempts:      d.GetAttempts(),
+		NextAttemptAt: d.GetNextAttemptAt().AsTime(),
+		LastError:     d.GetLastError(),
+	}
+	if t := d.GetLastAttemptAt(); t != nil {
+		result.LastAttemptAt = sql.NullTime{Time: t.AsTime(), Valid: true}
+	}
+	return result
+}
+
+func (raw *rawWebhookDelivery) toWebhookDelivery() *types.WebhookDelivery {
+	result := &types.WebhookDelivery{
+		Id:            raw.ID,
+		WebhookId:     raw.WebhookID,
+		AuditEventId:  raw.AuditEventID,
+		EventType:     eventTypeFromName(raw.EventType),
+		CreatedAt:     timestamppb.New(raw.CreatedAt),
+		Attempts:      raw.Attempts,
+		NextAttemptAt: timestamppb.New(raw.NextAttemptAt),
+		LastError:     raw.LastError,
+	}
+	for s, name := range webhookDeliveryStates {
+		if name == raw.State {
+			result.State = s
+		}
+	}
+	if raw.LastAttemptAt.Valid {
+		result.LastAttemptAt = timestamppb.New(raw.LastAttemptAt.Time)
+	}
+	return result
+}
+
+// webhookDeliveryQuery builds a query for the deliveries that f selects, with ? placeholders.
+// toTime converts a time to the representation that the database stores.
+func webhookDeliveryQuery(f *WebhookDeliveryFilter, toTime func(time.Time) interface{}) (string, []interface{}, error) {
+	if f == nil {
+		return "", nil, &ErrEmpty{Field: "filter"}
+	}
+	var conds []string
+	var args []interface{}
+	add := func(cond string, arg interface{}) {
+		conds = append(conds, cond)
+		args = append(args, arg)
+	}
+	if id := f.ID; id > 0 {
+		add("id=?", id)
+	}
+	if id := f.WebhookID; id > 0 {
+		add("webhook_id=?", id)
+	}
+	if s := f.State; s != types.WebhookDelivery_STATE_UNKNOWN {
+		name, ok := webhookDeliveryStates[s]
+		if !ok {
+			return "", nil, fmt.Errorf("unknown state %v", s)
+		}
+		add("state=?", name)
+	}
+	if !f.DueBefore.IsZero() {
+		add("next_attempt_at<=?", toTime(f.DueBefore))
+	}
+	if id := f.BeforeID; id > 0 {
+		add("id<?", id)
+	}
+	query := new(strings.Builder)
+	query.WriteString("select " + webhookDeliveryColumns + " from webhook_delivery")
+	if len(conds) > 0 {
+		query.WriteString(" where " + strings.Join(conds, " and "))
+	}
+	if f.OldestFirst {
+		query.WriteString(" order by id asc")
+	} else {
+		query.WriteString(" order by id desc")
+	}
+	if n := f.Limit; n > 0 {
+		query.WriteString(" limit ?")
+		args = append(args, n)
+	}
+	return query.String(), args, nil
+}
+
+// AddWebhook adds a webhook subscription, filling in its ID.
+func AddWebhook(ctx context.Context, db sqlx.ExtContext, w *types.Webhook) error {
+	if err := checkAddWebhook(w); err != nil {
+		return err
+	}
+	obj, err := fromWebhook(w)
+	if err != nil {
+		return fmt.Errorf("marshal webhook: %w", err)
+	}
+	if err := db.QueryRowxContext(ctx, `insert into webhook (created_at, url, description, event_types, secret) values ($1, $2, $3, $4, $5) returning id`,
+		obj.CreatedAt, obj.URL, obj.Description, obj.EventTypes, obj.Secret).Scan(&w.Id); err != nil {
+		return fmt.Errorf("insert: %w", err)
+	}
+	return nil
+}
+
+// GetWebhooks returns every webhook subscription, including its secret, in order of ID.
+func GetWebhooks(ctx context.Context, db sqlx.ExtContext) ([]*types.Webhook, error) {
+	rows, err := db.QueryxContext(ctx, `select `+webhookColumns+` from webhook order by id`)
+	if err != nil {
+		return nil, fmt.Errorf("select: %w", err)
+	}
+	defer rows.Close()
+	var result []*types.Webhook
+	for rows.Next() {
+		raw := &rawWebhook{}
+		if err := rows.StructScan(raw); err != nil {
+			return nil, fmt.Errorf("select: scan: %w", err)
+		}
+		w, err := raw.toWebhook()
+		if err != nil {
+			return nil, fmt.Errorf("convert to *types.Webhook: %w", err)
+		}
+		result = append(result, w)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("select: iterate over rows: %w", err)
+	}
+	return result, nil
+}
+
+// DeleteWebhook deletes a webhook subscription and its deliveries.  It returns sql.ErrNoRows if
+// there is no such webhook.
+func DeleteWebhook(ctx context.Context, db sqlx.ExtContext, id int64) error {
+	result, err := db.ExecContext(ctx, `delete from webhook where id=$1`, id)
+	if err != nil {
+		return fmt.Errorf("delete: %w", err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("delete: rows affected: %w", err)
+	} else if n == 0 {
+		return fmt.Errorf("delete: %w", sql.ErrNoRows)
+	}
+	return nil
+}
+
+// GetWebhookCursor returns the ID of the last audit event that was dispatched to webhooks, or
+// sql.ErrNoRows if dispatching has never started.
+func GetWebhookCursor(ctx context.Context, db sqlx.ExtContext) (int64, error) {
+	var id int64
+	if err := db.QueryRowxContext(ctx, `select audit_event_id from webhook_cursor`).Scan(&id); err != nil {
+		return 0, fmt.Errorf("select: %w", err)
+	}
+	return id, nil
+}
+
+// SetWebhookCursor records the ID of the last audit event that was dispatched to webhooks.
+func SetWebhookCursor(ctx context.Context, db sqlx.ExtContext, id int64) error {
+	if _, err := db.ExecContext(ctx, `insert into webhook_cursor (audit_event_id) values ($1)
+            on conflict (id) do update set audit_event_id=excluded.audit_event_id`, id); err != nil {
+		return fmt.Errorf("upsert: %w", err)
+	}
+	return nil
+}
+
+// AddWebhookDelivery queues a delivery, filling in its ID.
+func AddWebhookDelivery(ctx context.Context, db sqlx.ExtContext, d *types.WebhookDelivery) error {
+	if err := checkWebhookDelivery(d); err != nil {
+		return err
+	}
+	obj := fromWebhookDelivery(d)
+	rows, err := sqlx.NamedQueryContext(ctx, db, `insert into webhook_delivery
+                  ( webhook_id,  audit_event_id,  event_type,  state,  created_at,  attempts,  next_attempt_at,  last_attempt_at,  last_error)
+            values(:webhook_id, :audit_event_id, :event_type, :state, :created_at, :attempts, :next_attempt_at, :last_attempt_at, :last_error)
+            returning (id)`, obj)
+	if err != nil {
+		return fmt.Errorf("insert: %w", err)
+	}
+	defer rows.Close()
+	if ok := rows.Next(); !ok {
+		return errors.New("insert: no id returned")
+	}
+	if err := rows.Scan(&d.Id); err != nil {
+		return fmt.Errorf("insert: scan id: %w", err)
+	}
+	return nil
+}
+
+// QueryWebhookDeliveries returns the deliveries that match the filter, newest first.
+func QueryWebhookDeliveries(ctx context.Context, db sqlx.ExtContext, f *WebhookDeliveryFilter) ([]*types.WebhookDelivery, error) {
+	query, args, err := webhookDeliveryQuery(f, func(t time.Time) interface{} { return t })
+	if err != nil {
+		return nil, fmt.Errorf("build query: %w", err)
+	}
+	rows, err := db.QueryxContext(ctx, db.Rebind(query), args...)
+	if err != nil {
+		return nil, fmt.Errorf("select: %w", err)
+	}
+	defer rows.Close()
+	var result []*types.WebhookDelivery
+	for rows.Next() {
+		raw := &rawWebhookDelivery{}
+		if err := rows.StructScan(raw); err != nil {
+			return nil, fmt.Errorf("select: scan: %w", err)
+		}
+		result = append(result, raw.toWebhookDelivery())
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("select: iterate over rows: %w", err)
+	}
+	return result, nil
+}
+
+// UpdateWebhookDelivery records the outcome of a delivery attempt: its state, attempts, next and
+// last attempt times, and last error.  It returns sql.ErrNoRows if there is no such delivery.
+func UpdateWebhookDelivery(ctx context.Context, db sqlx.ExtContext, d *types.WebhookDelivery) error {
+	if err := checkWebhookDelivery(d); err != nil {
+		return err
+	}
+	obj := fromWebhookDelivery(d)
+	result, err := sqlx.NamedExecContext(ctx, db, `update webhook_delivery set state=:state, attempts=:attempts,
+            next_attempt_at=:next_attempt_at, last_attempt_at=:last_attempt_at, last_error=:last_error where id=:id`, obj)
+	if err != nil {
+		return fmt.Errorf("update: %w", err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("update: rows affected: %w", err)
+	} else if n == 0 {
+		return fmt.Errorf("update: %w", sql.ErrNoRows)
+	}
+	return nil
+}
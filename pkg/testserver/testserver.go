@@ -19,6 +19,9 @@ type S struct {
 	WantRootClient bool
 	Credentials    *client.Credentials
 	App            *cmd.App
+
+	// If true, the server is backed by store.NewMemory() instead of a test database.
+	InMemory bool
 }
 
 func New() *S {
@@ -38,6 +41,9 @@ func (s *S) Setup(t *testing.T, e *jtesting.E, server *grpc.Server) {
 	jssopb.RegisterUserService(server, jssopb.NewUserService(s.App.UserService))
 	jssopb.RegisterLoginService(server, jssopb.NewLoginService(s.App.LoginService))
 	jssopb.RegisterSessionService(server, jssopb.NewSessionService(s.App.SessionService))
+	jssopb.RegisterAuditService(server, jssopb.NewAuditService(s.App.AuditService))
+	jssopb.RegisterEventsService(server, jssopb.NewEventsService(s.App.EventsService))
+	jssopb.RegisterWebhooksService(server, jssopb.NewWebhooksService(s.App.WebhooksService))
 }
 
 // OK, maybe I went overboard with single-letter type names.
@@ -47,12 +53,24 @@ func (s *S) ToR(r *jtesting.R) {
 	if s.WantRootClient {
 		s.Credentials = &client.Credentials{Root: "root"}
 	}
-	r.DatabaseReady = func(t *testing.T, e *jtesting.E) {
-		db := store.MustGetTestDB(t, e)
-		var err error
-		s.App, err = cmd.Setup(s.AppConfig, s.AuthConfig, db)
-		if err != nil {
-			t.Fatal(err)
+	if s.InMemory {
+		r.Database = false
+		r.DatabaseReady = func(t *testing.T, e *jtesting.E) {
+			var err error
+			s.App, err = cmd.Setup(s.AppConfig, s.AuthConfig, store.NewMemory())
+			if err != nil {
+				t.Fatalf("setup app: %v", err)
+			}
+		}
+	} else {
+		r.DatabaseReady = func(t *testing.T, e *jtesting.E) {
+			db := store.MustGetTestDB(t, e)
+			go db.ListenForAuditEvents(e.Context, e.Logger.Named("audit_listener"))
+			var err error
+			s.App, err = cmd.Setup(s.AppConfig, s.AuthConfig, db)
+			if err != nil {
+				t.Fatal(err)
+			}
 		}
 	}
 	r.GRPCOptions = func(e *jtesting.E) []grpc.ServerOption {
@@ -0,0 +1,183 @@
+package tokens
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// KeyLength is the length of a token key, in bytes.
+const KeyLength = 32
+
+// Key is a token key and its ID.  The ID is recorded in the footer of tokens issued with the key, so
+// that the verifier can find the key without trying every key in the keyring.
+type Key struct {
+	ID     string
+	Secret []byte
+}
+
+func (k *Key) check() error {
+	if n := len(k.Secret); n != KeyLength {
+		return fmt.Errorf("invalid key length; got %d bytes, want %d bytes", n, KeyLength)
+	}
+	var nonNull bool
+	for _, b := range k.Secret {
+		if b != 0 {
+			nonNull = true
+			break
+		}
+	}
+	if !nonNull {
+		return errors.New("key is entirely null bytes; probably a configuration problem")
+	}
+	if strings.ContainsAny(k.ID, ":, \t\n") {
+		return fmt.Errorf("key id %q may not contain colons, commas, or whitespace", k.ID)
+	}
+	return nil
+}
+
+// GenerateKey returns a new random key.  If id is empty, the current UTC time is used as the ID.
+func GenerateKey(id string) (*Key, error) {
+	if id == "" {
+		id = time.Now().UTC().Format("20060102150405")
+	}
+	k := &Key{ID: id, Secret: make([]byte, KeyLength)}
+	if _, err := rand.Read(k.Secret); err != nil {
+		return nil, fmt.Errorf("read random bytes: %w", err)
+	}
+	if err := k.check(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Keyring is a set of keys.  The first key is the active key, used to issue new tokens; the others
+// are only used to verify tokens issued before the active key was rotated in.
+//
+// To rotate keys without downtime, add a new key to the end of the keyring and deploy that to
+// every replica, then move it to the front and deploy again.  Once the old active key's tokens
+// have expired, it can be removed.
+type Keyring struct {
+	keys []*Key
+}
+
+// NewKeyring returns a keyring containing the provided keys, the first of which is active.
+func NewKeyring(keys ...*Key) (*Keyring, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("keyring must contain at least one key")
+	}
+	seen := make(map[string]struct{})
+	for i, k := range keys {
+		if err := k.check(); err != nil {
+			return nil, fmt.Errorf("key %d (%q): %w", i, k.ID, err)
+		}
+		if k.ID == "" && len(keys) > 1 {
+			return nil, fmt.Errorf("key %d: keys in a keyring with more than one key must have an id", i)
+		}
+		if _, ok := seen[k.ID]; ok {
+			return nil, fmt.Errorf("key %d: duplicate id %q", i, k.ID)
+		}
+		seen[k.ID] = struct{}{}
+	}
+	return &Keyring{keys: keys}, nil
+}
+
+// ParseKeyring parses a keyring in the format produced by Keyring.String, a comma-separated list of
+// id:base64-secret pairs.
+func ParseKeyring(s string) (*Keyring, error) {
+	var keys []*Key
+	for i, part := range strings.Split(strings.TrimSpace(s), ",") {
+		part = strings.TrimSpace(part)
+		colon := strings.IndexByte(part, ':')
+		if colon < 1 {
+			return nil, fmt.Errorf("key %d: expected id:base64-secret", i)
+		}
+		secret, err := base64.StdEncoding.DecodeString(part[colon+1:])
+		if err != nil {
+			return nil, fmt.Errorf("key %d (%q): decode secret: %w", i, part[:colon], err)
+		}
+		keys = append(keys, &Key{ID: part[:colon], Secret: secret})
+	}
+	return NewKeyring(keys...)
+}
+
+// String returns the keyring in the format accepted by ParseKeyring.  The output contains the
+// secret keys.
+func (r *Keyring) String() string {
+	parts := make([]string, len(r.keys))
+	for i, k := range r.keys {
+		parts[i] = k.ID + ":" + base64.StdEncoding.EncodeToString(k.Secret)
+	}
+	return strings.Join(parts, ",")
+}
+
+// Active returns the key used to issue new tokens.
+func (r *Keyring) Active() *Key {
+	if r == nil || len(r.keys) == 0 {
+		return nil
+	}
+	return r.keys[0]
+}
+
+// Get returns the key with the provided ID, or nil if there is no such key.
+func (r *Keyring) Get(id string) *Key {
+	if r == nil {
+		return nil
+	}
+	for _, k := range r.keys {
+		if k.ID == id {
+			return k
+		}
+	}
+	return nil
+}
+
+// All returns every key in the keyring, active key first.
+func (r *Keyring) All() []*Key {
+	if r == nil {
+		return nil
+	}
+	return append([]*Key(nil), r.keys...)
+}
+
+// Add returns a new keyring with k added as an inactive key.
+func (r *Keyring) Add(k *Key) (*Keyring, error) {
+	return NewKeyring(append(r.All(), k)...)
+}
+
+// Activate returns a new keyring in which the key with the provided ID is active.  The previously
+// active key remains available for verification.
+func (r *Keyring) Activate(id string) (*Keyring, error) {
+	k := r.Get(id)
+	if k == nil {
+		return nil, fmt.Errorf("no key with id %q", id)
+	}
+	keys := []*Key{k}
+	for _, other := range r.keys {
+		if other.ID != id {
+			keys = append(keys, other)
+		}
+	}
+	return NewKeyring(keys...)
+}
+
+// Remove returns a new keyring without the key with the provided ID.  The active key can't be
+// removed; activate another key first.
+func (r *Keyring) Remove(id string) (*Keyring, error) {
+	if r.Get(id) == nil {
+		return nil, fmt.Errorf("no key with id %q", id)
+	}
+	if r.Active().ID == id {
+		return nil, fmt.Errorf("key %q is active; activate another key before removing it", id)
+	}
+	var keys []*Key
+	for _, k := range r.keys {
+		if k.ID != id {
+			keys = append(keys, k)
+		}
+	}
+	return NewKeyring(keys...)
+}
@@ -0,0 +1,167 @@
+package tokens
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jrockway/jsso2/pkg/types"
+	"github.com/o1egl/paseto/v2"
+	"google.golang.org/protobuf/proto"
+)
+
+// Public tokens are signed with Ed25519 (PASETO v2.public) instead of being encrypted, so that
+// they can be verified by anyone who has the public key, without giving them the ability to mint
+// their own.  Their contents are readable by anyone that has the token.  The keyring for public
+// tokens uses the same format as the keyring for private tokens; each secret is an Ed25519 seed.
+
+// PublicKey is the public half of a key that signs public tokens.
+type PublicKey struct {
+	ID  string
+	Key ed25519.PublicKey
+}
+
+// PublicKeys returns the public keys corresponding to every key in the keyring, active key first.
+func (r *Keyring) PublicKeys() []*PublicKey {
+	var result []*PublicKey
+	for _, k := range r.All() {
+		result = append(result, &PublicKey{
+			ID:  k.ID,
+			Key: ed25519.NewKeyFromSeed(k.Secret).Public().(ed25519.PublicKey),
+		})
+	}
+	return result
+}
+
+// Sign generates a public token from the provided protocol message, signing it with the keyring's
+// active key.
+func Sign(msg proto.Message, keys *Keyring) (string, error) {
+	k := keys.Active()
+	if k == nil || len(k.Secret) != ed25519.SeedSize {
+		return "", ErrInvalidKey
+	}
+	payload, err := wrap(msg, time.Now())
+	if err != nil {
+		return "", err
+	}
+	token, err := paseto.Sign(ed25519.NewKeyFromSeed(k.Secret), payload, footerFor(k.ID))
+	if err != nil {
+		return "", fmt.Errorf("sign payload: %w", err)
+	}
+	return token, nil
+}
+
+// VerifySignedAndUnmarshal unmarshals a token created by Sign into the provided protocol message.
+// Like VerifyAndUnmarshal, an error is returned if the token is too new, too old, has an invalid
+// signature, or contains a message of the wrong type.
+func VerifySignedAndUnmarshal(dst proto.Message, token string, maxAge time.Duration, keys []*PublicKey) error {
+	if token == "" {
+		return ErrEmptyToken
+	}
+	id, err := KeyID(token)
+	if err != nil {
+		return err
+	}
+	var candidates []*PublicKey
+	for _, k := range keys {
+		if id == "" || k.ID == id {
+			candidates = append(candidates, k)
+		}
+	}
+	if len(candidates) == 0 {
+		return fmt.Errorf("%w (key id %q)", ErrUnknownKey, id)
+	}
+	var payload []byte
+	var verifyErr error
+	for _, k := range candidates {
+		var f string
+		payload = nil
+		if verifyErr = paseto.Verify(token, k.Key, &payload, &f); verifyErr == nil {
+			break
+		}
+	}
+	if verifyErr != nil {
+		return fmt.Errorf("verify token: %w", verifyErr)
+	}
+	wrapper := &types.SecureToken{}
+	if err := proto.Unmarshal(payload, wrapper); err != nil {
+		return fmt.Errorf("unmarshal SecureToken: %w", err)
+	}
+	return unwrap(dst, wrapper, maxAge)
+}
+
+// jwk is an Ed25519 public key in the format described by RFC 8037.
+type jwk struct {
+	KeyType string `json:"kty"`
+	Curve   string `json:"crv"`
+	KeyID   string `json:"kid"`
+	Use     string `json:"use"`
+	X       string `json:"x"`
+}
+
+type jwks struct {
+	Keys []*jwk `json:"keys"`
+}
+
+// MarshalJWKS returns the provided public keys as a JSON Web Key Set.  The tokens they verify are
+// PASETO tokens, not JWTs, but the format is widely understood and easy to fetch.
+func MarshalJWKS(keys []*PublicKey) ([]byte, error) {
+	set := &jwks{Keys: []*jwk{}}
+	for _, k := range keys {
+		set.Keys = append(set.Keys, &jwk{
+			KeyType: "OKP",
+			Curve:   "Ed25519",
+			KeyID:   k.ID,
+			Use:     "sig",
+			X:       base64.RawURLEncoding.EncodeToString(k.Key),
+		})
+	}
+	return json.Marshal(set)
+}
+
+// ParseJWKS reads a JSON Web Key Set produced by MarshalJWKS.  Keys of other types are ignored.
+func ParseJWKS(r io.Reader) ([]*PublicKey, error) {
+	set := new(jwks)
+	if err := json.NewDecoder(r).Decode(set); err != nil {
+		return nil, fmt.Errorf("decode key set: %w", err)
+	}
+	var result []*PublicKey
+	for i, k := range set.Keys {
+		if k.KeyType != "OKP" || k.Curve != "Ed25519" {
+			continue
+		}
+		x, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(k.X, "="))
+		if err != nil {
+			return nil, fmt.Errorf("key %d (%q): decode public key: %w", i, k.KeyID, err)
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("key %d (%q): public key is %d bytes, want %d", i, k.KeyID, len(x), ed25519.PublicKeySize)
+		}
+		result = append(result, &PublicKey{ID: k.KeyID, Key: ed25519.PublicKey(x)})
+	}
+	if len(result) == 0 {
+		return nil, errors.New("key set contains no Ed25519 keys")
+	}
+	return result, nil
+}
+
+// JWKSHandler serves the public keys of the provided keyring as a JSON Web Key Set.  If the keyring
+// is nil, the set is empty.
+func JWKSHandler(keys *Keyring) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, err := MarshalJWKS(keys.PublicKeys())
+		if err != nil {
+			http.Error(w, fmt.Sprintf("marshal keys: %v", err), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("content-type", "application/json")
+		w.Header().Set("cache-control", "public, max-age=300")
+		w.Write(body)
+	})
+}
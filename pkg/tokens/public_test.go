@@ -0,0 +1,101 @@
+package tokens
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jrockway/jsso2/pkg/types"
+	"google.golang.org/protobuf/testing/protocmp"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	msg := &types.IdentityAssertion{
+		User:     &types.User{Id: 1, Username: "alice"},
+		Audience: "app.example.com",
+	}
+	k1, err := GenerateKey("one")
+	if err != nil {
+		t.Fatal(err)
+	}
+	k2, err := GenerateKey("two")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := NewKeyring(k1, k2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := Sign(msg, keys)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	if !strings.HasPrefix(token, "v2.public.") {
+		t.Errorf("token %q is not a v2.public token", token)
+	}
+	if id, _ := KeyID(token); id != "one" {
+		t.Errorf("key id:\n  got: %q\n want: \"one\"", id)
+	}
+
+	// Verifiers only need the public keys, which they'd fetch from the JWKS endpoint.
+	rec := httptest.NewRecorder()
+	JWKSHandler(keys).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+	if got, want := rec.Code, http.StatusOK; got != want {
+		t.Fatalf("jwks status:\n  got: %v\n want: %v", got, want)
+	}
+	pub, err := ParseJWKS(rec.Body)
+	if err != nil {
+		t.Fatalf("parse jwks: %v", err)
+	}
+	if diff := cmp.Diff(pub, keys.PublicKeys()); diff != "" {
+		t.Errorf("parsed jwks (-got +want):\n%s", diff)
+	}
+
+	got := new(types.IdentityAssertion)
+	if err := VerifySignedAndUnmarshal(got, token, time.Minute, pub); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if diff := cmp.Diff(got, msg, protocmp.Transform()); diff != "" {
+		t.Errorf("verified message (-got +want):\n%s", diff)
+	}
+	if err := VerifySignedAndUnmarshal(new(types.IdentityAssertion), token, -time.Minute, pub); !errors.Is(err, ErrTooOld) {
+		t.Errorf("verify expired token:\n  got: %v\n want: %v", err, ErrTooOld)
+	}
+	if err := VerifySignedAndUnmarshal(new(types.SetCookieRequest), token, time.Minute, pub); err == nil {
+		t.Error("verify into the wrong type: expected error")
+	}
+	if err := VerifySignedAndUnmarshal(new(types.IdentityAssertion), token, time.Minute, pub[1:]); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("verify without the signing key:\n  got: %v\n want: %v", err, ErrUnknownKey)
+	}
+
+	// A forged token claiming to be from a known key fails.
+	forger, err := GenerateKey("one")
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged, err := Sign(msg, &Keyring{keys: []*Key{forger}})
+	if err != nil {
+		t.Fatalf("sign forged token: %v", err)
+	}
+	if err := VerifySignedAndUnmarshal(new(types.IdentityAssertion), forged, time.Minute, pub); err == nil {
+		t.Error("verify forged token: expected error")
+	}
+
+	// Symmetric and public tokens are not interchangeable.
+	if err := VerifyAndUnmarshal(new(types.IdentityAssertion), token, time.Minute, keys); err == nil {
+		t.Error("decrypt public token: expected error")
+	}
+}
+
+func TestEmptyJWKS(t *testing.T) {
+	rec := httptest.NewRecorder()
+	JWKSHandler(nil).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+	if got, want := strings.TrimSpace(rec.Body.String()), `{"keys":[]}`; got != want {
+		t.Errorf("jwks:\n  got: %v\n want: %v", got, want)
+	}
+}
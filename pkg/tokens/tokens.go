@@ -3,6 +3,7 @@
 package tokens
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"time"
@@ -19,60 +20,146 @@ var (
 	ErrEmptyToken = errors.New("provided token is empty")
 	ErrTooNew     = errors.New("secure message is too new")
 	ErrTooOld     = errors.New("secure message is too old")
+	ErrUnknownKey = errors.New("token was issued with a key that is not in the keyring")
 )
 
 type GeneratorConfig struct {
-	Key []byte // A key with which to sign and encrypt tokens.  Must be exactly 32 bytes.
+	Keyring *Keyring // The keys with which to sign, encrypt, and verify tokens.
 }
 
+// SetKey configures the generator to use a single 32-byte key, with an empty ID.  Tokens issued
+// with a key that has no ID have no footer.
 func (c *GeneratorConfig) SetKey(key []byte) error {
-	if n := len(key); n != 32 {
-		return fmt.Errorf("invalid key length; got %d bytes, want 32 bytes", n)
-	}
-	c.Key = key
-	for _, c := range c.Key {
-		if c != 0 {
-			return nil
-		}
+	keys, err := NewKeyring(&Key{Secret: key})
+	if err != nil {
+		return err
 	}
-	return errors.New("key is entirely null bytes; probably a configuration problem")
+	c.Keyring = keys
+	return nil
 }
 
-// New generates a token from the provided protocol message, encrypting and signing it with the
-// provided 32-byte symmetric key.
-func New(msg proto.Message, key []byte) (string, error) {
-	if len(key) != 32 {
-		return "", ErrInvalidKey
-	}
+// footer is the PASETO footer of a token, which is authenticated but not encrypted.
+type footer struct {
+	KeyID string `json:"kid"`
+}
+
+// wrap marshals msg into a SecureToken issued at the provided time.
+func wrap(msg proto.Message, issuedAt time.Time) ([]byte, error) {
 	any, err := anypb.New(msg)
 	if err != nil {
-		return "", fmt.Errorf("marshal message to Any: %w", err)
+		return nil, fmt.Errorf("marshal message to Any: %w", err)
 	}
 	wrapper := &types.SecureToken{
 		Message:  any,
-		IssuedAt: timestamppb.Now(),
+		IssuedAt: timestamppb.New(issuedAt),
 	}
 	payload, err := proto.Marshal(wrapper)
 	if err != nil {
-		return "", fmt.Errorf("marshal SecureToken: %w", err)
+		return nil, fmt.Errorf("marshal SecureToken: %w", err)
+	}
+	return payload, nil
+}
+
+// unwrap checks the age of a SecureToken and unmarshals its contents into dst.
+func unwrap(dst proto.Message, wrapper *types.SecureToken, maxAge time.Duration) error {
+	age := time.Since(wrapper.GetIssuedAt().AsTime())
+	if age < 0 {
+		return fmt.Errorf("%w (issued_at is %s in the future)", ErrTooNew, age.String())
 	}
-	token, err := paseto.Encrypt(key, payload, "")
+	if age > maxAge {
+		return fmt.Errorf("%w (message is %s old)", ErrTooOld, age.String())
+	}
+	if err := wrapper.GetMessage().UnmarshalTo(dst); err != nil {
+		return fmt.Errorf("unmarshal contained message: %w", err)
+	}
+	return nil
+}
+
+// footerFor returns the footer for a token issued with the key with the provided ID.
+func footerFor(id string) interface{} {
+	if id == "" {
+		return ""
+	}
+	return &footer{KeyID: id}
+}
+
+// New generates a token from the provided protocol message, encrypting and signing it with the
+// keyring's active key.  The key's ID is recorded in the token's footer.
+func New(msg proto.Message, keys *Keyring) (string, error) {
+	return NewIssuedAt(msg, keys, time.Now())
+}
+
+// NewIssuedAt is like New, but records the provided issue time instead of now.  It's for re-issuing
+// the contents of an existing token without extending its lifetime.
+func NewIssuedAt(msg proto.Message, keys *Keyring, issuedAt time.Time) (string, error) {
+	k := keys.Active()
+	if k == nil {
+		return "", ErrInvalidKey
+	}
+	if len(k.Secret) != KeyLength {
+		return "", ErrInvalidKey
+	}
+	payload, err := wrap(msg, issuedAt)
+	if err != nil {
+		return "", err
+	}
+	token, err := paseto.Encrypt(k.Secret, payload, footerFor(k.ID))
 	if err != nil {
 		return "", fmt.Errorf("encrypt payload: %w", err)
 	}
 	return token, nil
 }
 
-// Decrypt returns the decrypted SecureToken.  It's only intended to be used from debugging
-// utilities.
-func Decrypt(token string, key []byte) (*types.SecureToken, error) {
-	if len(key) != 32 {
+// KeyID returns the ID of the key that the token claims to be encrypted with, or an empty string if
+// the token has no footer.  The ID is not authenticated until the token is decrypted.
+func KeyID(token string) (string, error) {
+	var raw string
+	if err := paseto.ParseFooter(token, &raw); err != nil {
+		return "", fmt.Errorf("parse footer: %w", err)
+	}
+	if raw == "" {
+		return "", nil
+	}
+	f := new(footer)
+	if err := json.Unmarshal([]byte(raw), f); err != nil {
+		return "", fmt.Errorf("unmarshal footer: %w", err)
+	}
+	return f.KeyID, nil
+}
+
+// Decrypt returns the decrypted SecureToken, without checking its age.  Tokens are decrypted with
+// the key named in their footer; tokens without a footer, like those issued before a keyring was
+// configured, are tried with every key.
+func Decrypt(token string, keys *Keyring) (*types.SecureToken, error) {
+	id, err := KeyID(token)
+	if err != nil {
+		return nil, err
+	}
+	candidates := keys.All()
+	if id != "" {
+		k := keys.Get(id)
+		if k == nil {
+			return nil, fmt.Errorf("%w (key id %q)", ErrUnknownKey, id)
+		}
+		candidates = []*Key{k}
+	}
+	if len(candidates) == 0 {
 		return nil, ErrInvalidKey
 	}
 	var payload []byte
-	var footer string
-	if err := paseto.Decrypt(token, key, &payload, &footer); err != nil {
-		return nil, fmt.Errorf("decrypt token: %w", err)
+	var decryptErr error
+	for _, k := range candidates {
+		if len(k.Secret) != KeyLength {
+			return nil, ErrInvalidKey
+		}
+		var f string
+		payload = nil
+		if decryptErr = paseto.Decrypt(token, k.Secret, &payload, &f); decryptErr == nil {
+			break
+		}
+	}
+	if decryptErr != nil {
+		return nil, fmt.Errorf("decrypt token: %w", decryptErr)
 	}
 	wrapper := &types.SecureToken{}
 	if err := proto.Unmarshal(payload, wrapper); err != nil {
@@ -84,23 +171,13 @@ func Decrypt(token string, key []byte) (*types.SecureToken, error) {
 // VerifyAndUnmarshal unmarshals a token created by NewToken into the provided protocol message.  An
 // error is returned if the token is too new, too old, cryptographically invalid, or if the type of
 // the destination message and contained message do not match.
-func VerifyAndUnmarshal(dst proto.Message, token string, maxAge time.Duration, key []byte) error {
+func VerifyAndUnmarshal(dst proto.Message, token string, maxAge time.Duration, keys *Keyring) error {
 	if token == "" {
 		return ErrEmptyToken
 	}
-	wrapper, err := Decrypt(token, key)
+	wrapper, err := Decrypt(token, keys)
 	if err != nil {
 		return fmt.Errorf("decrypt: %w", err)
 	}
-	age := time.Since(wrapper.GetIssuedAt().AsTime())
-	if age < 0 {
-		return fmt.Errorf("%w (issued_at is %s in the future)", ErrTooNew, age.String())
-	}
-	if age > maxAge {
-		return fmt.Errorf("%w (message is %s old)", ErrTooOld, age.String())
-	}
-	if err := wrapper.GetMessage().UnmarshalTo(dst); err != nil {
-		return fmt.Errorf("unmarshal contained message: %w", err)
-	}
-	return nil
+	return unwrap(dst, wrapper, maxAge)
 }
@@ -1,6 +1,7 @@
 package tokens
 
 import (
+	"errors"
 	"strings"
 	"testing"
 	"time"
@@ -83,7 +84,7 @@ func TestRoundTrip(t *testing.T) {
 			if len(test.decKey) == 0 {
 				test.decKey = defaultKey
 			}
-			token, err := New(test.input, test.encKey)
+			token, err := New(test.input, &Keyring{keys: []*Key{{Secret: test.encKey}}})
 			if err != nil && test.wantMarshalErr == "" {
 				t.Fatalf("marshal: %v", err)
 			} else if err != nil && !strings.Contains(err.Error(), test.wantMarshalErr) {
@@ -95,7 +96,7 @@ func TestRoundTrip(t *testing.T) {
 				return
 			}
 
-			err = VerifyAndUnmarshal(test.unmarshalInto, token, test.maxAge, test.decKey)
+			err = VerifyAndUnmarshal(test.unmarshalInto, token, test.maxAge, &Keyring{keys: []*Key{{Secret: test.decKey}}})
 			if err != nil && test.wantUnmarshalErr == "" {
 				t.Fatalf("unmarhsal: %v", err)
 			} else if err != nil && !strings.Contains(err.Error(), test.wantUnmarshalErr) {
@@ -113,3 +114,111 @@ func TestRoundTrip(t *testing.T) {
 		})
 	}
 }
+
+func TestKeyRotation(t *testing.T) {
+	msg := &types.SetCookieRequest{RedirectUrl: "http://example.com/"}
+	verify := func(token string, keys *Keyring) error {
+		return VerifyAndUnmarshal(&types.SetCookieRequest{}, token, time.Minute, keys)
+	}
+
+	var legacy GeneratorConfig
+	if err := legacy.SetKey([]byte("AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA")); err != nil {
+		t.Fatal(err)
+	}
+	legacyToken, err := New(msg, legacy.Keyring)
+	if err != nil {
+		t.Fatalf("new legacy token: %v", err)
+	}
+	if id, err := KeyID(legacyToken); err != nil || id != "" {
+		t.Errorf("legacy token key id:\n  got: %q, %v\n want: \"\", <nil>", id, err)
+	}
+
+	oldKey, err := GenerateKey("old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	newKey, err := GenerateKey("new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := NewKeyring(oldKey, &Key{ID: "legacy", Secret: []byte("AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA")})
+	if err != nil {
+		t.Fatalf("new keyring: %v", err)
+	}
+	if err := verify(legacyToken, keys); err != nil {
+		t.Errorf("verify legacy token with keyring: %v", err)
+	}
+	oldToken, err := New(msg, keys)
+	if err != nil {
+		t.Fatalf("new token: %v", err)
+	}
+	if id, err := KeyID(oldToken); err != nil || id != "old" {
+		t.Errorf("token key id:\n  got: %q, %v\n want: \"old\", <nil>", id, err)
+	}
+
+	// Roll in the new key.
+	if keys, err = keys.Add(newKey); err != nil {
+		t.Fatalf("add key: %v", err)
+	}
+	if keys, err = keys.Activate("new"); err != nil {
+		t.Fatalf("activate key: %v", err)
+	}
+	if _, err := keys.Remove("new"); err == nil {
+		t.Error("remove active key: expected error")
+	}
+	newToken, err := New(msg, keys)
+	if err != nil {
+		t.Fatalf("new token after rotation: %v", err)
+	}
+	if id, _ := KeyID(newToken); id != "new" {
+		t.Errorf("token key id after rotation:\n  got: %q\n want: \"new\"", id)
+	}
+	if err := verify(oldToken, keys); err != nil {
+		t.Errorf("verify token issued before rotation: %v", err)
+	}
+
+	// Roll out the old key.
+	if keys, err = keys.Remove("old"); err != nil {
+		t.Fatalf("remove old key: %v", err)
+	}
+	if err := verify(oldToken, keys); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("verify token issued with removed key:\n  got: %v\n want: %v", err, ErrUnknownKey)
+	}
+	if err := verify(newToken, keys); err != nil {
+		t.Errorf("verify token issued with new key: %v", err)
+	}
+
+	// The serialized form round-trips.
+	parsed, err := ParseKeyring(keys.String())
+	if err != nil {
+		t.Fatalf("parse keyring: %v", err)
+	}
+	if diff := cmp.Diff(parsed.All(), keys.All()); diff != "" {
+		t.Errorf("parsed keyring (-got +want):\n%s", diff)
+	}
+}
+
+func TestParseKeyring(t *testing.T) {
+	testData := []struct {
+		name, input, wantErr string
+	}{
+		{"empty", "", "expected id:base64-secret"},
+		{"no id", ":QUFBQUFBQUFBQUFBQUFBQUFBQUFBQUFBQUFBQUFBQUE=", "expected id:base64-secret"},
+		{"bad base64", "a:!!!", "decode secret"},
+		{"short key", "a:QUFB", "invalid key length"},
+		{"null key", "a:AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=", "null bytes"},
+		{"duplicate id", "a:QUFBQUFBQUFBQUFBQUFBQUFBQUFBQUFBQUFBQUFBQUE=,a:QkJCQkJCQkJCQkJCQkJCQkJCQkJCQkJCQkJCQkJCQkI=", "duplicate id"},
+		{"ok", "a:QUFBQUFBQUFBQUFBQUFBQUFBQUFBQUFBQUFBQUFBQUE=, b:QkJCQkJCQkJCQkJCQkJCQkJCQkJCQkJCQkJCQkJCQkI=", ""},
+	}
+	for _, test := range testData {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ParseKeyring(test.input)
+			if err == nil && test.wantErr != "" {
+				t.Fatalf("expected error containing %q", test.wantErr)
+			}
+			if err != nil && (test.wantErr == "" || !strings.Contains(err.Error(), test.wantErr)) {
+				t.Fatalf("unexpected error:\n  got: %v\n want: %v", err, test.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,485 @@
+// Package webhooks delivers identity events from the audit log to HTTP endpoints.
+//
+// Delivery happens in two stages.  The dispatcher follows the audit log and, in the same
+// transaction that advances its cursor, queues a pending delivery for every webhook subscribed to
+// the event's type.  The sender then POSTs due deliveries to their webhooks, retrying failures with
+// exponential backoff until they succeed or run out of attempts, at which point they are marked
+// dead.  Because the queue lives in the database, deliveries survive restarts, and every replica
+// can run both stages; serializable transactions keep them from doing the same work twice.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/jrockway/jsso2/pkg/audit"
+	"github.com/jrockway/jsso2/pkg/store"
+	"github.com/jrockway/jsso2/pkg/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+var (
+	deliveriesQueued = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "jsso2_webhook_deliveries_queued",
+		Help: "Number of webhook deliveries queued by the dispatcher.",
+	})
+	deliveryAttempts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "jsso2_webhook_delivery_attempts",
+		Help: "Number of attempts to deliver a webhook, by outcome.",
+	}, []string{"result"})
+	runErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "jsso2_webhook_run_errors",
+		Help: "Number of times dispatching or sending webhooks failed, by stage.",
+	}, []string{"stage"})
+)
+
+// Headers sent with each delivery.
+const (
+	// SignatureHeader contains "v1=" followed by the hex-encoded HMAC-SHA256 of the timestamp
+	// header, a period, and the request body, keyed with the webhook's secret.
+	SignatureHeader = "X-Jsso2-Signature"
+	// TimestampHeader contains the time the request was signed, in seconds since the Unix epoch.
+	TimestampHeader = "X-Jsso2-Timestamp"
+	// DeliveryHeader contains the delivery ID, which is the same for every attempt.
+	DeliveryHeader = "X-Jsso2-Delivery"
+	// EventHeader contains the event type, like "credential_added".
+	EventHeader = "X-Jsso2-Event"
+)
+
+// Config configures webhook delivery.
+type Config struct {
+	PollInterval   time.Duration `long:"webhook_poll_interval" env:"WEBHOOK_POLL_INTERVAL" default:"10s" description:"How often to look for due webhook deliveries, and for audit events that a missed notification would otherwise delay.  0 disables webhooks."`
+	Timeout        time.Duration `long:"webhook_timeout" env:"WEBHOOK_TIMEOUT" default:"10s" description:"How long to wait for a webhook endpoint to respond."`
+	MaxAttempts    int           `long:"webhook_max_attempts" env:"WEBHOOK_MAX_ATTEMPTS" default:"10" description:"Number of attempts after which a delivery is marked dead."`
+	InitialBackoff time.Duration `long:"webhook_initial_backoff" env:"WEBHOOK_INITIAL_BACKOFF" default:"30s" description:"How long to wait before retrying a failed delivery for the first time; the delay doubles with each attempt."`
+	MaxBackoff     time.Duration `long:"webhook_max_backoff" env:"WEBHOOK_MAX_BACKOFF" default:"6h" description:"The longest delay between attempts to deliver a webhook."`
+	BatchSize      int           `long:"webhook_batch_size" env:"WEBHOOK_BATCH_SIZE" default:"100" description:"Number of audit events or deliveries handled in each transaction."`
+
+	AllowPrivateDestinations bool `long:"webhook_allow_private_destinations" env:"WEBHOOK_ALLOW_PRIVATE_DESTINATIONS" description:"If true, deliver webhooks to loopback, link-local, and private network addresses.  Anyone who can manage webhooks can then make jsso2 send requests to internal services."`
+}
+
+// cgnat is the shared address space of RFC 6598, which net.IP.IsPrivate doesn't cover.
+var cgnat = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// publicIP returns true if ip is an ordinary unicast address on the public Internet.
+func publicIP(ip net.IP) bool {
+	return ip != nil && ip.IsGlobalUnicast() && !ip.IsPrivate() && !cgnat.Contains(ip)
+}
+
+// refusePrivate is a net.Dialer control function that refuses to connect to addresses that aren't
+// publicIP.  It runs after name resolution, so a webhook's hostname can't be pointed at an
+// internal service either.
+func refusePrivate(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("parse address %q: %w", address, err)
+	}
+	if !publicIP(net.ParseIP(host)) {
+		return fmt.Errorf("refusing to deliver to non-public address %s", host)
+	}
+	return nil
+}
+
+// NewClient returns the HTTP client that delivers webhooks.  It doesn't follow redirects, and
+// unless cfg.AllowPrivateDestinations is set, it only connects to public addresses.  (Environment
+// proxy settings are ignored, since the proxy would make the connection on our behalf.)
+func NewClient(cfg *Config) *http.Client {
+	dialer := &net.Dialer{Timeout: cfg.Timeout, KeepAlive: 30 * time.Second}
+	if !cfg.AllowPrivateDestinations {
+		dialer.Control = refusePrivate
+	}
+	return &http.Client{
+		Timeout: cfg.Timeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			MaxIdleConns:        100,
+			IdleConnTimeout:     90 * time.Second,
+			TLSHandshakeTimeout: 10 * time.Second,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// Sign returns the value of the signature header for a request body sent at the provided time.
+func Sign(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify returns true if the signature header of a received delivery is valid.  Receivers should
+// also reject timestamps that are too old, to prevent replays.
+func Verify(secret []byte, timestamp, signature string, body []byte) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
+
+// Payload is the JSON body of a delivery.
+type Payload struct {
+	// DeliveryID is the ID of the delivery, which is the same for every attempt.
+	DeliveryID int64 `json:"delivery_id"`
+	// Type is the event type, like "credential_added".
+	Type string `json:"type"`
+	// Text is a human-readable summary of the event.  It's named so that chat services that
+	// accept incoming webhooks display it.
+	Text string `json:"text"`
+	// Event is the audit event, in the protojson encoding of types.AuditEvent.
+	Event json.RawMessage `json:"event"`
+}
+
+// EventTypeName returns the name used for an event type in payloads and headers.
+func EventTypeName(t types.Event_Type) string {
+	return strings.ToLower(t.String())
+}
+
+// Summarize returns a human-readable summary of an event.
+func Summarize(t types.Event_Type, e *types.AuditEvent) string {
+	target, actor := e.GetTarget().GetUsername(), e.GetActor().GetUsername()
+	if target == "" {
+		target = "an unknown user"
+	}
+	var msg string
+	switch t {
+	case types.Event_LOGIN:
+		msg = fmt.Sprintf("%s logged in", target)
+	case types.Event_LOGIN_FAILED:
+		msg = fmt.Sprintf("a login as %s failed: %s", target, e.GetError())
+	case types.Event_LOGIN_FROM_NEW_IP:
+		msg = fmt.Sprintf("%s logged in from a new IP address", target)
+	case types.Event_LOGOUT:
+		msg = fmt.Sprintf("%s logged out", target)
+	case types.Event_SESSION_REVOKED:
+		msg = fmt.Sprintf("a session belonging to %s was revoked", target)
+	case types.Event_CREDENTIAL_ADDED:
+		msg = fmt.Sprintf("a new credential was added for %s", target)
+	case types.Event_USER_CHANGED:
+		msg = fmt.Sprintf("%s was changed by %s", target, actor)
+	default:
+		msg = fmt.Sprintf("%s: %s", e.GetAction(), target)
+	}
+	if ip := e.GetIpAddress(); ip != "" {
+		msg += fmt.Sprintf(" (from %s)", ip)
+	}
+	return "jsso2: " + msg
+}
+
+// Dispatch queues deliveries for audit events added since the last call, returning the number of
+// events it considered.  The first call starts from the end of the audit log, so that creating
+// the first webhook doesn't deliver the entire history.
+func Dispatch(ctx context.Context, l *zap.Logger, db store.Store, cfg *Config) (int, error) {
+	var n int
+	err := db.DoTx(ctx, l, false, func(tx store.Tx) error {
+		n = 0
+		cursor, err := tx.GetWebhookCursor(ctx)
+		if errors.Is(err, sql.ErrNoRows) {
+			newest, err := tx.QueryAuditEvents(ctx, &store.AuditFilter{Limit: 1})
+			if err != nil {
+				return fmt.Errorf("query newest audit event: %w", err)
+			}
+			var id int64
+			if len(newest) > 0 {
+				id = newest[0].GetId()
+			}
+			if err := tx.SetWebhookCursor(ctx, id); err != nil {
+				return fmt.Errorf("initialize cursor: %w", err)
+			}
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("get cursor: %w", err)
+		}
+		events, err := tx.QueryAuditEvents(ctx, &store.AuditFilter{AfterID: cursor, OldestFirst: true, Limit: cfg.BatchSize})
+		if err != nil {
+			return fmt.Errorf("read audit events after %d: %w", cursor, err)
+		}
+		if len(events) == 0 {
+			return nil
+		}
+		webhooks, err := tx.GetWebhooks(ctx)
+		if err != nil {
+			return fmt.Errorf("get webhooks: %w", err)
+		}
+		// The database rounds to the millisecond, which could push a delivery that's due now
+		// into the future.
+		now := timestamppb.New(time.Now().Truncate(time.Millisecond))
+		for _, e := range events {
+			t := audit.EventType(e)
+			if t == types.Event_TYPE_UNKNOWN {
+				continue
+			}
+			for _, w := range webhooks {
+				if !subscribed(w, t) {
+					continue
+				}
+				if err := tx.AddWebhookDelivery(ctx, &types.WebhookDelivery{
+					WebhookId:     w.GetId(),
+					AuditEventId:  e.GetId(),
+					EventType:     t,
+					State:         types.WebhookDelivery_PENDING,
+					CreatedAt:     now,
+					NextAttemptAt: now,
+				}); err != nil {
+					return fmt.Errorf("queue delivery of event %d to webhook %d: %w", e.GetId(), w.GetId(), err)
+				}
+				deliveriesQueued.Inc()
+			}
+		}
+		if err := tx.SetWebhookCursor(ctx, events[len(events)-1].GetId()); err != nil {
+			return fmt.Errorf("advance cursor: %w", err)
+		}
+		n = len(events)
+		return nil
+	})
+	return n, err
+}
+
+func subscribed(w *types.Webhook, t types.Event_Type) bool {
+	for _, want := range w.GetEventTypes() {
+		if want == t {
+			return true
+		}
+	}
+	return false
+}
+
+// Backoff returns how long to wait before the next attempt at a delivery that has failed attempts
+// times.  The delay is jittered so that deliveries that failed together don't retry together.
+func Backoff(cfg *Config, attempts int32) time.Duration {
+	d := cfg.InitialBackoff
+	for i := int32(1); i < attempts && d < cfg.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > cfg.MaxBackoff {
+		d = cfg.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// claimed is a delivery that Send is attempting, along with what it needs to make the request.
+type claimed struct {
+	delivery *types.WebhookDelivery
+	webhook  *types.Webhook
+	event    *types.AuditEvent
+}
+
+// claim finds due deliveries and leases them, by pushing their next attempt past the time that
+// sending them can take, so that other replicas leave them alone.
+func claim(ctx context.Context, l *zap.Logger, db store.Store, cfg *Config) ([]*claimed, error) {
+	var result []*claimed
+	err := db.DoTx(ctx, l, false, func(tx store.Tx) error {
+		result = nil
+		now := time.Now()
+		due, err := tx.QueryWebhookDeliveries(ctx, &store.WebhookDeliveryFilter{
+			State:       types.WebhookDelivery_PENDING,
+			DueBefore:   now,
+			OldestFirst: true,
+			Limit:       cfg.BatchSize,
+		})
+		if err != nil {
+			return fmt.Errorf("query due deliveries: %w", err)
+		}
+		if len(due) == 0 {
+			return nil
+		}
+		webhooks, err := tx.GetWebhooks(ctx)
+		if err != nil {
+			return fmt.Errorf("get webhooks: %w", err)
+		}
+		byID := make(map[int64]*types.Webhook, len(webhooks))
+		for _, w := range webhooks {
+			byID[w.GetId()] = w
+		}
+		lease := timestamppb.New(now.Add(2*cfg.Timeout + time.Minute))
+		for _, d := range due {
+			events, err := tx.QueryAuditEvents(ctx, &store.AuditFilter{AfterID: d.GetAuditEventId() - 1, OldestFirst: true, Limit: 1})
+			if err != nil {
+				return fmt.Errorf("read audit event %d: %w", d.GetAuditEventId(), err)
+			}
+			if len(events) == 0 || events[0].GetId() != d.GetAuditEventId() {
+				return fmt.Errorf("delivery %d: audit event %d not found", d.GetId(), d.GetAuditEventId())
+			}
+			d.NextAttemptAt = lease
+			if err := tx.UpdateWebhookDelivery(ctx, d); err != nil {
+				return fmt.Errorf("lease delivery %d: %w", d.GetId(), err)
+			}
+			result = append(result, &claimed{delivery: d, webhook: byID[d.GetWebhookId()], event: events[0]})
+		}
+		return nil
+	})
+	return result, err
+}
+
+// post makes one attempt at a delivery.  The response body is never read, so that the recorded
+// error can't be used to exfiltrate the content of whatever the URL points at.
+func post(ctx context.Context, client *http.Client, c *claimed) error {
+	eventJSON, err := protojson.Marshal(c.event)
+	if err != nil {
+		return fmt.Errorf("marshal audit event: %w", err)
+	}
+	t := c.delivery.GetEventType()
+	body, err := json.Marshal(&Payload{
+		DeliveryID: c.delivery.GetId(),
+		Type:       EventTypeName(t),
+		Text:       Summarize(t, c.event),
+		Event:      eventJSON,
+	})
+	if err != nil {
+		return fmt.Errorf("marshal payload: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.webhook.GetUrl(), bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, Sign(c.webhook.GetSecret(), timestamp, body))
+	req.Header.Set(DeliveryHeader, strconv.FormatInt(c.delivery.GetId(), 10))
+	req.Header.Set(EventHeader, EventTypeName(t))
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %d", res.StatusCode)
+	}
+	return nil
+}
+
+// Send attempts every due delivery, returning the number that it attempted.
+func Send(ctx context.Context, l *zap.Logger, db store.Store, client *http.Client, cfg *Config) (int, error) {
+	batch, err := claim(ctx, l, db, cfg)
+	if err != nil {
+		return 0, fmt.Errorf("claim due deliveries: %w", err)
+	}
+	var wg sync.WaitGroup
+	errs := make([]error, len(batch))
+	for i, c := range batch {
+		wg.Add(1)
+		go func(i int, c *claimed) {
+			defer wg.Done()
+			errs[i] = attempt(ctx, l, db, client, cfg, c)
+		}(i, c)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return len(batch), err
+		}
+	}
+	return len(batch), nil
+}
+
+// attempt makes one attempt at a claimed delivery and records the outcome.
+func attempt(ctx context.Context, l *zap.Logger, db store.Store, client *http.Client, cfg *Config, c *claimed) error {
+	d := c.delivery
+	l = l.With(zap.Int64("delivery_id", d.GetId()), zap.Int64("webhook_id", d.GetWebhookId()))
+	reqCtx, cancel := context.WithTimeout(ctx, cfg.Timeout)
+	err := post(reqCtx, client, c)
+	cancel()
+	if ctx.Err() != nil {
+		// Shutting down; the lease will expire and another replica will retry.
+		return ctx.Err()
+	}
+	now := time.Now()
+	d.Attempts++
+	d.LastAttemptAt = timestamppb.New(now)
+	switch {
+	case err == nil:
+		deliveryAttempts.WithLabelValues("succeeded").Inc()
+		d.State = types.WebhookDelivery_SUCCEEDED
+		d.LastError = ""
+	case int(d.GetAttempts()) >= cfg.MaxAttempts:
+		deliveryAttempts.WithLabelValues("dead").Inc()
+		l.Warn("webhook delivery failed for the last time", zap.Int32("attempts", d.GetAttempts()), zap.Error(err))
+		d.State = types.WebhookDelivery_DEAD
+		d.LastError = err.Error()
+	default:
+		deliveryAttempts.WithLabelValues("failed").Inc()
+		l.Debug("webhook delivery failed; will retry", zap.Int32("attempts", d.GetAttempts()), zap.Error(err))
+		d.NextAttemptAt = timestamppb.New(now.Add(Backoff(cfg, d.GetAttempts())))
+		d.LastError = err.Error()
+	}
+	if err := db.DoTx(ctx, l, false, func(tx store.Tx) error {
+		return tx.UpdateWebhookDelivery(ctx, d)
+	}); errors.Is(err, sql.ErrNoRows) {
+		l.Debug("webhook deleted during delivery")
+	} else if err != nil {
+		return fmt.Errorf("record outcome of delivery %d: %w", d.GetId(), err)
+	}
+	return nil
+}
+
+// Run dispatches and sends webhooks until the context is cancelled.
+func Run(ctx context.Context, l *zap.Logger, db store.Store, cfg *Config) {
+	if cfg.PollInterval <= 0 {
+		l.Info("webhooks disabled")
+		return
+	}
+	if cfg.BatchSize < 1 {
+		cfg.BatchSize = 1
+	}
+	client := NewClient(cfg)
+	notify := db.SubscribeAuditEvents(ctx)
+	t := time.NewTicker(cfg.PollInterval)
+	defer t.Stop()
+	for {
+		for {
+			n, err := Dispatch(ctx, l, db, cfg)
+			if err != nil {
+				if ctx.Err() == nil {
+					runErrors.WithLabelValues("dispatch").Inc()
+					l.Warn("problem dispatching webhooks", zap.Error(err))
+				}
+				break
+			}
+			if n < cfg.BatchSize {
+				break
+			}
+		}
+		for {
+			n, err := Send(ctx, l, db, client, cfg)
+			if err != nil {
+				if ctx.Err() == nil {
+					runErrors.WithLabelValues("send").Inc()
+					l.Warn("problem sending webhooks", zap.Error(err))
+				}
+				break
+			}
+			if n < cfg.BatchSize {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-notify:
+		case <-t.C:
+		}
+	}
+}
@@ -0,0 +1,319 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jrockway/jsso2/pkg/audit"
+	"github.com/jrockway/jsso2/pkg/store"
+	"github.com/jrockway/jsso2/pkg/types"
+	"go.uber.org/zap/zaptest"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestSign(t *testing.T) {
+	secret, body := []byte("secret"), []byte(`{"type":"login"}`)
+	sig := Sign(secret, "1600000000", body)
+	if !Verify(secret, "1600000000", sig, body) {
+		t.Error("signature does not verify")
+	}
+	if Verify(secret, "1600000001", sig, body) {
+		t.Error("signature verifies with a different timestamp")
+	}
+	if Verify([]byte("other"), "1600000000", sig, body) {
+		t.Error("signature verifies with a different secret")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	cfg := &Config{InitialBackoff: time.Second, MaxBackoff: 10 * time.Second}
+	testData := []struct {
+		attempts int32
+		max      time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 8 * time.Second},
+		{5, 10 * time.Second},
+		{100, 10 * time.Second},
+	}
+	for _, test := range testData {
+		got := Backoff(cfg, test.attempts)
+		if got < test.max/2 || got > test.max {
+			t.Errorf("attempt %d: backoff %v outside [%v, %v]", test.attempts, got, test.max/2, test.max)
+		}
+	}
+}
+
+func TestPublicIP(t *testing.T) {
+	testData := map[string]bool{
+		"8.8.8.8":         true,
+		"2001:4860::8888": true,
+		"127.0.0.1":       false,
+		"::1":             false,
+		"10.1.2.3":        false,
+		"172.16.0.1":      false,
+		"192.168.1.1":     false,
+		"169.254.169.254": false,
+		"fe80::1":         false,
+		"fd00::1":         false,
+		"100.64.0.1":      false,
+		"0.0.0.0":         false,
+		"::":              false,
+		"224.0.0.1":       false,
+	}
+	for addr, want := range testData {
+		if got := publicIP(net.ParseIP(addr)); got != want {
+			t.Errorf("%s:\n  got: %v\n want: %v", addr, got, want)
+		}
+	}
+}
+
+func TestClient(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/redirect":
+			http.Redirect(w, req, "/secret", http.StatusFound)
+		case "/secret":
+			w.Write([]byte("the contents of an internal service"))
+		default:
+			http.Error(w, "the contents of an internal error page", http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+	c := &claimed{
+		delivery: &types.WebhookDelivery{Id: 1, EventType: types.Event_LOGIN},
+		event:    &types.AuditEvent{},
+	}
+
+	// By default, the loopback address of the test server is refused.
+	c.webhook = &types.Webhook{Url: server.URL + "/secret"}
+	if err := post(ctx, NewClient(&Config{Timeout: time.Second}), c); err == nil || !strings.Contains(err.Error(), "non-public address") {
+		t.Errorf("post to loopback address: expected refusal, got %v", err)
+	}
+
+	client := NewClient(&Config{Timeout: time.Second, AllowPrivateDestinations: true})
+	if err := post(ctx, client, c); err != nil {
+		t.Errorf("post to loopback address with private destinations allowed: %v", err)
+	}
+
+	// Redirects are not followed, and response bodies are never recorded.
+	for _, path := range []string{"/redirect", "/error"} {
+		c.webhook = &types.Webhook{Url: server.URL + path}
+		err := post(ctx, client, c)
+		if err == nil {
+			t.Errorf("post to %s: expected error", path)
+			continue
+		}
+		if strings.Contains(err.Error(), "contents") {
+			t.Errorf("post to %s: error contains the response body: %v", path, err)
+		}
+	}
+}
+
+// receiver is a webhook endpoint that records what it receives.
+type receiver struct {
+	sync.Mutex
+	secret   []byte
+	fail     int // Number of requests to fail before succeeding.
+	payloads []*Payload
+	errs     []string
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.Lock()
+	defer r.Unlock()
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		r.errs = append(r.errs, err.Error())
+		return
+	}
+	if !Verify(r.secret, req.Header.Get(TimestampHeader), req.Header.Get(SignatureHeader), body) {
+		r.errs = append(r.errs, "bad signature")
+	}
+	p := new(Payload)
+	if err := json.Unmarshal(body, p); err != nil {
+		r.errs = append(r.errs, err.Error())
+	}
+	if got, want := req.Header.Get(EventHeader), p.Type; got != want {
+		r.errs = append(r.errs, "event header "+got+" does not match payload type "+want)
+	}
+	r.payloads = append(r.payloads, p)
+	if r.fail > 0 {
+		r.fail--
+		http.Error(w, "try again later", http.StatusServiceUnavailable)
+	}
+}
+
+func TestDelivery(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	l := zaptest.NewLogger(t)
+	db := store.NewMemory()
+	cfg := &Config{Timeout: time.Second, MaxAttempts: 3, InitialBackoff: time.Hour, MaxBackoff: time.Hour, BatchSize: 10}
+
+	addEvents := func(events ...*types.AuditEvent) {
+		t.Helper()
+		if err := db.DoTx(ctx, l, false, func(tx store.Tx) error {
+			for _, e := range events {
+				if err := tx.AddAuditEvent(ctx, e); err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			t.Fatalf("add audit events: %v", err)
+		}
+	}
+	deliveries := func() []*types.WebhookDelivery {
+		t.Helper()
+		var result []*types.WebhookDelivery
+		if err := db.DoTx(ctx, l, true, func(tx store.Tx) (err error) {
+			result, err = tx.QueryWebhookDeliveries(ctx, &store.WebhookDeliveryFilter{OldestFirst: true})
+			return
+		}); err != nil {
+			t.Fatalf("query deliveries: %v", err)
+		}
+		return result
+	}
+	newEvent := func(action string, result types.AuditEvent_Result) *types.AuditEvent {
+		return &types.AuditEvent{
+			CreatedAt: timestamppb.Now(),
+			Action:    action,
+			Target:    &types.User{Id: 1, Username: "alice"},
+			IpAddress: "192.0.2.1",
+			Result:    result,
+		}
+	}
+
+	// Events from before the first dispatch are never delivered.
+	addEvents(newEvent(audit.ActionEnroll, types.AuditEvent_SUCCESS))
+	if _, err := Dispatch(ctx, l, db, cfg); err != nil {
+		t.Fatalf("initial dispatch: %v", err)
+	}
+
+	r := &receiver{secret: bytes.Repeat([]byte{'x'}, 32), fail: 1}
+	server := httptest.NewServer(r)
+	defer server.Close()
+	webhook := &types.Webhook{
+		CreatedAt:  timestamppb.Now(),
+		Url:        server.URL,
+		EventTypes: []types.Event_Type{types.Event_CREDENTIAL_ADDED, types.Event_LOGIN_FROM_NEW_IP},
+		Secret:     r.secret,
+	}
+	if err := db.DoTx(ctx, l, false, func(tx store.Tx) error { return tx.AddWebhook(ctx, webhook) }); err != nil {
+		t.Fatalf("add webhook: %v", err)
+	}
+
+	addEvents(
+		newEvent(audit.ActionLogin, types.AuditEvent_SUCCESS),
+		newEvent(audit.ActionEnroll, types.AuditEvent_SUCCESS),
+		newEvent(audit.ActionEnroll, types.AuditEvent_FAILURE),
+	)
+	n, err := Dispatch(ctx, l, db, cfg)
+	if err != nil {
+		t.Fatalf("dispatch: %v", err)
+	}
+	if got, want := n, 3; got != want {
+		t.Errorf("dispatched events:\n  got: %v\n want: %v", got, want)
+	}
+	if n, err := Dispatch(ctx, l, db, cfg); err != nil || n != 0 {
+		t.Errorf("second dispatch: got %d events and error %v, want 0 events and no error", n, err)
+	}
+	ds := deliveries()
+	if got, want := len(ds), 1; got != want {
+		t.Fatalf("deliveries:\n  got: %v\n want: %v", got, want)
+	}
+	if got, want := ds[0].GetEventType(), types.Event_CREDENTIAL_ADDED; got != want {
+		t.Errorf("event type:\n  got: %v\n want: %v", got, want)
+	}
+
+	// The first attempt fails and is retried after the backoff.
+	if _, err := Send(ctx, l, db, server.Client(), cfg); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	d := deliveries()[0]
+	if got, want := d.GetState(), types.WebhookDelivery_PENDING; got != want {
+		t.Errorf("state after failure:\n  got: %v\n want: %v", got, want)
+	}
+	if got, want := d.GetAttempts(), int32(1); got != want {
+		t.Errorf("attempts after failure:\n  got: %v\n want: %v", got, want)
+	}
+	if d.GetLastError() == "" {
+		t.Error("last error not recorded")
+	}
+	if n, err := Send(ctx, l, db, server.Client(), cfg); err != nil || n != 0 {
+		t.Errorf("send before backoff: got %d attempts and error %v, want 0 attempts and no error", n, err)
+	}
+	d.NextAttemptAt = timestamppb.New(time.Now().Truncate(time.Millisecond))
+	if err := db.DoTx(ctx, l, false, func(tx store.Tx) error { return tx.UpdateWebhookDelivery(ctx, d) }); err != nil {
+		t.Fatalf("skip backoff: %v", err)
+	}
+	if _, err := Send(ctx, l, db, server.Client(), cfg); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	d = deliveries()[0]
+	if got, want := d.GetState(), types.WebhookDelivery_SUCCEEDED; got != want {
+		t.Errorf("state after retry:\n  got: %v\n want: %v", got, want)
+	}
+	if got, want := d.GetAttempts(), int32(2); got != want {
+		t.Errorf("attempts after retry:\n  got: %v\n want: %v", got, want)
+	}
+
+	r.Lock()
+	if len(r.errs) > 0 {
+		t.Errorf("receiver errors: %v", r.errs)
+	}
+	if got, want := len(r.payloads), 2; got != want {
+		t.Fatalf("requests received:\n  got: %v\n want: %v", got, want)
+	}
+	p := r.payloads[1]
+	r.Unlock()
+	if got, want := p.Type, "credential_added"; got != want {
+		t.Errorf("payload type:\n  got: %v\n want: %v", got, want)
+	}
+	if got, want := p.Text, "jsso2: a new credential was added for alice (from 192.0.2.1)"; got != want {
+		t.Errorf("payload text:\n  got: %v\n want: %v", got, want)
+	}
+	if got, want := p.DeliveryID, d.GetId(); got != want {
+		t.Errorf("payload delivery id:\n  got: %v\n want: %v", got, want)
+	}
+
+	// Deliveries that fail too many times are marked dead.
+	r.Lock()
+	r.fail = cfg.MaxAttempts
+	r.Unlock()
+	addEvents(newEvent(audit.ActionLoginNewIP, types.AuditEvent_SUCCESS))
+	if _, err := Dispatch(ctx, l, db, cfg); err != nil {
+		t.Fatalf("dispatch: %v", err)
+	}
+	for i := 0; i < cfg.MaxAttempts; i++ {
+		d := deliveries()[1]
+		d.NextAttemptAt = timestamppb.New(time.Now().Truncate(time.Millisecond))
+		if err := db.DoTx(ctx, l, false, func(tx store.Tx) error { return tx.UpdateWebhookDelivery(ctx, d) }); err != nil {
+			t.Fatalf("skip backoff: %v", err)
+		}
+		if _, err := Send(ctx, l, db, server.Client(), cfg); err != nil {
+			t.Fatalf("send: %v", err)
+		}
+	}
+	d = deliveries()[1]
+	if got, want := d.GetState(), types.WebhookDelivery_DEAD; got != want {
+		t.Errorf("state after final failure:\n  got: %v\n want: %v", got, want)
+	}
+	if got, want := d.GetAttempts(), int32(cfg.MaxAttempts); got != want {
+		t.Errorf("attempts after final failure:\n  got: %v\n want: %v", got, want)
+	}
+}
@@ -90,6 +90,9 @@ export class StartLoginRequest extends jspb.Message {
   getUsername(): string;
   setUsername(value: string): StartLoginRequest;
 
+  getRedirectToken(): string;
+  setRedirectToken(value: string): StartLoginRequest;
+
   serializeBinary(): Uint8Array;
   toObject(includeInstance?: boolean): StartLoginRequest.AsObject;
   static toObject(includeInstance: boolean, msg: StartLoginRequest): StartLoginRequest.AsObject;
@@ -101,6 +104,7 @@ export class StartLoginRequest extends jspb.Message {
 export namespace StartLoginRequest {
   export type AsObject = {
     username: string,
+    redirectToken: string,
   }
 }
 
@@ -113,6 +117,9 @@ export class StartLoginReply extends jspb.Message {
   getToken(): string;
   setToken(value: string): StartLoginReply;
 
+  getRedirectToken(): string;
+  setRedirectToken(value: string): StartLoginReply;
+
   serializeBinary(): Uint8Array;
   toObject(includeInstance?: boolean): StartLoginReply.AsObject;
   static toObject(includeInstance: boolean, msg: StartLoginReply): StartLoginReply.AsObject;
@@ -125,6 +132,7 @@ export namespace StartLoginReply {
   export type AsObject = {
     credentialRequestOptions?: webauthn_pb.PublicKeyCredentialRequestOptions.AsObject,
     token: string,
+    redirectToken: string,
   }
 }
 
@@ -313,6 +321,11 @@ export class AuthorizeHTTPRequest extends jspb.Message {
   getIpAddress(): string;
   setIpAddress(value: string): AuthorizeHTTPRequest;
 
+  getHeadersList(): Array<types_pb.Header>;
+  setHeadersList(value: Array<types_pb.Header>): AuthorizeHTTPRequest;
+  clearHeadersList(): AuthorizeHTTPRequest;
+  addHeaders(value?: types_pb.Header, index?: number): types_pb.Header;
+
   serializeBinary(): Uint8Array;
   toObject(includeInstance?: boolean): AuthorizeHTTPRequest.AsObject;
   static toObject(includeInstance: boolean, msg: AuthorizeHTTPRequest): AuthorizeHTTPRequest.AsObject;
@@ -329,6 +342,7 @@ export namespace AuthorizeHTTPRequest {
     authorizationHeadersList: Array<string>,
     cookiesList: Array<string>,
     ipAddress: string,
+    headersList: Array<types_pb.Header.AsObject>,
   }
 }
 
@@ -349,6 +363,12 @@ export class Allow extends jspb.Message {
   clearAddHeadersList(): Allow;
   addAddHeaders(value?: types_pb.Header, index?: number): types_pb.Header;
 
+  getUserId(): number;
+  setUserId(value: number): Allow;
+
+  getSessionHandle(): string;
+  setSessionHandle(value: string): Allow;
+
   serializeBinary(): Uint8Array;
   toObject(includeInstance?: boolean): Allow.AsObject;
   static toObject(includeInstance: boolean, msg: Allow): Allow.AsObject;
@@ -363,6 +383,8 @@ export namespace Allow {
     groupsList: Array<string>,
     bearerToken: string,
     addHeadersList: Array<types_pb.Header.AsObject>,
+    userId: number,
+    sessionHandle: string,
   }
 }
 
@@ -380,6 +402,14 @@ export class Deny extends jspb.Message {
   hasResponse(): boolean;
   clearResponse(): Deny;
 
+  getCategory(): Deny.Category;
+  setCategory(value: Deny.Category): Deny;
+
+  getAddHeadersList(): Array<types_pb.Header>;
+  setAddHeadersList(value: Array<types_pb.Header>): Deny;
+  clearAddHeadersList(): Deny;
+  addAddHeaders(value?: types_pb.Header, index?: number): types_pb.Header;
+
   getDestinationCase(): Deny.DestinationCase;
 
   serializeBinary(): Uint8Array;
@@ -395,6 +425,8 @@ export namespace Deny {
     reason: string,
     redirect?: Deny.Redirect.AsObject,
     response?: Deny.Response.AsObject,
+    category: Deny.Category,
+    addHeadersList: Array<types_pb.Header.AsObject>,
   }
 
   export class Redirect extends jspb.Message {
@@ -423,6 +455,9 @@ export namespace Deny {
     getBody(): string;
     setBody(value: string): Response;
 
+    getStatusCode(): number;
+    setStatusCode(value: number): Response;
+
     serializeBinary(): Uint8Array;
     toObject(includeInstance?: boolean): Response.AsObject;
     static toObject(includeInstance: boolean, msg: Response): Response.AsObject;
@@ -435,10 +470,18 @@ export namespace Deny {
     export type AsObject = {
       contentType: string,
       body: string,
+      statusCode: number,
     }
   }
 
 
+  export enum Category { 
+    CATEGORY_UNKNOWN = 0,
+    NO_CREDENTIALS = 1,
+    INVALID_CREDENTIALS = 2,
+    POLICY = 3,
+  }
+
   export enum DestinationCase { 
     DESTINATION_NOT_SET = 0,
     REDIRECT = 2,
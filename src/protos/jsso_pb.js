@@ -21,6 +21,7 @@ goog.exportSymbol('proto.jsso.AuthorizeHTTPReply', null, global);
 goog.exportSymbol('proto.jsso.AuthorizeHTTPReply.DecisionCase', null, global);
 goog.exportSymbol('proto.jsso.AuthorizeHTTPRequest', null, global);
 goog.exportSymbol('proto.jsso.Deny', null, global);
+goog.exportSymbol('proto.jsso.Deny.Category', null, global);
 goog.exportSymbol('proto.jsso.Deny.DestinationCase', null, global);
 goog.exportSymbol('proto.jsso.Deny.Redirect', null, global);
 goog.exportSymbol('proto.jsso.Deny.Response', null, global);
@@ -385,7 +386,7 @@ if (goog.DEBUG && !COMPILED) {
  * @constructor
  */
 proto.jsso.Deny = function(opt_data) {
-  jspb.Message.initialize(this, opt_data, 0, -1, null, proto.jsso.Deny.oneofGroups_);
+  jspb.Message.initialize(this, opt_data, 0, -1, proto.jsso.Deny.repeatedFields_, proto.jsso.Deny.oneofGroups_);
 };
 goog.inherits(proto.jsso.Deny, jspb.Message);
 if (goog.DEBUG && !COMPILED) {
@@ -1103,7 +1104,8 @@ proto.jsso.StartLoginRequest.prototype.toObject = function(opt_includeInstance)
  */
 proto.jsso.StartLoginRequest.toObject = function(includeInstance, msg) {
   var f, obj = {
-    username: jspb.Message.getFieldWithDefault(msg, 1, "")
+    username: jspb.Message.getFieldWithDefault(msg, 1, ""),
+    redirectToken: jspb.Message.getFieldWithDefault(msg, 2, "")
   };
 
   if (includeInstance) {
@@ -1144,6 +1146,10 @@ proto.jsso.StartLoginRequest.deserializeBinaryFromReader = function(msg, reader)
       var value = /** @type {string} */ (reader.readString());
       msg.setUsername(value);
       break;
+    case 2:
+      var value = /** @type {string} */ (reader.readString());
+      msg.setRedirectToken(value);
+      break;
     default:
       reader.skipField();
       break;
@@ -1180,6 +1186,13 @@ proto.jsso.StartLoginRequest.serializeBinaryToWriter = function(message, writer)
       f
     );
   }
+  f = message.getRedirectToken();
+  if (f.length > 0) {
+    writer.writeString(
+      2,
+      f
+    );
+  }
 };
 
 
@@ -1201,6 +1214,24 @@ proto.jsso.StartLoginRequest.prototype.setUsername = function(value) {
 };
 
 
+/**
+ * optional string redirect_token = 2;
+ * @return {string}
+ */
+proto.jsso.StartLoginRequest.prototype.getRedirectToken = function() {
+  return /** @type {string} */ (jspb.Message.getFieldWithDefault(this, 2, ""));
+};
+
+
+/**
+ * @param {string} value
+ * @return {!proto.jsso.StartLoginRequest} returns this
+ */
+proto.jsso.StartLoginRequest.prototype.setRedirectToken = function(value) {
+  return jspb.Message.setProto3StringField(this, 2, value);
+};
+
+
 
 
 
@@ -1234,7 +1265,8 @@ proto.jsso.StartLoginReply.prototype.toObject = function(opt_includeInstance) {
 proto.jsso.StartLoginReply.toObject = function(includeInstance, msg) {
   var f, obj = {
     credentialRequestOptions: (f = msg.getCredentialRequestOptions()) && webauthn_pb.PublicKeyCredentialRequestOptions.toObject(includeInstance, f),
-    token: jspb.Message.getFieldWithDefault(msg, 2, "")
+    token: jspb.Message.getFieldWithDefault(msg, 2, ""),
+    redirectToken: jspb.Message.getFieldWithDefault(msg, 3, "")
   };
 
   if (includeInstance) {
@@ -1280,6 +1312,10 @@ proto.jsso.StartLoginReply.deserializeBinaryFromReader = function(msg, reader) {
       var value = /** @type {string} */ (reader.readString());
       msg.setToken(value);
       break;
+    case 3:
+      var value = /** @type {string} */ (reader.readString());
+      msg.setRedirectToken(value);
+      break;
     default:
       reader.skipField();
       break;
@@ -1324,6 +1360,13 @@ proto.jsso.StartLoginReply.serializeBinaryToWriter = function(message, writer) {
       f
     );
   }
+  f = message.getRedirectToken();
+  if (f.length > 0) {
+    writer.writeString(
+      3,
+      f
+    );
+  }
 };
 
 
@@ -1382,6 +1425,24 @@ proto.jsso.StartLoginReply.prototype.setToken = function(value) {
 };
 
 
+/**
+ * optional string redirect_token = 3;
+ * @return {string}
+ */
+proto.jsso.StartLoginReply.prototype.getRedirectToken = function() {
+  return /** @type {string} */ (jspb.Message.getFieldWithDefault(this, 3, ""));
+};
+
+
+/**
+ * @param {string} value
+ * @return {!proto.jsso.StartLoginReply} returns this
+ */
+proto.jsso.StartLoginReply.prototype.setRedirectToken = function(value) {
+  return jspb.Message.setProto3StringField(this, 3, value);
+};
+
+
 
 
 
@@ -2595,7 +2656,7 @@ proto.jsso.WhoAmIReply.prototype.hasUser = function() {
  * @private {!Array<number>}
  * @const
  */
-proto.jsso.AuthorizeHTTPRequest.repeatedFields_ = [4,5];
+proto.jsso.AuthorizeHTTPRequest.repeatedFields_ = [4,5,7];
 
 
 
@@ -2633,7 +2694,9 @@ proto.jsso.AuthorizeHTTPRequest.toObject = function(includeInstance, msg) {
     requestId: jspb.Message.getFieldWithDefault(msg, 3, ""),
     authorizationHeadersList: (f = jspb.Message.getRepeatedField(msg, 4)) == null ? undefined : f,
     cookiesList: (f = jspb.Message.getRepeatedField(msg, 5)) == null ? undefined : f,
-    ipAddress: jspb.Message.getFieldWithDefault(msg, 6, "")
+    ipAddress: jspb.Message.getFieldWithDefault(msg, 6, ""),
+    headersList: jspb.Message.toObjectList(msg.getHeadersList(),
+    types_pb.Header.toObject, includeInstance)
   };
 
   if (includeInstance) {
@@ -2694,6 +2757,11 @@ proto.jsso.AuthorizeHTTPRequest.deserializeBinaryFromReader = function(msg, read
       var value = /** @type {string} */ (reader.readString());
       msg.setIpAddress(value);
       break;
+    case 7:
+      var value = new types_pb.Header;
+      reader.readMessage(value,types_pb.Header.deserializeBinaryFromReader);
+      msg.addHeaders(value);
+      break;
     default:
       reader.skipField();
       break;
@@ -2765,6 +2833,14 @@ proto.jsso.AuthorizeHTTPRequest.serializeBinaryToWriter = function(message, writ
       f
     );
   }
+  f = message.getHeadersList();
+  if (f.length > 0) {
+    writer.writeRepeatedMessage(
+      7,
+      f,
+      types_pb.Header.serializeBinaryToWriter
+    );
+  }
 };
 
 
@@ -2914,6 +2990,44 @@ proto.jsso.AuthorizeHTTPRequest.prototype.setIpAddress = function(value) {
 };
 
 
+/**
+ * repeated types.Header headers = 7;
+ * @return {!Array<!proto.types.Header>}
+ */
+proto.jsso.AuthorizeHTTPRequest.prototype.getHeadersList = function() {
+  return /** @type{!Array<!proto.types.Header>} */ (
+    jspb.Message.getRepeatedWrapperField(this, types_pb.Header, 7));
+};
+
+
+/**
+ * @param {!Array<!proto.types.Header>} value
+ * @return {!proto.jsso.AuthorizeHTTPRequest} returns this
+*/
+proto.jsso.AuthorizeHTTPRequest.prototype.setHeadersList = function(value) {
+  return jspb.Message.setRepeatedWrapperField(this, 7, value);
+};
+
+
+/**
+ * @param {!proto.types.Header=} opt_value
+ * @param {number=} opt_index
+ * @return {!proto.types.Header}
+ */
+proto.jsso.AuthorizeHTTPRequest.prototype.addHeaders = function(opt_value, opt_index) {
+  return jspb.Message.addToRepeatedWrapperField(this, 7, opt_value, proto.types.Header, opt_index);
+};
+
+
+/**
+ * Clears the list making it empty but non-null.
+ * @return {!proto.jsso.AuthorizeHTTPRequest} returns this
+ */
+proto.jsso.AuthorizeHTTPRequest.prototype.clearHeadersList = function() {
+  return this.setHeadersList([]);
+};
+
+
 
 /**
  * List of repeated fields within this message type.
@@ -2957,7 +3071,9 @@ proto.jsso.Allow.toObject = function(includeInstance, msg) {
     groupsList: (f = jspb.Message.getRepeatedField(msg, 2)) == null ? undefined : f,
     bearerToken: jspb.Message.getFieldWithDefault(msg, 3, ""),
     addHeadersList: jspb.Message.toObjectList(msg.getAddHeadersList(),
-    types_pb.Header.toObject, includeInstance)
+    types_pb.Header.toObject, includeInstance),
+    userId: jspb.Message.getFieldWithDefault(msg, 5, 0),
+    sessionHandle: jspb.Message.getFieldWithDefault(msg, 6, "")
   };
 
   if (includeInstance) {
@@ -3011,6 +3127,14 @@ proto.jsso.Allow.deserializeBinaryFromReader = function(msg, reader) {
       reader.readMessage(value,types_pb.Header.deserializeBinaryFromReader);
       msg.addAddHeaders(value);
       break;
+    case 5:
+      var value = /** @type {number} */ (reader.readInt64());
+      msg.setUserId(value);
+      break;
+    case 6:
+      var value = /** @type {string} */ (reader.readString());
+      msg.setSessionHandle(value);
+      break;
     default:
       reader.skipField();
       break;
@@ -3069,6 +3193,20 @@ proto.jsso.Allow.serializeBinaryToWriter = function(message, writer) {
       types_pb.Header.serializeBinaryToWriter
     );
   }
+  f = message.getUserId();
+  if (f !== 0) {
+    writer.writeInt64(
+      5,
+      f
+    );
+  }
+  f = message.getSessionHandle();
+  if (f.length > 0) {
+    writer.writeString(
+      6,
+      f
+    );
+  }
 };
 
 
@@ -3183,6 +3321,48 @@ proto.jsso.Allow.prototype.clearAddHeadersList = function() {
 };
 
 
+/**
+ * optional int64 user_id = 5;
+ * @return {number}
+ */
+proto.jsso.Allow.prototype.getUserId = function() {
+  return /** @type {number} */ (jspb.Message.getFieldWithDefault(this, 5, 0));
+};
+
+
+/**
+ * @param {number} value
+ * @return {!proto.jsso.Allow} returns this
+ */
+proto.jsso.Allow.prototype.setUserId = function(value) {
+  return jspb.Message.setProto3IntField(this, 5, value);
+};
+
+
+/**
+ * optional string session_handle = 6;
+ * @return {string}
+ */
+proto.jsso.Allow.prototype.getSessionHandle = function() {
+  return /** @type {string} */ (jspb.Message.getFieldWithDefault(this, 6, ""));
+};
+
+
+/**
+ * @param {string} value
+ * @return {!proto.jsso.Allow} returns this
+ */
+proto.jsso.Allow.prototype.setSessionHandle = function(value) {
+  return jspb.Message.setProto3StringField(this, 6, value);
+};
+
+
+/**
+ * List of repeated fields within this message type.
+ * @private {!Array<number>}
+ * @const
+ */
+proto.jsso.Deny.repeatedFields_ = [5];
 
 /**
  * Oneof group definitions for this message. Each group defines the field
@@ -3243,7 +3423,10 @@ proto.jsso.Deny.toObject = function(includeInstance, msg) {
   var f, obj = {
     reason: jspb.Message.getFieldWithDefault(msg, 1, ""),
     redirect: (f = msg.getRedirect()) && proto.jsso.Deny.Redirect.toObject(includeInstance, f),
-    response: (f = msg.getResponse()) && proto.jsso.Deny.Response.toObject(includeInstance, f)
+    response: (f = msg.getResponse()) && proto.jsso.Deny.Response.toObject(includeInstance, f),
+    category: jspb.Message.getFieldWithDefault(msg, 4, 0),
+    addHeadersList: jspb.Message.toObjectList(msg.getAddHeadersList(),
+    types_pb.Header.toObject, includeInstance)
   };
 
   if (includeInstance) {
@@ -3294,6 +3477,15 @@ proto.jsso.Deny.deserializeBinaryFromReader = function(msg, reader) {
       reader.readMessage(value,proto.jsso.Deny.Response.deserializeBinaryFromReader);
       msg.setResponse(value);
       break;
+    case 4:
+      var value = /** @type {!proto.jsso.Deny.Category} */ (reader.readEnum());
+      msg.setCategory(value);
+      break;
+    case 5:
+      var value = new types_pb.Header;
+      reader.readMessage(value,types_pb.Header.deserializeBinaryFromReader);
+      msg.addAddHeaders(value);
+      break;
     default:
       reader.skipField();
       break;
@@ -3346,6 +3538,32 @@ proto.jsso.Deny.serializeBinaryToWriter = function(message, writer) {
       proto.jsso.Deny.Response.serializeBinaryToWriter
     );
   }
+  f = message.getCategory();
+  if (f !== 0.0) {
+    writer.writeEnum(
+      4,
+      f
+    );
+  }
+  f = message.getAddHeadersList();
+  if (f.length > 0) {
+    writer.writeRepeatedMessage(
+      5,
+      f,
+      types_pb.Header.serializeBinaryToWriter
+    );
+  }
+};
+
+
+/**
+ * @enum {number}
+ */
+proto.jsso.Deny.Category = {
+  CATEGORY_UNKNOWN: 0,
+  NO_CREDENTIALS: 1,
+  INVALID_CREDENTIALS: 2,
+  POLICY: 3
 };
 
 
@@ -3512,7 +3730,8 @@ proto.jsso.Deny.Response.prototype.toObject = function(opt_includeInstance) {
 proto.jsso.Deny.Response.toObject = function(includeInstance, msg) {
   var f, obj = {
     contentType: jspb.Message.getFieldWithDefault(msg, 1, ""),
-    body: jspb.Message.getFieldWithDefault(msg, 2, "")
+    body: jspb.Message.getFieldWithDefault(msg, 2, ""),
+    statusCode: jspb.Message.getFieldWithDefault(msg, 3, 0)
   };
 
   if (includeInstance) {
@@ -3557,6 +3776,10 @@ proto.jsso.Deny.Response.deserializeBinaryFromReader = function(msg, reader) {
       var value = /** @type {string} */ (reader.readString());
       msg.setBody(value);
       break;
+    case 3:
+      var value = /** @type {number} */ (reader.readInt32());
+      msg.setStatusCode(value);
+      break;
     default:
       reader.skipField();
       break;
@@ -3600,6 +3823,13 @@ proto.jsso.Deny.Response.serializeBinaryToWriter = function(message, writer) {
       f
     );
   }
+  f = message.getStatusCode();
+  if (f !== 0) {
+    writer.writeInt32(
+      3,
+      f
+    );
+  }
 };
 
 
@@ -3639,6 +3869,24 @@ proto.jsso.Deny.Response.prototype.setBody = function(value) {
 };
 
 
+/**
+ * optional int32 status_code = 3;
+ * @return {number}
+ */
+proto.jsso.Deny.Response.prototype.getStatusCode = function() {
+  return /** @type {number} */ (jspb.Message.getFieldWithDefault(this, 3, 0));
+};
+
+
+/**
+ * @param {number} value
+ * @return {!proto.jsso.Deny.Response} returns this
+ */
+proto.jsso.Deny.Response.prototype.setStatusCode = function(value) {
+  return jspb.Message.setProto3IntField(this, 3, value);
+};
+
+
 /**
  * optional string reason = 1;
  * @return {string}
@@ -3731,6 +3979,62 @@ proto.jsso.Deny.prototype.hasResponse = function() {
 };
 
 
+/**
+ * optional Category category = 4;
+ * @return {!proto.jsso.Deny.Category}
+ */
+proto.jsso.Deny.prototype.getCategory = function() {
+  return /** @type {!proto.jsso.Deny.Category} */ (jspb.Message.getFieldWithDefault(this, 4, 0));
+};
+
+
+/**
+ * @param {!proto.jsso.Deny.Category} value
+ * @return {!proto.jsso.Deny} returns this
+ */
+proto.jsso.Deny.prototype.setCategory = function(value) {
+  return jspb.Message.setProto3EnumField(this, 4, value);
+};
+
+
+/**
+ * repeated types.Header add_headers = 5;
+ * @return {!Array<!proto.types.Header>}
+ */
+proto.jsso.Deny.prototype.getAddHeadersList = function() {
+  return /** @type{!Array<!proto.types.Header>} */ (
+    jspb.Message.getRepeatedWrapperField(this, types_pb.Header, 5));
+};
+
+
+/**
+ * @param {!Array<!proto.types.Header>} value
+ * @return {!proto.jsso.Deny} returns this
+*/
+proto.jsso.Deny.prototype.setAddHeadersList = function(value) {
+  return jspb.Message.setRepeatedWrapperField(this, 5, value);
+};
+
+
+/**
+ * @param {!proto.types.Header=} opt_value
+ * @param {number=} opt_index
+ * @return {!proto.types.Header}
+ */
+proto.jsso.Deny.prototype.addAddHeaders = function(opt_value, opt_index) {
+  return jspb.Message.addToRepeatedWrapperField(this, 5, opt_value, proto.types.Header, opt_index);
+};
+
+
+/**
+ * Clears the list making it empty but non-null.
+ * @return {!proto.jsso.Deny} returns this
+ */
+proto.jsso.Deny.prototype.clearAddHeadersList = function() {
+  return this.setAddHeadersList([]);
+};
+
+
 
 /**
  * Oneof group definitions for this message. Each group defines the field